@@ -4,6 +4,9 @@ import (
 	"embed"
 
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/app"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/event"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/partition"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/register"
 )
@@ -20,6 +23,41 @@ func init() {
 				return app.New(ctx.(*config.Context))
 			},
 			SQLDir: register.NewSQLFS(sqlFS),
+			Start: func() error {
+				partition.NewMigrator(ctx.(*config.Context)).Start() // 消息分表迁移
+				return nil
+			},
+		}
+	})
+
+	// 注册短信模块（给其他模块提供短信路由校验等服务）
+	register.AddModule(func(ctx interface{}) register.Module {
+
+		return register.Module{
+			Name:    "sms",
+			Service: common.NewSMSService(ctx.(*config.Context)),
+		}
+	})
+
+	// 注册事件管理模块
+	register.AddModule(func(ctx interface{}) register.Module {
+
+		return register.Module{
+			Name: "event_manager",
+			SetupAPI: func() register.APIRouter {
+				return event.NewManager(ctx.(*config.Context))
+			},
+		}
+	})
+
+	// 注册消息分表管理模块
+	register.AddModule(func(ctx interface{}) register.Module {
+
+		return register.Module{
+			Name: "message_partition_manager",
+			SetupAPI: func() register.APIRouter {
+				return partition.NewManager(ctx.(*config.Context))
+			},
 		}
 	})
 }
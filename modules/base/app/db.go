@@ -23,6 +23,12 @@ func (d *DB) queryWithAppID(appID string) (*model, error) {
 	return m, err
 }
 
+func (d *DB) queryWithAppIDTx(appID string, tx *dbr.Tx) (*model, error) {
+	var m *model
+	_, err := tx.Select("*").From("app").Where("app_id=?", appID).Load(&m)
+	return m, err
+}
+
 func (d *DB) existWithAppID(appID string) (bool, error) {
 	var count int
 	_, err := d.session.Select("count(*)").From("app").Where("app_id=?", appID).Load(&count)
@@ -34,6 +40,24 @@ func (d *DB) insert(m *model) error {
 	return err
 }
 
+func (d *DB) insertTx(m *model, tx *dbr.Tx) error {
+	_, err := tx.InsertInto("app").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	return err
+}
+
+func (d *DB) updateAppKeyTx(appID string, appKey string, tx *dbr.Tx) (int64, error) {
+	result, err := tx.Update("app").Set("app_key", appKey).Where("app_id=?", appID).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (d *DB) disableTx(appID string, appKey string, tx *dbr.Tx) error {
+	_, err := tx.Update("app").Set("status", StatusDisable.Int()).Set("app_key", appKey).Where("app_id=?", appID).Exec()
+	return err
+}
+
 type model struct {
 	AppID   string
 	AppKey  string
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/gocraft/dbr/v2"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
 )
@@ -15,6 +16,12 @@ type IService interface {
 	GetApp(appID string) (*Resp, error)
 	// 创建app
 	CreateApp(r Req) (*Resp, error)
+	// 在事务中创建app
+	CreateAppTx(r Req, tx *dbr.Tx) (*Resp, error)
+	// 在事务中重置app key
+	ResetAppKeyTx(appID string, tx *dbr.Tx) (string, error)
+	// 在事务中禁用app（同时重置app key，旧的app key立即失效）
+	DisableAppTx(appID string, tx *dbr.Tx) error
 }
 
 // Service app服务
@@ -85,6 +92,56 @@ func (s *Service) CreateApp(r Req) (*Resp, error) {
 
 }
 
+// CreateAppTx 在事务中创建APP 幂等
+func (s *Service) CreateAppTx(r Req, tx *dbr.Tx) (*Resp, error) {
+	if err := r.Check(); err != nil {
+		return nil, err
+	}
+	appM, err := s.db.queryWithAppIDTx(r.AppID, tx)
+	if err != nil {
+		return nil, err
+	}
+	if appM != nil {
+		return &Resp{
+			AppID:  appM.AppID,
+			AppKey: appM.AppKey,
+			Status: StatusEnable,
+		}, nil
+	}
+	appKey := util.GenerUUID()
+	err = s.db.insertTx(&model{
+		AppID:  r.AppID,
+		Status: StatusEnable.Int(),
+		AppKey: appKey,
+	}, tx)
+	if err != nil {
+		return nil, err
+	}
+	return &Resp{
+		AppID:  r.AppID,
+		AppKey: appKey,
+		Status: StatusEnable,
+	}, nil
+}
+
+// ResetAppKeyTx 在事务中重置APP的app key，旧的app key立即失效
+func (s *Service) ResetAppKeyTx(appID string, tx *dbr.Tx) (string, error) {
+	appKey := util.GenerUUID()
+	count, err := s.db.updateAppKeyTx(appID, appKey, tx)
+	if err != nil {
+		return "", err
+	}
+	if count == 0 {
+		return "", fmt.Errorf("app[%s]不存在！", appID)
+	}
+	return appKey, nil
+}
+
+// DisableAppTx 在事务中禁用APP，同时重置app key
+func (s *Service) DisableAppTx(appID string, tx *dbr.Tx) error {
+	return s.db.disableTx(appID, util.GenerUUID(), tx)
+}
+
 type Resp struct {
 	AppID   string
 	AppKey  string
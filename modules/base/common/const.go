@@ -14,9 +14,15 @@ const (
 	CodeTypeCheckMobile
 	// DestroyAccount 注销账号
 	CodeTypeDestroyAccount
+	// CodeTypeBindEmail 绑定邮箱
+	CodeTypeBindEmail
+	// CodeTypeChangeEmail 更换邮箱（发送到原邮箱验证身份）
+	CodeTypeChangeEmail
 )
 
 const (
 	// CacheKeySMSCode 短信验证码的缓存key
 	CacheKeySMSCode string = "smscode:"
+	// CacheKeyEmailCode 邮件验证码的缓存key
+	CacheKeyEmailCode string = "emailcode:"
 )
@@ -16,6 +16,11 @@ import (
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
 )
 
+func init() {
+	RegisterSMSProvider(string(config.SMSProviderAliyun), NewAliyunProvider)
+	RegisterSMSProvider(SMSProviderAliyunInternational, NewAliyunInternationalProvider)
+}
+
 type AliyunProvider struct {
 	ctx *config.Context
 	log.Log
@@ -0,0 +1,31 @@
+// console
+package common
+
+import (
+	"context"
+
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+	"go.uber.org/zap"
+)
+
+func init() {
+	RegisterSMSProvider(SMSProviderConsole, NewConsoleProvider)
+}
+
+// ConsoleProvider 不真正发送短信，只在日志中打印验证码（开发和测试环境使用，线上请勿配置）
+type ConsoleProvider struct {
+	log.Log
+}
+
+// NewConsoleProvider 创建控制台短信服务
+func NewConsoleProvider(ctx *config.Context) ISMSProvider {
+	return &ConsoleProvider{
+		Log: log.NewTLog("ConsoleProvider"),
+	}
+}
+
+func (p *ConsoleProvider) SendSMS(ctx context.Context, zone, phone string, code string) error {
+	p.Warn("短信验证码（console服务商，未真正发送）", zap.String("zone", zone), zap.String("phone", phone), zap.String("code", code))
+	return nil
+}
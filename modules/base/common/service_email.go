@@ -0,0 +1,173 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"sync"
+
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+	"go.uber.org/zap"
+)
+
+// IEmailProvider 邮件服务商
+type IEmailProvider interface {
+	SendEmail(ctx context.Context, to string, subject string, body string) error
+}
+
+// IEmailService 邮件验证码服务
+type IEmailService interface {
+	// 发送验证码 clientIP为请求方IP（用于限流，为空则不限制IP）
+	SendVerifyCode(ctx context.Context, email string, codeType CodeType, clientIP string) error
+	// 验证验证码(销毁缓存)
+	Verify(ctx context.Context, email, code string, codeType CodeType) error
+	// 最近几天的邮件发送和校验统计
+	Stats(days int) ([]*SMSStatsResp, error)
+}
+
+// EmailService 邮件验证码服务
+type EmailService struct {
+	ctx *config.Context
+	log.Log
+	provider   IEmailProvider
+	verifyCode *verifyCodeService
+}
+
+// NewEmailService 创建邮件验证码服务（测试模式使用本地邮件服务，否则使用smtp）
+func NewEmailService(ctx *config.Context) *EmailService {
+	var provider IEmailProvider
+	if ctx.GetConfig().Test {
+		provider = DefaultLocalEmailProvider
+	} else {
+		provider = NewSMTPEmailProvider(ctx)
+	}
+	return NewEmailServiceWithProvider(ctx, provider)
+}
+
+// NewEmailServiceWithProvider 使用指定的邮件服务商创建邮件验证码服务
+func NewEmailServiceWithProvider(ctx *config.Context, provider IEmailProvider) *EmailService {
+	return &EmailService{
+		ctx:        ctx,
+		Log:        log.NewTLog("EmailService"),
+		provider:   provider,
+		verifyCode: newVerifyCodeService(ctx, "email"),
+	}
+}
+
+// SendVerifyCode 发送验证码
+func (e *EmailService) SendVerifyCode(ctx context.Context, email string, codeType CodeType, clientIP string) error {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return err
+	}
+	return e.verifyCode.send(email, clientIP, emailCodeCacheKey(codeType, email), func(code string) error {
+		subject := fmt.Sprintf("【%s】验证码", e.ctx.GetConfig().AppName)
+		body := fmt.Sprintf("您正在进行%s操作，验证码为：%s，%d分钟内有效。\r\n如非本人操作，请忽略本邮件。", codeTypePurpose(codeType), code, int(verifyCodeExpire.Minutes()))
+		return e.provider.SendEmail(ctx, email, subject, body)
+	})
+}
+
+// Verify 验证验证码
+func (e *EmailService) Verify(ctx context.Context, email, code string, codeType CodeType) error {
+	span, _ := e.ctx.Tracer().StartSpanFromContext(ctx, "emailService.Verify")
+	defer span.Finish()
+
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return err
+	}
+	return e.verifyCode.verify(email, emailCodeCacheKey(codeType, email), code)
+}
+
+// Stats 最近几天的邮件发送和校验统计（最新的在前）
+func (e *EmailService) Stats(days int) ([]*SMSStatsResp, error) {
+	return e.verifyCode.stats(days)
+}
+
+// NormalizeEmail 校验邮箱格式并转为小写
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return "", errors.New("邮箱不能为空！")
+	}
+	if len(email) > 100 {
+		return "", errors.New("邮箱长度不能超过100！")
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		return "", errors.New("邮箱格式有误！")
+	}
+	return email, nil
+}
+
+func emailCodeCacheKey(codeType CodeType, email string) string {
+	return fmt.Sprintf("%s%d@%s", CacheKeyEmailCode, codeType, email)
+}
+
+func codeTypePurpose(codeType CodeType) string {
+	switch codeType {
+	case CodeTypeRegister:
+		return "注册"
+	case CodeTypePayPWD:
+		return "设置支付密码"
+	case CodeTypeForgetLoginPWD:
+		return "重置登录密码"
+	case CodeTypeCheckMobile:
+		return "登录设备验证"
+	case CodeTypeDestroyAccount:
+		return "注销账号"
+	case CodeTypeBindEmail:
+		return "绑定邮箱"
+	case CodeTypeChangeEmail:
+		return "更换邮箱"
+	}
+	return "身份验证"
+}
+
+// DefaultLocalEmailProvider 测试模式使用的本地邮件服务
+var DefaultLocalEmailProvider = NewLocalEmailProvider()
+
+// LocalEmailProvider 本地邮件服务，不真正发送，只记录每个收件人最后一封邮件（用于开发和测试）
+type LocalEmailProvider struct {
+	log.Log
+	sync.RWMutex
+	lastEmails map[string]*LocalEmail
+}
+
+// LocalEmail 本地邮件服务记录的邮件
+type LocalEmail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// NewLocalEmailProvider 创建本地邮件服务
+func NewLocalEmailProvider() *LocalEmailProvider {
+	return &LocalEmailProvider{
+		Log:        log.NewTLog("LocalEmailProvider"),
+		lastEmails: map[string]*LocalEmail{},
+	}
+}
+
+// SendEmail 记录邮件
+func (l *LocalEmailProvider) SendEmail(ctx context.Context, to string, subject string, body string) error {
+	l.Lock()
+	l.lastEmails[to] = &LocalEmail{
+		To:      to,
+		Subject: subject,
+		Body:    body,
+	}
+	l.Unlock()
+	l.Info("本地邮件服务收到邮件", zap.String("to", to), zap.String("subject", subject))
+	return nil
+}
+
+// LastEmail 收件人收到的最后一封邮件
+func (l *LocalEmailProvider) LastEmail(to string) *LocalEmail {
+	l.RLock()
+	defer l.RUnlock()
+	return l.lastEmails[to]
+}
@@ -0,0 +1,37 @@
+package common
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	email, err := NormalizeEmail(" Test@Example.COM ")
+	assert.NoError(t, err)
+	assert.Equal(t, "test@example.com", email)
+
+	for _, invalid := range []string{"", "test", "Test <test@example.com>", "test@example.com\r\nBcc: a@b.com"} {
+		_, err = NormalizeEmail(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestBuildEmailMessage(t *testing.T) {
+	msg := string(buildEmailMessage("noreply@example.com", "test@example.com", "【唐僧叨叨】验证码", strings.Repeat("验证码", 20)))
+	assert.Contains(t, msg, "Subject: =?UTF-8?b?")
+	assert.Contains(t, msg, "Message-ID: <")
+	assert.Contains(t, msg, "@example.com>\r\n")
+	for _, line := range strings.Split(msg, "\r\n") {
+		assert.LessOrEqual(t, len(line), 78)
+	}
+}
+
+func TestLocalEmailProvider(t *testing.T) {
+	provider := NewLocalEmailProvider()
+	assert.Nil(t, provider.LastEmail("test@example.com"))
+	assert.NoError(t, provider.SendEmail(context.Background(), "test@example.com", "subject", "body"))
+	assert.Equal(t, "body", provider.LastEmail("test@example.com").Body)
+}
@@ -4,9 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"math/rand"
-	"time"
+	"strings"
 
+	commonapi "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/common"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
 	"go.uber.org/zap"
@@ -18,60 +18,86 @@ type ISMSProvider interface {
 
 // ISMSService ISMSService
 type ISMSService interface {
-	// 发送验证码
-	SendVerifyCode(ctx context.Context, zone, phone string, codeType CodeType) error
+	// 发送验证码 clientIP为请求方IP（用于限流，为空则不限制IP）
+	SendVerifyCode(ctx context.Context, zone, phone string, codeType CodeType, clientIP string) error
 	// 验证验证码(销毁缓存)
 	Verify(ctx context.Context, zone, phone, code string, codeType CodeType) error
+	// 最近几天的短信发送和校验统计
+	Stats(days int) ([]*SMSStatsResp, error)
 }
 
 // SMSService 短信服务
 type SMSService struct {
 	ctx *config.Context
 	log.Log
+	verifyCode    *verifyCodeService
+	commonService commonapi.IService
 }
 
 // NewSMSService 创建短信服务
 func NewSMSService(ctx *config.Context) *SMSService {
 	return &SMSService{
-		ctx: ctx,
-		Log: log.NewTLog("SMSService"),
+		ctx:           ctx,
+		Log:           log.NewTLog("SMSService"),
+		verifyCode:    newVerifyCodeService(ctx, "sms"),
+		commonService: commonapi.NewService(ctx),
 	}
 }
 
-// SendVerifyCode 发送验证码
-func (s *SMSService) SendVerifyCode(ctx context.Context, zone, phone string, codeType CodeType) error {
-	var smsProvider ISMSProvider
-
-	smsProviderName := s.ctx.GetConfig().SMSProvider
-	if smsProviderName == config.SMSProviderAliyun {
-		if zone != "0086" && s.ctx.GetConfig().AliyunInternationalSMS.AccessKeyID != "" {
-			smsProvider = NewAliyunInternationalProvider(s.ctx)
-		} else {
-			smsProvider = NewAliyunProvider(s.ctx)
+// SendVerifyCode 发送验证码（按区号路由选择服务商，前面的服务商发送失败时自动转到下一个）
+func (s *SMSService) SendVerifyCode(ctx context.Context, zone, phone string, codeType CodeType, clientIP string) error {
+	providerNames := s.providerNamesWithZone(zone)
+	providers := make([]ISMSProvider, 0, len(providerNames))
+	for _, providerName := range providerNames {
+		factory := getSMSProviderFactory(providerName)
+		if factory == nil {
+			s.Warn("短信服务商不存在！", zap.String("provider", providerName))
+			continue
 		}
-	} else if smsProviderName == config.SMSProviderUnisms {
-		smsProvider = NewUnismsProvider(s.ctx)
-	} else if smsProviderName == config.SMSProviderSmsbao {
-		smsProvider = NewSmsbaoProvider(s.ctx)
+		providers = append(providers, factory(s.ctx))
 	}
-
-	if smsProvider == nil {
+	if len(providers) == 0 {
 		return errors.New("没有找到短信提供商！")
 	}
+	return s.verifyCode.send(fmt.Sprintf("%s@%s", zone, phone), clientIP, smsCodeCacheKey(codeType, zone, phone), func(code string) error {
+		var err error
+		for i, smsProvider := range providers {
+			if err = smsProvider.SendSMS(ctx, zone, phone, code); err == nil {
+				return nil
+			}
+			if i < len(providers)-1 {
+				s.Warn("短信发送失败，转到下一个服务商", zap.String("provider", providerNames[i]), zap.String("zone", zone), zap.Error(err))
+			}
+		}
+		return err
+	})
+}
 
-	verifyCode := ""
-	rand.Seed(int64(time.Now().Nanosecond()))
-	for i := 0; i < 4; i++ {
-		verifyCode += fmt.Sprintf("%v", rand.Intn(10))
-	}
-	s.Info("发送验证码", zap.String("code", verifyCode))
-	cacheKey := fmt.Sprintf("%s%d@%s@%s", CacheKeySMSCode, codeType, zone, phone)
-	err := s.ctx.GetRedisConn().SetAndExpire(cacheKey, verifyCode, time.Minute*5)
+// ValidateRoutes 校验短信路由配置（供后台修改系统配置时调用）
+func (s *SMSService) ValidateRoutes(routes string) error {
+	return ValidateSMSRoutes(routes)
+}
+
+// providerNamesWithZone 区号对应的服务商（先按系统配置中的短信路由，没有配置则使用配置文件中的smsProvider）
+func (s *SMSService) providerNamesWithZone(zone string) []string {
+	appConfig, err := s.commonService.GetAppConfig()
 	if err != nil {
-		return err
+		s.Warn("获取系统配置失败，使用默认短信服务商", zap.Error(err))
+	} else if appConfig != nil && strings.TrimSpace(appConfig.SMSRoutes) != "" {
+		routes, err := ParseSMSRoutes(appConfig.SMSRoutes)
+		if err != nil {
+			s.Warn("短信路由配置有误，使用默认短信服务商", zap.Error(err))
+		} else if providerNames := routes[zone]; len(providerNames) > 0 {
+			return providerNames
+		} else if providerNames := routes[smsRouteDefaultZone]; len(providerNames) > 0 {
+			return providerNames
+		}
 	}
-	err = smsProvider.SendSMS(ctx, zone, phone, verifyCode)
-	return err
+	smsProviderName := s.ctx.GetConfig().SMSProvider
+	if smsProviderName == config.SMSProviderAliyun && zone != "0086" && s.ctx.GetConfig().AliyunInternationalSMS.AccessKeyID != "" {
+		return []string{SMSProviderAliyunInternational}
+	}
+	return []string{string(smsProviderName)}
 }
 
 // Verify 验证验证码
@@ -79,15 +105,14 @@ func (s *SMSService) Verify(ctx context.Context, zone, phone, code string, codeT
 	span, _ := s.ctx.Tracer().StartSpanFromContext(ctx, "smsService.Verify")
 	defer span.Finish()
 
-	cacheKey := fmt.Sprintf("%s%d@%s@%s", CacheKeySMSCode, codeType, zone, phone)
-	sysCode, err := s.ctx.GetRedisConn().GetString(cacheKey)
-	if err != nil {
-		return err
-	}
-	if sysCode != "" && sysCode == code {
-		s.ctx.GetRedisConn().Del(cacheKey)
-		return nil
-	}
-	s.Info("验证码错误:"+code+", 真code:"+sysCode+", phone:"+phone, zap.String("code", code))
-	return errors.New("验证码无效！")
+	return s.verifyCode.verify(fmt.Sprintf("%s@%s", zone, phone), smsCodeCacheKey(codeType, zone, phone), code)
+}
+
+// Stats 最近几天的短信发送和校验统计（最新的在前）
+func (s *SMSService) Stats(days int) ([]*SMSStatsResp, error) {
+	return s.verifyCode.stats(days)
+}
+
+func smsCodeCacheKey(codeType CodeType, zone, phone string) string {
+	return fmt.Sprintf("%s%d@%s@%s", CacheKeySMSCode, codeType, zone, phone)
 }
@@ -16,6 +16,10 @@ import (
 	"net/url"
 )
 
+func init() {
+	RegisterSMSProvider(string(config.SMSProviderSmsbao), NewSmsbaoProvider)
+}
+
 type SmsbaoProvider struct {
 	ctx *config.Context
 	log.Log
@@ -0,0 +1,136 @@
+// smtp
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+	"go.uber.org/zap"
+)
+
+const smtpTimeout = time.Second * 10
+
+// SMTPEmailProvider 通过smtp发送邮件（使用配置中的support.email、support.emailSmtp、support.emailPwd）
+// 465端口使用SSL连接，其他端口在服务器支持时使用STARTTLS
+type SMTPEmailProvider struct {
+	ctx *config.Context
+	log.Log
+}
+
+// NewSMTPEmailProvider 创建smtp邮件服务
+func NewSMTPEmailProvider(ctx *config.Context) IEmailProvider {
+	return &SMTPEmailProvider{
+		ctx: ctx,
+		Log: log.NewTLog("SMTPEmailProvider"),
+	}
+}
+
+// SendEmail 发送邮件
+func (s *SMTPEmailProvider) SendEmail(ctx context.Context, to string, subject string, body string) error {
+	support := s.ctx.GetConfig().Support
+	if support.Email == "" || support.EmailSmtp == "" {
+		return errors.New("没有配置邮件服务！")
+	}
+	if strings.ContainsAny(to, "\r\n") {
+		return errors.New("收件人格式有误！")
+	}
+	host, port, err := net.SplitHostPort(support.EmailSmtp)
+	if err != nil {
+		return fmt.Errorf("邮件服务地址[%s]格式有误：%w", support.EmailSmtp, err)
+	}
+	msg := buildEmailMessage(support.Email, to, subject, body)
+	auth := smtp.PlainAuth("", support.Email, support.EmailPwd, host)
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	if port == "465" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", support.EmailSmtp, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", support.EmailSmtp)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if port != "465" {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err = client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+				return err
+			}
+		}
+	}
+	if support.EmailPwd != "" {
+		if err = client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(support.Email); err != nil {
+		return err
+	}
+	if err = client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		w.Close()
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	if err = client.Quit(); err != nil {
+		s.Warn("关闭smtp连接失败", zap.Error(err))
+	}
+	return nil
+}
+
+// buildEmailMessage 生成utf-8纯文本邮件
+func buildEmailMessage(from string, to string, subject string, body string) []byte {
+	var buff bytes.Buffer
+	buff.WriteString(fmt.Sprintf("From: %s\r\n", from))
+	buff.WriteString(fmt.Sprintf("To: %s\r\n", to))
+	buff.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject)))
+	buff.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
+	buff.WriteString(fmt.Sprintf("Message-ID: <%s@%s>\r\n", util.GenerUUID(), emailDomain(from)))
+	buff.WriteString("MIME-Version: 1.0\r\n")
+	buff.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buff.WriteString("Content-Transfer-Encoding: base64\r\n")
+	buff.WriteString("\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 {
+		buff.WriteString(encoded[:76])
+		buff.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	buff.WriteString(encoded)
+	buff.WriteString("\r\n")
+	return buff.Bytes()
+}
+
+func emailDomain(email string) string {
+	if i := strings.LastIndex(email, "@"); i >= 0 {
+		return email[i+1:]
+	}
+	return "localhost"
+}
@@ -11,6 +11,10 @@ import (
 	"go.uber.org/zap"
 )
 
+func init() {
+	RegisterSMSProvider(string(config.SMSProviderUnisms), NewUnismsProvider)
+}
+
 type UnismsProvider struct {
 	ctx *config.Context
 	log.Log
@@ -0,0 +1,303 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	commonapi "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/common"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+	"go.uber.org/zap"
+)
+
+const (
+	verifyCodeExpire = time.Minute * 5 // 验证码有效期
+
+	smsDefaultCodeLength    = 6
+	smsDefaultSendInterval  = 60
+	smsDefaultPhoneDayLimit = 10
+	smsDefaultIPHourLimit   = 20
+	smsDefaultVerifyMaxFail = 5
+	smsMinCodeLength        = 4
+	smsMaxCodeLength        = 8
+
+	smsStatsExpire = time.Hour * 24 * 32 // 统计数据保留时间
+	smsStatsMaxDay = 31
+)
+
+// 统计项
+const (
+	smsStatsSendOK        = "send_ok"        // 发送成功
+	smsStatsSendFail      = "send_fail"      // 服务商发送失败
+	smsStatsSendLimited   = "send_limited"   // 被限流
+	smsStatsVerifyOK      = "verify_ok"      // 校验成功
+	smsStatsVerifyFail    = "verify_fail"    // 验证码错误
+	smsStatsVerifyExpired = "verify_expired" // 验证码不存在或已过期
+	smsStatsVerifyLocked  = "verify_locked"  // 错误次数过多验证码作废
+)
+
+// ErrSMSLimit 验证码发送被限制（错误信息可以直接返回给用户，短信和邮件共用）
+var ErrSMSLimit = errors.New("验证码发送过于频繁")
+
+// verifyCodeService 验证码的生成、发送限流、校验和统计（短信和邮件共用，各自使用不同的缓存前缀）
+type verifyCodeService struct {
+	ctx *config.Context
+	log.Log
+	channel       string // 渠道（sms/email），用于区分限流和统计的缓存key
+	commonService commonapi.IService
+}
+
+func newVerifyCodeService(ctx *config.Context, channel string) *verifyCodeService {
+	return &verifyCodeService{
+		ctx:           ctx,
+		Log:           log.NewTLog(fmt.Sprintf("verifyCode[%s]", channel)),
+		channel:       channel,
+		commonService: commonapi.NewService(ctx),
+	}
+}
+
+// send 检查限流后生成验证码并通过sendFnc发送，target为接收方（手机号或邮箱）
+func (s *verifyCodeService) send(target string, clientIP string, cacheKey string, sendFnc func(code string) error) error {
+	limit := s.getLimit()
+	err := s.checkSendLimit(target, clientIP, limit)
+	if err != nil {
+		s.incrStats(smsStatsSendLimited)
+		s.Warn("验证码发送被限制", zap.String("target", target), zap.String("ip", clientIP), zap.Error(err))
+		return err
+	}
+	verifyCode, err := generateVerifyCode(limit.codeLength)
+	if err != nil {
+		return err
+	}
+	err = s.ctx.GetRedisConn().SetAndExpire(cacheKey, verifyCode, verifyCodeExpire)
+	if err != nil {
+		return err
+	}
+	// 新验证码重新计算失败次数
+	err = s.ctx.GetRedisConn().Del(verifyCodeFailCacheKey(cacheKey))
+	if err != nil {
+		return err
+	}
+	err = sendFnc(verifyCode)
+	if err != nil {
+		s.incrStats(smsStatsSendFail)
+		if delErr := s.ctx.GetRedisConn().Del(cacheKey); delErr != nil {
+			s.Warn("删除验证码缓存失败！", zap.Error(delErr))
+		}
+		return err
+	}
+	s.incrStats(smsStatsSendOK)
+	return nil
+}
+
+// verify 校验验证码，成功后验证码失效，错误次数过多验证码作废
+func (s *verifyCodeService) verify(target string, cacheKey string, code string) error {
+	sysCode, err := s.ctx.GetRedisConn().GetString(cacheKey)
+	if err != nil {
+		return err
+	}
+	if sysCode == "" {
+		s.incrStats(smsStatsVerifyExpired)
+		return errors.New("验证码无效！")
+	}
+	if code != "" && subtle.ConstantTimeCompare([]byte(sysCode), []byte(code)) == 1 {
+		s.ctx.GetRedisConn().Del(cacheKey)
+		s.ctx.GetRedisConn().Del(verifyCodeFailCacheKey(cacheKey))
+		s.incrStats(smsStatsVerifyOK)
+		return nil
+	}
+	s.incrStats(smsStatsVerifyFail)
+	failKey := verifyCodeFailCacheKey(cacheKey)
+	failCount, err := s.ctx.GetRedisConn().Incr(failKey)
+	if err != nil {
+		return err
+	}
+	if failCount == 1 {
+		s.ctx.GetRedisConn().Expire(failKey, verifyCodeExpire)
+	}
+	if failCount >= int64(s.getLimit().verifyMaxFail) { // 错误次数过多，验证码作废
+		s.ctx.GetRedisConn().Del(cacheKey)
+		s.ctx.GetRedisConn().Del(failKey)
+		s.incrStats(smsStatsVerifyLocked)
+		s.Warn("验证码错误次数过多，已作废", zap.String("target", target))
+		return errors.New("验证码错误次数过多，请重新获取！")
+	}
+	s.Info("验证码错误", zap.String("target", target))
+	return errors.New("验证码无效！")
+}
+
+type smsLimit struct {
+	codeLength     int
+	sendInterval   int
+	targetDayLimit int
+	ipHourLimit    int
+	verifyMaxFail  int
+}
+
+// 从系统配置中获取限制，未配置的使用默认值（短信和邮件共用一套配置）
+func (s *verifyCodeService) getLimit() *smsLimit {
+	limit := &smsLimit{
+		codeLength:     smsDefaultCodeLength,
+		sendInterval:   smsDefaultSendInterval,
+		targetDayLimit: smsDefaultPhoneDayLimit,
+		ipHourLimit:    smsDefaultIPHourLimit,
+		verifyMaxFail:  smsDefaultVerifyMaxFail,
+	}
+	appConfig, err := s.commonService.GetAppConfig()
+	if err != nil {
+		s.Warn("获取短信验证码配置失败，使用默认配置！", zap.Error(err))
+		return limit
+	}
+	if appConfig.SMSCodeLength > 0 {
+		limit.codeLength = appConfig.SMSCodeLength
+	}
+	if limit.codeLength < smsMinCodeLength {
+		limit.codeLength = smsMinCodeLength
+	}
+	if limit.codeLength > smsMaxCodeLength {
+		limit.codeLength = smsMaxCodeLength
+	}
+	if appConfig.SMSSendInterval > 0 {
+		limit.sendInterval = appConfig.SMSSendInterval
+	}
+	if appConfig.SMSPhoneDayLimit > 0 {
+		limit.targetDayLimit = appConfig.SMSPhoneDayLimit
+	}
+	if appConfig.SMSIPHourLimit > 0 {
+		limit.ipHourLimit = appConfig.SMSIPHourLimit
+	}
+	if appConfig.SMSVerifyMaxFail > 0 {
+		limit.verifyMaxFail = appConfig.SMSVerifyMaxFail
+	}
+	return limit
+}
+
+// 检查发送间隔、接收方每日上限和IP每小时上限（计数保存在redis中，多个api节点共享）
+func (s *verifyCodeService) checkSendLimit(target string, clientIP string, limit *smsLimit) error {
+	now := time.Now()
+	count, err := s.incrWithExpire(fmt.Sprintf("%slimit:interval:%s", s.channel, target), time.Second*time.Duration(limit.sendInterval))
+	if err != nil {
+		return err
+	}
+	if count > 1 {
+		return fmt.Errorf("%w，请%d秒后再试！", ErrSMSLimit, limit.sendInterval)
+	}
+	if clientIP != "" {
+		count, err = s.incrWithExpire(fmt.Sprintf("%slimit:ip:%s:%s", s.channel, now.Format("2006010215"), clientIP), time.Hour)
+		if err != nil {
+			return err
+		}
+		if count > int64(limit.ipHourLimit) {
+			return fmt.Errorf("%w，请稍后再试！", ErrSMSLimit)
+		}
+	}
+	count, err = s.incrWithExpire(fmt.Sprintf("%slimit:target:%s:%s", s.channel, now.Format("20060102"), target), time.Hour*24)
+	if err != nil {
+		return err
+	}
+	if count > int64(limit.targetDayLimit) {
+		return fmt.Errorf("%w，今日发送次数已达上限！", ErrSMSLimit)
+	}
+	return nil
+}
+
+// 计数加一，第一次计数时设置过期时间
+func (s *verifyCodeService) incrWithExpire(key string, expire time.Duration) (int64, error) {
+	count, err := s.ctx.GetRedisConn().Incr(key)
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		if err := s.ctx.GetRedisConn().Expire(key, expire); err != nil {
+			s.ctx.GetRedisConn().Del(key) // 避免计数永不过期
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+func (s *verifyCodeService) incrStats(field string) {
+	key := s.statsCacheKey(time.Now())
+	count, err := s.ctx.GetRedisConn().Hincrby(key, field, 1)
+	if err != nil {
+		s.Warn("记录短信统计失败！", zap.Error(err), zap.String("field", field))
+		return
+	}
+	if count == 1 {
+		if err := s.ctx.GetRedisConn().Expire(key, smsStatsExpire); err != nil {
+			s.Warn("设置短信统计过期时间失败！", zap.Error(err))
+		}
+	}
+}
+
+// 最近几天的发送和校验统计（最新的在前）
+func (s *verifyCodeService) stats(days int) ([]*SMSStatsResp, error) {
+	if days <= 0 {
+		days = 1
+	}
+	if days > smsStatsMaxDay {
+		days = smsStatsMaxDay
+	}
+	now := time.Now()
+	resps := make([]*SMSStatsResp, 0, days)
+	for i := 0; i < days; i++ {
+		day := now.AddDate(0, 0, -i)
+		values, err := s.ctx.GetRedisConn().Hgetall(s.statsCacheKey(day))
+		if err != nil {
+			return nil, err
+		}
+		get := func(field string) int64 {
+			v, _ := strconv.ParseInt(values[field], 10, 64)
+			return v
+		}
+		resps = append(resps, &SMSStatsResp{
+			Date:          day.Format("2006-01-02"),
+			SendOK:        get(smsStatsSendOK),
+			SendFail:      get(smsStatsSendFail),
+			SendLimited:   get(smsStatsSendLimited),
+			VerifyOK:      get(smsStatsVerifyOK),
+			VerifyFail:    get(smsStatsVerifyFail),
+			VerifyExpired: get(smsStatsVerifyExpired),
+			VerifyLocked:  get(smsStatsVerifyLocked),
+		})
+	}
+	return resps, nil
+}
+
+func (s *verifyCodeService) statsCacheKey(t time.Time) string {
+	return fmt.Sprintf("%sstats:%s", s.channel, t.Format("20060102"))
+}
+
+func verifyCodeFailCacheKey(cacheKey string) string {
+	return cacheKey + ":fail"
+}
+
+// generateVerifyCode 生成指定长度的数字验证码
+func generateVerifyCode(length int) (string, error) {
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		code[i] = byte('0' + n.Int64())
+	}
+	return string(code), nil
+}
+
+// SMSStatsResp 验证码发送和校验统计
+type SMSStatsResp struct {
+	Date          string `json:"date"`
+	SendOK        int64  `json:"send_ok"`        // 发送成功
+	SendFail      int64  `json:"send_fail"`      // 服务商发送失败
+	SendLimited   int64  `json:"send_limited"`   // 被限流
+	VerifyOK      int64  `json:"verify_ok"`      // 校验成功
+	VerifyFail    int64  `json:"verify_fail"`    // 验证码错误
+	VerifyExpired int64  `json:"verify_expired"` // 验证码不存在或已过期
+	VerifyLocked  int64  `json:"verify_locked"`  // 错误次数过多验证码作废
+}
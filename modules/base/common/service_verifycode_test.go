@@ -0,0 +1,18 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateVerifyCode(t *testing.T) {
+	for _, length := range []int{smsMinCodeLength, smsDefaultCodeLength, smsMaxCodeLength} {
+		code, err := generateVerifyCode(length)
+		assert.NoError(t, err)
+		assert.Len(t, code, length)
+		for _, ch := range code {
+			assert.True(t, ch >= '0' && ch <= '9')
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// webhook
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	commonapi "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/common"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+)
+
+const (
+	smsWebhookTimeout         = time.Second * 10
+	smsWebhookHeaderTimestamp = "X-SMS-Timestamp"
+	smsWebhookHeaderSignature = "X-SMS-Signature"
+)
+
+func init() {
+	RegisterSMSProvider(SMSProviderWebhook, NewWebhookProvider)
+}
+
+// WebhookProvider 将验证码POST到系统配置中的sms_webhook_url，由接收方自行发送短信
+// 配置了sms_webhook_secret时带签名头 X-SMS-Signature: sha256=hex(hmac_sha256(secret, timestamp + "." + body))
+type WebhookProvider struct {
+	ctx *config.Context
+	log.Log
+	commonService commonapi.IService
+	client        *http.Client
+}
+
+// NewWebhookProvider 创建webhook短信服务
+func NewWebhookProvider(ctx *config.Context) ISMSProvider {
+	return &WebhookProvider{
+		ctx:           ctx,
+		Log:           log.NewTLog("WebhookProvider"),
+		commonService: commonapi.NewService(ctx),
+		client:        &http.Client{Timeout: smsWebhookTimeout},
+	}
+}
+
+type smsWebhookReq struct {
+	Zone      string `json:"zone"`
+	Phone     string `json:"phone"`
+	Code      string `json:"code"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+func (w *WebhookProvider) SendSMS(ctx context.Context, zone, phone string, code string) error {
+	appConfig, err := w.commonService.GetAppConfig()
+	if err != nil {
+		return err
+	}
+	if appConfig == nil || appConfig.SMSWebhookURL == "" {
+		return errors.New("没有配置短信webhook地址！")
+	}
+	timestamp := time.Now().Unix()
+	body, err := json.Marshal(&smsWebhookReq{
+		Zone:      zone,
+		Phone:     phone,
+		Code:      code,
+		Timestamp: timestamp,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, appConfig.SMSWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestampStr := strconv.FormatInt(timestamp, 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(smsWebhookHeaderTimestamp, timestampStr)
+	if appConfig.SMSWebhookSecret != "" {
+		req.Header.Set(smsWebhookHeaderSignature, "sha256="+signSMSWebhook(appConfig.SMSWebhookSecret, timestampStr, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("短信webhook返回状态码[%d]", resp.StatusCode)
+	}
+	return nil
+}
+
+func signSMSWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
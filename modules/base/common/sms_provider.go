@@ -0,0 +1,105 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+)
+
+const (
+	// SMSProviderAliyunInternational 阿里云国际短信
+	SMSProviderAliyunInternational = "aliyun_international"
+	// SMSProviderConsole 只在日志中打印验证码（开发和测试环境使用）
+	SMSProviderConsole = "console"
+	// SMSProviderWebhook 将验证码推送到配置的http地址，由自己的服务发送
+	SMSProviderWebhook = "webhook"
+
+	// smsRouteDefaultZone 未单独配置的区号使用的路由
+	smsRouteDefaultZone = "*"
+)
+
+// SMSProviderFactory 创建短信服务商
+type SMSProviderFactory func(ctx *config.Context) ISMSProvider
+
+var (
+	smsProviders     = map[string]SMSProviderFactory{}
+	smsProvidersLock sync.RWMutex
+)
+
+// RegisterSMSProvider 注册短信服务商（一般在服务商的init中调用），同名的会被覆盖
+func RegisterSMSProvider(name string, factory SMSProviderFactory) {
+	smsProvidersLock.Lock()
+	defer smsProvidersLock.Unlock()
+	smsProviders[name] = factory
+}
+
+// SMSProviderNames 已注册的短信服务商
+func SMSProviderNames() []string {
+	smsProvidersLock.RLock()
+	defer smsProvidersLock.RUnlock()
+	names := make([]string, 0, len(smsProviders))
+	for name := range smsProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getSMSProviderFactory(name string) SMSProviderFactory {
+	smsProvidersLock.RLock()
+	defer smsProvidersLock.RUnlock()
+	return smsProviders[name]
+}
+
+// ParseSMSRoutes 解析短信路由配置，格式：区号=服务商1,服务商2;区号=服务商
+// 服务商按顺序失败转移，区号为*表示未单独配置的区号 如：0086=aliyun,unisms;*=unisms,webhook
+func ParseSMSRoutes(routes string) (map[string][]string, error) {
+	routeMap := map[string][]string{}
+	for _, route := range strings.FieldsFunc(routes, func(r rune) bool {
+		return r == ';' || r == '\n'
+	}) {
+		route = strings.TrimSpace(route)
+		if route == "" {
+			continue
+		}
+		parts := strings.SplitN(route, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("短信路由[%s]格式有误！", route)
+		}
+		zone := strings.TrimSpace(parts[0])
+		if zone == "" {
+			return nil, fmt.Errorf("短信路由[%s]的区号不能为空！", route)
+		}
+		providers := make([]string, 0)
+		for _, provider := range strings.Split(parts[1], ",") {
+			provider = strings.TrimSpace(provider)
+			if provider != "" {
+				providers = append(providers, provider)
+			}
+		}
+		if len(providers) == 0 {
+			return nil, fmt.Errorf("短信路由[%s]的服务商不能为空！", route)
+		}
+		routeMap[zone] = providers
+	}
+	return routeMap, nil
+}
+
+// ValidateSMSRoutes 校验短信路由配置（格式和服务商是否已注册）
+func ValidateSMSRoutes(routes string) error {
+	routeMap, err := ParseSMSRoutes(routes)
+	if err != nil {
+		return err
+	}
+	for zone, providers := range routeMap {
+		for _, provider := range providers {
+			if getSMSProviderFactory(provider) == nil {
+				return fmt.Errorf("短信路由[%s]的服务商[%s]不存在！", zone, provider)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSMSRoutes(t *testing.T) {
+	routes, err := ParseSMSRoutes(" 0086=aliyun, unisms ;\n*=webhook;")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"aliyun", "unisms"}, routes["0086"])
+	assert.Equal(t, []string{"webhook"}, routes["*"])
+
+	routes, err = ParseSMSRoutes("")
+	assert.NoError(t, err)
+	assert.Len(t, routes, 0)
+
+	_, err = ParseSMSRoutes("0086")
+	assert.Error(t, err)
+	_, err = ParseSMSRoutes("=aliyun")
+	assert.Error(t, err)
+	_, err = ParseSMSRoutes("0086= , ")
+	assert.Error(t, err)
+}
+
+func TestSMSProviderRegistry(t *testing.T) {
+	names := SMSProviderNames()
+	for _, name := range []string{"aliyun", SMSProviderAliyunInternational, "unisms", "smsbao", SMSProviderConsole, SMSProviderWebhook} {
+		assert.Contains(t, names, name)
+	}
+	assert.Nil(t, getSMSProviderFactory("notexist"))
+}
+
+func TestValidateSMSRoutes(t *testing.T) {
+	assert.NoError(t, ValidateSMSRoutes(""))
+	assert.NoError(t, ValidateSMSRoutes("0086=aliyun,unisms;*=webhook"))
+	assert.Error(t, ValidateSMSRoutes("0086"))
+	assert.Error(t, ValidateSMSRoutes("0086=aliyun,notexist"))
+}
+
+func TestSignSMSWebhook(t *testing.T) {
+	sign := signSMSWebhook("secret", "1700000000", []byte(`{"code":"123456"}`))
+	assert.Len(t, sign, 64)
+	assert.Equal(t, sign, signSMSWebhook("secret", "1700000000", []byte(`{"code":"123456"}`)))
+	assert.NotEqual(t, sign, signSMSWebhook("secret", "1700000001", []byte(`{"code":"123456"}`)))
+}
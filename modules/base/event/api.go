@@ -2,6 +2,7 @@ package event
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/file"
 	"github.com/gocraft/dbr/v2"
@@ -58,6 +59,20 @@ const (
 	EventUpdateSearchMessage string = "message.update.search.data"
 )
 
+const (
+	// StatusDead 超过最大重试次数，不再自动重试（死信）
+	StatusDead = 3
+	// StatusDiscarded 已被管理员丢弃
+	StatusDiscarded = 4
+)
+
+const (
+	eventMaxAttempts    = 8                // 最大执行次数，超过则进入死信
+	eventRetryBaseDelay = time.Second * 30 // 第一次重试的延迟，之后按指数递增
+	eventRetryMaxDelay  = time.Hour        // 重试的最大延迟
+	eventRetryLease     = time.Minute * 5  // 重试执行中的租期，防止被定时任务重复领取
+)
+
 // Event 事件
 type Event struct {
 	db  *DB
@@ -118,21 +133,42 @@ func (e *Event) Support(typ int) bool {
 	return false
 }
 
-func (e *Event) updateEventStatus(err error, versionLock int64, eventID int64) {
+func (e *Event) updateEventStatus(err error, model *Model) {
 	var reason string
-	var status = et.Success
+	var status = et.Success.Int()
+	var attempt = model.Attempt
+	var nextRetryAt int64
 	if err != nil {
-		e.Warn("执行事件失败！", zap.Error(err), zap.Int64("eventID", eventID))
+		attempt++
+		e.Warn("执行事件失败！", zap.Error(err), zap.Int64("eventID", model.Id), zap.Int("attempt", attempt))
 		reason = fmt.Sprintf("执行事件失败！-> %v", err)
-		status = et.Fail
+		if attempt >= eventMaxAttempts {
+			status = StatusDead
+			e.Error("事件超过最大重试次数，已转为死信！", zap.Int64("eventID", model.Id), zap.String("event", model.Event))
+		} else {
+			status = et.Fail.Int()
+			nextRetryAt = time.Now().Add(eventRetryDelay(attempt)).Unix()
+		}
 	}
-	err = e.db.UpdateStatus(reason, status.Int(), versionLock, eventID)
+	err = e.db.UpdateResult(reason, status, attempt, nextRetryAt, model.VersionLock, model.Id)
 	if err != nil {
-		e.Error("更新事件状态失败！", zap.Int64("eventID", eventID), zap.Error(err))
+		e.Error("更新事件状态失败！", zap.Int64("eventID", model.Id), zap.Error(err))
 		return
 	}
 }
 
+// eventRetryDelay 第attempt次失败后的重试延迟
+func eventRetryDelay(attempt int) time.Duration {
+	delay := eventRetryBaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= eventRetryMaxDelay {
+			return eventRetryMaxDelay
+		}
+	}
+	return delay
+}
+
 // EventTimerPush 定时发布事件
 func (e *Event) EventTimerPush() {
 	models, err := e.db.QueryAllWait(1000)
@@ -145,4 +181,26 @@ func (e *Event) EventTimerPush() {
 			e.handleEvent(model)
 		}
 	}
+	e.retryFailedEvents()
+}
+
+// 重试到期的失败事件
+func (e *Event) retryFailedEvents() {
+	now := time.Now()
+	models, err := e.db.QueryAllRetry(1000, now.Unix())
+	if err != nil {
+		e.Error("查询待重试的事件失败！", zap.Error(err))
+		return
+	}
+	for _, model := range models {
+		ok, err := e.db.ClaimRetry(model.Id, model.NextRetryAt, now.Add(eventRetryLease).Unix())
+		if err != nil {
+			e.Error("领取重试事件失败！", zap.Error(err), zap.Int64("eventID", model.Id))
+			continue
+		}
+		if !ok { // 已被其他节点领取
+			continue
+		}
+		e.handleEvent(model)
+	}
 }
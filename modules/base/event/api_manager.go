@@ -0,0 +1,229 @@
+package event
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/common"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+
+	et "github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkevent"
+)
+
+// 批量操作的最大事件数量
+const managerBatchMaxCount = 1000
+
+// Manager 事件后台管理
+type Manager struct {
+	ctx *config.Context
+	log.Log
+	db *DB
+}
+
+// NewManager NewManager
+func NewManager(ctx *config.Context) *Manager {
+	return &Manager{
+		ctx: ctx,
+		Log: log.NewTLog("eventManager"),
+		db:  NewDB(ctx.DB()),
+	}
+}
+
+// Route 路由配置
+func (m *Manager) Route(r *wkhttp.WKHttp) {
+	auth := r.Group("/v1/manager", m.ctx.AuthMiddleware(r))
+	{
+		auth.GET("/events", m.list)                  // 失败或死信事件列表
+		auth.PUT("/events/:id/replay", m.replay)     // 重新投递事件
+		auth.PUT("/events/:id/discard", m.discard)   // 丢弃事件
+		auth.POST("/events/replay", m.replayBatch)   // 批量重新投递事件
+		auth.POST("/events/discard", m.discardBatch) // 批量丢弃事件
+	}
+}
+
+// 失败或死信事件列表
+func (m *Manager) list(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	statuses := []int{et.Fail.Int(), StatusDead}
+	statusStr := c.Query("status")
+	if statusStr != "" {
+		status, _ := strconv.Atoi(statusStr)
+		if status != et.Fail.Int() && status != StatusDead {
+			c.ResponseError(errors.New("只能查询失败或死信的事件！"))
+			return
+		}
+		statuses = []int{status}
+	}
+	eventKey := strings.TrimSpace(c.Query("event"))
+	pageIndex, pageSize := c.GetPage()
+	models, err := m.db.QueryWithStatus(statuses, eventKey, uint64(pageSize), uint64(pageIndex))
+	if err != nil {
+		m.Error("查询事件列表失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询事件列表失败！"))
+		return
+	}
+	count, err := m.db.QueryCountWithStatus(statuses, eventKey)
+	if err != nil {
+		m.Error("查询事件数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询事件数量失败！"))
+		return
+	}
+	list := make([]*managerEventResp, 0, len(models))
+	for _, model := range models {
+		var nextRetryAt string
+		if model.Status == et.Fail.Int() && model.NextRetryAt > 0 {
+			nextRetryAt = time.Unix(model.NextRetryAt, 0).Format("2006-01-02 15:04:05")
+		}
+		list = append(list, &managerEventResp{
+			ID:          model.Id,
+			Event:       model.Event,
+			Type:        model.Type,
+			Data:        model.Data,
+			Status:      model.Status,
+			Reason:      model.Reason,
+			Attempt:     model.Attempt,
+			NextRetryAt: nextRetryAt,
+			CreatedAt:   model.CreatedAt.String(),
+			UpdatedAt:   model.UpdatedAt.String(),
+		})
+	}
+	c.Response(map[string]interface{}{
+		"count": count,
+		"list":  list,
+	})
+}
+
+// 重新投递事件
+func (m *Manager) replay(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	if id <= 0 {
+		c.ResponseError(errors.New("事件ID有误！"))
+		return
+	}
+	count, err := m.db.Replay([]int64{id})
+	if err != nil {
+		m.Error("重新投递事件失败！", zap.Error(err), zap.Int64("eventID", id))
+		c.ResponseError(errors.New("重新投递事件失败！"))
+		return
+	}
+	if count == 0 {
+		c.ResponseError(errors.New("事件不存在或不是失败状态！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 丢弃事件
+func (m *Manager) discard(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	if id <= 0 {
+		c.ResponseError(errors.New("事件ID有误！"))
+		return
+	}
+	count, err := m.db.Discard([]int64{id})
+	if err != nil {
+		m.Error("丢弃事件失败！", zap.Error(err), zap.Int64("eventID", id))
+		c.ResponseError(errors.New("丢弃事件失败！"))
+		return
+	}
+	if count == 0 {
+		c.ResponseError(errors.New("事件不存在或不是失败状态！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 批量重新投递事件
+func (m *Manager) replayBatch(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	ids, err := m.bindEventIDs(c)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	count, err := m.db.Replay(ids)
+	if err != nil {
+		m.Error("批量重新投递事件失败！", zap.Error(err))
+		c.ResponseError(errors.New("批量重新投递事件失败！"))
+		return
+	}
+	c.Response(map[string]interface{}{
+		"count": count,
+	})
+}
+
+// 批量丢弃事件
+func (m *Manager) discardBatch(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	ids, err := m.bindEventIDs(c)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	count, err := m.db.Discard(ids)
+	if err != nil {
+		m.Error("批量丢弃事件失败！", zap.Error(err))
+		c.ResponseError(errors.New("批量丢弃事件失败！"))
+		return
+	}
+	c.Response(map[string]interface{}{
+		"count": count,
+	})
+}
+
+func (m *Manager) bindEventIDs(c *wkhttp.Context) ([]int64, error) {
+	var req struct {
+		IDs []int64 `json:"ids"` // 事件ID
+	}
+	if err := c.BindJSON(&req); err != nil {
+		m.Error(common.ErrData.Error(), zap.Error(err))
+		return nil, common.ErrData
+	}
+	if len(req.IDs) == 0 {
+		return nil, errors.New("事件ID不能为空！")
+	}
+	if len(req.IDs) > managerBatchMaxCount {
+		return nil, errors.New("单次操作的事件数量过多！")
+	}
+	return req.IDs, nil
+}
+
+type managerEventResp struct {
+	ID          int64  `json:"id"`
+	Event       string `json:"event"`         // 事件标示
+	Type        int    `json:"type"`          // 事件类型
+	Data        string `json:"data"`          // 事件数据
+	Status      int    `json:"status"`        // 事件状态 2.发布失败（等待重试） 3.死信
+	Reason      string `json:"reason"`        // 失败原因
+	Attempt     int    `json:"attempt"`       // 已执行失败的次数
+	NextRetryAt string `json:"next_retry_at"` // 下次重试时间
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
@@ -36,6 +36,72 @@ func (d *DB) UpdateStatus(reason string, status int, versionLock int64, id int64
 	return err
 }
 
+// UpdateResult 更新事件执行结果
+func (d *DB) UpdateResult(reason string, status int, attempt int, nextRetryAt int64, versionLock int64, id int64) error {
+	_, err := d.session.Update("event").Set("status", status).Set("reason", reason).Set("attempt", attempt).Set("next_retry_at", nextRetryAt).Where("id=? and version_lock=?", id, versionLock).Exec()
+	return err
+}
+
+// QueryAllRetry 查询所有到期待重试的失败事件
+func (d *DB) QueryAllRetry(limit uint64, now int64) ([]*Model, error) {
+	var models []*Model
+	_, err := d.session.Select("*").From("event").Where("status=? and next_retry_at<=?", wkevent.Fail.Int(), now).OrderDir("next_retry_at", true).Limit(limit).Load(&models)
+	return models, err
+}
+
+// ClaimRetry 领取重试事件（将下次重试时间推后作为租期），返回是否领取成功
+func (d *DB) ClaimRetry(id int64, nextRetryAt int64, leaseUntil int64) (bool, error) {
+	result, err := d.session.Update("event").Set("next_retry_at", leaseUntil).Where("id=? and status=? and next_retry_at=?", id, wkevent.Fail.Int(), nextRetryAt).Exec()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// QueryWithStatus 分页查询指定状态的事件
+func (d *DB) QueryWithStatus(statuses []int, event string, pageSize, page uint64) ([]*Model, error) {
+	var models []*Model
+	builder := d.session.Select("*").From("event").Where("status in ?", statuses)
+	if event != "" {
+		builder = builder.Where("event=?", event)
+	}
+	_, err := builder.OrderDir("id", false).Offset((page - 1) * pageSize).Limit(pageSize).Load(&models)
+	return models, err
+}
+
+// QueryCountWithStatus 查询指定状态的事件数量
+func (d *DB) QueryCountWithStatus(statuses []int, event string) (int64, error) {
+	var count int64
+	builder := d.session.Select("count(*)").From("event").Where("status in ?", statuses)
+	if event != "" {
+		builder = builder.Where("event=?", event)
+	}
+	_, err := builder.Load(&count)
+	return count, err
+}
+
+// Replay 重新投递失败或死信事件（重置重试次数，由定时任务立即重试），返回影响的事件数量
+func (d *DB) Replay(ids []int64) (int64, error) {
+	result, err := d.session.Update("event").Set("status", wkevent.Fail.Int()).Set("attempt", 0).Set("next_retry_at", 0).Where("id in ? and status in ?", ids, []int{wkevent.Fail.Int(), StatusDead}).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Discard 丢弃失败或死信事件，返回影响的事件数量
+func (d *DB) Discard(ids []int64) (int64, error) {
+	result, err := d.session.Update("event").Set("status", StatusDiscarded).Set("next_retry_at", 0).Where("id in ? and status in ?", ids, []int{wkevent.Fail.Int(), StatusDead}).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 // QueryWithID 根据id查询事件
 func (d *DB) QueryWithID(id int64) (*Model, error) {
 	var model *Model
@@ -57,8 +123,10 @@ type Model struct {
 	Event       string // 事件标示
 	Type        int    // 事件类型
 	Data        string // 事件数据
-	Status      int    // 事件状态 0.待发布 1.已发布 2.发布失败！
-	Reason      string // 原因 如果状态为2，则有发布失败的原因
+	Status      int    // 事件状态 0.待发布 1.已发布 2.发布失败（等待重试） 3.死信 4.已丢弃
+	Reason      string // 原因 如果状态为2或3，则有发布失败的原因
+	Attempt     int    // 已执行失败的次数
+	NextRetryAt int64  // 下次重试时间（秒级时间戳）
 	VersionLock int64  // 乐观锁
 	db.BaseModel
 }
@@ -35,13 +35,13 @@ func (e *Event) handleEvent(model *Model) {
 	if handler == nil {
 		listeners := e.ctx.GetEventListeners(model.Event)
 		if listeners == nil {
-			e.updateEventStatus(nil, model.VersionLock, model.Id)
+			e.updateEventStatus(nil, model)
 			e.Debug("不支持的事件!", zap.String("event", model.Event))
 			return
 		}
 		for _, listener := range listeners {
 			listener([]byte(model.Data), func(err error) {
-				e.updateEventStatus(err, model.VersionLock, model.Id)
+				e.updateEventStatus(err, model)
 			})
 		}
 		return
@@ -62,10 +62,11 @@ func (e *Event) handleGroupCreateEvent(model *Model) {
 			err := util.ReadJsonByByte([]byte(model.Data), &req)
 			if err != nil {
 				e.Error("解析JSON失败！", zap.Error(err), zap.String("data", model.Data))
+				e.updateEventStatus(err, model)
 				return
 			}
 			err = e.ctx.SendGroupCreate(req)
-			e.updateEventStatus(err, model.VersionLock, model.Id)
+			e.updateEventStatus(err, model)
 			fmt.Println("handleGroupCreateEvent3....JobFunc")
 		},
 	}
@@ -82,10 +83,11 @@ func (e *Event) handleGroupUnableAddDestroyAccount(model *Model) {
 			err := util.ReadJsonByByte([]byte(model.Data), &req)
 			if err != nil {
 				e.Error("解析JSON失败！", zap.Error(err), zap.String("data", model.Data))
+				e.updateEventStatus(err, model)
 				return
 			}
 			err = e.ctx.SendUnableAddDestoryAccountInGroup(req)
-			e.updateEventStatus(err, model.VersionLock, model.Id)
+			e.updateEventStatus(err, model)
 		},
 	}
 }
@@ -101,10 +103,11 @@ func (e *Event) handleGroupUpdateEvent(model *Model) {
 			err := util.ReadJsonByByte([]byte(model.Data), &req)
 			if err != nil {
 				e.Error("解析JSON失败！", zap.Error(err), zap.String("data", model.Data))
+				e.updateEventStatus(err, model)
 				return
 			}
 			err = e.ctx.SendGroupUpdate(req)
-			e.updateEventStatus(err, model.VersionLock, model.Id)
+			e.updateEventStatus(err, model)
 			err = e.ctx.SendChannelUpdateToGroup(req.GroupNo)
 			if err != nil {
 				e.Error("发送频道更新cmd失败！", zap.Error(err))
@@ -127,7 +130,7 @@ func (e *Event) handleGroupUpdateEvent(model *Model) {
 // 				return
 // 			}
 // 			err = e.ctx.SendGroupMemberAdd(req)
-// 			e.updateEventStatus(err, model.VersionLock, model.Id)
+// 			e.updateEventStatus(err, model)
 // 		},
 // 	}
 // }
@@ -143,10 +146,11 @@ func (e *Event) handleGroupMemberRemoveEvent(model *Model) {
 			err := util.ReadJsonByByte([]byte(model.Data), &req)
 			if err != nil {
 				e.Error("解析JSON失败！", zap.Error(err), zap.String("data", model.Data))
+				e.updateEventStatus(err, model)
 				return
 			}
 			err = e.ctx.SendGroupMemberRemove(req)
-			e.updateEventStatus(err, model.VersionLock, model.Id)
+			e.updateEventStatus(err, model)
 		},
 	}
 }
@@ -162,6 +166,7 @@ func (e *Event) handleGroupAvatarUpdateEvent(model *Model) {
 			err := util.ReadJsonByByte([]byte(model.Data), &req)
 			if err != nil {
 				e.Error("解析JSON失败！", zap.Error(err), zap.String("data", model.Data))
+				e.updateEventStatus(err, model)
 				return
 			}
 			// 组合群头像
@@ -176,6 +181,7 @@ func (e *Event) handleGroupAvatarUpdateEvent(model *Model) {
 			_, err = e.fileService.DownloadAndMakeCompose(uploadPath, downloadURLs)
 			if err != nil {
 				e.Error("组合群头像失败！", zap.String("groupNo", req.GroupNo), zap.Any("members", req.Members), zap.Error(err))
+				e.updateEventStatus(err, model)
 				return
 			}
 			// 发送群头像更新命令
@@ -189,9 +195,10 @@ func (e *Event) handleGroupAvatarUpdateEvent(model *Model) {
 			})
 			if err != nil {
 				e.Error("发送群头像更新命令失败！", zap.String("groupNo", req.GroupNo), zap.Any("members", req.Members), zap.Error(err))
+				e.updateEventStatus(err, model)
 				return
 			}
-			e.updateEventStatus(err, model.VersionLock, model.Id)
+			e.updateEventStatus(err, model)
 		},
 	}
 }
@@ -206,10 +213,11 @@ func (e *Event) handleGroupMemberScanJoin(model *Model) {
 			err := util.ReadJsonByByte([]byte(model.Data), &req)
 			if err != nil {
 				e.Error("解析JSON失败！", zap.Error(err), zap.String("data", model.Data))
+				e.updateEventStatus(err, model)
 				return
 			}
 			err = e.ctx.SendGroupMemberScanJoin(req)
-			e.updateEventStatus(err, model.VersionLock, model.Id)
+			e.updateEventStatus(err, model)
 		},
 	}
 }
@@ -224,10 +232,11 @@ func (e *Event) handleGroupTransferGrouper(model *Model) {
 			err := util.ReadJsonByByte([]byte(model.Data), &req)
 			if err != nil {
 				e.Error("解析JSON失败！", zap.Error(err), zap.String("data", model.Data))
+				e.updateEventStatus(err, model)
 				return
 			}
 			err = e.ctx.SendGroupTransferGrouper(req)
-			e.updateEventStatus(err, model.VersionLock, model.Id)
+			e.updateEventStatus(err, model)
 			err = e.ctx.SendGroupMemberUpdate(req.GroupNo)
 			if err != nil {
 				e.Error("发送群成员更新cmd失败！", zap.Error(err))
@@ -246,10 +255,11 @@ func (e *Event) handleGroupMemberInviteRequest(model *Model) {
 			err := util.ReadJsonByByte([]byte(model.Data), &req)
 			if err != nil {
 				e.Error("解析JSON失败！", zap.Error(err), zap.String("data", model.Data))
+				e.updateEventStatus(err, model)
 				return
 			}
 			err = e.ctx.SendGroupMemberInviteReq(req)
-			e.updateEventStatus(err, model.VersionLock, model.Id)
+			e.updateEventStatus(err, model)
 		},
 	}
 }
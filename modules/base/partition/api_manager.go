@@ -0,0 +1,244 @@
+package partition
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// Manager 消息分表后台管理
+type Manager struct {
+	ctx *config.Context
+	log.Log
+	db      *DB
+	service *Service
+}
+
+// NewManager NewManager
+func NewManager(ctx *config.Context) *Manager {
+	return &Manager{
+		ctx:     ctx,
+		Log:     log.NewTLog("messagePartitionManager"),
+		db:      NewDB(ctx.DB()),
+		service: GetService(ctx),
+	}
+}
+
+// Route 路由配置
+func (m *Manager) Route(r *wkhttp.WKHttp) {
+	auth := r.Group("/v1/manager", m.ctx.AuthMiddleware(r))
+	{
+		auth.GET("/message/partition", m.status) // 消息分表状态和迁移进度
+		auth.POST("/message/partition", m.start) // 修改消息表数量并开始迁移
+	}
+}
+
+// 消息分表状态和迁移进度
+func (m *Manager) status(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	state, err := m.service.loadState()
+	if err != nil {
+		m.Error("查询消息分表版本失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询消息分表版本失败！"))
+		return
+	}
+	resp := &partitionResp{
+		Version:    state.Active.Version,
+		TableCount: state.Active.TableCount,
+	}
+	if state.Migrating != nil {
+		progresses, err := m.db.queryProgress(state.Migrating.Version)
+		if err != nil {
+			m.Error("查询消息分表迁移进度失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询消息分表迁移进度失败！"))
+			return
+		}
+		resp.Migrating = newPartitionMigrateResp(state.Migrating, progresses)
+	}
+	c.Response(resp)
+}
+
+// 修改消息表数量并开始迁移
+func (m *Manager) start(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	var req struct {
+		TableCount int `json:"table_count"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	if req.TableCount <= 0 || req.TableCount > messageTableMaxCount {
+		c.ResponseError(fmt.Errorf("消息表数量必须在1到%d之间！", messageTableMaxCount))
+		return
+	}
+	state, err := m.service.loadState()
+	if err != nil {
+		m.Error("查询消息分表版本失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询消息分表版本失败！"))
+		return
+	}
+	if state.Migrating != nil {
+		c.ResponseError(errors.New("已有正在进行的消息分表迁移！"))
+		return
+	}
+	if state.Active.TableCount == req.TableCount {
+		c.ResponseError(errors.New("消息表数量没有变化！"))
+		return
+	}
+	for i := 0; i < req.TableCount; i++ {
+		err = m.db.createTableIfNotExist(tableName(i))
+		if err != nil {
+			m.Error("创建消息表失败！", zap.Error(err), zap.String("table", tableName(i)))
+			c.ResponseError(errors.New("创建消息表失败！"))
+			return
+		}
+	}
+	progresses := make([]*ProgressModel, 0, state.Active.TableCount)
+	for i := 0; i < state.Active.TableCount; i++ {
+		maxID, err := m.db.queryMaxID(tableName(i))
+		if err != nil {
+			m.Error("查询消息表最大主键失败！", zap.Error(err), zap.String("table", tableName(i)))
+			c.ResponseError(errors.New("查询消息表失败！"))
+			return
+		}
+		progresses = append(progresses, &ProgressModel{
+			TableName: tableName(i),
+			MaxID:     maxID,
+			Status:    ProgressStatusDoing,
+		})
+	}
+	maxVersion, err := m.db.queryMaxVersion()
+	if err != nil {
+		m.Error("查询消息分表最大版本失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询消息分表版本失败！"))
+		return
+	}
+	model := &Model{
+		Version:     maxVersion + 1,
+		TableCount:  req.TableCount,
+		Status:      StatusMigrating,
+		FromVersion: state.Active.Version,
+		StartedAt:   time.Now().Unix(),
+	}
+	tx, err := m.ctx.DB().Begin()
+	if err != nil {
+		m.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer tx.RollbackUnlessCommitted()
+	err = m.db.insertTx(model, tx)
+	if err != nil {
+		m.Error("添加消息分表版本失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加消息分表版本失败！"))
+		return
+	}
+	for _, progress := range progresses {
+		progress.Version = model.Version
+		err = m.db.insertProgressTx(progress, tx)
+		if err != nil {
+			m.Error("添加消息分表迁移进度失败！", zap.Error(err))
+			c.ResponseError(errors.New("添加消息分表版本失败！"))
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		m.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	m.service.refreshState()
+	m.Info("开始消息分表迁移", zap.Int("version", model.Version), zap.Int("fromTableCount", state.Active.TableCount), zap.Int("tableCount", model.TableCount))
+	c.Response(newPartitionMigrateResp(model, progresses))
+}
+
+func newPartitionMigrateResp(model *Model, progresses []*ProgressModel) *partitionMigrateResp {
+	tables := make([]*partitionTableResp, 0, len(progresses))
+	for _, progress := range progresses {
+		tables = append(tables, &partitionTableResp{
+			Table:      progress.TableName,
+			LastID:     progress.LastID,
+			MaxID:      progress.MaxID,
+			MovedCount: progress.MovedCount,
+			Status:     progress.Status,
+		})
+	}
+	return &partitionMigrateResp{
+		Version:       model.Version,
+		TableCount:    model.TableCount,
+		FromVersion:   model.FromVersion,
+		MigratedCount: model.MigratedCount,
+		StartedAt:     time.Unix(model.StartedAt, 0).Format("2006-01-02 15:04:05"),
+		Percent:       progressPercent(progresses),
+		Tables:        tables,
+	}
+}
+
+// progressPercent 迁移进度百分比（按开始迁移时各旧表的最大主键估算）
+func progressPercent(progresses []*ProgressModel) float64 {
+	var total, scanned int64
+	allDone := true
+	for _, progress := range progresses {
+		total += progress.MaxID
+		if progress.Status == ProgressStatusDone {
+			scanned += progress.MaxID
+			continue
+		}
+		allDone = false
+		if progress.LastID < progress.MaxID {
+			scanned += progress.LastID
+		} else {
+			scanned += progress.MaxID
+		}
+	}
+	if total <= 0 {
+		if allDone {
+			return 100
+		}
+		return 0
+	}
+	percent := float64(scanned) * 100 / float64(total)
+	if !allDone && percent >= 100 { // 还有开始迁移后写入旧表的消息没扫描完
+		percent = 99.99
+	}
+	return math.Floor(percent*100) / 100
+}
+
+type partitionResp struct {
+	Version    int                   `json:"version"`             // 使用中的分表版本
+	TableCount int                   `json:"table_count"`         // 使用中的消息表数量
+	Migrating  *partitionMigrateResp `json:"migrating,omitempty"` // 迁移中的版本
+}
+
+type partitionMigrateResp struct {
+	Version       int                   `json:"version"`        // 迁移的目标版本
+	TableCount    int                   `json:"table_count"`    // 迁移后的消息表数量
+	FromVersion   int                   `json:"from_version"`   // 迁移前的版本
+	MigratedCount int64                 `json:"migrated_count"` // 已迁移的消息数量
+	StartedAt     string                `json:"started_at"`     // 开始迁移时间
+	Percent       float64               `json:"percent"`        // 迁移进度（百分比）
+	Tables        []*partitionTableResp `json:"tables"`         // 各旧表的迁移进度
+}
+
+type partitionTableResp struct {
+	Table      string `json:"table"`       // 旧消息表
+	LastID     int64  `json:"last_id"`     // 已扫描到的主键
+	MaxID      int64  `json:"max_id"`      // 开始迁移时的最大主键
+	MovedCount int64  `json:"moved_count"` // 已迁移到新表的消息数量
+	Status     int    `json:"status"`      // 状态 0.迁移中 1.已完成
+}
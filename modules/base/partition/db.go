@@ -0,0 +1,196 @@
+package partition
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gocraft/dbr/v2"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+)
+
+// DB 消息分表的db
+type DB struct {
+	session *dbr.Session
+}
+
+// NewDB 创建DB
+func NewDB(session *dbr.Session) *DB {
+	return &DB{
+		session: session,
+	}
+}
+
+// queryUnretired 查询使用中和迁移中的版本
+func (d *DB) queryUnretired() ([]*Model, error) {
+	var models []*Model
+	_, err := d.session.Select("*").From("message_partition").Where("status in ?", []int{StatusMigrating, StatusActive}).OrderDir("version", true).Load(&models)
+	return models, err
+}
+
+// queryMaxVersion 查询最大的版本号
+func (d *DB) queryMaxVersion() (int, error) {
+	var version int
+	err := d.session.Select("IFNULL(max(version),0)").From("message_partition").LoadOne(&version)
+	return version, err
+}
+
+// insertIfNotExist 插入版本（版本已存在则忽略，多实例同时初始化时只有一个生效）
+func (d *DB) insertIfNotExist(m *Model) error {
+	_, err := d.session.InsertBySql("INSERT IGNORE INTO message_partition (version,table_count,status,from_version,started_at,finished_at) VALUES (?,?,?,?,?,?)", m.Version, m.TableCount, m.Status, m.FromVersion, m.StartedAt, m.FinishedAt).Exec()
+	return err
+}
+
+func (d *DB) insertTx(m *Model, tx *dbr.Tx) error {
+	_, err := tx.InsertInto("message_partition").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	return err
+}
+
+func (d *DB) insertProgressTx(m *ProgressModel, tx *dbr.Tx) error {
+	_, err := tx.InsertInto("message_partition_progress").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	return err
+}
+
+// queryProgress 查询版本的迁移进度
+func (d *DB) queryProgress(version int) ([]*ProgressModel, error) {
+	var models []*ProgressModel
+	_, err := d.session.Select("*").From("message_partition_progress").Where("version=?", version).OrderDir("id", true).Load(&models)
+	return models, err
+}
+
+// claim 领取迁移任务，返回是否领取成功
+func (d *DB) claim(version int, now int64, leaseUntil int64) (bool, error) {
+	result, err := d.session.Update("message_partition").Set("lease_until", leaseUntil).Where("version=? and status=? and lease_until<?", version, StatusMigrating, now).Exec()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// release 释放迁移任务
+func (d *DB) release(version int) error {
+	_, err := d.session.Update("message_partition").Set("lease_until", 0).Where("version=?", version).Exec()
+	return err
+}
+
+// queryMaxID 查询表的最大主键
+func (d *DB) queryMaxID(table string) (int64, error) {
+	var maxID int64
+	err := d.session.Select("IFNULL(max(id),0)").From(table).LoadOne(&maxID)
+	return maxID, err
+}
+
+// queryRows 按主键顺序查询需要检查的消息
+func (d *DB) queryRows(table string, lastID int64, limit uint64) ([]*rowModel, error) {
+	var models []*rowModel
+	_, err := d.session.Select("id", "channel_id").From(table).Where("id>?", lastID).OrderDir("id", true).Limit(limit).Load(&models)
+	return models, err
+}
+
+// queryColumns 查询消息表的字段（不包含自增主键）
+func (d *DB) queryColumns(table string) ([]string, error) {
+	rows, err := d.session.Query(fmt.Sprintf("SELECT * FROM `%s` LIMIT 0", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if column == "id" {
+			continue
+		}
+		results = append(results, column)
+	}
+	return results, nil
+}
+
+// createTableIfNotExist 按message表的结构创建消息表
+func (d *DB) createTableIfNotExist(table string) error {
+	_, err := d.session.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` LIKE `message`", table))
+	return err
+}
+
+// moveTx 将消息从旧表移动到新表（新表已存在的消息忽略）
+func (d *DB) moveTx(fromTable string, toTable string, columns []string, ids []int64, tx *dbr.Tx) error {
+	quoted := make([]string, 0, len(columns))
+	for _, column := range columns {
+		quoted = append(quoted, fmt.Sprintf("`%s`", column))
+	}
+	columnStr := strings.Join(quoted, ",")
+	_, err := tx.InsertBySql(fmt.Sprintf("INSERT IGNORE INTO `%s` (%s) SELECT %s FROM `%s` WHERE id in ?", toTable, columnStr, columnStr, fromTable), ids).Exec()
+	if err != nil {
+		return err
+	}
+	_, err = tx.DeleteFrom(fromTable).Where("id in ?", ids).Exec()
+	return err
+}
+
+// updateProgressTx 更新迁移进度
+func (d *DB) updateProgressTx(version int, table string, lastID int64, moved int64, tx *dbr.Tx) error {
+	_, err := tx.UpdateBySql("UPDATE message_partition_progress SET last_id=?,moved_count=moved_count+? WHERE version=? and table_name=?", lastID, moved, version, table).Exec()
+	if err != nil {
+		return err
+	}
+	if moved <= 0 {
+		return nil
+	}
+	_, err = tx.UpdateBySql("UPDATE message_partition SET migrated_count=migrated_count+? WHERE version=?", moved, version).Exec()
+	return err
+}
+
+// finishProgress 旧表迁移完成
+func (d *DB) finishProgress(version int, table string) error {
+	_, err := d.session.Update("message_partition_progress").Set("status", ProgressStatusDone).Where("version=? and table_name=?", version, table).Exec()
+	return err
+}
+
+// finishTx 迁移完成，新版本开始使用，旧版本废弃
+func (d *DB) finishTx(version int, fromVersion int, finishedAt int64, tx *dbr.Tx) error {
+	_, err := tx.Update("message_partition").Set("status", StatusRetired).Where("version=?", fromVersion).Exec()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Update("message_partition").SetMap(map[string]interface{}{
+		"status":      StatusActive,
+		"lease_until": 0,
+		"finished_at": finishedAt,
+	}).Where("version=? and status=?", version, StatusMigrating).Exec()
+	return err
+}
+
+// Model 消息分表版本
+type Model struct {
+	Version       int   // 分表版本
+	TableCount    int   // 消息表数量
+	Status        int   // 状态 0.迁移中 1.使用中 2.已废弃
+	FromVersion   int   // 从哪个版本迁移过来
+	MigratedCount int64 // 已迁移的消息数量
+	LeaseUntil    int64 // 迁移任务租期（秒级时间戳）
+	StartedAt     int64 // 开始迁移时间（秒级时间戳）
+	FinishedAt    int64 // 迁移完成时间（秒级时间戳）
+	db.BaseModel
+}
+
+// ProgressModel 旧表的迁移进度
+type ProgressModel struct {
+	Version    int    // 迁移的目标版本
+	TableName  string // 旧消息表
+	LastID     int64  // 已扫描到的主键
+	MaxID      int64  // 开始迁移时的最大主键
+	MovedCount int64  // 已迁移到新表的消息数量
+	Status     int    // 状态 0.迁移中 1.已完成
+	db.BaseModel
+}
+
+type rowModel struct {
+	ID        int64
+	ChannelID string
+}
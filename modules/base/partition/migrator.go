@@ -0,0 +1,198 @@
+package partition
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+	"go.uber.org/zap"
+)
+
+const (
+	migrateInterval    = time.Second * 10         // 迁移任务的执行间隔
+	migrateBatchSize   = 500                      // 每批迁移的消息数量
+	migrateRoundLimit  = 20                       // 每次执行最多迁移的批数，避免长时间占用数据库
+	migrateLease       = time.Minute * 2          // 迁移任务的租期
+	migrateSwitchGrace = stateRefreshInterval * 6 // 开始迁移前等待各实例切换到新版本（之后旧表不再有新消息写入）
+)
+
+// Migrator 消息分表迁移，按主键顺序扫描旧表，把不属于当前表的消息分批移动到新版本对应的表
+type Migrator struct {
+	ctx     *config.Context
+	db      *DB
+	service *Service
+	log.Log
+	running int32
+}
+
+// NewMigrator 创建迁移任务
+func NewMigrator(ctx *config.Context) *Migrator {
+	return &Migrator{
+		ctx:     ctx,
+		db:      NewDB(ctx.DB()),
+		service: GetService(ctx),
+		Log:     log.NewTLog("MessagePartitionMigrator"),
+	}
+}
+
+// Start 开启定时迁移
+func (m *Migrator) Start() {
+	m.ctx.Schedule(migrateInterval, m.migrate)
+}
+
+func (m *Migrator) migrate() {
+	if !atomic.CompareAndSwapInt32(&m.running, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&m.running, 0)
+
+	state, err := m.service.loadState()
+	if err != nil {
+		m.Error("查询消息分表版本失败！", zap.Error(err))
+		return
+	}
+	target := state.Migrating
+	if target == nil {
+		return
+	}
+	now := time.Now()
+	if now.Unix()-target.StartedAt < int64(migrateSwitchGrace.Seconds()) {
+		return
+	}
+	ok, err := m.db.claim(target.Version, now.Unix(), now.Add(migrateLease).Unix())
+	if err != nil {
+		m.Error("领取消息分表迁移任务失败！", zap.Error(err), zap.Int("version", target.Version))
+		return
+	}
+	if !ok { // 其他实例正在迁移
+		return
+	}
+	defer func() {
+		if err := m.db.release(target.Version); err != nil {
+			m.Warn("释放消息分表迁移任务失败！", zap.Error(err), zap.Int("version", target.Version))
+		}
+	}()
+
+	progresses, err := m.db.queryProgress(target.Version)
+	if err != nil {
+		m.Error("查询消息分表迁移进度失败！", zap.Error(err), zap.Int("version", target.Version))
+		return
+	}
+	batches := 0
+	for _, progress := range progresses {
+		if progress.Status == ProgressStatusDone {
+			continue
+		}
+		for batches < migrateRoundLimit {
+			batches++
+			done, err := m.migrateBatch(target, progress)
+			if err != nil {
+				m.Error("迁移消息失败！", zap.Error(err), zap.Int("version", target.Version), zap.String("table", progress.TableName), zap.Int64("lastID", progress.LastID))
+				return
+			}
+			if done {
+				if err = m.db.finishProgress(target.Version, progress.TableName); err != nil {
+					m.Error("更新消息分表迁移进度失败！", zap.Error(err), zap.String("table", progress.TableName))
+					return
+				}
+				progress.Status = ProgressStatusDone
+				m.Info("消息表迁移完成", zap.Int("version", target.Version), zap.String("table", progress.TableName), zap.Int64("moved", progress.MovedCount))
+				break
+			}
+		}
+		if progress.Status != ProgressStatusDone {
+			return
+		}
+	}
+
+	err = m.finish(target)
+	if err != nil {
+		m.Error("完成消息分表迁移失败！", zap.Error(err), zap.Int("version", target.Version))
+		return
+	}
+	m.service.refreshState()
+	m.Info("消息分表迁移完成", zap.Int("version", target.Version), zap.Int("tableCount", target.TableCount))
+}
+
+// migrateBatch 迁移旧表的一批消息，旧表已扫描完返回true
+func (m *Migrator) migrateBatch(target *Model, progress *ProgressModel) (bool, error) {
+	rows, err := m.db.queryRows(progress.TableName, progress.LastID, migrateBatchSize)
+	if err != nil {
+		return false, err
+	}
+	if len(rows) == 0 {
+		return true, nil
+	}
+	lastID := rows[len(rows)-1].ID
+	moves := groupMoveRows(rows, progress.TableName, target.TableCount)
+	var columns []string
+	if len(moves) > 0 {
+		columns, err = m.db.queryColumns(progress.TableName)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	tx, err := m.ctx.DB().Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.RollbackUnlessCommitted()
+	var moved int64
+	for _, toTable := range sortedTables(moves) {
+		ids := moves[toTable]
+		err = m.db.moveTx(progress.TableName, toTable, columns, ids, tx)
+		if err != nil {
+			return false, err
+		}
+		moved += int64(len(ids))
+	}
+	err = m.db.updateProgressTx(target.Version, progress.TableName, lastID, moved, tx)
+	if err != nil {
+		return false, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+	progress.LastID = lastID
+	progress.MovedCount += moved
+	return false, nil
+}
+
+func (m *Migrator) finish(target *Model) error {
+	tx, err := m.ctx.DB().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.RollbackUnlessCommitted()
+	err = m.db.finishTx(target.Version, target.FromVersion, time.Now().Unix(), tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// groupMoveRows 按新版本的表对需要移动的消息分组（已经在正确表里的消息不移动）
+func groupMoveRows(rows []*rowModel, fromTable string, tableCount int) map[string][]int64 {
+	moves := make(map[string][]int64)
+	for _, row := range rows {
+		toTable := Table(tableCount, row.ChannelID)
+		if toTable == fromTable {
+			continue
+		}
+		moves[toTable] = append(moves[toTable], row.ID)
+	}
+	return moves
+}
+
+func sortedTables(moves map[string][]int64) []string {
+	tables := make([]string, 0, len(moves))
+	for table := range moves {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
@@ -0,0 +1,203 @@
+package partition
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sync"
+	"time"
+
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+	"go.uber.org/zap"
+)
+
+const (
+	// StatusMigrating 迁移中
+	StatusMigrating = 0
+	// StatusActive 使用中
+	StatusActive = 1
+	// StatusRetired 已废弃
+	StatusRetired = 2
+)
+
+const (
+	// ProgressStatusDoing 迁移中
+	ProgressStatusDoing = 0
+	// ProgressStatusDone 已完成
+	ProgressStatusDone = 1
+)
+
+const (
+	messageTableMaxCount = 256             // 消息表的最大数量
+	stateRefreshInterval = time.Second * 5 // 分表版本的缓存时间，多实例部署时各实例最多延迟这么久看到新版本
+	serviceValueKey      = "message_partition_service"
+)
+
+var serviceLock sync.Mutex
+
+// Service 消息分表路由
+// 迁移中时新消息写入新版本的表，读取时同时读新表和旧表（未迁移的消息还在旧表），迁移完成后只读新表
+type Service struct {
+	ctx *config.Context
+	db  *DB
+	log.Log
+
+	stateLock   sync.RWMutex
+	state       *State
+	refreshedAt time.Time
+}
+
+// GetService 获取消息分表服务（同一个ctx共用一个，共享分表版本缓存）
+func GetService(ctx *config.Context) *Service {
+	serviceLock.Lock()
+	defer serviceLock.Unlock()
+	if s, ok := ctx.Value(serviceValueKey).(*Service); ok {
+		return s
+	}
+	s := &Service{
+		ctx: ctx,
+		db:  NewDB(ctx.DB()),
+		Log: log.NewTLog("MessagePartition"),
+	}
+	ctx.SetValue(s, serviceValueKey)
+	return s
+}
+
+// State 当前的分表版本
+type State struct {
+	Active    *Model // 使用中的版本
+	Migrating *Model // 迁移中的版本（没有迁移时为nil）
+}
+
+// Table 根据消息表数量和频道ID获取消息表
+func Table(tableCount int, channelID string) string {
+	if tableCount <= 0 {
+		tableCount = 1
+	}
+	tableIndex := crc32.ChecksumIEEE([]byte(channelID)) % uint32(tableCount)
+	return tableName(int(tableIndex))
+}
+
+func tableName(tableIndex int) string {
+	if tableIndex == 0 {
+		return "message"
+	}
+	return fmt.Sprintf("message%d", tableIndex)
+}
+
+// WriteTable 新消息写入的表
+func (s *Service) WriteTable(channelID string) string {
+	return s.GetState().writeTable(channelID)
+}
+
+// ReadTables 读取消息时需要查询的表（迁移中时先返回旧表再返回新表）
+// 迁移在一个事务里把消息从旧表移到新表，先查旧表再查新表，消息在两次查询之间被移走时也能在新表里查到
+func (s *Service) ReadTables(channelID string) []string {
+	return s.GetState().readTables(channelID)
+}
+
+func (st *State) writeTable(channelID string) string {
+	if st.Migrating != nil {
+		return Table(st.Migrating.TableCount, channelID)
+	}
+	return Table(st.Active.TableCount, channelID)
+}
+
+func (st *State) readTables(channelID string) []string {
+	newTable := st.writeTable(channelID)
+	if st.Migrating != nil {
+		oldTable := Table(st.Active.TableCount, channelID)
+		if oldTable != newTable {
+			return []string{oldTable, newTable}
+		}
+	}
+	return []string{newTable}
+}
+
+// GetState 获取当前的分表版本（带缓存，查询失败时使用上一次的结果）
+func (s *Service) GetState() *State {
+	s.stateLock.RLock()
+	state := s.state
+	refreshedAt := s.refreshedAt
+	s.stateLock.RUnlock()
+	if state != nil && time.Since(refreshedAt) < stateRefreshInterval {
+		return state
+	}
+
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+	if s.state != nil && time.Since(s.refreshedAt) < stateRefreshInterval {
+		return s.state
+	}
+	newState, err := s.loadState()
+	if err != nil {
+		s.Error("查询消息分表版本失败！", zap.Error(err))
+		if s.state == nil {
+			s.state = s.defaultState()
+		}
+		s.refreshedAt = time.Now() // 避免数据库异常时每次请求都去查询
+		return s.state
+	}
+	s.state = newState
+	s.refreshedAt = time.Now()
+	return s.state
+}
+
+// refreshState 立即重新加载分表版本
+func (s *Service) refreshState() {
+	s.stateLock.Lock()
+	s.refreshedAt = time.Time{}
+	s.stateLock.Unlock()
+	s.GetState()
+}
+
+func (s *Service) loadState() (*State, error) {
+	models, err := s.db.queryUnretired()
+	if err != nil {
+		return nil, err
+	}
+	if len(models) == 0 {
+		// 第一次使用时以配置的消息表数量作为第一个版本
+		err = s.db.insertIfNotExist(&Model{
+			Version:    1,
+			TableCount: s.ctx.GetConfig().TablePartitionConfig.MessageTableCount,
+			Status:     StatusActive,
+		})
+		if err != nil {
+			return nil, err
+		}
+		models, err = s.db.queryUnretired()
+		if err != nil {
+			return nil, err
+		}
+	}
+	state := newState(models)
+	if state.Active == nil {
+		return nil, errors.New("消息分表版本不存在")
+	}
+	return state, nil
+}
+
+func newState(models []*Model) *State {
+	state := &State{}
+	for _, model := range models {
+		switch model.Status {
+		case StatusActive:
+			state.Active = model
+		case StatusMigrating:
+			state.Migrating = model
+		}
+	}
+	return state
+}
+
+func (s *Service) defaultState() *State {
+	return &State{
+		Active: &Model{
+			Version:    0,
+			TableCount: s.ctx.GetConfig().TablePartitionConfig.MessageTableCount,
+			Status:     StatusActive,
+		},
+	}
+}
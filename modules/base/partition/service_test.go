@@ -0,0 +1,94 @@
+package partition
+
+import (
+	"fmt"
+	"hash/crc32"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTable(t *testing.T) {
+	// 和原来按crc32取模的分表规则保持一致
+	for i := 0; i < 100; i++ {
+		channelID := fmt.Sprintf("channel%d", i)
+		index := crc32.ChecksumIEEE([]byte(channelID)) % 5
+		expected := "message"
+		if index != 0 {
+			expected = fmt.Sprintf("message%d", index)
+		}
+		assert.Equal(t, expected, Table(5, channelID))
+	}
+	assert.Equal(t, "message", Table(1, "channel1"))
+	assert.Equal(t, "message", Table(0, "channel1"))
+}
+
+func TestStateTables(t *testing.T) {
+	moved, stayed := "", ""
+	for i := 0; i < 100 && (moved == "" || stayed == ""); i++ {
+		channelID := fmt.Sprintf("channel%d", i)
+		if Table(5, channelID) != Table(8, channelID) {
+			moved = channelID
+		} else {
+			stayed = channelID
+		}
+	}
+
+	state := &State{Active: &Model{Version: 1, TableCount: 5, Status: StatusActive}}
+	assert.Equal(t, Table(5, moved), state.writeTable(moved))
+	assert.Equal(t, []string{Table(5, moved)}, state.readTables(moved))
+
+	// 迁移中：写新表，先读旧表再读新表
+	state.Migrating = &Model{Version: 2, TableCount: 8, Status: StatusMigrating, FromVersion: 1}
+	assert.Equal(t, Table(8, moved), state.writeTable(moved))
+	assert.Equal(t, []string{Table(5, moved), Table(8, moved)}, state.readTables(moved))
+	assert.Equal(t, []string{Table(8, stayed)}, state.readTables(stayed))
+
+	state = newState([]*Model{
+		{Version: 1, TableCount: 5, Status: StatusActive},
+		{Version: 2, TableCount: 8, Status: StatusMigrating},
+	})
+	assert.Equal(t, 1, state.Active.Version)
+	assert.Equal(t, 2, state.Migrating.Version)
+}
+
+func TestGroupMoveRows(t *testing.T) {
+	rows := make([]*rowModel, 0)
+	for i := 0; i < 50; i++ {
+		rows = append(rows, &rowModel{ID: int64(i + 1), ChannelID: fmt.Sprintf("channel%d", i)})
+	}
+	fromTable := "message"
+	moves := groupMoveRows(rows, fromTable, 8)
+	count := 0
+	for toTable, ids := range moves {
+		assert.NotEqual(t, fromTable, toTable)
+		for _, id := range ids {
+			assert.Equal(t, toTable, Table(8, rows[id-1].ChannelID))
+		}
+		count += len(ids)
+	}
+	stayed := 0
+	for _, row := range rows {
+		if Table(8, row.ChannelID) == fromTable {
+			stayed++
+		}
+	}
+	assert.Equal(t, len(rows), count+stayed)
+	assert.Len(t, groupMoveRows(nil, fromTable, 8), 0)
+}
+
+func TestProgressPercent(t *testing.T) {
+	assert.Equal(t, float64(0), progressPercent([]*ProgressModel{{MaxID: 0}}))
+	assert.Equal(t, float64(100), progressPercent([]*ProgressModel{{MaxID: 0, Status: ProgressStatusDone}}))
+	assert.Equal(t, float64(25), progressPercent([]*ProgressModel{
+		{MaxID: 100, LastID: 50},
+		{MaxID: 100, LastID: 0},
+	}))
+	assert.Equal(t, float64(75), progressPercent([]*ProgressModel{
+		{MaxID: 100, LastID: 100, Status: ProgressStatusDone},
+		{MaxID: 100, LastID: 50},
+	}))
+	// 开始迁移后旧表还有新写入的消息，没扫描完不能显示100
+	assert.Equal(t, 99.99, progressPercent([]*ProgressModel{{MaxID: 100, LastID: 120}}))
+	assert.Equal(t, float64(100), progressPercent([]*ProgressModel{{MaxID: 100, LastID: 120, Status: ProgressStatusDone}}))
+}
@@ -0,0 +1,8 @@
+-- +migrate Up
+
+ALTER TABLE `event` ADD COLUMN attempt integer not null DEFAULT 0 COMMENT '已执行失败的次数';
+ALTER TABLE `event` ADD COLUMN next_retry_at BIGINT not null DEFAULT 0 COMMENT '下次重试时间（秒级时间戳）';
+CREATE INDEX event_status_retry on `event` (status, next_retry_at);
+
+-- 历史发布失败的事件不再自动重试，转为死信由管理员确认后重新投递
+UPDATE `event` SET status=3 WHERE status=2;
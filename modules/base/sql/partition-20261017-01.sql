@@ -0,0 +1,33 @@
+-- +migrate Up
+
+-- 消息分表版本（同一时间最多一个使用中和一个迁移中的版本）
+create table `message_partition`
+(
+  id             bigint        not null primary key AUTO_INCREMENT,
+  version        integer       not null default 0,  -- 分表版本
+  table_count    integer       not null default 0,  -- 消息表数量
+  status         smallint      not null default 0,  -- 状态 0.迁移中 1.使用中 2.已废弃
+  from_version   integer       not null default 0,  -- 从哪个版本迁移过来
+  migrated_count bigint        not null default 0,  -- 已迁移的消息数量
+  lease_until    bigint        not null default 0,  -- 迁移任务租期（秒级时间戳），防止多个实例同时迁移
+  started_at     bigint        not null default 0,  -- 开始迁移时间（秒级时间戳）
+  finished_at    bigint        not null default 0,  -- 迁移完成时间（秒级时间戳）
+  created_at     timeStamp     not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at     timeStamp     not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX message_partition_version on `message_partition` (version);
+
+-- 消息分表迁移进度（每个旧表一条，按主键顺序扫描）
+create table `message_partition_progress`
+(
+  id             bigint        not null primary key AUTO_INCREMENT,
+  version        integer       not null default 0,  -- 迁移的目标版本
+  table_name     VARCHAR(40)   not null default '', -- 旧消息表
+  last_id        bigint        not null default 0,  -- 已扫描到的主键
+  max_id         bigint        not null default 0,  -- 开始迁移时的最大主键（用于计算进度）
+  moved_count    bigint        not null default 0,  -- 已迁移到新表的消息数量
+  status         smallint      not null default 0,  -- 状态 0.迁移中 1.已完成
+  created_at     timeStamp     not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at     timeStamp     not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX message_partition_progress_table on `message_partition_progress` (version, table_name);
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -246,6 +247,18 @@ func (cn *Common) insertAppConfigIfNeed() (*appConfigModel, error) {
 		return nil, err
 	}
 	if appConfigM != nil {
+		if appConfigM.FileSignSecret == "" { // 老版本升级上来的没有文件签名密钥
+			appConfigM.FileSignSecret, err = newFileSignSecret()
+			if err != nil {
+				return nil, err
+			}
+			err = cn.appConfigDB.updateWithMap(map[string]interface{}{
+				"file_sign_secret": appConfigM.FileSignSecret,
+			}, appConfigM.Id)
+			if err != nil {
+				return nil, err
+			}
+		}
 		return (*appConfigModel)(appConfigM), nil
 	}
 
@@ -282,18 +295,33 @@ func (cn *Common) insertAppConfigIfNeed() (*appConfigModel, error) {
 		return nil, err
 	}
 
+	fileSignSecret, err := newFileSignSecret()
+	if err != nil {
+		return nil, err
+	}
 	appConfigM = &appConfigModel{
-		RSAPrivateKey: privateKeyBuff.String(),
-		RSAPublicKey:  publicKeyBuff.String(),
-		Version:       1,
-		SuperToken:    util.GenerUUID(),
-		SuperTokenOn:  0,
-		SearchByPhone: 1,
+		RSAPrivateKey:  privateKeyBuff.String(),
+		RSAPublicKey:   publicKeyBuff.String(),
+		Version:        1,
+		SuperToken:     util.GenerUUID(),
+		SuperTokenOn:   0,
+		SearchByPhone:  1,
+		FileSignSecret: fileSignSecret,
 	}
 	err = cn.appConfigDB.insert(appConfigM)
 	return appConfigM, err
 }
 
+// newFileSignSecret 生成文件访问地址签名密钥
+func newFileSignSecret() (string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
 func (cn *Common) appConfig(c *wkhttp.Context) {
 	versionStr := c.Query("version")
 	appConfigM, err := cn.appConfigDB.Query()
@@ -6,10 +6,23 @@ import (
 
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/register"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
 	"go.uber.org/zap"
 )
 
+const (
+	// appConfigSecretMask 返回给后台的脱敏密钥
+	appConfigSecretMask = "******"
+	// smsServiceName 短信模块注册的名称
+	smsServiceName = "sms"
+)
+
+// smsRoutesValidator 短信路由校验（短信服务在base模块，通过模块注册获取，避免循环引用）
+type smsRoutesValidator interface {
+	ValidateRoutes(routes string) error
+}
+
 // Manager 通用后台管理api
 type Manager struct {
 	ctx *config.Context
@@ -214,12 +227,60 @@ func (m *Manager) updateConfig(c *wkhttp.Context) {
 		WssAddrJw                      string `json:"wss_addr_jw"`                         // 是否可以修改api地址
 		SocketAddr                     string `json:"socket_addr"`                         // 是否可以修改api地址
 		SocketAddrJw                   string `json:"socket_addr_jw"`                      // 是否可以修改api地址
+		RobotCreateOn                  int    `json:"robot_create_on"`                     // 是否允许用户自助创建机器人
+		RobotCreateApprovalOn          int    `json:"robot_create_approval_on"`            // 用户创建的机器人是否需要管理员审核
+		RobotMaxCountPerUser           int    `json:"robot_max_count_per_user"`            // 每个用户最多可创建的机器人数量
+		SMSCodeLength                  int    `json:"sms_code_length"`                     // 短信验证码长度
+		SMSSendInterval                int    `json:"sms_send_interval"`                   // 同一手机号发送短信验证码的间隔（秒）
+		SMSPhoneDayLimit               int    `json:"sms_phone_day_limit"`                 // 同一手机号每天最多发送的短信验证码数量
+		SMSIPHourLimit                 int    `json:"sms_ip_hour_limit"`                   // 同一IP每小时最多发送的短信验证码数量
+		SMSVerifyMaxFail               int    `json:"sms_verify_max_fail"`                 // 每个短信验证码最多可校验失败的次数
+		SMSRoutes                      string `json:"sms_routes"`                          // 短信路由
+		SMSWebhookURL                  string `json:"sms_webhook_url"`                     // webhook短信服务商推送验证码的地址
+		SMSWebhookSecret               string `json:"sms_webhook_secret"`                  // webhook短信服务商的签名密钥
+		LoginRiskOn                    int    `json:"login_risk_on"`                       // 是否开启异常登录检测
+		LoginRiskNewRegionAction       int    `json:"login_risk_new_region_action"`        // 新地区登录的处理方式
+		LoginRiskTravelAction          int    `json:"login_risk_travel_action"`            // 不可能的移动速度登录的处理方式
+		LoginRiskFailAction            int    `json:"login_risk_fail_action"`              // 多次密码错误后登录的处理方式
+		LoginRiskFailCount             int    `json:"login_risk_fail_count"`               // 一小时内密码错误多少次后视为异常登录
+		LoginRiskBlockMinutes          int    `json:"login_risk_block_minutes"`            // 暂时禁止登录的时长（分钟）
+		LoginLockCaptchaCount          int    `json:"login_lock_captcha_count"`            // 账号或IP密码错误多少次后要求图形验证码
+		LoginLockAccountCount          int    `json:"login_lock_account_count"`            // 同一账号密码错误多少次后暂时锁定
+		LoginLockIPCount               int    `json:"login_lock_ip_count"`                 // 同一IP密码错误多少次后暂时锁定
+		LoginLockMinutes               int    `json:"login_lock_minutes"`                  // 登录锁定时长（分钟）
+		IMCallbackSecret               string `json:"im_callback_secret"`                  // IM回调签名密钥（为空不校验签名）
+		IMCallbackAllowIPs             string `json:"im_callback_allow_ips"`               // IM回调允许的来源IP，多个用逗号分隔，支持CIDR（为空不限制）
+		IMCallbackMaxSkew              int    `json:"im_callback_max_skew"`                // IM回调签名时间戳允许的误差（秒）
+		GRPCToken                      string `json:"grpc_token"`                          // grpc webhook服务的访问令牌（为空不校验）
+		GRPCCertFile                   string `json:"grpc_cert_file"`                      // grpc webhook服务的TLS证书文件
+		GRPCKeyFile                    string `json:"grpc_key_file"`                       // grpc webhook服务的TLS私钥文件
+		RobotWebhookAllowIPs           string `json:"robot_webhook_allow_ips"`             // 机器人webhook允许推送的内网地址，多个用逗号分隔，支持CIDR（为空只允许公网地址）
+		RobotWebhookAllowHTTP          int    `json:"robot_webhook_allow_http"`            // 机器人webhook是否允许http地址
 	}
 	var req reqVO
 	if err := c.BindJSON(&req); err != nil {
 		c.ResponseError(errors.New("请求数据格式有误！"))
 		return
 	}
+	if _, err := ParseAllowIPs(req.IMCallbackAllowIPs); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if _, err := ParseAllowIPs(req.RobotWebhookAllowIPs); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if strings.TrimSpace(req.SMSRoutes) != "" {
+		validator, ok := register.GetService(smsServiceName).(smsRoutesValidator)
+		if !ok {
+			c.ResponseError(errors.New("短信服务不存在，无法配置短信路由！"))
+			return
+		}
+		if err := validator.ValidateRoutes(req.SMSRoutes); err != nil {
+			c.ResponseError(err)
+			return
+		}
+	}
 	appConfigM, err := m.appconfigDB.Query()
 	if err != nil {
 		m.Error("查询应用配置失败！", zap.Error(err))
@@ -247,6 +308,45 @@ func (m *Manager) updateConfig(c *wkhttp.Context) {
 	configMap["wss_addr_jw"] = req.WssAddrJw
 	configMap["socket_addr"] = req.SocketAddr
 	configMap["socket_addr_jw"] = req.SocketAddrJw
+	configMap["robot_create_on"] = req.RobotCreateOn
+	configMap["robot_create_approval_on"] = req.RobotCreateApprovalOn
+	configMap["robot_max_count_per_user"] = req.RobotMaxCountPerUser
+	configMap["sms_code_length"] = req.SMSCodeLength
+	configMap["sms_send_interval"] = req.SMSSendInterval
+	configMap["sms_phone_day_limit"] = req.SMSPhoneDayLimit
+	configMap["sms_ip_hour_limit"] = req.SMSIPHourLimit
+	configMap["sms_verify_max_fail"] = req.SMSVerifyMaxFail
+	configMap["sms_routes"] = strings.TrimSpace(req.SMSRoutes)
+	configMap["sms_webhook_url"] = strings.TrimSpace(req.SMSWebhookURL)
+	configMap["login_risk_on"] = req.LoginRiskOn
+	configMap["login_risk_new_region_action"] = req.LoginRiskNewRegionAction
+	configMap["login_risk_travel_action"] = req.LoginRiskTravelAction
+	configMap["login_risk_fail_action"] = req.LoginRiskFailAction
+	configMap["login_risk_fail_count"] = req.LoginRiskFailCount
+	configMap["login_risk_block_minutes"] = req.LoginRiskBlockMinutes
+	configMap["login_lock_captcha_count"] = req.LoginLockCaptchaCount
+	configMap["login_lock_account_count"] = req.LoginLockAccountCount
+	configMap["login_lock_ip_count"] = req.LoginLockIPCount
+	configMap["login_lock_minutes"] = req.LoginLockMinutes
+	// 密钥返回给后台时已脱敏，为空或未修改脱敏值表示保持原来的值
+	if keepAppConfigSecret(req.IMCallbackSecret) {
+		req.IMCallbackSecret = appConfigM.ImCallbackSecret
+	}
+	if keepAppConfigSecret(req.GRPCToken) {
+		req.GRPCToken = appConfigM.GrpcToken
+	}
+	if keepAppConfigSecret(req.SMSWebhookSecret) {
+		req.SMSWebhookSecret = appConfigM.SmsWebhookSecret
+	}
+	configMap["sms_webhook_secret"] = req.SMSWebhookSecret
+	configMap["im_callback_secret"] = req.IMCallbackSecret
+	configMap["im_callback_allow_ips"] = strings.TrimSpace(req.IMCallbackAllowIPs)
+	configMap["im_callback_max_skew"] = req.IMCallbackMaxSkew
+	configMap["grpc_token"] = strings.TrimSpace(req.GRPCToken)
+	configMap["grpc_cert_file"] = req.GRPCCertFile
+	configMap["grpc_key_file"] = req.GRPCKeyFile
+	configMap["robot_webhook_allow_ips"] = strings.TrimSpace(req.RobotWebhookAllowIPs)
+	configMap["robot_webhook_allow_http"] = req.RobotWebhookAllowHTTP
 
 	err = m.appconfigDB.updateWithMap(configMap, appConfigM.Id)
 	if err != nil {
@@ -288,6 +388,35 @@ func (m *Manager) appconfig(c *wkhttp.Context) {
 	var wss_addr_jw = ""
 	var socket_addr = ""
 	var socket_addr_jw = ""
+	var robotCreateOn = 1
+	var robotCreateApprovalOn = 0
+	var robotMaxCountPerUser = 5
+	var smsCodeLength = 6
+	var smsSendInterval = 60
+	var smsPhoneDayLimit = 10
+	var smsIPHourLimit = 20
+	var smsVerifyMaxFail = 5
+	var smsRoutes = ""
+	var smsWebhookURL = ""
+	var smsWebhookSecret = ""
+	var loginRiskOn = 0
+	var loginRiskNewRegionAction = 1
+	var loginRiskTravelAction = 2
+	var loginRiskFailAction = 2
+	var loginRiskFailCount = 5
+	var loginRiskBlockMinutes = 30
+	var loginLockCaptchaCount = 3
+	var loginLockAccountCount = 10
+	var loginLockIPCount = 50
+	var loginLockMinutes = 15
+	var imCallbackSecret = ""
+	var imCallbackAllowIPs = ""
+	var imCallbackMaxSkew = 300
+	var grpcToken = ""
+	var grpcCertFile = ""
+	var grpcKeyFile = ""
+	var robotWebhookAllowIPs = ""
+	var robotWebhookAllowHTTP = 0
 
 	if appconfig != nil {
 		revokeSecond = appconfig.RevokeSecond
@@ -310,6 +439,35 @@ func (m *Manager) appconfig(c *wkhttp.Context) {
 		wss_addr_jw = appconfig.WssAddrJw
 		socket_addr = appconfig.SocketAddr
 		socket_addr_jw = appconfig.SocketAddrJw
+		robotCreateOn = appconfig.RobotCreateOn
+		robotCreateApprovalOn = appconfig.RobotCreateApprovalOn
+		robotMaxCountPerUser = appconfig.RobotMaxCountPerUser
+		smsCodeLength = appconfig.SmsCodeLength
+		smsSendInterval = appconfig.SmsSendInterval
+		smsPhoneDayLimit = appconfig.SmsPhoneDayLimit
+		smsIPHourLimit = appconfig.SmsIpHourLimit
+		smsVerifyMaxFail = appconfig.SmsVerifyMaxFail
+		smsRoutes = appconfig.SmsRoutes
+		smsWebhookURL = appconfig.SmsWebhookUrl
+		smsWebhookSecret = appconfig.SmsWebhookSecret
+		loginRiskOn = appconfig.LoginRiskOn
+		loginRiskNewRegionAction = appconfig.LoginRiskNewRegionAction
+		loginRiskTravelAction = appconfig.LoginRiskTravelAction
+		loginRiskFailAction = appconfig.LoginRiskFailAction
+		loginRiskFailCount = appconfig.LoginRiskFailCount
+		loginRiskBlockMinutes = appconfig.LoginRiskBlockMinutes
+		loginLockCaptchaCount = appconfig.LoginLockCaptchaCount
+		loginLockAccountCount = appconfig.LoginLockAccountCount
+		loginLockIPCount = appconfig.LoginLockIpCount
+		loginLockMinutes = appconfig.LoginLockMinutes
+		imCallbackSecret = appconfig.ImCallbackSecret
+		imCallbackAllowIPs = appconfig.ImCallbackAllowIps
+		imCallbackMaxSkew = appconfig.ImCallbackMaxSkew
+		grpcToken = appconfig.GrpcToken
+		grpcCertFile = appconfig.GrpcCertFile
+		grpcKeyFile = appconfig.GrpcKeyFile
+		robotWebhookAllowIPs = appconfig.RobotWebhookAllowIps
+		robotWebhookAllowHTTP = appconfig.RobotWebhookAllowHttp
 	}
 	if revokeSecond == 0 {
 		revokeSecond = 120
@@ -338,9 +496,51 @@ func (m *Manager) appconfig(c *wkhttp.Context) {
 		WssAddrJw:                      wss_addr_jw,
 		SocketAddr:                     socket_addr,
 		SocketAddrJw:                   socket_addr_jw,
+		RobotCreateOn:                  robotCreateOn,
+		RobotCreateApprovalOn:          robotCreateApprovalOn,
+		RobotMaxCountPerUser:           robotMaxCountPerUser,
+		SMSCodeLength:                  smsCodeLength,
+		SMSSendInterval:                smsSendInterval,
+		SMSPhoneDayLimit:               smsPhoneDayLimit,
+		SMSIPHourLimit:                 smsIPHourLimit,
+		SMSVerifyMaxFail:               smsVerifyMaxFail,
+		SMSRoutes:                      smsRoutes,
+		SMSWebhookURL:                  smsWebhookURL,
+		SMSWebhookSecret:               maskAppConfigSecret(smsWebhookSecret),
+		LoginRiskOn:                    loginRiskOn,
+		LoginRiskNewRegionAction:       loginRiskNewRegionAction,
+		LoginRiskTravelAction:          loginRiskTravelAction,
+		LoginRiskFailAction:            loginRiskFailAction,
+		LoginRiskFailCount:             loginRiskFailCount,
+		LoginRiskBlockMinutes:          loginRiskBlockMinutes,
+		LoginLockCaptchaCount:          loginLockCaptchaCount,
+		LoginLockAccountCount:          loginLockAccountCount,
+		LoginLockIPCount:               loginLockIPCount,
+		LoginLockMinutes:               loginLockMinutes,
+		IMCallbackSecret:               maskAppConfigSecret(imCallbackSecret),
+		IMCallbackAllowIPs:             imCallbackAllowIPs,
+		IMCallbackMaxSkew:              imCallbackMaxSkew,
+		GRPCToken:                      maskAppConfigSecret(grpcToken),
+		GRPCCertFile:                   grpcCertFile,
+		GRPCKeyFile:                    grpcKeyFile,
+		RobotWebhookAllowIPs:           robotWebhookAllowIPs,
+		RobotWebhookAllowHTTP:          robotWebhookAllowHTTP,
 	})
 }
 
+// maskAppConfigSecret 密钥不返回明文，只告诉后台是否已设置
+func maskAppConfigSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return appConfigSecretMask
+}
+
+// keepAppConfigSecret 修改配置时密钥为空或者是脱敏值表示不修改
+func keepAppConfigSecret(secret string) bool {
+	return secret == "" || secret == appConfigSecretMask
+}
+
 type managerAppConfigResp struct {
 	RevokeSecond                   int    `json:"revoke_second"`
 	WelcomeMessage                 string `json:"welcome_message"`
@@ -362,6 +562,35 @@ type managerAppConfigResp struct {
 	WssAddrJw                      string `json:"wss_addr_jw"`
 	SocketAddr                     string `json:"socket_addr"`
 	SocketAddrJw                   string `json:"socket_addr_jw"`
+	RobotCreateOn                  int    `json:"robot_create_on"`              // 是否允许用户自助创建机器人
+	RobotCreateApprovalOn          int    `json:"robot_create_approval_on"`     // 用户创建的机器人是否需要管理员审核
+	RobotMaxCountPerUser           int    `json:"robot_max_count_per_user"`     // 每个用户最多可创建的机器人数量
+	SMSCodeLength                  int    `json:"sms_code_length"`              // 短信验证码长度
+	SMSSendInterval                int    `json:"sms_send_interval"`            // 同一手机号发送短信验证码的间隔（秒）
+	SMSPhoneDayLimit               int    `json:"sms_phone_day_limit"`          // 同一手机号每天最多发送的短信验证码数量
+	SMSIPHourLimit                 int    `json:"sms_ip_hour_limit"`            // 同一IP每小时最多发送的短信验证码数量
+	SMSVerifyMaxFail               int    `json:"sms_verify_max_fail"`          // 每个短信验证码最多可校验失败的次数
+	SMSRoutes                      string `json:"sms_routes"`                   // 短信路由
+	SMSWebhookURL                  string `json:"sms_webhook_url"`              // webhook短信服务商推送验证码的地址
+	SMSWebhookSecret               string `json:"sms_webhook_secret"`           // webhook短信服务商的签名密钥
+	LoginRiskOn                    int    `json:"login_risk_on"`                // 是否开启异常登录检测
+	LoginRiskNewRegionAction       int    `json:"login_risk_new_region_action"` // 新地区登录的处理方式
+	LoginRiskTravelAction          int    `json:"login_risk_travel_action"`     // 不可能的移动速度登录的处理方式
+	LoginRiskFailAction            int    `json:"login_risk_fail_action"`       // 多次密码错误后登录的处理方式
+	LoginRiskFailCount             int    `json:"login_risk_fail_count"`        // 一小时内密码错误多少次后视为异常登录
+	LoginRiskBlockMinutes          int    `json:"login_risk_block_minutes"`     // 暂时禁止登录的时长（分钟）
+	LoginLockCaptchaCount          int    `json:"login_lock_captcha_count"`     // 账号或IP密码错误多少次后要求图形验证码
+	LoginLockAccountCount          int    `json:"login_lock_account_count"`     // 同一账号密码错误多少次后暂时锁定
+	LoginLockIPCount               int    `json:"login_lock_ip_count"`          // 同一IP密码错误多少次后暂时锁定
+	LoginLockMinutes               int    `json:"login_lock_minutes"`           // 登录锁定时长（分钟）
+	IMCallbackSecret               string `json:"im_callback_secret"`           // IM回调签名密钥（为空不校验签名）
+	IMCallbackAllowIPs             string `json:"im_callback_allow_ips"`        // IM回调允许的来源IP，多个用逗号分隔，支持CIDR（为空不限制）
+	IMCallbackMaxSkew              int    `json:"im_callback_max_skew"`         // IM回调签名时间戳允许的误差（秒）
+	GRPCToken                      string `json:"grpc_token"`                   // grpc webhook服务的访问令牌（为空不校验）
+	GRPCCertFile                   string `json:"grpc_cert_file"`               // grpc webhook服务的TLS证书文件
+	GRPCKeyFile                    string `json:"grpc_key_file"`                // grpc webhook服务的TLS私钥文件
+	RobotWebhookAllowIPs           string `json:"robot_webhook_allow_ips"`      // 机器人webhook允许推送的内网地址，多个用逗号分隔，支持CIDR（为空只允许公网地址）
+	RobotWebhookAllowHTTP          int    `json:"robot_webhook_allow_http"`     // 机器人webhook是否允许http地址
 }
 
 type managerAppModule struct {
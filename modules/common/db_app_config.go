@@ -51,6 +51,36 @@ type appConfigModel struct {
 	RegisterUserMustCompleteInfoOn int    // 注册用户是否必须完善个人信息
 	ChannelPinnedMessageMaxCount   int    // 频道置顶消息最大数量
 	CanModifyApiUrl                int    // 是否可以修改API地址
+	RobotCreateOn                  int    // 是否允许用户自助创建机器人
+	RobotCreateApprovalOn          int    // 用户创建的机器人是否需要管理员审核
+	RobotMaxCountPerUser           int    // 每个用户最多可创建的机器人数量
+	SmsCodeLength                  int    // 短信验证码长度
+	SmsSendInterval                int    // 同一手机号发送短信验证码的间隔（秒）
+	SmsPhoneDayLimit               int    // 同一手机号每天最多发送的短信验证码数量
+	SmsIpHourLimit                 int    // 同一IP每小时最多发送的短信验证码数量
+	SmsVerifyMaxFail               int    // 每个短信验证码最多可校验失败的次数
+	SmsRoutes                      string // 短信路由
+	SmsWebhookUrl                  string // webhook短信服务商推送验证码的地址
+	SmsWebhookSecret               string // webhook短信服务商的签名密钥
+	LoginRiskOn                    int    // 是否开启异常登录检测
+	LoginRiskNewRegionAction       int    // 新地区登录的处理方式
+	LoginRiskTravelAction          int    // 不可能的移动速度登录的处理方式
+	LoginRiskFailAction            int    // 多次密码错误后登录的处理方式
+	LoginRiskFailCount             int    // 一小时内密码错误多少次后视为异常登录
+	LoginRiskBlockMinutes          int    // 暂时禁止登录的时长（分钟）
+	LoginLockCaptchaCount          int    // 账号或IP密码错误多少次后要求图形验证码
+	LoginLockAccountCount          int    // 同一账号密码错误多少次后暂时锁定
+	LoginLockIpCount               int    // 同一IP密码错误多少次后暂时锁定
+	LoginLockMinutes               int    // 登录锁定时长（分钟）
+	FileSignSecret                 string // 文件访问地址签名密钥
+	ImCallbackSecret               string // IM回调签名密钥（为空不校验签名）
+	ImCallbackAllowIps             string // IM回调允许的来源IP，多个用逗号分隔，支持CIDR（为空不限制）
+	ImCallbackMaxSkew              int    // IM回调签名时间戳允许的误差（秒）
+	GrpcToken                      string // grpc webhook服务的访问令牌（为空不校验）
+	GrpcCertFile                   string // grpc webhook服务的TLS证书文件
+	GrpcKeyFile                    string // grpc webhook服务的TLS私钥文件
+	RobotWebhookAllowIps           string // 机器人webhook允许推送的内网地址，多个用逗号分隔，支持CIDR（为空只允许公网地址）
+	RobotWebhookAllowHttp          int    // 机器人webhook是否允许http地址
 	ApiAddr                        string
 	ApiAddrJw                      string
 	WebAddr                        string
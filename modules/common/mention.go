@@ -0,0 +1,24 @@
+package common
+
+import "encoding/json"
+
+// GetMention 获取消息payload中的@信息（all为1表示@所有人）
+func GetMention(payloadMap map[string]interface{}) (all bool, uids []string) {
+	mentionMap, ok := payloadMap["mention"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if allNum, ok := mentionMap["all"].(json.Number); ok {
+		allI, _ := allNum.Int64()
+		all = allI == 1
+	}
+	if uidObjs, ok := mentionMap["uids"].([]interface{}); ok {
+		uids = make([]string, 0, len(uidObjs))
+		for _, uidObj := range uidObjs {
+			if uid, ok := uidObj.(string); ok {
+				uids = append(uids, uid)
+			}
+		}
+	}
+	return
+}
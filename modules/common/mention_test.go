@@ -0,0 +1,23 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMention(t *testing.T) {
+	all, uids := GetMention(map[string]interface{}{
+		"mention": map[string]interface{}{
+			"all":  json.Number("1"),
+			"uids": []interface{}{"u1", 2},
+		},
+	})
+	assert.True(t, all)
+	assert.Equal(t, []string{"u1"}, uids)
+
+	all, uids = GetMention(map[string]interface{}{"mention": "bad"})
+	assert.False(t, all)
+	assert.Len(t, uids, 0)
+}
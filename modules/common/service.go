@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"net"
+	"strings"
 	"sync"
 	"time"
 
@@ -67,6 +69,36 @@ func (s *service) GetAppConfig() (*AppConfigResp, error) {
 		InviteSystemAccountJoinGroupOn: appConfigM.InviteSystemAccountJoinGroupOn,
 		RegisterUserMustCompleteInfoOn: appConfigM.RegisterUserMustCompleteInfoOn,
 		ChannelPinnedMessageMaxCount:   appConfigM.ChannelPinnedMessageMaxCount,
+		RobotCreateOn:                  appConfigM.RobotCreateOn,
+		RobotCreateApprovalOn:          appConfigM.RobotCreateApprovalOn,
+		RobotMaxCountPerUser:           appConfigM.RobotMaxCountPerUser,
+		SMSCodeLength:                  appConfigM.SmsCodeLength,
+		SMSSendInterval:                appConfigM.SmsSendInterval,
+		SMSPhoneDayLimit:               appConfigM.SmsPhoneDayLimit,
+		SMSIPHourLimit:                 appConfigM.SmsIpHourLimit,
+		SMSVerifyMaxFail:               appConfigM.SmsVerifyMaxFail,
+		SMSRoutes:                      appConfigM.SmsRoutes,
+		SMSWebhookURL:                  appConfigM.SmsWebhookUrl,
+		SMSWebhookSecret:               appConfigM.SmsWebhookSecret,
+		LoginRiskOn:                    appConfigM.LoginRiskOn,
+		LoginRiskNewRegionAction:       appConfigM.LoginRiskNewRegionAction,
+		LoginRiskTravelAction:          appConfigM.LoginRiskTravelAction,
+		LoginRiskFailAction:            appConfigM.LoginRiskFailAction,
+		LoginRiskFailCount:             appConfigM.LoginRiskFailCount,
+		LoginRiskBlockMinutes:          appConfigM.LoginRiskBlockMinutes,
+		LoginLockCaptchaCount:          appConfigM.LoginLockCaptchaCount,
+		LoginLockAccountCount:          appConfigM.LoginLockAccountCount,
+		LoginLockIPCount:               appConfigM.LoginLockIpCount,
+		LoginLockMinutes:               appConfigM.LoginLockMinutes,
+		FileSignSecret:                 appConfigM.FileSignSecret,
+		IMCallbackSecret:               appConfigM.ImCallbackSecret,
+		IMCallbackAllowIPs:             appConfigM.ImCallbackAllowIps,
+		IMCallbackMaxSkew:              appConfigM.ImCallbackMaxSkew,
+		GRPCToken:                      appConfigM.GrpcToken,
+		GRPCCertFile:                   appConfigM.GrpcCertFile,
+		GRPCKeyFile:                    appConfigM.GrpcKeyFile,
+		RobotWebhookAllowIPs:           appConfigM.RobotWebhookAllowIps,
+		RobotWebhookAllowHTTP:          appConfigM.RobotWebhookAllowHttp,
 	}, nil
 }
 
@@ -140,4 +172,63 @@ type AppConfigResp struct {
 	InviteSystemAccountJoinGroupOn int    // 是否允许邀请系统账号进入群聊
 	RegisterUserMustCompleteInfoOn int    // 是否要求注册用户必须填写完整信息
 	ChannelPinnedMessageMaxCount   int    // 频道置顶消息最大数量
+	RobotCreateOn                  int    // 是否允许用户自助创建机器人
+	RobotCreateApprovalOn          int    // 用户创建的机器人是否需要管理员审核
+	RobotMaxCountPerUser           int    // 每个用户最多可创建的机器人数量
+	SMSCodeLength                  int    // 短信验证码长度
+	SMSSendInterval                int    // 同一手机号发送短信验证码的间隔（秒）
+	SMSPhoneDayLimit               int    // 同一手机号每天最多发送的短信验证码数量
+	SMSIPHourLimit                 int    // 同一IP每小时最多发送的短信验证码数量
+	SMSVerifyMaxFail               int    // 每个短信验证码最多可校验失败的次数
+	SMSRoutes                      string // 短信路由 格式：区号=服务商1,服务商2;*=服务商
+	SMSWebhookURL                  string // webhook短信服务商推送验证码的地址
+	SMSWebhookSecret               string // webhook短信服务商的签名密钥
+	LoginRiskOn                    int    // 是否开启异常登录检测
+	LoginRiskNewRegionAction       int    // 新地区登录的处理方式 0.不处理 1.安全提醒 2.验证手机号或邮箱 3.暂时禁止登录
+	LoginRiskTravelAction          int    // 不可能的移动速度登录的处理方式
+	LoginRiskFailAction            int    // 多次密码错误后登录的处理方式
+	LoginRiskFailCount             int    // 一小时内密码错误多少次后视为异常登录
+	LoginRiskBlockMinutes          int    // 暂时禁止登录的时长（分钟）
+	LoginLockCaptchaCount          int    // 账号或IP密码错误多少次后要求图形验证码
+	LoginLockAccountCount          int    // 同一账号密码错误多少次后暂时锁定
+	LoginLockIPCount               int    // 同一IP密码错误多少次后暂时锁定
+	LoginLockMinutes               int    // 登录锁定时长（分钟）
+	FileSignSecret                 string // 文件访问地址签名密钥
+	IMCallbackSecret               string // IM回调签名密钥（为空不校验签名）
+	IMCallbackAllowIPs             string // IM回调允许的来源IP，多个用逗号分隔，支持CIDR（为空不限制）
+	IMCallbackMaxSkew              int    // IM回调签名时间戳允许的误差（秒）
+	GRPCToken                      string // grpc webhook服务的访问令牌（为空不校验）
+	GRPCCertFile                   string // grpc webhook服务的TLS证书文件
+	GRPCKeyFile                    string // grpc webhook服务的TLS私钥文件
+	RobotWebhookAllowIPs           string // 机器人webhook允许推送的内网地址，多个用逗号分隔，支持CIDR（为空只允许公网地址）
+	RobotWebhookAllowHTTP          int    // 机器人webhook是否允许http地址
+}
+
+// ParseAllowIPs 解析IP白名单，支持单个IP和CIDR，多个用逗号、空格或换行分隔
+func ParseAllowIPs(value string) ([]*net.IPNet, error) {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+	nets := make([]*net.IPNet, 0, len(fields))
+	for _, field := range fields {
+		if !strings.Contains(field, "/") {
+			ip := net.ParseIP(field)
+			if ip == nil {
+				return nil, fmt.Errorf("IP格式有误：%s", field)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(field)
+		if err != nil {
+			return nil, fmt.Errorf("IP段格式有误：%s", field)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
 }
@@ -0,0 +1,5 @@
+-- +migrate Up
+
+ALTER TABLE `app_config` ADD COLUMN robot_create_on smallint not null DEFAULT 1 COMMENT '是否允许用户自助创建机器人';
+ALTER TABLE `app_config` ADD COLUMN robot_create_approval_on smallint not null DEFAULT 0 COMMENT '用户创建的机器人是否需要管理员审核';
+ALTER TABLE `app_config` ADD COLUMN robot_max_count_per_user integer not null DEFAULT 5 COMMENT '每个用户最多可创建的机器人数量';
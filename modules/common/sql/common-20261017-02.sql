@@ -0,0 +1,7 @@
+-- +migrate Up
+
+ALTER TABLE `app_config` ADD COLUMN sms_code_length smallint not null DEFAULT 6 COMMENT '短信验证码长度';
+ALTER TABLE `app_config` ADD COLUMN sms_send_interval integer not null DEFAULT 60 COMMENT '同一手机号发送短信验证码的间隔（秒）';
+ALTER TABLE `app_config` ADD COLUMN sms_phone_day_limit integer not null DEFAULT 10 COMMENT '同一手机号每天最多发送的短信验证码数量';
+ALTER TABLE `app_config` ADD COLUMN sms_ip_hour_limit integer not null DEFAULT 20 COMMENT '同一IP每小时最多发送的短信验证码数量';
+ALTER TABLE `app_config` ADD COLUMN sms_verify_max_fail smallint not null DEFAULT 5 COMMENT '每个短信验证码最多可校验失败的次数';
@@ -0,0 +1,5 @@
+-- +migrate Up
+
+ALTER TABLE `app_config` ADD COLUMN sms_routes VARCHAR(1000) not null DEFAULT '' COMMENT '短信路由 格式：区号=服务商1,服务商2;*=服务商 为空则使用配置文件中的smsProvider';
+ALTER TABLE `app_config` ADD COLUMN sms_webhook_url VARCHAR(255) not null DEFAULT '' COMMENT 'webhook短信服务商推送验证码的地址';
+ALTER TABLE `app_config` ADD COLUMN sms_webhook_secret VARCHAR(100) not null DEFAULT '' COMMENT 'webhook短信服务商的签名密钥';
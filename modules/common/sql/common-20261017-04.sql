@@ -0,0 +1,8 @@
+-- +migrate Up
+
+ALTER TABLE `app_config` ADD COLUMN login_risk_on smallint not null DEFAULT 0 COMMENT '是否开启异常登录检测';
+ALTER TABLE `app_config` ADD COLUMN login_risk_new_region_action smallint not null DEFAULT 1 COMMENT '新地区登录的处理方式 0.不处理 1.安全提醒 2.验证手机号或邮箱 3.暂时禁止登录';
+ALTER TABLE `app_config` ADD COLUMN login_risk_travel_action smallint not null DEFAULT 2 COMMENT '不可能的移动速度登录的处理方式 0.不处理 1.安全提醒 2.验证手机号或邮箱 3.暂时禁止登录';
+ALTER TABLE `app_config` ADD COLUMN login_risk_fail_action smallint not null DEFAULT 2 COMMENT '多次密码错误后登录的处理方式 0.不处理 1.安全提醒 2.验证手机号或邮箱 3.暂时禁止登录';
+ALTER TABLE `app_config` ADD COLUMN login_risk_fail_count integer not null DEFAULT 5 COMMENT '一小时内密码错误多少次后视为异常登录';
+ALTER TABLE `app_config` ADD COLUMN login_risk_block_minutes integer not null DEFAULT 30 COMMENT '暂时禁止登录的时长（分钟）';
@@ -0,0 +1,6 @@
+-- +migrate Up
+
+ALTER TABLE `app_config` ADD COLUMN login_lock_captcha_count integer not null DEFAULT 3 COMMENT '账号或IP密码错误多少次后要求图形验证码';
+ALTER TABLE `app_config` ADD COLUMN login_lock_account_count integer not null DEFAULT 10 COMMENT '同一账号密码错误多少次后暂时锁定';
+ALTER TABLE `app_config` ADD COLUMN login_lock_ip_count integer not null DEFAULT 50 COMMENT '同一IP密码错误多少次后暂时锁定';
+ALTER TABLE `app_config` ADD COLUMN login_lock_minutes integer not null DEFAULT 15 COMMENT '登录锁定时长（分钟）';
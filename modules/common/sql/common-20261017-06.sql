@@ -0,0 +1,3 @@
+-- +migrate Up
+
+ALTER TABLE `app_config` ADD COLUMN file_sign_secret varchar(100) not null DEFAULT '' COMMENT '文件访问地址签名密钥（为空时启动自动生成）';
@@ -0,0 +1,8 @@
+-- +migrate Up
+
+ALTER TABLE `app_config` ADD COLUMN im_callback_secret varchar(100) not null DEFAULT '' COMMENT 'IM回调签名密钥（为空不校验签名）';
+ALTER TABLE `app_config` ADD COLUMN im_callback_allow_ips varchar(1000) not null DEFAULT '' COMMENT 'IM回调允许的来源IP，多个用逗号分隔，支持CIDR（为空不限制）';
+ALTER TABLE `app_config` ADD COLUMN im_callback_max_skew integer not null DEFAULT 300 COMMENT 'IM回调签名时间戳允许的误差（秒）';
+ALTER TABLE `app_config` ADD COLUMN grpc_token varchar(100) not null DEFAULT '' COMMENT 'grpc webhook服务的访问令牌（为空不校验，修改后重启生效）';
+ALTER TABLE `app_config` ADD COLUMN grpc_cert_file varchar(255) not null DEFAULT '' COMMENT 'grpc webhook服务的TLS证书文件（修改后重启生效）';
+ALTER TABLE `app_config` ADD COLUMN grpc_key_file varchar(255) not null DEFAULT '' COMMENT 'grpc webhook服务的TLS私钥文件（修改后重启生效）';
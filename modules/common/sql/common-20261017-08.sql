@@ -0,0 +1,4 @@
+-- +migrate Up
+
+ALTER TABLE `app_config` ADD COLUMN robot_webhook_allow_ips varchar(1000) not null DEFAULT '' COMMENT '机器人webhook允许推送的内网地址，多个用逗号分隔，支持CIDR（为空只允许公网地址）';
+ALTER TABLE `app_config` ADD COLUMN robot_webhook_allow_http smallint not null DEFAULT 0 COMMENT '机器人webhook是否允许http地址（默认只允许https）';
@@ -1,12 +1,15 @@
 package file
 
 import (
-	_ "embed"
+	"embed"
 
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/register"
 )
 
+//go:embed sql
+var sqlFS embed.FS
+
 //go:embed swagger/api.yaml
 var swaggerContent string
 
@@ -18,6 +21,7 @@ func init() {
 			SetupAPI: func() register.APIRouter {
 				return New(ctx.(*config.Context))
 			},
+			SQLDir:  register.NewSQLFS(sqlFS),
 			Swagger: swaggerContent,
 		}
 	})
@@ -17,6 +17,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // File 文件操作
@@ -25,6 +26,8 @@ type File struct {
 	log.Log
 	service     IService
 	appConfigDB *common.AppConfigDb
+	chatFileDB  *chatFileDB
+	signer      *fileSigner
 }
 
 type AppConfig struct {
@@ -39,6 +42,8 @@ func New(ctx *config.Context) *File {
 		Log:         log.NewTLog("File"),
 		service:     NewService(ctx),
 		appConfigDB: common.NewAppConfigDB(ctx),
+		chatFileDB:  newChatFileDB(ctx),
+		signer:      newFileSigner(ctx),
 	}
 }
 
@@ -58,6 +63,9 @@ func (f *File) Route(r *wkhttp.WKHttp) {
 		auth.GET("/upload", f.getFilePath)
 		//上传文件
 		auth.POST("/upload", f.uploadFile)
+		// 获取聊天文件的签名访问地址
+		auth.GET("/signed_url", f.signedURL)
+		auth.POST("/signed_urls", f.signedURLs)
 	}
 }
 
@@ -84,8 +92,12 @@ func (f *File) makeImageCompose(c *wkhttp.Context) {
 		c.ResponseError(errors.New("组合图片失败！"))
 		return
 	}
+	path, _ := resultMap["fid"].(string) // seaweedfs返回fid，其他上传服务返回path
+	if path == "" {
+		path, _ = resultMap["path"].(string)
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"path": resultMap["fid"].(string),
+		"path": path,
 	})
 }
 
@@ -166,6 +178,18 @@ func (f *File) uploadFile(c *wkhttp.Context) {
 	if !strings.HasPrefix(path, "/") {
 		path = fmt.Sprintf("/%s", path)
 	}
+	if Type(fileType) == TypeChat {
+		allow, err := f.canUploadChatFile(c.GetLoginUID(), normalizeFilePath(fmt.Sprintf("%s%s", fileType, path)))
+		if err != nil {
+			f.Error("校验聊天文件上传权限失败！", zap.Error(err))
+			c.ResponseError(errors.New("校验聊天文件上传权限失败！"))
+			return
+		}
+		if !allow {
+			c.ResponseError(errors.New("没有权限上传该文件"))
+			return
+		}
+	}
 	var sign []byte
 	if signatureInt == 1 {
 		// bytes, err := ioutil.ReadAll(file)
@@ -201,6 +225,17 @@ func (f *File) uploadFile(c *wkhttp.Context) {
 		c.ResponseError(errors.New("上传文件失败！"))
 		return
 	}
+	if Type(fileType) == TypeChat {
+		err = f.chatFileDB.insertIfNotExist(&chatFileModel{
+			Path: normalizeFilePath(fmt.Sprintf("%s%s", fileType, path)),
+			UID:  c.GetLoginUID(),
+		})
+		if err != nil {
+			f.Error("添加聊天文件上传记录失败！", zap.Error(err))
+			c.ResponseError(errors.New("上传文件失败！"))
+			return
+		}
+	}
 	if signatureInt == 1 {
 		encoded := base64.StdEncoding.EncodeToString(sign[:])
 		fmt.Print("编码文件", encoded)
@@ -222,6 +257,21 @@ func (f *File) getFile(c *wkhttp.Context) {
 		c.Response(errors.New("访问路径不能为空"))
 		return
 	}
+	relPath := normalizeFilePath(ph)
+	chatFile := isChatFilePath(relPath)
+	if chatFile {
+		err := f.signer.verify(relPath, c.Query(fileSignExpiresKey), c.Query(fileSignKey), time.Now())
+		if err != nil {
+			if !errors.Is(err, ErrFileSignInvalid) {
+				f.Error("校验文件签名失败！", zap.Error(err))
+			}
+			c.ResponseWithStatus(http.StatusForbidden, gin.H{
+				"msg":    ErrFileSignInvalid.Error(),
+				"status": http.StatusForbidden,
+			})
+			return
+		}
+	}
 	filename := c.Query("filename")
 	if filename == "" {
 		paths := strings.Split(ph, "/")
@@ -229,6 +279,32 @@ func (f *File) getFile(c *wkhttp.Context) {
 			filename = paths[len(paths)-1]
 		}
 	}
+	served, err := f.service.ServeFile(c.Writer, c.Request, ph, filename)
+	if served {
+		if errors.Is(err, ErrFileNotFound) {
+			c.Writer.WriteHeader(http.StatusNotFound)
+		} else if err != nil {
+			f.Error("读取文件失败！", zap.String("path", ph), zap.Error(err))
+			c.ResponseError(errors.New("读取文件失败！"))
+		}
+		return
+	}
+	if chatFile {
+		// 聊天文件不能重定向到永久的公开地址，签名地址和本次访问地址同时过期
+		expires, _ := strconv.ParseInt(c.Query(fileSignExpiresKey), 10, 64)
+		expire := time.Until(time.Unix(expires, 0))
+		if expire < time.Second {
+			expire = time.Second
+		}
+		err = f.service.ServeChatFile(c.Writer, c.Request, relPath, filename, expire)
+		if errors.Is(err, ErrFileNotFound) {
+			c.Writer.WriteHeader(http.StatusNotFound)
+		} else if err != nil {
+			f.Error("读取聊天文件失败！", zap.String("path", ph), zap.Error(err))
+			c.ResponseError(errors.New("读取文件失败！"))
+		}
+		return
+	}
 	downloadURL, err := f.service.DownloadURL(ph, filename)
 	if err != nil {
 		c.ResponseError(err)
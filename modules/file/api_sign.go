@@ -0,0 +1,153 @@
+package file
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/common"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/register"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const signedURLsMaxCount = 100 // 批量获取签名地址的最大数量
+
+// groupMemberService 群成员查询（通过模块注册获取，避免和群模块循环引用）
+type groupMemberService interface {
+	ExistMember(groupNo string, uid string) (bool, error)
+}
+
+// friendService 好友关系查询（通过模块注册获取，避免和用户模块循环引用）
+type friendService interface {
+	IsFriend(uid string, toUID string) (bool, error)
+}
+
+// 获取聊天文件的签名访问地址
+func (f *File) signedURL(c *wkhttp.Context) {
+	relPath := normalizeFilePath(c.Query("path"))
+	if relPath == "" {
+		c.ResponseError(errors.New("文件路径不能为空"))
+		return
+	}
+	resp, err := f.signedURLResp(c.GetLoginUID(), relPath)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	c.Response(resp)
+}
+
+// 批量获取聊天文件的签名访问地址（没有权限的文件不返回）
+func (f *File) signedURLs(c *wkhttp.Context) {
+	var paths []string
+	if err := c.BindJSON(&paths); err != nil {
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if len(paths) > signedURLsMaxCount {
+		c.ResponseError(errors.New("文件数量不能大于100！"))
+		return
+	}
+	loginUID := c.GetLoginUID()
+	resps := make([]*signedURLResp, 0, len(paths))
+	for _, ph := range paths {
+		relPath := normalizeFilePath(ph)
+		if relPath == "" {
+			continue
+		}
+		resp, err := f.signedURLResp(loginUID, relPath)
+		if err != nil {
+			continue
+		}
+		resp.Path = ph
+		resps = append(resps, resp)
+	}
+	c.Response(resps)
+}
+
+func (f *File) signedURLResp(loginUID string, relPath string) (*signedURLResp, error) {
+	if !isChatFilePath(relPath) { // 头像、表情等公开文件不需要签名
+		return &signedURLResp{Path: relPath, URL: filePreviewPrefix + relPath}, nil
+	}
+	allow, err := f.canAccessChatFile(loginUID, relPath)
+	if err != nil {
+		f.Error("校验文件访问权限失败！", zap.String("path", relPath), zap.Error(err))
+		return nil, errors.New("校验文件访问权限失败！")
+	}
+	if !allow {
+		return nil, errors.New("没有权限访问该文件")
+	}
+	url, expires, err := f.signer.signURL(relPath, time.Now())
+	if err != nil {
+		f.Error("生成文件签名地址失败！", zap.Error(err))
+		return nil, errors.New("生成文件签名地址失败！")
+	}
+	return &signedURLResp{Path: relPath, URL: url, Expires: expires}, nil
+}
+
+// canAccessChatFile 上传者和文件所属频道的成员可以访问聊天文件
+func (f *File) canAccessChatFile(loginUID string, relPath string) (bool, error) {
+	chatFile, err := f.chatFileDB.queryWithPath(relPath)
+	if err != nil {
+		return false, err
+	}
+	if chatFile != nil && chatFile.UID == loginUID {
+		return true, nil
+	}
+	channelID, channelType, ok := parseChatFilePath(relPath)
+	if !ok {
+		return false, nil
+	}
+	switch channelType {
+	case common.ChannelTypePerson.Uint8():
+		// 单聊文件的频道ID是接收者的uid（也兼容fake频道ID）
+		for _, uid := range strings.Split(channelID, "@") {
+			if uid == loginUID {
+				return true, nil
+			}
+		}
+		if chatFile != nil || strings.Contains(channelID, "@") {
+			return false, nil
+		}
+		// 上线前上传的文件没有上传记录，发送者通过和接收者的好友关系访问
+		userService, ok := register.GetService(UserServiceName).(friendService)
+		if !ok {
+			return false, errors.New("用户服务不存在")
+		}
+		return userService.IsFriend(loginUID, channelID)
+	case common.ChannelTypeGroup.Uint8():
+		groupService, ok := register.GetService(GroupServiceName).(groupMemberService)
+		if !ok {
+			return false, errors.New("群服务不存在")
+		}
+		return groupService.ExistMember(channelID, loginUID)
+	}
+	return false, nil
+}
+
+// canUploadChatFile 不能覆盖别人上传的聊天文件，群聊文件只有群成员可以上传
+// 单聊文件的频道ID是接收者的uid，上传者通过上传记录访问，所以不限制
+func (f *File) canUploadChatFile(loginUID string, relPath string) (bool, error) {
+	chatFile, err := f.chatFileDB.queryWithPath(relPath)
+	if err != nil {
+		return false, err
+	}
+	if chatFile != nil {
+		return chatFile.UID == loginUID, nil
+	}
+	_, channelType, ok := parseChatFilePath(relPath)
+	if !ok {
+		return false, nil
+	}
+	if channelType == common.ChannelTypeGroup.Uint8() {
+		return f.canAccessChatFile(loginUID, relPath)
+	}
+	return true, nil
+}
+
+type signedURLResp struct {
+	Path    string `json:"path"`    // 请求的文件路径
+	URL     string `json:"url"`     // 访问地址（聊天文件带签名）
+	Expires int64  `json:"expires"` // 签名过期时间（秒），公开文件为0
+}
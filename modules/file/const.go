@@ -25,3 +25,10 @@ const (
 	// TypeWorkplaceAppIcon
 	TypeWorkplaceAppIcon Type = "workplaceappicon"
 )
+
+const (
+	// GroupServiceName 群模块注册的服务名
+	GroupServiceName = "group"
+	// UserServiceName 用户模块注册的服务名
+	UserServiceName = "user"
+)
@@ -0,0 +1,37 @@
+package file
+
+import (
+	"github.com/gocraft/dbr/v2"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/db"
+)
+
+type chatFileDB struct {
+	session *dbr.Session
+	ctx     *config.Context
+}
+
+func newChatFileDB(ctx *config.Context) *chatFileDB {
+	return &chatFileDB{
+		session: ctx.DB(),
+		ctx:     ctx,
+	}
+}
+
+// 添加上传记录（同一路径保留第一个上传者）
+func (c *chatFileDB) insertIfNotExist(m *chatFileModel) error {
+	_, err := c.session.InsertBySql("insert into chat_file(path,uid) values(?,?) ON DUPLICATE KEY UPDATE path=path", m.Path, m.UID).Exec()
+	return err
+}
+
+func (c *chatFileDB) queryWithPath(path string) (*chatFileModel, error) {
+	var model *chatFileModel
+	_, err := c.session.Select("*").From("chat_file").Where("path=?", path).Load(&model)
+	return model, err
+}
+
+type chatFileModel struct {
+	Path string
+	UID  string
+	db.BaseModel
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
@@ -12,9 +13,13 @@ import (
 	_ "image/png"
 	"io"
 	"io/ioutil"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -37,6 +42,20 @@ type IService interface {
 	IUploadService
 	DownloadAndMakeCompose(uploadPath string, downloadURLs []string) (map[string]interface{}, error)
 	DownloadImage(url string, ctx context.Context) (io.ReadCloser, error)
+	// ServeFile 上传服务支持直接访问文件时返回文件内容，返回false表示需要重定向到下载地址
+	ServeFile(w http.ResponseWriter, r *http.Request, path string, filename string) (bool, error)
+	// ServeChatFile 返回不能直接访问的聊天文件：支持签名的上传服务重定向到有效期为expire的签名地址，其他上传服务由服务端读取后返回
+	ServeChatFile(w http.ResponseWriter, r *http.Request, path string, filename string, expire time.Duration) error
+}
+
+// iFileServer 可以直接提供文件访问的上传服务
+type iFileServer interface {
+	ServeFile(w http.ResponseWriter, r *http.Request, path string, filename string) error
+}
+
+// iPresigner 可以生成有时效的下载地址的上传服务（聊天文件不能重定向到永久的公开地址）
+type iPresigner interface {
+	PresignedURL(path string, filename string, expire time.Duration) (string, error)
 }
 
 // NewService NewService
@@ -49,6 +68,8 @@ func NewService(ctx *config.Context) IService {
 		uploadService = NewServiceOSS(ctx)
 	} else if service == config.FileServiceQiniu {
 		uploadService = NewServiceQiniu(ctx)
+	} else if service == FileServiceLocal {
+		uploadService = NewServiceLocal(ctx)
 	} else {
 		uploadService = NewSeaweedFS(ctx)
 	}
@@ -80,6 +101,86 @@ func (s *Service) DownloadURL(path string, filename string) (string, error) {
 	return s.uploadService.DownloadURL(path, filename)
 }
 
+func (s *Service) ServeFile(w http.ResponseWriter, r *http.Request, path string, filename string) (bool, error) {
+	fileServer, ok := s.uploadService.(iFileServer)
+	if !ok {
+		return false, nil
+	}
+	return true, fileServer.ServeFile(w, r, path, filename)
+}
+
+func (s *Service) ServeChatFile(w http.ResponseWriter, r *http.Request, path string, filename string, expire time.Duration) error {
+	if presigner, ok := s.uploadService.(iPresigner); ok {
+		presignedURL, err := presigner.PresignedURL(path, filename, expire)
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, presignedURL, http.StatusFound)
+		return nil
+	}
+	downloadURL, err := s.uploadService.DownloadURL(path, filename)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.downloadClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrFileNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("读取文件返回状态[%d]失败！", resp.StatusCode)
+	}
+	setFileResponseHeader(w, path, filename)
+	if resp.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	_, err = io.Copy(w, resp.Body)
+	if err != nil {
+		s.Warn("返回聊天文件内容失败！", zap.String("path", path), zap.Error(err))
+	}
+	return nil
+}
+
+// setFileResponseHeader 只有图片、音频和视频可以在浏览器中直接打开，其他文件（包括html、svg）一律作为附件下载，防止在本站域名下执行脚本
+func setFileResponseHeader(w http.ResponseWriter, ph string, filename string) {
+	contentType, disposition := fileResponseType(ph, filename)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+}
+
+// fileResponseType 根据扩展名返回文件的Content-Type和Content-Disposition
+func fileResponseType(ph string, filename string) (string, string) {
+	contentType := mime.TypeByExtension(path.Ext(ph))
+	disposition := "inline"
+	if !isInlineContentType(contentType) {
+		contentType = "application/octet-stream"
+		disposition = "attachment"
+	}
+	return contentType, mime.FormatMediaType(disposition, map[string]string{"filename": filename})
+}
+
+// isInlineContentType 是否是可以直接在浏览器中打开的类型（svg可以包含脚本，不算图片）
+func isInlineContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if mediaType == "image/svg+xml" {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "image/") || strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/")
+}
+
 func (s *Service) DownloadImage(url string, ctx context.Context) (io.ReadCloser, error) {
 	reader, err := s.downloadImage(url, ctx)
 	if err != nil {
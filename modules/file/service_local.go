@@ -0,0 +1,146 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+	"go.uber.org/zap"
+)
+
+// FileServiceLocal 本地文件存储（文件保存在rootDir/files下，由/v1/file/preview直接提供访问）
+const FileServiceLocal config.FileService = "local"
+
+const localFileDir = "files"
+
+// ErrFileNotFound 文件不存在
+var ErrFileNotFound = errors.New("文件不存在")
+
+// ServiceLocal 本地文件存储
+type ServiceLocal struct {
+	log.Log
+	ctx     *config.Context
+	rootDir string
+}
+
+// NewServiceLocal NewServiceLocal
+func NewServiceLocal(ctx *config.Context) *ServiceLocal {
+	return &ServiceLocal{
+		Log:     log.NewTLog("ServiceLocal"),
+		ctx:     ctx,
+		rootDir: filepath.Join(ctx.GetConfig().RootDir, localFileDir),
+	}
+}
+
+// UploadFile 上传文件（先写入临时文件再重命名，避免读到写了一半的文件）
+func (s *ServiceLocal) UploadFile(filePath string, contentType string, copyFileWriter func(io.Writer) error) (map[string]interface{}, error) {
+	relPath, fullPath, err := s.resolvePath(filePath)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(fullPath), 0755)
+	if err != nil {
+		s.Error("创建文件目录失败！", zap.String("filePath", fullPath), zap.Error(err))
+		return nil, err
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(fullPath), ".upload-*")
+	if err != nil {
+		s.Error("创建临时文件失败！", zap.String("filePath", fullPath), zap.Error(err))
+		return nil, err
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+
+	err = copyFileWriter(tmpFile)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		s.Error("复制文件内容失败！", zap.String("filePath", fullPath), zap.Error(err))
+		return nil, err
+	}
+	err = os.Chmod(tmpPath, 0644)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Rename(tmpPath, fullPath)
+	if err != nil {
+		s.Error("保存文件失败！", zap.String("filePath", fullPath), zap.Error(err))
+		return nil, err
+	}
+	return map[string]interface{}{
+		"path": relPath,
+	}, nil
+}
+
+// DownloadURL 本地文件通过预览接口访问
+func (s *ServiceLocal) DownloadURL(ph string, filename string) (string, error) {
+	relPath, _, err := s.resolvePath(ph)
+	if err != nil {
+		return "", err
+	}
+	result, err := url.JoinPath(s.ctx.GetConfig().External.APIBaseURL, "file/preview", relPath)
+	if err != nil {
+		return "", err
+	}
+	if filename != "" {
+		vals := url.Values{}
+		vals.Set("filename", filename)
+		result = fmt.Sprintf("%s?%s", result, vals.Encode())
+	}
+	return result, nil
+}
+
+// ServeFile 直接返回文件内容（支持Range和If-Modified-Since）
+func (s *ServiceLocal) ServeFile(w http.ResponseWriter, r *http.Request, ph string, filename string) error {
+	_, fullPath, err := s.resolvePath(ph)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrFileNotFound
+		}
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.IsDir() {
+		return ErrFileNotFound
+	}
+	if filename == "" {
+		filename = stat.Name()
+	}
+	setFileResponseHeader(w, fullPath, filename)
+	http.ServeContent(w, r, filename, stat.ModTime(), f)
+	return nil
+}
+
+// resolvePath 将访问路径转换为存储目录下的相对路径和文件路径，不允许访问存储目录之外的文件
+func (s *ServiceLocal) resolvePath(ph string) (string, string, error) {
+	if strings.ContainsRune(ph, 0) {
+		return "", "", errors.New("文件路径不合法")
+	}
+	relPath := strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(ph, "\\", "/")), "/")
+	if relPath == "" || relPath == "." {
+		return "", "", errors.New("文件路径不能为空")
+	}
+	fullPath := filepath.Join(s.rootDir, filepath.FromSlash(relPath))
+	rel, err := filepath.Rel(s.rootDir, fullPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", "", errors.New("文件路径不合法")
+	}
+	return relPath, fullPath, nil
+}
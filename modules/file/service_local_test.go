@@ -0,0 +1,102 @@
+package file
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+)
+
+func newTestServiceLocal(t *testing.T) *ServiceLocal {
+	return &ServiceLocal{
+		Log:     log.NewTLog("ServiceLocal"),
+		rootDir: t.TempDir(),
+	}
+}
+
+func TestServiceLocalUploadAndServe(t *testing.T) {
+	s := newTestServiceLocal(t)
+	resultMap, err := s.UploadFile("chat/1/test.txt", "text/plain", func(w io.Writer) error {
+		_, err := io.WriteString(w, "hello local file")
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "chat/1/test.txt", resultMap["path"])
+
+	data, err := os.ReadFile(filepath.Join(s.rootDir, "chat", "1", "test.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello local file", string(data))
+
+	// 完整读取
+	w := httptest.NewRecorder()
+	err = s.ServeFile(w, httptest.NewRequest(http.MethodGet, "/v1/file/preview/chat/1/test.txt", nil), "/chat/1/test.txt", "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "sandbox", w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "hello local file", w.Body.String())
+
+	// Range读取
+	req := httptest.NewRequest(http.MethodGet, "/v1/file/preview/chat/1/test.txt", nil)
+	req.Header.Set("Range", "bytes=6-10")
+	w = httptest.NewRecorder()
+	err = s.ServeFile(w, req, "/chat/1/test.txt", "a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "local", w.Body.String())
+	assert.Equal(t, "bytes 6-10/16", w.Header().Get("Content-Range"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "a.txt")
+
+	// 图片可以直接打开
+	_, err = s.UploadFile("chat/1/test.png", "image/png", func(w io.Writer) error {
+		_, err := io.WriteString(w, "png")
+		return err
+	})
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	err = s.ServeFile(w, httptest.NewRequest(http.MethodGet, "/v1/file/preview/chat/1/test.png", nil), "/chat/1/test.png", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Disposition"), "inline"))
+
+	// 不存在的文件
+	err = s.ServeFile(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), "/chat/1/none.txt", "")
+	assert.Equal(t, ErrFileNotFound, err)
+	err = s.ServeFile(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), "/chat/1", "")
+	assert.Equal(t, ErrFileNotFound, err)
+}
+
+func TestIsInlineContentType(t *testing.T) {
+	assert.True(t, isInlineContentType("image/jpeg"))
+	assert.True(t, isInlineContentType("audio/mpeg"))
+	assert.True(t, isInlineContentType("video/mp4"))
+	assert.False(t, isInlineContentType("image/svg+xml"))
+	assert.False(t, isInlineContentType("text/html; charset=utf-8"))
+	assert.False(t, isInlineContentType(""))
+}
+
+func TestServiceLocalResolvePath(t *testing.T) {
+	s := newTestServiceLocal(t)
+
+	relPath, fullPath, err := s.resolvePath("/chat/../../../etc/passwd")
+	assert.NoError(t, err)
+	assert.Equal(t, "etc/passwd", relPath)
+	assert.Equal(t, filepath.Join(s.rootDir, "etc", "passwd"), fullPath)
+
+	relPath, _, err = s.resolvePath("..\\..\\avatar\\1.png")
+	assert.NoError(t, err)
+	assert.Equal(t, "avatar/1.png", relPath)
+
+	_, _, err = s.resolvePath("/../")
+	assert.Error(t, err)
+	_, _, err = s.resolvePath("chat/a\x00.png")
+	assert.Error(t, err)
+}
@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/minio/minio-go/v7"
@@ -22,6 +24,9 @@ type ServiceMinio struct {
 	log.Log
 	ctx            *config.Context
 	downloadClient *http.Client
+	presignClient  *minio.Client // 生成下载签名地址的client（使用下载地址的域名）
+	presignLock    sync.Mutex
+	chatPrivate    atomic.Bool // 本次启动后是否已去掉聊天文件目录的公开读权限
 }
 
 // NewServiceMinio NewServiceMinio
@@ -81,6 +86,18 @@ func (sm *ServiceMinio) UploadFile(filePath string, contentType string, copyFile
 			sm.Error(fmt.Sprintf("创建 %s目录失败", bucketName))
 			return nil, err
 		}
+	}
+	if bucketName == string(TypeChat) {
+		// 聊天文件不公开读，只能通过有时效的签名地址访问（已存在的桶也去掉公开读权限）
+		if !sm.chatPrivate.Load() {
+			err = minioClient.SetBucketPolicy(ctx, bucketName, "")
+			if err != nil {
+				sm.Error("设置聊天文件目录为私有失败", zap.Error(err))
+				return nil, err
+			}
+			sm.chatPrivate.Store(true)
+		}
+	} else if !exists {
 		policy := `{
 			"Version": "2012-10-17",
 			"Statement": [{
@@ -119,6 +136,51 @@ func (sm *ServiceMinio) UploadFile(filePath string, contentType string, copyFile
 	}, err
 }
 
+// PresignedURL 聊天文件有时效的下载地址
+func (sm *ServiceMinio) PresignedURL(ph string, filename string, expire time.Duration) (string, error) {
+	client, err := sm.getPresignClient()
+	if err != nil {
+		return "", err
+	}
+	ph = strings.TrimPrefix(ph, "/")
+	idx := strings.Index(ph, "/")
+	if idx <= 0 {
+		return "", ErrFileNotFound
+	}
+	contentType, disposition := fileResponseType(ph, filename)
+	vals := url.Values{}
+	vals.Set("response-content-type", contentType)
+	vals.Set("response-content-disposition", disposition)
+	result, err := client.PresignedGetObject(context.Background(), ph[:idx], ph[idx+1:], expire, vals)
+	if err != nil {
+		return "", err
+	}
+	return result.String(), nil
+}
+
+// getPresignClient 签名地址中包含域名，所以使用下载地址创建client
+func (sm *ServiceMinio) getPresignClient() (*minio.Client, error) {
+	sm.presignLock.Lock()
+	defer sm.presignLock.Unlock()
+	if sm.presignClient != nil {
+		return sm.presignClient, nil
+	}
+	minioConfig := sm.ctx.GetConfig().Minio
+	downloadURL, err := url.Parse(minioConfig.DownloadURL)
+	if err != nil {
+		return nil, err
+	}
+	client, err := minio.New(downloadURL.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(minioConfig.AccessKeyID, minioConfig.SecretAccessKey, ""),
+		Secure: strings.HasPrefix(downloadURL.Scheme, "https"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	sm.presignClient = client
+	return client, nil
+}
+
 func (sm *ServiceMinio) DownloadURL(ph string, filename string) (string, error) {
 	minioConfig := sm.ctx.GetConfig().Minio
 	vals := url.Values{}
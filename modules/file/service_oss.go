@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"io"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
@@ -58,7 +60,12 @@ func (s *ServiceOSS) UploadFile(filePath string, contentType string, copyFileWri
 		s.Error("复制文件内容失败！", zap.Error(err))
 		return nil, err
 	}
-	err = bucket.PutObject(filePath, buff, oss.ContentType(contentType), oss.ContentLength(int64(len(buff.Bytes()))))
+	options := []oss.Option{oss.ContentType(contentType), oss.ContentLength(int64(len(buff.Bytes())))}
+	if isChatFilePath(normalizeFilePath(filePath)) {
+		// 聊天文件不公开读，只能通过有时效的签名地址访问
+		options = append(options, oss.ObjectACL(oss.ACLPrivate))
+	}
+	err = bucket.PutObject(filePath, buff, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -72,3 +79,22 @@ func (s *ServiceOSS) DownloadURL(path string, filename string) (string, error) {
 	rpath, _ := url.JoinPath(ossCfg.BucketURL, path)
 	return rpath, nil
 }
+
+// PresignedURL 聊天文件有时效的下载地址
+func (s *ServiceOSS) PresignedURL(path string, filename string, expire time.Duration) (string, error) {
+	ossCfg := s.ctx.GetConfig().OSS
+	client, err := oss.New(ossCfg.Endpoint, ossCfg.AccessKeyID, ossCfg.AccessKeySecret)
+	if err != nil {
+		return "", err
+	}
+	bucket, err := client.Bucket(ossCfg.BucketName)
+	if err != nil {
+		return "", err
+	}
+	contentType, disposition := fileResponseType(path, filename)
+	expiredInSec := int64(expire.Seconds())
+	if expiredInSec <= 0 {
+		expiredInSec = 1
+	}
+	return bucket.SignURL(strings.TrimPrefix(path, "/"), oss.HTTPGet, expiredInSec, oss.ResponseContentType(contentType), oss.ResponseContentDisposition(disposition))
+}
@@ -0,0 +1,142 @@
+package file
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/common"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+)
+
+const (
+	fileSignExpire     = time.Hour * 2 // 签名地址有效期
+	filePreviewPrefix  = "file/preview/"
+	fileSignExpiresKey = "expires"
+	fileSignKey        = "signature"
+)
+
+// ErrFileSignInvalid 签名无效或已过期
+var ErrFileSignInvalid = errors.New("文件访问地址无效或已过期")
+
+// fileSigner 文件访问地址签名（密钥在应用配置中，启动时自动生成）
+type fileSigner struct {
+	commonService common.IService
+	secret        []byte
+	secretLock    sync.RWMutex
+}
+
+func newFileSigner(ctx *config.Context) *fileSigner {
+	return &fileSigner{
+		commonService: common.NewService(ctx),
+	}
+}
+
+func (f *fileSigner) getSecret() ([]byte, error) {
+	f.secretLock.RLock()
+	secret := f.secret
+	f.secretLock.RUnlock()
+	if len(secret) > 0 {
+		return secret, nil
+	}
+	appConfig, err := f.commonService.GetAppConfig()
+	if err != nil {
+		return nil, err
+	}
+	if appConfig == nil || appConfig.FileSignSecret == "" {
+		return nil, errors.New("文件签名密钥未配置")
+	}
+	secret = []byte(appConfig.FileSignSecret)
+	f.secretLock.Lock()
+	f.secret = secret
+	f.secretLock.Unlock()
+	return secret, nil
+}
+
+// signURL 生成带签名的文件访问地址（相对地址，和上传接口返回的path格式一致）
+func (f *fileSigner) signURL(relPath string, now time.Time) (string, int64, error) {
+	secret, err := f.getSecret()
+	if err != nil {
+		return "", 0, err
+	}
+	expires := now.Add(fileSignExpire).Unix()
+	vals := url.Values{}
+	vals.Set(fileSignExpiresKey, strconv.FormatInt(expires, 10))
+	vals.Set(fileSignKey, signFilePath(secret, relPath, expires))
+	return fmt.Sprintf("%s%s?%s", filePreviewPrefix, escapeFilePath(relPath), vals.Encode()), expires, nil
+}
+
+// escapeFilePath 逐段转义文件路径，文件名中的#、?、%和空格等字符不会破坏地址
+func escapeFilePath(relPath string) string {
+	segments := strings.Split(relPath, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// verify 校验文件访问地址的签名
+func (f *fileSigner) verify(relPath string, expiresStr string, signature string, now time.Time) error {
+	secret, err := f.getSecret()
+	if err != nil {
+		return err
+	}
+	if !verifyFilePathSign(secret, relPath, expiresStr, signature, now) {
+		return ErrFileSignInvalid
+	}
+	return nil
+}
+
+func signFilePath(secret []byte, relPath string, expires int64) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(fmt.Sprintf("%s\n%d", relPath, expires)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func verifyFilePathSign(secret []byte, relPath string, expiresStr string, signature string, now time.Time) bool {
+	if expiresStr == "" || signature == "" {
+		return false
+	}
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil || expires < now.Unix() {
+		return false
+	}
+	expected := signFilePath(secret, relPath, expires)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// normalizeFilePath 统一文件路径格式：去掉file/preview/前缀和多余的斜杠，例如 chat/2/g1/a.png
+func normalizeFilePath(ph string) string {
+	ph = strings.TrimPrefix(strings.TrimPrefix(ph, "/"), filePreviewPrefix)
+	ph = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(ph, "\\", "/")), "/")
+	if ph == "." {
+		return ""
+	}
+	return ph
+}
+
+// isChatFilePath 聊天文件需要签名才能访问
+func isChatFilePath(relPath string) bool {
+	return strings.HasPrefix(relPath, string(TypeChat)+"/")
+}
+
+// parseChatFilePath 解析聊天文件路径中的频道 chat/<频道类型>/<频道ID>/<文件>
+func parseChatFilePath(relPath string) (channelID string, channelType uint8, ok bool) {
+	parts := strings.SplitN(relPath, "/", 4)
+	if len(parts) != 4 || parts[0] != string(TypeChat) || parts[2] == "" || parts[3] == "" {
+		return "", 0, false
+	}
+	t, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil {
+		return "", 0, false
+	}
+	return parts[2], uint8(t), true
+}
@@ -0,0 +1,59 @@
+package file
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyFilePathSign(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Now()
+	expires := now.Add(time.Minute).Unix()
+	expiresStr := strconv.FormatInt(expires, 10)
+	sign := signFilePath(secret, "chat/2/g1/a.png", expires)
+
+	assert.True(t, verifyFilePathSign(secret, "chat/2/g1/a.png", expiresStr, sign, now))
+	assert.False(t, verifyFilePathSign(secret, "chat/2/g1/b.png", expiresStr, sign, now))
+	assert.False(t, verifyFilePathSign([]byte("other"), "chat/2/g1/a.png", expiresStr, sign, now))
+	assert.False(t, verifyFilePathSign(secret, "chat/2/g1/a.png", strconv.FormatInt(expires+1, 10), sign, now))
+	assert.False(t, verifyFilePathSign(secret, "chat/2/g1/a.png", expiresStr, sign, now.Add(time.Minute*2)))
+	assert.False(t, verifyFilePathSign(secret, "chat/2/g1/a.png", "", sign, now))
+	assert.False(t, verifyFilePathSign(secret, "chat/2/g1/a.png", expiresStr, "", now))
+}
+
+func TestNormalizeFilePath(t *testing.T) {
+	assert.Equal(t, "chat/2/g1/a.png", normalizeFilePath("/chat/2/g1/a.png"))
+	assert.Equal(t, "chat/2/g1/a.png", normalizeFilePath("file/preview/chat/2/g1/a.png"))
+	assert.Equal(t, "chat/2/g1/a.png", normalizeFilePath("/file/preview/chat//2/./g1/a.png"))
+	assert.Equal(t, "chat/a.png", normalizeFilePath("/avatar/../chat/a.png"))
+	assert.Equal(t, "", normalizeFilePath("/"))
+
+	assert.True(t, isChatFilePath("chat/2/g1/a.png"))
+	assert.False(t, isChatFilePath("avatar/1/u1.png"))
+	assert.False(t, isChatFilePath("chatbg/a.png"))
+}
+
+func TestEscapeFilePath(t *testing.T) {
+	assert.Equal(t, "chat/2/g1/a.png", escapeFilePath("chat/2/g1/a.png"))
+	assert.Equal(t, "chat/1/u1/a%20b%23c%3Fd%25.png", escapeFilePath("chat/1/u1/a b#c?d%.png"))
+}
+
+func TestParseChatFilePath(t *testing.T) {
+	channelID, channelType, ok := parseChatFilePath("chat/2/g1/a.png")
+	assert.True(t, ok)
+	assert.Equal(t, "g1", channelID)
+	assert.Equal(t, uint8(2), channelType)
+
+	channelID, channelType, ok = parseChatFilePath("chat/1/u1/2024/a.png")
+	assert.True(t, ok)
+	assert.Equal(t, "u1", channelID)
+	assert.Equal(t, uint8(1), channelType)
+
+	_, _, ok = parseChatFilePath("chat/x/g1/a.png")
+	assert.False(t, ok)
+	_, _, ok = parseChatFilePath("chat/2/a.png")
+	assert.False(t, ok)
+}
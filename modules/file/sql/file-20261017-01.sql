@@ -0,0 +1,12 @@
+-- +migrate Up
+
+-- 聊天文件上传记录（校验文件访问权限时用于识别上传者）
+create table `chat_file`
+(
+  id         integer      not null primary key AUTO_INCREMENT,
+  path       VARCHAR(255) not null default '',                -- 文件路径（不含file/preview/前缀）
+  uid        VARCHAR(40)  not null default '',                -- 上传者uid
+  created_at timeStamp    not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at timeStamp    not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX chat_file_path on `chat_file` (path);
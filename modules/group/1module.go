@@ -30,6 +30,7 @@ func init() {
 			},
 			SQLDir:  register.NewSQLFS(sqlFS),
 			Swagger: swaggerContent,
+			Service: api.groupService,
 			IMDatasource: register.IMDatasource{
 				HasData: func(channelID string, channelType uint8) register.IMDatasourceType {
 					if channelType == common.ChannelTypeGroup.Uint8() {
@@ -81,8 +82,8 @@ func init() {
 					if groupInfo == nil {
 						return nil, nil
 					}
-					if groupInfo.Forbidden == 1 {
-						return api.groupService.GetMemberUIDsOfManager(channelID)
+					if groupInfo.Forbidden == 1 { // 拥有禁言权限的成员（包括群主和管理员）不受全员禁言限制
+						return api.permissionService.GetMemberUIDsWithPermission(channelID, PermissionMuteMember)
 					}
 					return make([]string, 0), nil
 				},
@@ -186,6 +187,7 @@ func newChannelRespWithGroupResp(groupResp *GroupResp) *model.ChannelResp {
 	extraMap["revoke_remind"] = groupResp.RevokeRemind
 	extraMap["join_group_remind"] = groupResp.JoinGroupRemind
 	extraMap["chat_pwd_on"] = groupResp.ChatPwdOn
+	extraMap["mention_only"] = groupResp.MentionOnly
 	extraMap["allow_view_history_msg"] = groupResp.AllowViewHistoryMsg
 	extraMap["group_type"] = groupResp.GroupType
 	extraMap["allow_member_pinned_message"] = groupResp.AllowMemberPinnedMessage
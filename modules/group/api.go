@@ -34,28 +34,30 @@ import (
 type Group struct {
 	ctx *config.Context
 	log.Log
-	db            *DB
-	settingDB     *settingDB
-	appConfigDB   *common2.AppConfigDb
-	userDB        *user.DB
-	groupService  IService
-	fileService   file.IService
-	commonService common2.IService
+	db                *DB
+	settingDB         *settingDB
+	appConfigDB       *common2.AppConfigDb
+	userDB            *user.DB
+	groupService      IService
+	fileService       file.IService
+	permissionService *PermissionService
+	commonService     common2.IService
 }
 
 // New New
 func New(ctx *config.Context) *Group {
 
 	g := &Group{
-		ctx:           ctx,
-		Log:           log.NewTLog("Group"),
-		db:            NewDB(ctx),
-		userDB:        user.NewDB(ctx),
-		appConfigDB:   common2.NewAppConfigDB(ctx),
-		settingDB:     newSettingDB(ctx),
-		groupService:  NewService(ctx),
-		fileService:   file.NewService(ctx),
-		commonService: common2.NewService(ctx),
+		ctx:               ctx,
+		Log:               log.NewTLog("Group"),
+		db:                NewDB(ctx),
+		userDB:            user.NewDB(ctx),
+		appConfigDB:       common2.NewAppConfigDB(ctx),
+		settingDB:         newSettingDB(ctx),
+		groupService:      NewService(ctx),
+		permissionService: NewPermissionService(ctx),
+		fileService:       file.NewService(ctx),
+		commonService:     common2.NewService(ctx),
 	}
 	g.ctx.AddEventListener(event.GroupDisband, g.handleGroupDisbandEvent)
 	g.ctx.AddEventListener(event.EventUserRegister, g.handleRegisterUserEvent)
@@ -72,8 +74,10 @@ func (g *Group) Route(r *wkhttp.WKHttp) {
 	group := r.Group("/v1/group", g.ctx.AuthMiddleware(r))
 	{
 		group.POST("/create", g.groupCreate)
-		group.GET("/my", g.list)                            //我保存的群
-		group.GET("/forbidden_times", g.forbiddenTimesList) // 获取禁言时常列表
+		group.GET("/my", g.list)                                    //我保存的群
+		group.GET("/forbidden_times", g.forbiddenTimesList)         // 获取禁言时常列表
+		group.GET("/invite_links/:link_no", g.inviteLinkGet)        // 获取邀请链接信息
+		group.POST("/invite_links/:link_no/join", g.inviteLinkJoin) // 通过邀请链接加入群
 	}
 	groups := r.Group("/v1/groups", g.ctx.AuthMiddleware(r))
 	{
@@ -98,6 +102,20 @@ func (g *Group) Route(r *wkhttp.WKHttp) {
 		groups.POST("/:group_no/forbidden_with_member", g.forbiddenWithGroupMember)        // 禁言或解禁某个群成员
 		groups.POST("/:group_no/avatar", g.avatarUpload)                                   // 上传群头像
 		groups.DELETE("/:group_no/disband", g.disband)                                     // 解散群
+		groups.PUT("/:group_no/join_question", g.joinQuestionUpdate)                       // 修改入群申请问题
+		groups.POST("/:group_no/join_requests", g.joinRequestAdd)                          // 申请入群
+		groups.GET("/:group_no/join_requests", g.joinRequestList)                          // 待审核的入群申请
+		groups.POST("/:group_no/join_requests/:request_no/approve", g.joinRequestApprove)  // 通过入群申请
+		groups.POST("/:group_no/join_requests/:request_no/reject", g.joinRequestReject)    // 拒绝入群申请
+		groups.POST("/:group_no/invite_links", g.inviteLinkAdd)                            // 创建邀请链接
+		groups.GET("/:group_no/invite_links", g.inviteLinkList)                            // 邀请链接列表
+		groups.DELETE("/:group_no/invite_links/:link_no", g.inviteLinkRevoke)              // 撤销邀请链接
+		groups.GET("/:group_no/invite_links/:link_no/members", g.inviteLinkMembers)        // 通过邀请链接加入的成员
+		groups.GET("/:group_no/roles", g.roleList)                                         // 群的自定义角色
+		groups.POST("/:group_no/roles", g.roleAdd)                                         // 创建自定义角色
+		groups.PUT("/:group_no/roles/:role_no", g.roleUpdate)                              // 修改自定义角色
+		groups.DELETE("/:group_no/roles/:role_no", g.roleDelete)                           // 删除自定义角色
+		groups.PUT("/:group_no/members/:uid/role", g.memberRoleUpdate)                     // 设置成员的自定义角色
 	}
 	openGroups := r.Group("/v1/groups")
 	{ // 获取群头像
@@ -112,6 +130,7 @@ func (g *Group) Route(r *wkhttp.WKHttp) {
 		openGroup.POST("invite/sure", g.groupMemberInviteSure)         // 确认邀请
 	}
 	go g.CheckForbiddenLoop()
+	g.ctx.Schedule(joinRequestExpireInterval, g.expireJoinRequests) // 定时清理过期的入群申请
 }
 
 // 解散群
@@ -220,14 +239,12 @@ func (g *Group) membersGet(c *wkhttp.Context) {
 		return
 	}
 
-	resps := make([]memberDetailResp, 0)
-	if len(members) > 0 {
-		for _, memberModel := range members {
-			resp := memberDetailResp{}
-			resps = append(resps, resp.from(memberModel))
-		}
+	resps, err := g.newMemberDetailResps(groupNo, members)
+	if err != nil {
+		g.Error("查询群角色失败！", zap.Error(err), zap.String("groupNo", groupNo))
+		c.ResponseError(errors.New("查询群角色失败！"))
+		return
 	}
-
 	c.Response(resps)
 }
 
@@ -395,14 +412,37 @@ func (g *Group) syncMembers(c *wkhttp.Context) {
 		c.ResponseError(errors.New("同步成员信息失败！"))
 		return
 	}
-	resps := make([]memberDetailResp, 0)
-	for _, memberModel := range memberModels {
-		resp := memberDetailResp{}
-		resps = append(resps, resp.from(memberModel))
+	resps, err := g.newMemberDetailResps(groupNo, memberModels)
+	if err != nil {
+		g.Error("查询群角色失败！", zap.Error(err), zap.String("groupNo", groupNo))
+		c.ResponseError(errors.New("查询群角色失败！"))
+		return
 	}
 	c.Response(resps)
 }
 
+// newMemberDetailResps 成员详情，同时计算成员在群内的权限
+func (g *Group) newMemberDetailResps(groupNo string, memberModels []*MemberDetailModel) ([]memberDetailResp, error) {
+	resps := make([]memberDetailResp, 0, len(memberModels))
+	if len(memberModels) == 0 {
+		return resps, nil
+	}
+	roles, err := g.db.queryRolesWithGroupNo(groupNo)
+	if err != nil {
+		return nil, err
+	}
+	rolePermissions := make(map[string]string, len(roles))
+	for _, role := range roles {
+		rolePermissions[role.RoleNo] = role.Permissions
+	}
+	for _, memberModel := range memberModels {
+		resp := memberDetailResp{}.from(memberModel)
+		resp.Permissions = memberPermissions(memberModel.Role, rolePermissions[memberModel.RoleNo])
+		resps = append(resps, resp)
+	}
+	return resps, nil
+}
+
 // 获取群详情
 func (g *Group) groupGet(c *wkhttp.Context) {
 	groupNo := c.Param("group_no")
@@ -782,15 +822,12 @@ func (g *Group) groupUpdate(c *wkhttp.Context) {
 		c.ResponseError(err)
 		return
 	}
-	// 查询是否是管理者
-	isManager, err := g.db.QueryIsGroupManagerOrCreator(groupNo, loginUID)
-	if err != nil {
-		g.Error("查询是否是群管理者失败！", zap.Error(err))
-		c.ResponseError(errors.New("查询是否是群管理者失败！"))
-		return
+	// 修改邀请模式属于群设置，其他属于群信息
+	permission := PermissionEditGroupInfo
+	if _, ok := groupMap[common.GroupAttrKeyInvite]; ok {
+		permission = PermissionChangeSetting
 	}
-	if !isManager {
-		c.ResponseError(errors.New("只有群管理者才能修改！"))
+	if !g.checkGroupPermission(c, groupNo, permission) {
 		return
 	}
 
@@ -906,13 +943,13 @@ func (g *Group) memberAdd(c *wkhttp.Context) {
 	判断群是否开启了邀请模式 如果开启了 再判断邀请的人是否是群主或管理员 如果不是则不允许直接添加群成员
 	**/
 	if group.Invite == 1 {
-		creatorOrManager, err := g.db.QueryIsGroupManagerOrCreator(groupNo, operator)
+		canInvite, err := g.permissionService.HasPermission(groupNo, operator, PermissionInviteMember)
 		if err != nil {
-			g.Error("查询是否是创建者和管理者失败！", zap.Error(err))
-			c.ResponseError(errors.New("查询是否是创建者和管理者失败！"))
+			g.Error("查询群权限失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询群权限失败！"))
 			return
 		}
-		if !creatorOrManager {
+		if !canInvite {
 			c.ResponseError(errors.New("群开启了邀请模式，不能添加群成员！"))
 			return
 		}
@@ -1407,14 +1444,7 @@ func (g *Group) groupForbidden(c *wkhttp.Context) {
 	loginName := c.MustGet("name").(string)
 	groupNo := c.Param("group_no")
 	on := c.Param("on")
-	isCreatorOrManager, err := g.db.QueryIsGroupManagerOrCreator(groupNo, loginUID)
-	if err != nil {
-		g.Error("查询是否是创建者失败！", zap.Error(err))
-		c.ResponseError(errors.New("查询是否是创建者失败！"))
-		return
-	}
-	if !isCreatorOrManager {
-		c.ResponseError(errors.New("只有创建者或管理员才能禁言！"))
+	if !g.checkGroupPermission(c, groupNo, PermissionMuteMember) {
 		return
 	}
 	groupModel, err := g.getGroupInfo(groupNo)
@@ -1427,12 +1457,13 @@ func (g *Group) groupForbidden(c *wkhttp.Context) {
 
 	whitelistUIDs := make([]string, 0)
 	if forbidden == 1 {
-		managerOrCreaterUIDs, err := g.db.QueryGroupManagerOrCreatorUIDS(groupNo)
+		// 拥有禁言权限的成员（包括群主和管理员）不受全员禁言限制
+		muteMemberUIDs, err := g.permissionService.GetMemberUIDsWithPermission(groupNo, PermissionMuteMember)
 		if err != nil {
 			c.ResponseErrorf("查询管理者们的uid失败！", err)
 			return
 		}
-		whitelistUIDs = managerOrCreaterUIDs
+		whitelistUIDs = muteMemberUIDs
 	}
 	// 重置白名单
 	err = g.resetIMWhitelist(whitelistUIDs, groupNo)
@@ -1494,13 +1525,13 @@ func (g *Group) groupForbidden(c *wkhttp.Context) {
 	c.ResponseOK()
 }
 
-// 设置群管理员（包含创建者）列表作为群白名单
+// 设置拥有禁言权限的成员（包含创建者和管理员）列表作为群白名单
 func (g *Group) setIMWhitelistForGroupManager(groupNo string) error {
-	managerOrCreaterUIDs, err := g.db.QueryGroupManagerOrCreatorUIDS(groupNo)
+	muteMemberUIDs, err := g.permissionService.GetMemberUIDsWithPermission(groupNo, PermissionMuteMember)
 	if err != nil {
 		return err
 	}
-	return g.resetIMWhitelist(managerOrCreaterUIDs, groupNo)
+	return g.resetIMWhitelist(muteMemberUIDs, groupNo)
 }
 
 // 重新设置群管理的白名单
@@ -1551,15 +1582,29 @@ func (g *Group) groupQRCode(c *wkhttp.Context) {
 		c.ResponseError(errors.New("设置缓存失败！"))
 		return
 	}
+	baseURL, err := g.qrcodeBaseURL(c)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	c.Response(gin.H{
+		"day":    7,
+		"qrcode": g.qrcodeURL(baseURL, uuid),
+		"expire": time.Now().Add(time.Hour * 24 * 7).Format("01月02日"),
+	})
+
+}
+
+// qrcodeBaseURL 根据客户端所在地区获取二维码内容的基础地址
+func (g *Group) qrcodeBaseURL(c *wkhttp.Context) (string, error) {
 	appConfigM, err := g.appConfigDB.Query()
 	if err != nil {
 		g.Error("读取上传配置失败！", zap.Error(err))
-		c.ResponseError(errors.New("读取上传配置失败！"))
-		return
+		return "", errors.New("读取上传配置失败！")
 	}
 	if appConfigM == nil {
-		g.Error("读取上传配置失败1！", zap.Error(err))
-		c.ResponseError(errors.New("读取上传配置失败1！"))
+		g.Error("读取上传配置失败1！")
+		return "", errors.New("读取上传配置失败1！")
 	}
 
 	// 获取当前客户IP
@@ -1571,13 +1616,12 @@ func (g *Group) groupQRCode(c *wkhttp.Context) {
 	} else {
 		BASEURLL = appConfigM.ApiAddr
 	}
+	return BASEURLL, nil
+}
 
-	c.Response(gin.H{
-		"day":    7,
-		"qrcode": fmt.Sprintf("%s%s", BASEURLL, strings.ReplaceAll(g.ctx.GetConfig().QRCodeInfoURL, ":code", uuid)),
-		"expire": time.Now().Add(time.Hour * 24 * 7).Format("01月02日"),
-	})
-
+// qrcodeURL 生成二维码内容地址
+func (g *Group) qrcodeURL(baseURL string, code string) string {
+	return fmt.Sprintf("%s%s", baseURL, strings.ReplaceAll(g.ctx.GetConfig().QRCodeInfoURL, ":code", code))
 }
 
 // 加入群
@@ -1970,15 +2014,7 @@ func (g *Group) memberUpdate(c *wkhttp.Context) {
 		c.ResponseError(err)
 		return
 	}
-	isManager, err := g.db.QueryIsGroupManagerOrCreator(groupNo, loginUID)
-	if err != nil {
-		g.Error("查询是否是群管理者失败！", zap.Error(err))
-		c.ResponseError(errors.New("查询是否是群管理者失败！"))
-		return
-	}
-	if !isManager && loginUID != memberUID {
-		g.Error("只有管理员才能修改其他人的成员信息！")
-		c.ResponseError(errors.New("只有管理员才能修改其他人的成员信息！"))
+	if loginUID != memberUID && !g.checkGroupPermission(c, groupNo, PermissionEditGroupInfo) {
 		return
 	}
 	memberModel, err := g.db.QueryMemberWithUID(memberUID, groupNo)
@@ -2045,25 +2081,6 @@ func (g *Group) memberRemove(c *wkhttp.Context) {
 		c.ResponseError(err)
 		return
 	}
-	var loginMember *MemberModel
-	// 查询操作者身份
-	// 这里要兼容后台管理系统的删除操作
-	if c.CheckLoginRole() != nil {
-		loginMember, err = g.db.QueryMemberWithUID(operator, groupNo)
-		if err != nil {
-			g.Error("查询操作者群成员信息错误", zap.Error(err))
-			c.ResponseError(errors.New("查询操作者群成员信息错误"))
-			return
-		}
-		if loginMember == nil {
-			c.ResponseError(errors.New("操作者不再此群"))
-			return
-		}
-		if loginMember.Role != int(common.GroupMemberRoleCreater) && loginMember.Role != int(common.GroupMemberRoleManager) {
-			c.ResponseError(errors.New("普通成员无法删除群成员"))
-			return
-		}
-	}
 	// 验证删除者是否包含自己
 	for _, uid := range req.Members {
 		if uid == operator {
@@ -2071,6 +2088,13 @@ func (g *Group) memberRemove(c *wkhttp.Context) {
 			return
 		}
 	}
+	// 验证操作者权限
+	// 这里要兼容后台管理系统的删除操作
+	if c.CheckLoginRole() != nil {
+		if !g.checkOperateMembers(c, groupNo, req.Members, PermissionRemoveMember) {
+			return
+		}
+	}
 	deleteMembers, err := g.db.QueryMembersWithUids(req.Members, groupNo)
 	if err != nil {
 		g.Error("查询被删除的群成员信息错误", zap.Error(err))
@@ -2081,21 +2105,6 @@ func (g *Group) memberRemove(c *wkhttp.Context) {
 		c.ResponseError(errors.New("被删除者不在此群内"))
 		return
 	}
-	if loginMember != nil {
-		// 验证权限
-		for _, member := range deleteMembers {
-			if loginMember.Role == int(common.GroupMemberRoleManager) {
-				if member.Role == int(common.GroupMemberRoleManager) {
-					c.ResponseError(errors.New("管理员不能删除管理员"))
-					return
-				}
-				if member.Role == int(common.GroupMemberRoleCreater) {
-					c.ResponseError(errors.New("管理员不能删除群主"))
-					return
-				}
-			}
-		}
-	}
 	realDeleteMemberModels, err := g.userDB.QueryByUIDs(req.Members)
 	if err != nil {
 		g.Error("查询成员用户信息失败！", zap.Error(err))
@@ -2555,15 +2564,7 @@ func (g *Group) blacklist(c *wkhttp.Context) {
 		c.ResponseError(errors.New("群不存在"))
 		return
 	}
-	// 查询是否是管理者
-	isManager, err := g.db.QueryIsGroupManagerOrCreator(groupNo, loginUID)
-	if err != nil {
-		g.Error("查询是否是群管理者失败！", zap.Error(err))
-		c.ResponseError(errors.New("查询是否是群管理者失败！"))
-		return
-	}
-	if !isManager {
-		c.ResponseError(errors.New("只有群管理者才能修改！"))
+	if !g.checkOperateMembers(c, groupNo, req.Uids, PermissionRemoveMember) {
 		return
 	}
 	status := 0
@@ -2698,7 +2699,6 @@ func (g *Group) forbiddenWithGroupMember(c *wkhttp.Context) {
 		c.ResponseError(errors.New("数据格式有误！"))
 		return
 	}
-	loginUID := c.GetLoginUID()
 	groupNo := c.Param("group_no")
 	if groupNo == "" {
 		c.ResponseError(errors.New("群编号不能为空"))
@@ -2718,16 +2718,6 @@ func (g *Group) forbiddenWithGroupMember(c *wkhttp.Context) {
 		c.ResponseError(err)
 		return
 	}
-	loginGroupMember, err := g.db.QueryMemberWithUID(loginUID, group.GroupNo)
-	if err != nil {
-		g.Error("查询登录用户群内信息错误", zap.Error(err))
-		c.ResponseError(errors.New("查询登录用户群内信息错误"))
-		return
-	}
-	if loginGroupMember == nil {
-		c.ResponseError(errors.New("登录用户不在本群内无法操作"))
-		return
-	}
 	member, err := g.db.QueryMemberWithUID(req.MemberUID, group.GroupNo)
 	if err != nil {
 		g.Error("查询成员信息错误", zap.Error(err))
@@ -2738,8 +2728,7 @@ func (g *Group) forbiddenWithGroupMember(c *wkhttp.Context) {
 		c.ResponseError(errors.New("该成员不在群内"))
 		return
 	}
-	if loginGroupMember.Role == MemberRoleCommon || member.Role == MemberRoleCreator || loginGroupMember.Role == member.Role {
-		c.ResponseError(errors.New("操作用户权限不够"))
+	if !g.checkOperateMembers(c, group.GroupNo, []string{req.MemberUID}, PermissionMuteMember) {
 		return
 	}
 	member.Version = g.ctx.GenSeq(common.GroupMemberSeqKey)
@@ -2897,46 +2886,52 @@ func (g *Group) getGroupInfo(groupNo string) (*Model, error) {
 // ---------- vo ----------
 
 type groupDetailResp struct {
-	GroupNo     string `json:"group_no"`  // 群编号
-	Name        string `json:"name"`      // 群名称
-	Notice      string `json:"notice"`    // 群公告
-	Forbidden   int    `json:"forbidden"` // 是否全员禁言
-	CreatedAt   string `json:"created_at"`
-	UpdatedAt   string `json:"updated_at"`
-	MemberCount int64  `json:"member_count"` // 成员数量
-	Version     int64  `json:"version"`      // 群数据版本
+	GroupNo          string `json:"group_no"`           // 群编号
+	Name             string `json:"name"`               // 群名称
+	Notice           string `json:"notice"`             // 群公告
+	Forbidden        int    `json:"forbidden"`          // 是否全员禁言
+	JoinQuestion     string `json:"join_question"`      // 入群申请问题
+	AllowJoinRequest int    `json:"allow_join_request"` // 是否允许非成员直接申请入群
+	CreatedAt        string `json:"created_at"`
+	UpdatedAt        string `json:"updated_at"`
+	MemberCount      int64  `json:"member_count"` // 成员数量
+	Version          int64  `json:"version"`      // 群数据版本
 }
 
 func (g groupDetailResp) from(model *Model, memberCount int64) groupDetailResp {
 	return groupDetailResp{
-		GroupNo:     model.GroupNo,
-		Name:        model.Name,
-		Notice:      model.Notice,
-		Version:     model.Version,
-		Forbidden:   model.Forbidden,
-		MemberCount: memberCount,
-		CreatedAt:   model.CreatedAt.String(),
-		UpdatedAt:   model.UpdatedAt.String(),
+		GroupNo:          model.GroupNo,
+		Name:             model.Name,
+		Notice:           model.Notice,
+		Version:          model.Version,
+		Forbidden:        model.Forbidden,
+		JoinQuestion:     model.JoinQuestion,
+		AllowJoinRequest: model.AllowJoinRequest,
+		MemberCount:      memberCount,
+		CreatedAt:        model.CreatedAt.String(),
+		UpdatedAt:        model.UpdatedAt.String(),
 	}
 }
 
 // 成员详情model
 type memberDetailResp struct {
-	ID                 uint64 `json:"id"`
-	UID                string `json:"uid"`                  // 成员uid
-	GroupNo            string `json:"group_no"`             // 群唯一编号
-	Name               string `json:"name"`                 // 群成员名称
-	Remark             string `json:"remark"`               // 成员备注
-	Role               int    `json:"role"`                 // 成员角色
-	Version            int64  `json:"version"`              // 版本号
-	IsDeleted          int    `json:"is_deleted"`           // 是否删除
-	Status             int    `json:"status"`               //成员状态0:正常，2:黑名单
-	Vercode            string `json:"vercode"`              // 验证码
-	InviteUID          string `json:"invite_uid"`           // 邀请人
-	Robot              int    `json:"robot"`                // 机器人
-	ForbiddenExpirTime int64  `json:"forbidden_expir_time"` // 禁言时长
-	CreatedAt          string `json:"created_at"`
-	UpdatedAt          string `json:"updated_at"`
+	ID                 uint64       `json:"id"`
+	UID                string       `json:"uid"`                  // 成员uid
+	GroupNo            string       `json:"group_no"`             // 群唯一编号
+	Name               string       `json:"name"`                 // 群成员名称
+	Remark             string       `json:"remark"`               // 成员备注
+	Role               int          `json:"role"`                 // 成员角色
+	RoleNo             string       `json:"role_no"`              // 自定义角色编号
+	Permissions        []Permission `json:"permissions"`          // 成员拥有的群权限
+	Version            int64        `json:"version"`              // 版本号
+	IsDeleted          int          `json:"is_deleted"`           // 是否删除
+	Status             int          `json:"status"`               //成员状态0:正常，2:黑名单
+	Vercode            string       `json:"vercode"`              // 验证码
+	InviteUID          string       `json:"invite_uid"`           // 邀请人
+	Robot              int          `json:"robot"`                // 机器人
+	ForbiddenExpirTime int64        `json:"forbidden_expir_time"` // 禁言时长
+	CreatedAt          string       `json:"created_at"`
+	UpdatedAt          string       `json:"updated_at"`
 }
 
 func (r memberDetailResp) from(model *MemberDetailModel) memberDetailResp {
@@ -2947,6 +2942,7 @@ func (r memberDetailResp) from(model *MemberDetailModel) memberDetailResp {
 		Name:      model.Name,
 		Remark:    model.Remark,
 		Role:      model.Role,
+		RoleNo:    model.RoleNo,
 		Version:   model.Version,
 		IsDeleted: model.IsDeleted,
 		Status:    model.Status,
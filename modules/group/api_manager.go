@@ -25,6 +25,8 @@ type Manager struct {
 	managerDB *managerDB
 	userDB    *user.DB
 	db        *DB
+
+	permissionService *PermissionService
 }
 
 // NewManager NewManager
@@ -35,6 +37,8 @@ func NewManager(ctx *config.Context) *Manager {
 		managerDB: newManagerDB(ctx.DB()),
 		userDB:    user.NewDB(ctx),
 		db:        NewDB(ctx),
+
+		permissionService: NewPermissionService(ctx),
 	}
 }
 
@@ -317,12 +321,13 @@ func (m *Manager) forbidden(c *wkhttp.Context) {
 
 	whitelistUIDs := make([]string, 0)
 	if forbidden == 1 {
-		managerOrCreaterUIDs, err := m.db.QueryGroupManagerOrCreatorUIDS(groupNo)
+		// 拥有禁言权限的成员（包括群主和管理员）不受全员禁言限制
+		muteMemberUIDs, err := m.permissionService.GetMemberUIDsWithPermission(groupNo, PermissionMuteMember)
 		if err != nil {
 			c.ResponseErrorf("查询管理者们的uid失败！", err)
 			return
 		}
-		whitelistUIDs = managerOrCreaterUIDs
+		whitelistUIDs = muteMemberUIDs
 	}
 	// 群全员禁言
 	err = m.ctx.IMWhitelistSet(config.ChannelWhitelistReq{
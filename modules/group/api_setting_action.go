@@ -59,21 +59,13 @@ type groupUpdateContext struct {
 	g          *Group
 }
 
-func (g *groupUpdateContext) isManager() (bool, error) {
-	isManager, err := g.g.db.QueryIsGroupManagerOrCreator(g.groupModel.GroupNo, g.loginUID)
-	if err != nil {
-		g.g.Error("查询是否是群管理者失败！", zap.Error(err))
-		return false, err
-	}
-	return isManager, nil
-}
-
 func (g *groupUpdateContext) checkPermissions() error {
-	isManager, err := g.isManager()
+	has, err := g.g.permissionService.HasPermission(g.groupModel.GroupNo, g.loginUID, PermissionChangeSetting)
 	if err != nil {
+		g.g.Error("查询群权限失败！", zap.Error(err))
 		return err
 	}
-	if !isManager {
+	if !has {
 		return errors.New("没有权限！")
 	}
 	return nil
@@ -137,6 +129,10 @@ var settingActionMap = map[string]groupSettingActionFnc{
 		ctx.groupSetting.Mute = int(value.(float64))
 		return ctx.updateSettingAndSendCMD()
 	},
+	"mention_only": func(ctx *settingContext, value interface{}) error { // 仅被@时通知
+		ctx.groupSetting.MentionOnly = int(value.(float64))
+		return ctx.updateSettingAndSendCMD()
+	},
 	"top": func(ctx *settingContext, value interface{}) error { // 会话置顶
 		ctx.groupSetting.Top = int(value.(float64))
 		return ctx.updateSettingAndSendCMD()
@@ -199,11 +195,12 @@ var groupUpdateActionMap = map[string]groupUpdateActionFnc{
 
 		whitelistUIDs := make([]string, 0)
 		if ctx.groupModel.Forbidden == 1 {
-			managerOrCreaterUIDs, err := ctx.g.db.QueryGroupManagerOrCreatorUIDS(groupNo)
+			// 拥有禁言权限的成员（包括群主和管理员）不受全员禁言限制
+			muteMemberUIDs, err := ctx.g.permissionService.GetMemberUIDsWithPermission(groupNo, PermissionMuteMember)
 			if err != nil {
 				return err
 			}
-			whitelistUIDs = managerOrCreaterUIDs
+			whitelistUIDs = muteMemberUIDs
 		}
 		err = ctx.g.ctx.IMWhitelistSet(config.ChannelWhitelistReq{
 			ChannelReq: config.ChannelReq{
@@ -276,4 +273,11 @@ var groupUpdateActionMap = map[string]groupUpdateActionFnc{
 		// 通知群内成员更新频道
 		return ctx.g.ctx.SendChannelUpdateToGroup(groupNo)
 	},
+	GroupAllowJoinRequest: func(ctx *groupUpdateContext, value interface{}) error {
+		if err := ctx.checkPermissions(); err != nil {
+			return err
+		}
+		ctx.groupModel.AllowJoinRequest = int(value.(float64))
+		return ctx.updateGroup()
+	},
 }
@@ -27,6 +27,39 @@ const (
 	InviteStatusOK = 1
 )
 
+// 入群申请状态
+const (
+	// JoinRequestStatusWait 待审核
+	JoinRequestStatusWait = 0
+	// JoinRequestStatusApproved 已通过
+	JoinRequestStatusApproved = 1
+	// JoinRequestStatusRejected 已拒绝
+	JoinRequestStatusRejected = 2
+	// JoinRequestStatusExpired 已过期
+	JoinRequestStatusExpired = 3
+)
+
+// 群邀请链接状态
+const (
+	// InviteLinkStatusRevoked 已撤销
+	InviteLinkStatusRevoked = 0
+	// InviteLinkStatusNormal 正常
+	InviteLinkStatusNormal = 1
+)
+
+// GroupAllowJoinRequest 群设置：是否允许非成员直接申请入群
+const GroupAllowJoinRequest = "allow_join_request"
+
+// InviteLinkCodePrefix 邀请链接二维码内容的前缀 格式： grouplink_xxxx
+const InviteLinkCodePrefix = "grouplink_"
+
+const (
+	// CMDGroupJoinRequest 有新的入群申请（发给群主和管理员）
+	CMDGroupJoinRequest = "groupJoinRequest"
+	// CMDGroupJoinRequestHandled 入群申请已处理（发给群主、管理员和申请者）
+	CMDGroupJoinRequestHandled = "groupJoinRequestHandled"
+)
+
 // 群类型
 type GroupType int
 
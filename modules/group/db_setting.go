@@ -61,6 +61,7 @@ func (s *settingDB) UpdateSetting(setting *Setting) error {
 	_, err := s.session.Update("group_setting").SetMap(map[string]interface{}{
 		"chat_pwd_on":       setting.ChatPwdOn,
 		"mute":              setting.Mute,
+		"mention_only":      setting.MentionOnly,
 		"top":               setting.Top,
 		"save":              setting.Save,
 		"show_nick":         setting.ShowNick,
@@ -83,6 +84,7 @@ func (s *settingDB) UpdateSettingWithTx(setting *Setting, tx *dbr.Tx) error {
 	_, err := tx.Update("group_setting").SetMap(map[string]interface{}{
 		"chat_pwd_on":       setting.ChatPwdOn,
 		"mute":              setting.Mute,
+		"mention_only":      setting.MentionOnly,
 		"top":               setting.Top,
 		"save":              setting.Save,
 		"show_nick":         setting.ShowNick,
@@ -105,6 +107,7 @@ type Setting struct {
 	UID             string // 用户uid
 	GroupNo         string // 群编号
 	Mute            int    // 免打扰
+	MentionOnly     int    // 仅被@时通知
 	Top             int    // 置顶
 	ShowNick        int    // 显示昵称
 	Save            int    // 是否保存
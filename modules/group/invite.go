@@ -38,10 +38,11 @@ func (g *Group) groupMemberInviteAdd(c *wkhttp.Context) {
 		return
 	}
 
-	creatorOrManagerUIDS, err := g.db.QueryGroupManagerOrCreatorUIDS(groupNo)
+	// 通知可以确认邀请的成员（包括群主和管理员）
+	managerUIDs, err := g.permissionService.GetMemberUIDsWithPermission(groupNo, PermissionInviteMember)
 	if err != nil {
-		g.Error("查询创建者或管理员的uid失败！", zap.String("group_no", groupNo), zap.Error(err))
-		c.ResponseError(errors.New("查询创建者或管理员的uid失败！"))
+		g.Error("查询可以确认邀请的成员uid失败！", zap.String("group_no", groupNo), zap.Error(err))
+		c.ResponseError(errors.New("查询可以确认邀请的成员uid失败！"))
 		return
 	}
 
@@ -68,7 +69,7 @@ func (g *Group) groupMemberInviteAdd(c *wkhttp.Context) {
 			Inviter:     loginUID,
 			InviterName: loginName,
 			Num:         len(req.UIDS),
-			Subscribers: creatorOrManagerUIDS,
+			Subscribers: managerUIDs,
 		},
 	}, tx)
 	if err != nil {
@@ -133,14 +134,7 @@ func (g *Group) getToGroupMemberConfirmInviteDetailH5(c *wkhttp.Context) {
 		return
 	}
 
-	managerOrCreator, err := g.db.QueryIsGroupManagerOrCreator(groupNo, loginUID)
-	if err != nil {
-		g.Error("查询是否管理者或创建者失败！")
-		c.ResponseError(errors.New("查询是否管理者或创建者失败！"))
-		return
-	}
-	if !managerOrCreator {
-		c.ResponseError(errors.New("你不是群主或管理员！"))
+	if !g.checkGroupPermission(c, groupNo, PermissionInviteMember) {
 		return
 	}
 	authCode := util.GenerUUID()
@@ -0,0 +1,473 @@
+package group
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gocraft/dbr/v2"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	inviteLinkMaxCount      = 100                       // 每个群最多可存在的邀请链接数量
+	inviteLinkNameMaxLen    = 40                        // 链接名称最大长度
+	inviteLinkMaxUses       = 100000                    // 最多可加入人数的上限
+	inviteLinkMaxExpireTime = int64(60 * 60 * 24 * 365) // 有效时长的上限（秒）
+)
+
+// 创建邀请链接
+func (g *Group) inviteLinkAdd(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	var req inviteLinkReq
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	group, err := g.getGroupInfo(groupNo)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if group.Status == GroupStatusDisabled {
+		c.ResponseError(errors.New("群已被封禁，不能创建邀请链接"))
+		return
+	}
+	if !g.checkGroupPermission(c, groupNo, PermissionManageInviteLink) {
+		return
+	}
+	count, err := g.db.queryInviteLinkCount(groupNo)
+	if err != nil {
+		g.Error("查询邀请链接数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询邀请链接数量失败！"))
+		return
+	}
+	if count >= inviteLinkMaxCount {
+		c.ResponseError(errors.New("邀请链接数量已达上限，请先撤销不用的链接！"))
+		return
+	}
+	baseURL, err := g.qrcodeBaseURL(c)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+
+	var expireAt int64
+	if req.ExpireSeconds > 0 {
+		expireAt = time.Now().Unix() + req.ExpireSeconds
+	}
+	model := &InviteLinkModel{
+		LinkNo:          util.GenerUUID(),
+		GroupNo:         groupNo,
+		Name:            req.Name,
+		Creator:         c.GetLoginUID(),
+		ExpireAt:        expireAt,
+		MaxUses:         req.MaxUses,
+		RequireApproval: req.RequireApproval,
+		Status:          InviteLinkStatusNormal,
+	}
+	if err := g.db.insertInviteLink(model); err != nil {
+		g.Error("添加邀请链接失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加邀请链接失败！"))
+		return
+	}
+	model, err = g.db.QueryInviteLinkWithNo(model.LinkNo)
+	if err != nil || model == nil {
+		g.Error("查询邀请链接失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询邀请链接失败！"))
+		return
+	}
+	c.Response(g.newInviteLinkResp(model, baseURL, time.Now().Unix()))
+}
+
+// 邀请链接列表
+func (g *Group) inviteLinkList(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	if !g.checkGroupPermission(c, groupNo, PermissionManageInviteLink) {
+		return
+	}
+	models, err := g.db.queryInviteLinksWithGroupNo(groupNo)
+	if err != nil {
+		g.Error("查询邀请链接失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询邀请链接失败！"))
+		return
+	}
+	baseURL, err := g.qrcodeBaseURL(c)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	now := time.Now().Unix()
+	list := make([]*inviteLinkResp, 0, len(models))
+	for _, model := range models {
+		list = append(list, g.newInviteLinkResp(model, baseURL, now))
+	}
+	c.Response(list)
+}
+
+// 撤销邀请链接
+func (g *Group) inviteLinkRevoke(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	linkNo := c.Param("link_no")
+	if !g.checkGroupPermission(c, groupNo, PermissionManageInviteLink) {
+		return
+	}
+	link, err := g.db.QueryInviteLinkWithNo(linkNo)
+	if err != nil {
+		g.Error("查询邀请链接失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询邀请链接失败！"))
+		return
+	}
+	if link == nil || link.GroupNo != groupNo {
+		c.ResponseError(errors.New("邀请链接不存在！"))
+		return
+	}
+	if link.Status == InviteLinkStatusRevoked {
+		c.ResponseOK()
+		return
+	}
+	tx, err := g.ctx.DB().Begin()
+	if err != nil {
+		g.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	if err := g.db.revokeInviteLinkTx(linkNo, tx); err != nil {
+		tx.Rollback()
+		g.Error("撤销邀请链接失败！", zap.Error(err))
+		c.ResponseError(errors.New("撤销邀请链接失败！"))
+		return
+	}
+	if err := g.db.expireJoinRequestsWithInviteLinkTx(linkNo, tx); err != nil {
+		tx.Rollback()
+		g.Error("更新邀请链接的入群申请失败！", zap.Error(err))
+		c.ResponseError(errors.New("更新邀请链接的入群申请失败！"))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.RollbackUnlessCommitted()
+		g.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 通过邀请链接加入的成员
+func (g *Group) inviteLinkMembers(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	linkNo := c.Param("link_no")
+	if !g.checkGroupPermission(c, groupNo, PermissionManageInviteLink) {
+		return
+	}
+	link, err := g.db.QueryInviteLinkWithNo(linkNo)
+	if err != nil {
+		g.Error("查询邀请链接失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询邀请链接失败！"))
+		return
+	}
+	if link == nil || link.GroupNo != groupNo {
+		c.ResponseError(errors.New("邀请链接不存在！"))
+		return
+	}
+	members, err := g.db.queryMembersWithInviteLink(groupNo, linkNo)
+	if err != nil {
+		g.Error("查询通过邀请链接加入的成员失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询通过邀请链接加入的成员失败！"))
+		return
+	}
+	list := make([]*inviteLinkMemberResp, 0, len(members))
+	for _, member := range members {
+		list = append(list, &inviteLinkMemberResp{
+			UID:       member.UID,
+			Name:      member.Name,
+			Remark:    member.Remark,
+			InviteUID: member.InviteUID,
+			JoinedAt:  member.CreatedAt.String(),
+		})
+	}
+	c.Response(list)
+}
+
+// 获取邀请链接信息（扫码或打开链接后展示）
+func (g *Group) inviteLinkGet(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	link, group, ok := g.getInviteLinkAndGroup(c)
+	if !ok {
+		return
+	}
+	memberCount, err := g.db.QueryMemberCount(group.GroupNo)
+	if err != nil {
+		g.Error("查询群成员数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群成员数量失败！"))
+		return
+	}
+	isMember, err := g.db.ExistMember(loginUID, group.GroupNo)
+	if err != nil {
+		g.Error("查询是否存在群内失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否存在群内失败！"))
+		return
+	}
+	usable := true
+	var reason string
+	if err := checkInviteLinkUsable(link, time.Now().Unix()); err != nil {
+		usable = false
+		reason = err.Error()
+	}
+	resp := map[string]interface{}{
+		"link_no":          link.LinkNo,
+		"group_no":         group.GroupNo,
+		"group_name":       group.Name,
+		"member_count":     memberCount,
+		"require_approval": link.RequireApproval,
+		"is_member":        isMember,
+		"usable":           usable,
+		"reason":           reason,
+	}
+	if link.RequireApproval == 1 {
+		resp["join_question"] = group.JoinQuestion
+	}
+	c.Response(resp)
+}
+
+// 通过邀请链接加入群
+func (g *Group) inviteLinkJoin(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req joinRequestReq
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	link, group, ok := g.getInviteLinkAndGroup(c)
+	if !ok {
+		return
+	}
+	if err := checkInviteLinkUsable(link, time.Now().Unix()); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if group.Status == GroupStatusDisabled {
+		c.ResponseError(errors.New("群已被封禁，不能加入"))
+		return
+	}
+	// 链接创建者已没有管理邀请链接的权限时，链接自动失效
+	creatorHasPermission, err := g.permissionService.HasPermission(group.GroupNo, link.Creator, PermissionManageInviteLink)
+	if err != nil {
+		g.Error("查询群权限失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群权限失败！"))
+		return
+	}
+	if !creatorHasPermission {
+		c.ResponseError(errors.New("邀请链接已失效！"))
+		return
+	}
+	if link.RequireApproval == 1 {
+		g.submitJoinRequest(c, group, req, link.LinkNo)
+		return
+	}
+
+	exist, err := g.db.ExistMember(loginUID, group.GroupNo)
+	if err != nil {
+		g.Error("查询是否存在群内失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否存在群内失败！"))
+		return
+	}
+	if exist {
+		c.ResponseError(errors.New("已经在群内！"))
+		return
+	}
+	creator, err := g.userDB.QueryByUID(link.Creator)
+	if err != nil {
+		g.Error("查询链接创建者信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询链接创建者信息失败！"))
+		return
+	}
+	var creatorName string
+	if creator != nil {
+		creatorName = creator.Name
+	}
+
+	tx, err := g.ctx.DB().Begin()
+	if err != nil {
+		g.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	used, err := g.db.useInviteLinkTx(link.LinkNo, time.Now().Unix(), tx)
+	if err != nil {
+		tx.Rollback()
+		g.Error("更新邀请链接加入人数失败！", zap.Error(err))
+		c.ResponseError(errors.New("更新邀请链接加入人数失败！"))
+		return
+	}
+	if !used { // 并发加入时人数已满或链接刚被撤销
+		tx.Rollback()
+		c.ResponseError(errors.New("邀请链接已失效！"))
+		return
+	}
+	commitCallback, err := g.addMembersTx([]string{loginUID}, group.GroupNo, link.Creator, creatorName, tx)
+	if err != nil {
+		tx.Rollback()
+		c.ResponseError(err)
+		return
+	}
+	if err := g.db.updateMemberInviteLinkTx(group.GroupNo, loginUID, link.LinkNo, tx); err != nil {
+		tx.Rollback()
+		g.Error("记录成员的邀请链接失败！", zap.Error(err))
+		c.ResponseError(errors.New("记录成员的邀请链接失败！"))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.RollbackUnlessCommitted()
+		g.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	if commitCallback != nil {
+		commitCallback()
+	}
+	c.Response(map[string]interface{}{
+		"group_no": group.GroupNo,
+	})
+}
+
+// useInviteLinkForRequestTx 审核通过通过邀请链接提交的申请时占用链接的加入人数，链接已撤销、过期或人数已满时返回错误
+func (g *Group) useInviteLinkForRequestTx(linkNo string, tx *dbr.Tx) error {
+	used, err := g.db.useInviteLinkTx(linkNo, time.Now().Unix(), tx)
+	if err != nil {
+		g.Error("更新邀请链接加入人数失败！", zap.Error(err))
+		return errors.New("更新邀请链接加入人数失败！")
+	}
+	if !used {
+		return errors.New("申请使用的邀请链接已失效，不能通过！")
+	}
+	return nil
+}
+
+// recordInviteLinkJoinTx 审核通过通过邀请链接提交的申请后，记录成员是通过哪个链接加入的
+func (g *Group) recordInviteLinkJoinTx(linkNo string, groupNo string, uid string, tx *dbr.Tx) error {
+	if err := g.db.updateMemberInviteLinkTx(groupNo, uid, linkNo, tx); err != nil {
+		g.Error("记录成员的邀请链接失败！", zap.Error(err))
+		return errors.New("记录成员的邀请链接失败！")
+	}
+	return nil
+}
+
+// getInviteLinkAndGroup 获取路径中的邀请链接和所属群，失败时直接响应错误并返回false
+func (g *Group) getInviteLinkAndGroup(c *wkhttp.Context) (*InviteLinkModel, *Model, bool) {
+	link, err := g.db.QueryInviteLinkWithNo(c.Param("link_no"))
+	if err != nil {
+		g.Error("查询邀请链接失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询邀请链接失败！"))
+		return nil, nil, false
+	}
+	if link == nil {
+		c.ResponseError(errors.New("邀请链接不存在！"))
+		return nil, nil, false
+	}
+	group, err := g.getGroupInfo(link.GroupNo)
+	if err != nil {
+		c.ResponseError(err)
+		return nil, nil, false
+	}
+	return link, group, true
+}
+
+// checkInviteLinkUsable 检查邀请链接当前是否可以使用
+func checkInviteLinkUsable(link *InviteLinkModel, now int64) error {
+	if link.Status == InviteLinkStatusRevoked {
+		return errors.New("邀请链接已被撤销！")
+	}
+	if link.ExpireAt > 0 && link.ExpireAt <= now {
+		return errors.New("邀请链接已过期！")
+	}
+	if link.MaxUses > 0 && link.JoinCount >= link.MaxUses {
+		return errors.New("邀请链接的加入人数已达上限！")
+	}
+	return nil
+}
+
+type inviteLinkReq struct {
+	Name            string `json:"name"`             // 链接名称
+	ExpireSeconds   int64  `json:"expire_seconds"`   // 有效时长（秒），0表示永不过期
+	MaxUses         int    `json:"max_uses"`         // 最多可加入人数，0表示不限制
+	RequireApproval int    `json:"require_approval"` // 是否需要群主或管理员审核 0.否 1.是
+}
+
+func (r inviteLinkReq) check() error {
+	if utf8.RuneCountInString(r.Name) > inviteLinkNameMaxLen {
+		return errors.New("链接名称不能超过40个字！")
+	}
+	if r.ExpireSeconds < 0 || r.ExpireSeconds > inviteLinkMaxExpireTime {
+		return errors.New("有效时长不正确！")
+	}
+	if r.MaxUses < 0 || r.MaxUses > inviteLinkMaxUses {
+		return errors.New("最多可加入人数不正确！")
+	}
+	if r.RequireApproval != 0 && r.RequireApproval != 1 {
+		return errors.New("是否需要审核的值不正确！")
+	}
+	return nil
+}
+
+type inviteLinkResp struct {
+	LinkNo          string `json:"link_no"`          // 链接编号
+	GroupNo         string `json:"group_no"`         // 群编号
+	Name            string `json:"name"`             // 链接名称
+	Creator         string `json:"creator"`          // 创建者uid
+	ExpireAt        int64  `json:"expire_at"`        // 过期时间（秒级时间戳），0表示永不过期
+	MaxUses         int    `json:"max_uses"`         // 最多可加入人数，0表示不限制
+	JoinCount       int    `json:"join_count"`       // 已通过此链接加入的人数
+	RequireApproval int    `json:"require_approval"` // 是否需要审核
+	Status          int    `json:"status"`           // 状态 0.已撤销 1.正常
+	Usable          bool   `json:"usable"`           // 当前是否可用（未撤销、未过期且人数未满）
+	QRCode          string `json:"qrcode"`           // 二维码内容
+	CreatedAt       string `json:"created_at"`
+}
+
+func (g *Group) newInviteLinkResp(model *InviteLinkModel, baseURL string, now int64) *inviteLinkResp {
+	return &inviteLinkResp{
+		LinkNo:          model.LinkNo,
+		GroupNo:         model.GroupNo,
+		Name:            model.Name,
+		Creator:         model.Creator,
+		ExpireAt:        model.ExpireAt,
+		MaxUses:         model.MaxUses,
+		JoinCount:       model.JoinCount,
+		RequireApproval: model.RequireApproval,
+		Status:          model.Status,
+		Usable:          checkInviteLinkUsable(model, now) == nil,
+		QRCode:          g.qrcodeURL(baseURL, InviteLinkCodePrefix+model.LinkNo),
+		CreatedAt:       model.CreatedAt.String(),
+	}
+}
+
+type inviteLinkMemberResp struct {
+	UID       string `json:"uid"`        // 成员uid
+	Name      string `json:"name"`       // 成员名称
+	Remark    string `json:"remark"`     // 成员在群内的备注
+	InviteUID string `json:"invite_uid"` // 邀请人（链接创建者或审核人）
+	JoinedAt  string `json:"joined_at"`  // 加入时间
+}
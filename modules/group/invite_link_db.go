@@ -0,0 +1,86 @@
+package group
+
+import (
+	"github.com/gocraft/dbr/v2"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+)
+
+// insertInviteLink 添加邀请链接
+func (d *DB) insertInviteLink(model *InviteLinkModel) error {
+	_, err := d.session.InsertInto("group_invite_link").Columns(util.AttrToUnderscore(model)...).Record(model).Exec()
+	return err
+}
+
+// QueryInviteLinkWithNo 通过链接编号查询
+func (d *DB) QueryInviteLinkWithNo(linkNo string) (*InviteLinkModel, error) {
+	var model *InviteLinkModel
+	_, err := d.session.Select("*").From("group_invite_link").Where("link_no=?", linkNo).Load(&model)
+	return model, err
+}
+
+// queryInviteLinksWithGroupNo 查询群的邀请链接
+func (d *DB) queryInviteLinksWithGroupNo(groupNo string) ([]*InviteLinkModel, error) {
+	var models []*InviteLinkModel
+	_, err := d.session.Select("*").From("group_invite_link").Where("group_no=?", groupNo).OrderDir("id", false).Load(&models)
+	return models, err
+}
+
+// queryInviteLinkCount 查询群内未撤销的邀请链接数量
+func (d *DB) queryInviteLinkCount(groupNo string) (int64, error) {
+	var count int64
+	_, err := d.session.Select("count(*)").From("group_invite_link").Where("group_no=? and status=?", groupNo, InviteLinkStatusNormal).Load(&count)
+	return count, err
+}
+
+// revokeInviteLinkTx 撤销邀请链接
+func (d *DB) revokeInviteLinkTx(linkNo string, tx *dbr.Tx) error {
+	_, err := tx.Update("group_invite_link").Set("status", InviteLinkStatusRevoked).Where("link_no=?", linkNo).Exec()
+	return err
+}
+
+// expireJoinRequestsWithInviteLinkTx 链接撤销后，通过此链接提交的待审核申请标记为已过期
+func (d *DB) expireJoinRequestsWithInviteLinkTx(linkNo string, tx *dbr.Tx) error {
+	_, err := tx.Update("group_join_request").Set("status", JoinRequestStatusExpired).Set("updated_at", dbr.Expr("NOW()")).Where("invite_link_no=? and status=?", linkNo, JoinRequestStatusWait).Exec()
+	return err
+}
+
+// useInviteLinkTx 通过链接加入时增加加入人数（链接已撤销、过期或人数已满时返回false）
+func (d *DB) useInviteLinkTx(linkNo string, now int64, tx *dbr.Tx) (bool, error) {
+	result, err := tx.UpdateBySql("UPDATE group_invite_link SET join_count=join_count+1 WHERE link_no=? and status=? and (expire_at=0 or expire_at>?) and (max_uses=0 or join_count<max_uses)", linkNo, InviteLinkStatusNormal, now).Exec()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// updateMemberInviteLinkTx 记录成员是通过哪个链接加入的
+func (d *DB) updateMemberInviteLinkTx(groupNo string, uid string, linkNo string, tx *dbr.Tx) error {
+	_, err := tx.Update("group_member").Set("invite_link_no", linkNo).Where("group_no=? and uid=?", groupNo, uid).Exec()
+	return err
+}
+
+// queryMembersWithInviteLink 查询通过链接加入的成员
+func (d *DB) queryMembersWithInviteLink(groupNo string, linkNo string) ([]*MemberDetailModel, error) {
+	var models []*MemberDetailModel
+	_, err := d.session.Select("group_member.id,group_member.uid,group_member.group_no,group_member.remark,group_member.role,IFNULL(user.name,'') name,IFNULL(user.username,'') username,group_member.status,group_member.invite_uid,group_member.created_at,group_member.updated_at").From("group_member").LeftJoin("user", "group_member.uid=user.uid").Where("group_member.group_no=? and group_member.invite_link_no=? and group_member.is_deleted=0", groupNo, linkNo).OrderDir("group_member.created_at", false).Load(&models)
+	return models, err
+}
+
+// InviteLinkModel 群邀请链接
+type InviteLinkModel struct {
+	LinkNo          string // 链接唯一编号
+	GroupNo         string // 群编号
+	Name            string // 链接名称
+	Creator         string // 创建者uid
+	ExpireAt        int64  // 过期时间（秒级时间戳），0表示永不过期
+	MaxUses         int    // 最多可加入人数，0表示不限制
+	JoinCount       int    // 已通过此链接加入的人数
+	RequireApproval int    // 是否需要群主或管理员审核
+	Status          int    // 状态 0.已撤销 1.正常
+	db.BaseModel
+}
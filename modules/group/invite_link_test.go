@@ -0,0 +1,36 @@
+package group
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckInviteLinkUsable(t *testing.T) {
+	now := int64(1700000000)
+	assert.NoError(t, checkInviteLinkUsable(&InviteLinkModel{Status: InviteLinkStatusNormal}, now))
+
+	// 已撤销
+	assert.Error(t, checkInviteLinkUsable(&InviteLinkModel{Status: InviteLinkStatusRevoked}, now))
+
+	// 过期时间为0表示永不过期
+	assert.NoError(t, checkInviteLinkUsable(&InviteLinkModel{Status: InviteLinkStatusNormal, ExpireAt: now + 1}, now))
+	assert.Error(t, checkInviteLinkUsable(&InviteLinkModel{Status: InviteLinkStatusNormal, ExpireAt: now}, now))
+
+	// 最多可加入人数为0表示不限制
+	assert.NoError(t, checkInviteLinkUsable(&InviteLinkModel{Status: InviteLinkStatusNormal, JoinCount: 1000}, now))
+	assert.NoError(t, checkInviteLinkUsable(&InviteLinkModel{Status: InviteLinkStatusNormal, MaxUses: 10, JoinCount: 9}, now))
+	assert.Error(t, checkInviteLinkUsable(&InviteLinkModel{Status: InviteLinkStatusNormal, MaxUses: 10, JoinCount: 10}, now))
+}
+
+func TestInviteLinkReqCheck(t *testing.T) {
+	assert.NoError(t, inviteLinkReq{}.check())
+	assert.NoError(t, inviteLinkReq{Name: strings.Repeat("字", inviteLinkNameMaxLen), ExpireSeconds: 3600, MaxUses: 50, RequireApproval: 1}.check())
+
+	assert.Error(t, inviteLinkReq{Name: strings.Repeat("字", inviteLinkNameMaxLen+1)}.check())
+	assert.Error(t, inviteLinkReq{ExpireSeconds: -1}.check())
+	assert.Error(t, inviteLinkReq{ExpireSeconds: inviteLinkMaxExpireTime + 1}.check())
+	assert.Error(t, inviteLinkReq{MaxUses: -1}.check())
+	assert.Error(t, inviteLinkReq{RequireApproval: 2}.check())
+}
@@ -0,0 +1,387 @@
+package group
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/common"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	joinRequestExpire         = time.Hour * 24 * 7 // 入群申请有效期
+	joinRequestReasonMaxLen   = 200                // 申请理由最大长度
+	joinRequestAnswerMaxLen   = 200                // 回答最大长度
+	joinQuestionMaxLen        = 100                // 入群问题最大长度
+	joinRequestExpireInterval = time.Minute * 10   // 清理过期申请的间隔
+	joinRequestRejectCooldown = time.Hour * 24     // 申请被拒绝后多久才能再次申请
+)
+
+// 申请入群
+func (g *Group) joinRequestAdd(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	var req joinRequestReq
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	group, err := g.getGroupInfo(groupNo)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	// 默认只能通过需审核的邀请链接申请，群开启后才允许直接申请
+	if group.AllowJoinRequest != 1 {
+		c.ResponseError(errors.New("该群未开启入群申请！"))
+		return
+	}
+	g.submitJoinRequest(c, group, req, "")
+}
+
+// submitJoinRequest 保存入群申请并通知群主和管理员
+func (g *Group) submitJoinRequest(c *wkhttp.Context, group *Model, req joinRequestReq, inviteLinkNo string) {
+	loginUID := c.GetLoginUID()
+	loginName := c.GetLoginName()
+	groupNo := group.GroupNo
+	req.Reason = strings.TrimSpace(req.Reason)
+	req.Answer = strings.TrimSpace(req.Answer)
+	if err := req.check(group.JoinQuestion); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if group.Status == GroupStatusDisabled {
+		c.ResponseError(errors.New("群已被封禁，不能申请加入"))
+		return
+	}
+	existMember, err := g.db.ExistMember(loginUID, groupNo)
+	if err != nil {
+		g.Error("查询是否存在群内时失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否存在群内时失败！"))
+		return
+	}
+	if existMember {
+		c.ResponseError(errors.New("已经在群内，不能再申请！"))
+		return
+	}
+
+	now := time.Now()
+	rejected, err := g.db.queryLastRejectedJoinRequest(groupNo, loginUID)
+	if err != nil {
+		g.Error("查询被拒绝的入群申请失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询被拒绝的入群申请失败！"))
+		return
+	}
+	if rejected != nil {
+		if left := joinRequestCooldownLeft(time.Time(rejected.UpdatedAt), now); left > 0 {
+			c.ResponseError(fmt.Errorf("入群申请已被拒绝，请%d分钟后再试", int(math.Ceil(left.Minutes()))))
+			return
+		}
+	}
+	model, err := g.db.queryWaitJoinRequest(groupNo, loginUID, now.Unix())
+	if err != nil {
+		g.Error("查询入群申请失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询入群申请失败！"))
+		return
+	}
+	refresh := model != nil
+	if refresh { // 已有待审核的申请，更新申请内容
+		model.Reason = req.Reason
+		model.Question = group.JoinQuestion
+		model.Answer = req.Answer
+		model.ExpireAt = now.Add(joinRequestExpire).Unix()
+		model.InviteLinkNo = inviteLinkNo
+		err = g.db.updateWaitJoinRequest(model)
+	} else {
+		model = &JoinRequestModel{
+			RequestNo:    util.GenerUUID(),
+			GroupNo:      groupNo,
+			UID:          loginUID,
+			Reason:       req.Reason,
+			Question:     group.JoinQuestion,
+			Answer:       req.Answer,
+			Status:       JoinRequestStatusWait,
+			ExpireAt:     now.Add(joinRequestExpire).Unix(),
+			InviteLinkNo: inviteLinkNo,
+		}
+		err = g.db.insertJoinRequest(model)
+	}
+	if err != nil {
+		g.Error("保存入群申请失败！", zap.Error(err))
+		c.ResponseError(errors.New("保存入群申请失败！"))
+		return
+	}
+
+	if refresh { // 只是更新了待审核的申请，不重复通知
+		c.Response(map[string]interface{}{
+			"request_no": model.RequestNo,
+		})
+		return
+	}
+	managerUIDs, err := g.permissionService.GetMemberUIDsWithPermission(groupNo, PermissionInviteMember)
+	if err != nil {
+		g.Error("查询可以审核入群申请的成员uid失败！", zap.String("group_no", groupNo), zap.Error(err))
+	} else if len(managerUIDs) > 0 {
+		err = g.ctx.SendCMD(config.MsgCMDReq{
+			CMD:         CMDGroupJoinRequest,
+			Subscribers: managerUIDs,
+			Param: map[string]interface{}{
+				"group_no":   groupNo,
+				"request_no": model.RequestNo,
+				"uid":        loginUID,
+				"name":       loginName,
+				"reason":     model.Reason,
+			},
+		})
+		if err != nil {
+			g.Warn("发送入群申请命令失败！", zap.Error(err))
+		}
+	}
+	c.Response(map[string]interface{}{
+		"request_no": model.RequestNo,
+	})
+}
+
+// 待审核的入群申请列表
+func (g *Group) joinRequestList(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	if !g.checkGroupPermission(c, groupNo, PermissionInviteMember) {
+		return
+	}
+	pageIndex, pageSize := c.GetPage()
+	now := time.Now().Unix()
+	models, err := g.db.queryWaitJoinRequestsWithPage(groupNo, now, uint64(pageSize), uint64(pageIndex))
+	if err != nil {
+		g.Error("查询入群申请失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询入群申请失败！"))
+		return
+	}
+	count, err := g.db.queryWaitJoinRequestCount(groupNo, now)
+	if err != nil {
+		g.Error("查询入群申请数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询入群申请数量失败！"))
+		return
+	}
+	list := make([]*joinRequestResp, 0, len(models))
+	for _, model := range models {
+		list = append(list, newJoinRequestResp(model))
+	}
+	c.Response(map[string]interface{}{
+		"count": count,
+		"list":  list,
+	})
+}
+
+// 通过入群申请
+func (g *Group) joinRequestApprove(c *wkhttp.Context) {
+	g.handleJoinRequest(c, JoinRequestStatusApproved)
+}
+
+// 拒绝入群申请
+func (g *Group) joinRequestReject(c *wkhttp.Context) {
+	g.handleJoinRequest(c, JoinRequestStatusRejected)
+}
+
+func (g *Group) handleJoinRequest(c *wkhttp.Context, status int) {
+	loginUID := c.GetLoginUID()
+	loginName := c.GetLoginName()
+	groupNo := c.Param("group_no")
+	requestNo := c.Param("request_no")
+	if _, err := g.getGroupInfo(groupNo); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if !g.checkGroupPermission(c, groupNo, PermissionInviteMember) {
+		return
+	}
+	model, err := g.db.queryJoinRequestWithNo(requestNo)
+	if err != nil {
+		g.Error("查询入群申请失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询入群申请失败！"))
+		return
+	}
+	if model == nil || model.GroupNo != groupNo {
+		c.ResponseError(errors.New("入群申请不存在！"))
+		return
+	}
+
+	tx, err := g.ctx.DB().Begin()
+	if err != nil {
+		g.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	handled, err := g.db.handleJoinRequestTx(requestNo, status, loginUID, time.Now().Unix(), tx)
+	if err != nil {
+		tx.Rollback()
+		g.Error("更新入群申请状态失败！", zap.Error(err))
+		c.ResponseError(errors.New("更新入群申请状态失败！"))
+		return
+	}
+	if !handled {
+		tx.Rollback()
+		c.ResponseError(errors.New("入群申请已被处理或已过期！"))
+		return
+	}
+	var commitCallback func()
+	if status == JoinRequestStatusApproved {
+		if model.InviteLinkNo != "" {
+			if err := g.useInviteLinkForRequestTx(model.InviteLinkNo, tx); err != nil {
+				tx.Rollback()
+				c.ResponseError(err)
+				return
+			}
+		}
+		commitCallback, err = g.addMembersTx([]string{model.UID}, groupNo, loginUID, loginName, tx)
+		if err != nil {
+			tx.Rollback()
+			c.ResponseError(err)
+			return
+		}
+		if model.InviteLinkNo != "" {
+			if err := g.recordInviteLinkJoinTx(model.InviteLinkNo, groupNo, model.UID, tx); err != nil {
+				tx.Rollback()
+				c.ResponseError(err)
+				return
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tx.RollbackUnlessCommitted()
+		g.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	if commitCallback != nil {
+		commitCallback()
+	}
+
+	subscribers, err := g.permissionService.GetMemberUIDsWithPermission(groupNo, PermissionInviteMember)
+	if err != nil {
+		g.Error("查询可以审核入群申请的成员uid失败！", zap.String("group_no", groupNo), zap.Error(err))
+	}
+	subscribers = append(subscribers, model.UID)
+	err = g.ctx.SendCMD(config.MsgCMDReq{
+		CMD:         CMDGroupJoinRequestHandled,
+		Subscribers: util.RemoveRepeatedElement(subscribers),
+		Param: map[string]interface{}{
+			"group_no":   groupNo,
+			"request_no": requestNo,
+			"uid":        model.UID,
+			"status":     status,
+			"handler":    loginUID,
+		},
+	})
+	if err != nil {
+		g.Warn("发送入群申请处理命令失败！", zap.Error(err))
+	}
+	c.ResponseOK()
+}
+
+// 修改入群申请问题
+func (g *Group) joinQuestionUpdate(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	var req struct {
+		Question string `json:"question"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	question := strings.TrimSpace(req.Question)
+	if utf8.RuneCountInString(question) > joinQuestionMaxLen {
+		c.ResponseError(errors.New("入群问题不能超过100个字！"))
+		return
+	}
+	if _, err := g.getGroupInfo(groupNo); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if !g.checkGroupPermission(c, groupNo, PermissionChangeSetting) {
+		return
+	}
+	err := g.db.updateJoinQuestion(groupNo, question, g.ctx.GenSeq(common.GroupSeqKey))
+	if err != nil {
+		g.Error("修改入群问题失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改入群问题失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// expireJoinRequests 定时将过期的入群申请标记为已过期
+func (g *Group) expireJoinRequests() {
+	count, err := g.db.expireJoinRequests(time.Now().Unix())
+	if err != nil {
+		g.Warn("清理过期的入群申请失败！", zap.Error(err))
+		return
+	}
+	if count > 0 {
+		g.Info("入群申请已过期", zap.Int64("count", count))
+	}
+}
+
+// joinRequestCooldownLeft 申请被拒绝后还需要等待多久才能再次申请
+func joinRequestCooldownLeft(rejectedAt time.Time, now time.Time) time.Duration {
+	return rejectedAt.Add(joinRequestRejectCooldown).Sub(now)
+}
+
+type joinRequestReq struct {
+	Reason string `json:"reason"` // 申请理由
+	Answer string `json:"answer"` // 入群问题的回答
+}
+
+func (j joinRequestReq) check(question string) error {
+	if utf8.RuneCountInString(j.Reason) > joinRequestReasonMaxLen {
+		return errors.New("申请理由不能超过200个字！")
+	}
+	if utf8.RuneCountInString(j.Answer) > joinRequestAnswerMaxLen {
+		return errors.New("回答不能超过200个字！")
+	}
+	if question != "" && j.Answer == "" {
+		return errors.New("请回答入群问题！")
+	}
+	return nil
+}
+
+type joinRequestResp struct {
+	RequestNo string `json:"request_no"` // 申请编号
+	GroupNo   string `json:"group_no"`   // 群编号
+	UID       string `json:"uid"`        // 申请者uid
+	Name      string `json:"name"`       // 申请者名称
+	Reason    string `json:"reason"`     // 申请理由
+	Question  string `json:"question"`   // 申请时群设置的问题
+	Answer    string `json:"answer"`     // 问题的回答
+	Status    int    `json:"status"`     // 状态 0.待审核 1.已通过 2.已拒绝 3.已过期
+	ExpireAt  int64  `json:"expire_at"`  // 过期时间（秒级时间戳）
+	CreatedAt string `json:"created_at"`
+}
+
+func newJoinRequestResp(model *JoinRequestDetailModel) *joinRequestResp {
+	return &joinRequestResp{
+		RequestNo: model.RequestNo,
+		GroupNo:   model.GroupNo,
+		UID:       model.UID,
+		Name:      model.Name,
+		Reason:    model.Reason,
+		Question:  model.Question,
+		Answer:    model.Answer,
+		Status:    model.Status,
+		ExpireAt:  model.ExpireAt,
+		CreatedAt: model.CreatedAt.String(),
+	}
+}
@@ -0,0 +1,110 @@
+package group
+
+import (
+	"github.com/gocraft/dbr/v2"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+)
+
+// insertJoinRequest 添加入群申请
+func (d *DB) insertJoinRequest(model *JoinRequestModel) error {
+	_, err := d.session.InsertInto("group_join_request").Columns(util.AttrToUnderscore(model)...).Record(model).Exec()
+	return err
+}
+
+// queryWaitJoinRequest 查询用户在群里未过期的待审核申请
+func (d *DB) queryWaitJoinRequest(groupNo string, uid string, now int64) (*JoinRequestModel, error) {
+	var model *JoinRequestModel
+	_, err := d.session.Select("*").From("group_join_request").Where("group_no=? and uid=? and status=? and expire_at>?", groupNo, uid, JoinRequestStatusWait, now).OrderDir("id", false).Limit(1).Load(&model)
+	return model, err
+}
+
+// queryLastRejectedJoinRequest 查询用户在群里最近一次被拒绝的申请
+func (d *DB) queryLastRejectedJoinRequest(groupNo string, uid string) (*JoinRequestModel, error) {
+	var model *JoinRequestModel
+	_, err := d.session.Select("*").From("group_join_request").Where("group_no=? and uid=? and status=?", groupNo, uid, JoinRequestStatusRejected).OrderDir("id", false).Limit(1).Load(&model)
+	return model, err
+}
+
+// updateWaitJoinRequest 用户再次申请时更新申请内容和过期时间
+func (d *DB) updateWaitJoinRequest(model *JoinRequestModel) error {
+	_, err := d.session.Update("group_join_request").SetMap(map[string]interface{}{
+		"reason":         model.Reason,
+		"question":       model.Question,
+		"answer":         model.Answer,
+		"expire_at":      model.ExpireAt,
+		"invite_link_no": model.InviteLinkNo,
+	}).Where("request_no=? and status=?", model.RequestNo, JoinRequestStatusWait).Exec()
+	return err
+}
+
+// queryJoinRequestWithNo 通过申请编号查询
+func (d *DB) queryJoinRequestWithNo(requestNo string) (*JoinRequestModel, error) {
+	var model *JoinRequestModel
+	_, err := d.session.Select("*").From("group_join_request").Where("request_no=?", requestNo).Load(&model)
+	return model, err
+}
+
+// queryWaitJoinRequestsWithPage 分页查询群内待审核的申请
+func (d *DB) queryWaitJoinRequestsWithPage(groupNo string, now int64, pageSize, page uint64) ([]*JoinRequestDetailModel, error) {
+	var models []*JoinRequestDetailModel
+	_, err := d.session.Select("group_join_request.*,IFNULL(user.name,'') name").From("group_join_request").LeftJoin("user", "group_join_request.uid=user.uid").Where("group_join_request.group_no=? and group_join_request.status=? and group_join_request.expire_at>?", groupNo, JoinRequestStatusWait, now).OrderDir("group_join_request.id", false).Offset((page - 1) * pageSize).Limit(pageSize).Load(&models)
+	return models, err
+}
+
+// queryWaitJoinRequestCount 查询群内待审核的申请数量
+func (d *DB) queryWaitJoinRequestCount(groupNo string, now int64) (int64, error) {
+	var count int64
+	_, err := d.session.Select("count(*)").From("group_join_request").Where("group_no=? and status=? and expire_at>?", groupNo, JoinRequestStatusWait, now).Load(&count)
+	return count, err
+}
+
+// handleJoinRequestTx 处理待审核的申请，返回是否处理成功（已被其他管理员处理或已过期返回false）
+func (d *DB) handleJoinRequestTx(requestNo string, status int, handler string, now int64, tx *dbr.Tx) (bool, error) {
+	result, err := tx.Update("group_join_request").Set("status", status).Set("handler", handler).Set("updated_at", dbr.Expr("NOW()")).Where("request_no=? and status=? and expire_at>?", requestNo, JoinRequestStatusWait, now).Exec()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// expireJoinRequests 将过期的待审核申请标记为已过期
+func (d *DB) expireJoinRequests(now int64) (int64, error) {
+	result, err := d.session.Update("group_join_request").Set("status", JoinRequestStatusExpired).Where("status=? and expire_at<=?", JoinRequestStatusWait, now).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// updateJoinQuestion 修改入群申请问题
+func (d *DB) updateJoinQuestion(groupNo string, question string, version int64) error {
+	_, err := d.session.Update("group").Set("join_question", question).Set("version", version).Where("group_no=?", groupNo).Exec()
+	return err
+}
+
+// JoinRequestModel 入群申请
+type JoinRequestModel struct {
+	RequestNo string // 申请唯一编号
+	GroupNo   string // 群编号
+	UID       string // 申请者uid
+	Reason    string // 申请理由
+	Question  string // 申请时群设置的问题
+	Answer    string // 问题的回答
+	Status    int    // 状态 0.待审核 1.已通过 2.已拒绝 3.已过期
+	Handler   string // 处理者uid
+	ExpireAt  int64  // 过期时间（秒级时间戳）
+	// 通过哪个邀请链接申请的
+	InviteLinkNo string
+	db.BaseModel
+}
+
+// JoinRequestDetailModel 入群申请详情
+type JoinRequestDetailModel struct {
+	JoinRequestModel
+	Name string // 申请者名称
+}
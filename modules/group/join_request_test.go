@@ -0,0 +1,30 @@
+package group
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinRequestReqCheck(t *testing.T) {
+	assert.NoError(t, joinRequestReq{}.check(""))
+	assert.NoError(t, joinRequestReq{Reason: "我是群主的同事"}.check(""))
+
+	// 群设置了问题时必须回答
+	assert.Error(t, joinRequestReq{Reason: "你好"}.check("你的工号是多少？"))
+	assert.NoError(t, joinRequestReq{Answer: "1024"}.check("你的工号是多少？"))
+
+	// 按字数而不是字节数限制长度
+	assert.NoError(t, joinRequestReq{Reason: strings.Repeat("字", joinRequestReasonMaxLen)}.check(""))
+	assert.Error(t, joinRequestReq{Reason: strings.Repeat("字", joinRequestReasonMaxLen+1)}.check(""))
+	assert.Error(t, joinRequestReq{Answer: strings.Repeat("a", joinRequestAnswerMaxLen+1)}.check(""))
+}
+
+func TestJoinRequestCooldownLeft(t *testing.T) {
+	now := time.Now()
+	assert.True(t, joinRequestCooldownLeft(now.Add(-time.Hour), now) > 0)
+	assert.Equal(t, time.Hour, joinRequestCooldownLeft(now.Add(time.Hour-joinRequestRejectCooldown), now))
+	assert.True(t, joinRequestCooldownLeft(now.Add(-joinRequestRejectCooldown), now) <= 0)
+}
@@ -0,0 +1,233 @@
+package group
+
+import (
+	"strings"
+
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+)
+
+// Permission 群权限
+type Permission string
+
+const (
+	// PermissionInviteMember 邀请成员（包括群开启邀请模式后直接拉人、确认邀请和审核入群申请）
+	PermissionInviteMember Permission = "invite_member"
+	// PermissionRemoveMember 移除成员（包括拉黑）
+	PermissionRemoveMember Permission = "remove_member"
+	// PermissionMuteMember 禁言成员（包括全员禁言）
+	PermissionMuteMember Permission = "mute_member"
+	// PermissionPinMessage 置顶消息
+	PermissionPinMessage Permission = "pin_message"
+	// PermissionEditGroupInfo 修改群信息（群名称、群公告、成员在群内的备注）
+	PermissionEditGroupInfo Permission = "edit_group_info"
+	// PermissionChangeSetting 修改群设置
+	PermissionChangeSetting Permission = "change_setting"
+	// PermissionRevokeMessage 撤回或删除他人的消息
+	PermissionRevokeMessage Permission = "revoke_message"
+	// PermissionManageInviteLink 管理邀请链接
+	PermissionManageInviteLink Permission = "manage_invite_link"
+)
+
+// AllPermissions 所有的群权限，群主和管理员拥有所有权限
+var AllPermissions = []Permission{
+	PermissionInviteMember,
+	PermissionRemoveMember,
+	PermissionMuteMember,
+	PermissionPinMessage,
+	PermissionEditGroupInfo,
+	PermissionChangeSetting,
+	PermissionRevokeMessage,
+	PermissionManageInviteLink,
+}
+
+// MemberPermission 成员在群内的角色和权限
+type MemberPermission struct {
+	UID         string
+	Role        int          // 成员角色 0.普通成员 1.创建者 2.管理员
+	RoleNo      string       // 自定义角色编号
+	Permissions []Permission // 拥有的权限
+}
+
+func newMemberPermission(m *memberPermissionModel) *MemberPermission {
+	return &MemberPermission{
+		UID:         m.UID,
+		Role:        m.Role,
+		RoleNo:      m.RoleNo,
+		Permissions: memberPermissions(m.Role, m.Permissions),
+	}
+}
+
+// Has 是否拥有某个权限
+func (m *MemberPermission) Has(permission Permission) bool {
+	if m == nil {
+		return false
+	}
+	for _, p := range m.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// CanOperate 是否可以用某个权限操作另一个成员（只能操作身份比自己低的成员）
+func (m *MemberPermission) CanOperate(target *MemberPermission, permission Permission) bool {
+	if !m.Has(permission) {
+		return false
+	}
+	if target == nil { // 对方已不在群内
+		return true
+	}
+	return m.rank() > target.rank()
+}
+
+// rank 成员身份的高低 群主 > 管理员 > 有自定义角色的成员 > 普通成员
+func (m *MemberPermission) rank() int {
+	switch m.Role {
+	case MemberRoleCreator:
+		return 3
+	case MemberRoleManager:
+		return 2
+	}
+	if m.RoleNo != "" {
+		return 1
+	}
+	return 0
+}
+
+// PermissionService 群权限服务，群和消息模块的权限判断统一走这里
+type PermissionService struct {
+	db *DB
+}
+
+// NewPermissionService NewPermissionService
+func NewPermissionService(ctx *config.Context) *PermissionService {
+	return &PermissionService{
+		db: NewDB(ctx),
+	}
+}
+
+// GetMemberPermission 获取成员在群内的权限，不在群内返回nil
+func (p *PermissionService) GetMemberPermission(groupNo string, uid string) (*MemberPermission, error) {
+	members, err := p.GetMemberPermissions(groupNo, []string{uid})
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+	return members[0], nil
+}
+
+// GetMemberPermissions 获取一批成员在群内的权限
+func (p *PermissionService) GetMemberPermissions(groupNo string, uids []string) ([]*MemberPermission, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	models, err := p.db.queryMemberPermissions(groupNo, uids)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]*MemberPermission, 0, len(models))
+	for _, model := range models {
+		members = append(members, newMemberPermission(model))
+	}
+	return members, nil
+}
+
+// HasPermission 成员是否拥有某个权限
+func (p *PermissionService) HasPermission(groupNo string, uid string, permission Permission) (bool, error) {
+	member, err := p.GetMemberPermission(groupNo, uid)
+	if err != nil {
+		return false, err
+	}
+	return member.Has(permission), nil
+}
+
+// CanOperateMember 操作者是否可以用某个权限操作指定成员
+func (p *PermissionService) CanOperateMember(groupNo string, operatorUID string, memberUID string, permission Permission) (bool, error) {
+	members, err := p.GetMemberPermissions(groupNo, []string{operatorUID, memberUID})
+	if err != nil {
+		return false, err
+	}
+	var operator, member *MemberPermission
+	for _, m := range members {
+		if m.UID == operatorUID {
+			operator = m
+		}
+		if m.UID == memberUID {
+			member = m
+		}
+	}
+	return operator.CanOperate(member, permission), nil
+}
+
+// GetMemberUIDsWithPermission 获取拥有某个权限的成员uid（包括群主和管理员）
+func (p *PermissionService) GetMemberUIDsWithPermission(groupNo string, permission Permission) ([]string, error) {
+	roles, err := p.db.queryRolesWithGroupNo(groupNo)
+	if err != nil {
+		return nil, err
+	}
+	roleNos := make([]string, 0, len(roles))
+	for _, role := range roles {
+		for _, rolePermission := range parsePermissions(role.Permissions) {
+			if rolePermission == permission {
+				roleNos = append(roleNos, role.RoleNo)
+				break
+			}
+		}
+	}
+	return p.db.queryMemberUIDsWithRoles(groupNo, roleNos)
+}
+
+// IsCreatorOrManager 是否是创建者或管理者
+func (p *PermissionService) IsCreatorOrManager(groupNo string, uid string) (bool, error) {
+	member, err := p.GetMemberPermission(groupNo, uid)
+	if err != nil {
+		return false, err
+	}
+	return member != nil && (member.Role == MemberRoleCreator || member.Role == MemberRoleManager), nil
+}
+
+// memberPermissions 计算成员的权限 群主和管理员拥有所有权限，其他成员只有自定义角色的权限
+func memberPermissions(role int, rolePermissions string) []Permission {
+	if role == MemberRoleCreator || role == MemberRoleManager {
+		return AllPermissions
+	}
+	return parsePermissions(rolePermissions)
+}
+
+// parsePermissions 解析以逗号分隔的权限，忽略不认识的权限
+func parsePermissions(s string) []Permission {
+	permissions := make([]Permission, 0)
+	for _, item := range strings.Split(s, ",") {
+		permission := Permission(strings.TrimSpace(item))
+		if permission.valid() {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+// formatPermissions 将权限按固定顺序去重后以逗号拼接
+func formatPermissions(permissions []Permission) string {
+	items := make([]string, 0, len(permissions))
+	for _, p := range AllPermissions {
+		for _, permission := range permissions {
+			if permission == p {
+				items = append(items, string(p))
+				break
+			}
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+func (p Permission) valid() bool {
+	for _, permission := range AllPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
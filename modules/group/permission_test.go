@@ -0,0 +1,55 @@
+package group
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemberPermissions(t *testing.T) {
+	// 群主和管理员拥有所有权限，忽略自定义角色
+	assert.Equal(t, AllPermissions, memberPermissions(MemberRoleCreator, ""))
+	assert.Equal(t, AllPermissions, memberPermissions(MemberRoleManager, "pin_message"))
+
+	// 普通成员只有自定义角色的权限，不认识的权限被忽略
+	assert.Empty(t, memberPermissions(MemberRoleCommon, ""))
+	assert.Equal(t, []Permission{PermissionPinMessage, PermissionMuteMember}, memberPermissions(MemberRoleCommon, "pin_message, mute_member,unknown"))
+}
+
+func TestFormatPermissions(t *testing.T) {
+	assert.Equal(t, "", formatPermissions(nil))
+	// 按固定顺序去重
+	assert.Equal(t, "invite_member,pin_message", formatPermissions([]Permission{PermissionPinMessage, PermissionInviteMember, PermissionPinMessage}))
+	assert.Equal(t, []Permission{PermissionInviteMember, PermissionPinMessage}, parsePermissions("invite_member,pin_message"))
+}
+
+func TestMemberPermissionCanOperate(t *testing.T) {
+	creator := &MemberPermission{Role: MemberRoleCreator, Permissions: AllPermissions}
+	manager := &MemberPermission{Role: MemberRoleManager, Permissions: AllPermissions}
+	muter := &MemberPermission{Role: MemberRoleCommon, RoleNo: "r1", Permissions: []Permission{PermissionMuteMember}}
+	plain := &MemberPermission{Role: MemberRoleCommon}
+
+	assert.True(t, creator.CanOperate(manager, PermissionRemoveMember))
+	assert.False(t, manager.CanOperate(manager, PermissionRemoveMember))
+	assert.False(t, manager.CanOperate(creator, PermissionRevokeMessage))
+
+	// 自定义角色只能用拥有的权限操作没有角色的成员
+	assert.True(t, muter.CanOperate(plain, PermissionMuteMember))
+	assert.False(t, muter.CanOperate(plain, PermissionRemoveMember))
+	assert.False(t, muter.CanOperate(muter, PermissionMuteMember))
+	assert.False(t, muter.CanOperate(manager, PermissionMuteMember))
+	assert.False(t, plain.CanOperate(plain, PermissionMuteMember))
+
+	// 对方已不在群内时只看是否有权限
+	assert.True(t, muter.CanOperate(nil, PermissionMuteMember))
+	var notMember *MemberPermission
+	assert.False(t, notMember.CanOperate(plain, PermissionMuteMember))
+}
+
+func TestRoleReqCheck(t *testing.T) {
+	assert.NoError(t, roleReq{Name: "值班员", Permissions: []Permission{PermissionMuteMember, PermissionPinMessage}}.check())
+	assert.NoError(t, roleReq{Name: "观察员"}.check())
+
+	assert.Error(t, roleReq{}.check())
+	assert.Error(t, roleReq{Name: "值班员", Permissions: []Permission{"disband"}}.check())
+}
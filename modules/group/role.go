@@ -0,0 +1,359 @@
+package group
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/common"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	roleMaxCount   = 20 // 每个群最多可创建的自定义角色数量
+	roleNameMaxLen = 20 // 角色名称最大长度
+)
+
+// 群的自定义角色列表
+func (g *Group) roleList(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	exist, err := g.db.ExistMember(c.GetLoginUID(), groupNo)
+	if err != nil {
+		g.Error("查询是否存在群内失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否存在群内失败！"))
+		return
+	}
+	if !exist {
+		c.ResponseError(errors.New("不在群内，不能查看群角色！"))
+		return
+	}
+	models, err := g.db.queryRolesWithGroupNo(groupNo)
+	if err != nil {
+		g.Error("查询群角色失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群角色失败！"))
+		return
+	}
+	list := make([]*roleResp, 0, len(models))
+	for _, model := range models {
+		list = append(list, newRoleResp(model))
+	}
+	c.Response(list)
+}
+
+// 创建自定义角色
+func (g *Group) roleAdd(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	var req roleReq
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if _, err := g.getGroupInfo(groupNo); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if !g.checkGroupCreator(c, groupNo) {
+		return
+	}
+	count, err := g.db.queryRoleCount(groupNo)
+	if err != nil {
+		g.Error("查询群角色数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群角色数量失败！"))
+		return
+	}
+	if count >= roleMaxCount {
+		c.ResponseError(errors.New("群角色数量已达上限！"))
+		return
+	}
+	model := &RoleModel{
+		RoleNo:      util.GenerUUID(),
+		GroupNo:     groupNo,
+		Name:        req.Name,
+		Permissions: formatPermissions(req.Permissions),
+	}
+	if err := g.db.insertRole(model); err != nil {
+		g.Error("添加群角色失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加群角色失败！"))
+		return
+	}
+	c.Response(newRoleResp(model))
+}
+
+// 修改自定义角色
+func (g *Group) roleUpdate(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	var req roleReq
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if !g.checkGroupCreator(c, groupNo) {
+		return
+	}
+	model, ok := g.getGroupRole(c, groupNo, c.Param("role_no"))
+	if !ok {
+		return
+	}
+	model.Name = req.Name
+	model.Permissions = formatPermissions(req.Permissions)
+	if err := g.db.updateRole(model); err != nil {
+		g.Error("修改群角色失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改群角色失败！"))
+		return
+	}
+	// 拥有此角色的成员权限发生了变化，通过同步成员告知客户端
+	err := g.db.updateMembersVersionWithRoleNo(groupNo, model.RoleNo, g.ctx.GenSeq(common.GroupMemberSeqKey))
+	if err != nil {
+		g.Error("更新角色成员版本失败！", zap.Error(err))
+		c.ResponseError(errors.New("更新角色成员版本失败！"))
+		return
+	}
+	g.sendMemberRoleUpdateCMD(groupNo, "")
+	g.refreshMuteWhitelist(groupNo)
+	c.Response(newRoleResp(model))
+}
+
+// 删除自定义角色
+func (g *Group) roleDelete(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	if !g.checkGroupCreator(c, groupNo) {
+		return
+	}
+	model, ok := g.getGroupRole(c, groupNo, c.Param("role_no"))
+	if !ok {
+		return
+	}
+	tx, err := g.ctx.DB().Begin()
+	if err != nil {
+		g.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.RollbackUnlessCommitted()
+			panic(err)
+		}
+	}()
+	if err := g.db.deleteRoleTx(model.RoleNo, tx); err != nil {
+		tx.Rollback()
+		g.Error("删除群角色失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除群角色失败！"))
+		return
+	}
+	if err := g.db.clearMembersRoleNoTx(groupNo, model.RoleNo, g.ctx.GenSeq(common.GroupMemberSeqKey), tx); err != nil {
+		tx.Rollback()
+		g.Error("清除成员的角色失败！", zap.Error(err))
+		c.ResponseError(errors.New("清除成员的角色失败！"))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.RollbackUnlessCommitted()
+		g.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	g.sendMemberRoleUpdateCMD(groupNo, "")
+	g.refreshMuteWhitelist(groupNo)
+	c.ResponseOK()
+}
+
+// 设置成员的自定义角色（role_no为空表示取消角色）
+func (g *Group) memberRoleUpdate(c *wkhttp.Context) {
+	groupNo := c.Param("group_no")
+	memberUID := c.Param("uid")
+	var req struct {
+		RoleNo string `json:"role_no"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		g.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if !g.checkGroupCreator(c, groupNo) {
+		return
+	}
+	member, err := g.db.QueryMemberWithUID(memberUID, groupNo)
+	if err != nil {
+		g.Error("查询成员信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询成员信息失败！"))
+		return
+	}
+	if member == nil {
+		c.ResponseError(errors.New("成员信息不存在！"))
+		return
+	}
+	if req.RoleNo != "" {
+		if _, ok := g.getGroupRole(c, groupNo, req.RoleNo); !ok {
+			return
+		}
+	}
+	err = g.db.updateMemberRoleNo(groupNo, memberUID, req.RoleNo, g.ctx.GenSeq(common.GroupMemberSeqKey))
+	if err != nil {
+		g.Error("设置成员角色失败！", zap.Error(err))
+		c.ResponseError(errors.New("设置成员角色失败！"))
+		return
+	}
+	g.sendMemberRoleUpdateCMD(groupNo, memberUID)
+	g.refreshMuteWhitelist(groupNo)
+	c.ResponseOK()
+}
+
+// getGroupRole 获取群内的角色，不存在时直接响应错误并返回false
+func (g *Group) getGroupRole(c *wkhttp.Context, groupNo string, roleNo string) (*RoleModel, bool) {
+	model, err := g.db.queryRoleWithNo(roleNo)
+	if err != nil {
+		g.Error("查询群角色失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群角色失败！"))
+		return nil, false
+	}
+	if model == nil || model.GroupNo != groupNo {
+		c.ResponseError(errors.New("群角色不存在！"))
+		return nil, false
+	}
+	return model, true
+}
+
+// sendMemberRoleUpdateCMD 成员角色变化后通知客户端同步群成员
+func (g *Group) sendMemberRoleUpdateCMD(groupNo string, uid string) {
+	param := map[string]interface{}{
+		"group_no": groupNo,
+	}
+	if uid != "" {
+		param["uid"] = uid
+	}
+	err := g.ctx.SendCMD(config.MsgCMDReq{
+		ChannelID:   groupNo,
+		ChannelType: common.ChannelTypeGroup.Uint8(),
+		CMD:         common.CMDGroupMemberUpdate,
+		Param:       param,
+	})
+	if err != nil {
+		g.Warn("发送群成员更新命令失败！", zap.Error(err))
+	}
+}
+
+// refreshMuteWhitelist 角色权限变化后，全员禁言中的群重新设置白名单
+func (g *Group) refreshMuteWhitelist(groupNo string) {
+	groupModel, err := g.db.QueryWithGroupNo(groupNo)
+	if err != nil {
+		g.Warn("查询群信息失败！", zap.Error(err))
+		return
+	}
+	if groupModel == nil || groupModel.Forbidden != 1 {
+		return
+	}
+	if err := g.setIMWhitelistForGroupManager(groupNo); err != nil {
+		g.Warn("设置白名单失败！", zap.String("group_no", groupNo), zap.Error(err))
+	}
+}
+
+// checkGroupCreator 只有群主可以操作，否则直接响应错误并返回false
+func (g *Group) checkGroupCreator(c *wkhttp.Context, groupNo string) bool {
+	isCreator, err := g.db.QueryIsGroupCreator(groupNo, c.GetLoginUID())
+	if err != nil {
+		g.Error("查询是否是创建者失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否是创建者失败！"))
+		return false
+	}
+	if !isCreator {
+		c.ResponseError(errors.New("只有群主才能管理群角色！"))
+		return false
+	}
+	return true
+}
+
+// checkGroupPermission 检查登录用户是否拥有群权限，没有时直接响应错误并返回false
+func (g *Group) checkGroupPermission(c *wkhttp.Context, groupNo string, permission Permission) bool {
+	has, err := g.permissionService.HasPermission(groupNo, c.GetLoginUID(), permission)
+	if err != nil {
+		g.Error("查询群权限失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群权限失败！"))
+		return false
+	}
+	if !has {
+		c.ResponseError(errors.New("没有权限！"))
+		return false
+	}
+	return true
+}
+
+// checkOperateMembers 检查登录用户是否可以用某个权限操作这些成员，不可以时直接响应错误并返回false
+func (g *Group) checkOperateMembers(c *wkhttp.Context, groupNo string, memberUIDs []string, permission Permission) bool {
+	loginUID := c.GetLoginUID()
+	members, err := g.permissionService.GetMemberPermissions(groupNo, append([]string{loginUID}, memberUIDs...))
+	if err != nil {
+		g.Error("查询群权限失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群权限失败！"))
+		return false
+	}
+	var operator *MemberPermission
+	for _, member := range members {
+		if member.UID == loginUID {
+			operator = member
+			break
+		}
+	}
+	if !operator.Has(permission) {
+		c.ResponseError(errors.New("没有权限！"))
+		return false
+	}
+	for _, member := range members {
+		if member.UID != loginUID && !operator.CanOperate(member, permission) {
+			c.ResponseError(errors.New("不能操作身份比自己高或相同的成员！"))
+			return false
+		}
+	}
+	return true
+}
+
+type roleReq struct {
+	Name        string       `json:"name"`        // 角色名称
+	Permissions []Permission `json:"permissions"` // 角色拥有的权限
+}
+
+func (r roleReq) check() error {
+	if r.Name == "" {
+		return errors.New("角色名称不能为空！")
+	}
+	if utf8.RuneCountInString(r.Name) > roleNameMaxLen {
+		return errors.New("角色名称不能超过20个字！")
+	}
+	for _, permission := range r.Permissions {
+		if !permission.valid() {
+			return errors.New("不支持的权限！")
+		}
+	}
+	return nil
+}
+
+type roleResp struct {
+	RoleNo      string       `json:"role_no"`     // 角色编号
+	GroupNo     string       `json:"group_no"`    // 群编号
+	Name        string       `json:"name"`        // 角色名称
+	Permissions []Permission `json:"permissions"` // 角色拥有的权限
+}
+
+func newRoleResp(model *RoleModel) *roleResp {
+	return &roleResp{
+		RoleNo:      model.RoleNo,
+		GroupNo:     model.GroupNo,
+		Name:        model.Name,
+		Permissions: parsePermissions(model.Permissions),
+	}
+}
@@ -0,0 +1,103 @@
+package group
+
+import (
+	"github.com/gocraft/dbr/v2"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+)
+
+// insertRole 添加自定义角色
+func (d *DB) insertRole(model *RoleModel) error {
+	_, err := d.session.InsertInto("group_role").Columns(util.AttrToUnderscore(model)...).Record(model).Exec()
+	return err
+}
+
+// updateRole 修改角色名称和权限
+func (d *DB) updateRole(model *RoleModel) error {
+	_, err := d.session.Update("group_role").SetMap(map[string]interface{}{
+		"name":        model.Name,
+		"permissions": model.Permissions,
+	}).Where("role_no=?", model.RoleNo).Exec()
+	return err
+}
+
+// deleteRoleTx 删除角色
+func (d *DB) deleteRoleTx(roleNo string, tx *dbr.Tx) error {
+	_, err := tx.DeleteFrom("group_role").Where("role_no=?", roleNo).Exec()
+	return err
+}
+
+// queryRoleWithNo 通过角色编号查询
+func (d *DB) queryRoleWithNo(roleNo string) (*RoleModel, error) {
+	var model *RoleModel
+	_, err := d.session.Select("*").From("group_role").Where("role_no=?", roleNo).Load(&model)
+	return model, err
+}
+
+// queryRolesWithGroupNo 查询群的所有自定义角色
+func (d *DB) queryRolesWithGroupNo(groupNo string) ([]*RoleModel, error) {
+	var models []*RoleModel
+	_, err := d.session.Select("*").From("group_role").Where("group_no=?", groupNo).OrderDir("id", true).Load(&models)
+	return models, err
+}
+
+// queryRoleCount 查询群的自定义角色数量
+func (d *DB) queryRoleCount(groupNo string) (int64, error) {
+	var count int64
+	_, err := d.session.Select("count(*)").From("group_role").Where("group_no=?", groupNo).Load(&count)
+	return count, err
+}
+
+// updateMemberRoleNo 设置成员的自定义角色
+func (d *DB) updateMemberRoleNo(groupNo string, uid string, roleNo string, version int64) error {
+	_, err := d.session.Update("group_member").Set("role_no", roleNo).Set("version", version).Where("group_no=? and uid=? and is_deleted=0", groupNo, uid).Exec()
+	return err
+}
+
+// updateMembersVersionWithRoleNo 角色权限变更后更新拥有此角色的成员版本，使客户端通过同步成员获取最新权限
+func (d *DB) updateMembersVersionWithRoleNo(groupNo string, roleNo string, version int64) error {
+	_, err := d.session.Update("group_member").Set("version", version).Where("group_no=? and role_no=?", groupNo, roleNo).Exec()
+	return err
+}
+
+// clearMembersRoleNoTx 删除角色时清除成员的角色
+func (d *DB) clearMembersRoleNoTx(groupNo string, roleNo string, version int64, tx *dbr.Tx) error {
+	_, err := tx.Update("group_member").Set("role_no", "").Set("version", version).Where("group_no=? and role_no=?", groupNo, roleNo).Exec()
+	return err
+}
+
+// queryMemberPermissions 查询一批成员的角色及自定义角色的权限
+func (d *DB) queryMemberPermissions(groupNo string, uids []string) ([]*memberPermissionModel, error) {
+	var models []*memberPermissionModel
+	_, err := d.session.Select("group_member.uid,group_member.role,group_member.role_no,IFNULL(group_role.permissions,'') permissions").From("group_member").LeftJoin("group_role", "group_member.role_no=group_role.role_no and group_member.group_no=group_role.group_no").Where("group_member.group_no=? and group_member.uid in ? and group_member.is_deleted=0", groupNo, uids).Load(&models)
+	return models, err
+}
+
+// queryMemberUIDsWithRoles 查询群主、管理员以及拥有指定自定义角色的成员uid
+func (d *DB) queryMemberUIDsWithRoles(groupNo string, roleNos []string) ([]string, error) {
+	var uids []string
+	builder := d.session.Select("uid").From("group_member")
+	if len(roleNos) > 0 {
+		builder = builder.Where("group_no=? and is_deleted=0 and (role=? or role=? or role_no in ?)", groupNo, MemberRoleCreator, MemberRoleManager, roleNos)
+	} else {
+		builder = builder.Where("group_no=? and is_deleted=0 and (role=? or role=?)", groupNo, MemberRoleCreator, MemberRoleManager)
+	}
+	_, err := builder.Load(&uids)
+	return uids, err
+}
+
+// RoleModel 群自定义角色
+type RoleModel struct {
+	RoleNo      string // 角色唯一编号
+	GroupNo     string // 群编号
+	Name        string // 角色名称
+	Permissions string // 角色拥有的权限，多个以逗号分隔
+	db.BaseModel
+}
+
+type memberPermissionModel struct {
+	UID         string
+	Role        int
+	RoleNo      string
+	Permissions string // 自定义角色的权限
+}
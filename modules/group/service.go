@@ -46,6 +46,10 @@ type IService interface {
 	GetMemberUIDsOfManager(groupNo string) ([]string, error)
 	// 是否是创建者或管理者
 	IsCreatorOrManager(groupNo string, uid string) (bool, error)
+	// 成员是否拥有某个群权限
+	HasPermission(groupNo string, uid string, permission Permission) (bool, error)
+	// 操作者是否可以用某个群权限操作指定成员（只能操作身份比自己低的成员）
+	CanOperateMember(groupNo string, operatorUID string, memberUID string, permission Permission) (bool, error)
 	// 获取成员总数量和在线数量
 	// 第一个返回参数为成员总数量
 	// 第二个返回参数为在线数量
@@ -74,17 +78,19 @@ type Service struct {
 	db        *DB
 	managerDB *managerDB
 	log.Log
-	settingDB *settingDB
+	settingDB         *settingDB
+	permissionService *PermissionService
 }
 
 // NewService NewService
 func NewService(ctx *config.Context) IService {
 	return &Service{
-		ctx:       ctx,
-		db:        NewDB(ctx),
-		managerDB: newManagerDB(ctx.DB()),
-		Log:       log.NewTLog("groupService"),
-		settingDB: newSettingDB(ctx),
+		ctx:               ctx,
+		db:                NewDB(ctx),
+		managerDB:         newManagerDB(ctx.DB()),
+		Log:               log.NewTLog("groupService"),
+		settingDB:         newSettingDB(ctx),
+		permissionService: NewPermissionService(ctx),
 	}
 }
 
@@ -316,7 +322,15 @@ func (s *Service) GetMemberUIDsOfManager(groupNo string) ([]string, error) {
 }
 
 func (s *Service) IsCreatorOrManager(groupNo string, uid string) (bool, error) {
-	return s.db.QueryIsGroupManagerOrCreator(groupNo, uid)
+	return s.permissionService.IsCreatorOrManager(groupNo, uid)
+}
+
+func (s *Service) HasPermission(groupNo string, uid string, permission Permission) (bool, error) {
+	return s.permissionService.HasPermission(groupNo, uid, permission)
+}
+
+func (s *Service) CanOperateMember(groupNo string, operatorUID string, memberUID string, permission Permission) (bool, error) {
+	return s.permissionService.CanOperateMember(groupNo, operatorUID, memberUID, permission)
 }
 
 func (s *Service) GetMemberTotalAndOnlineCount(groupNo string) (int, int, error) {
@@ -475,6 +489,7 @@ type SettingResp struct {
 	UID             string
 	GroupNo         string // 群编号
 	Mute            int    // 免打扰
+	MentionOnly     int    // 仅被@时通知
 	Top             int    // 置顶
 	ShowNick        int    // 显示昵称
 	Save            int    // 是否保存
@@ -491,6 +506,7 @@ func toSettingResp(m *Setting) *SettingResp {
 	return &SettingResp{
 		GroupNo:         m.GroupNo,
 		Mute:            m.Mute,
+		MentionOnly:     m.MentionOnly,
 		Top:             m.Top,
 		ShowNick:        m.ShowNick,
 		Save:            m.Save,
@@ -513,6 +529,7 @@ type GroupResp struct {
 	Remark                   string    `json:"remark"`                      // 群备注
 	Notice                   string    `json:"notice"`                      // 群公告
 	Mute                     int       `json:"mute"`                        // 免打扰
+	MentionOnly              int       `json:"mention_only"`                // 仅被@时通知
 	Top                      int       `json:"top"`                         // 置顶
 	ShowNick                 int       `json:"show_nick"`                   // 显示昵称
 	Save                     int       `json:"save"`                        // 是否保存
@@ -547,6 +564,7 @@ func (g *GroupResp) from(model *DetailModel) *GroupResp {
 		Name:                     model.Name,
 		Notice:                   model.Notice,
 		Mute:                     model.Mute,
+		MentionOnly:              model.MentionOnly,
 		Top:                      model.Top,
 		ShowNick:                 model.ShowNick,
 		Save:                     model.Save,
@@ -0,0 +1,3 @@
+-- +migrate Up
+
+ALTER TABLE `group_setting` ADD COLUMN mention_only smallint not null DEFAULT 0 COMMENT '仅被@时通知 0.否 1.是';
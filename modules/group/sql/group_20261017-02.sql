@@ -0,0 +1,24 @@
+-- +migrate Up
+
+ALTER TABLE `group` ADD COLUMN join_question VARCHAR(100) not null DEFAULT '' COMMENT '入群申请问题，为空表示不需要回答';
+
+-- 入群申请
+create table `group_join_request`
+(
+  id           integer       not null primary key AUTO_INCREMENT,
+  request_no   VARCHAR(40)   not null default '', -- 申请唯一编号
+  group_no     VARCHAR(40)   not null default '', -- 群编号
+  uid          VARCHAR(40)   not null default '', -- 申请者uid
+  reason       VARCHAR(200)  not null default '', -- 申请理由
+  question     VARCHAR(100)  not null default '', -- 申请时群设置的问题
+  answer       VARCHAR(200)  not null default '', -- 问题的回答
+  status       smallint      not null default 0,  -- 状态 0.待审核 1.已通过 2.已拒绝 3.已过期
+  handler      VARCHAR(40)   not null default '', -- 处理者uid
+  expire_at    BIGINT        not null default 0,  -- 过期时间（秒级时间戳）
+  created_at   timeStamp     not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at   timeStamp     not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX group_join_request_no on `group_join_request` (request_no);
+CREATE INDEX group_join_request_group_status on `group_join_request` (group_no, status);
+CREATE INDEX group_join_request_uid on `group_join_request` (uid, group_no);
+CREATE INDEX group_join_request_status_expire on `group_join_request` (status, expire_at);
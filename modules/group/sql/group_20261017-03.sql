@@ -0,0 +1,25 @@
+-- +migrate Up
+
+-- 群邀请链接
+create table `group_invite_link`
+(
+  id               integer       not null primary key AUTO_INCREMENT,
+  link_no          VARCHAR(40)   not null default '', -- 链接唯一编号
+  group_no         VARCHAR(40)   not null default '', -- 群编号
+  name             VARCHAR(40)   not null default '', -- 链接名称
+  creator          VARCHAR(40)   not null default '', -- 创建者uid
+  expire_at        BIGINT        not null default 0,  -- 过期时间（秒级时间戳），0表示永不过期
+  max_uses         integer       not null default 0,  -- 最多可加入人数，0表示不限制
+  join_count       integer       not null default 0,  -- 已通过此链接加入的人数
+  require_approval smallint      not null default 0,  -- 是否需要群主或管理员审核 0.否 1.是
+  status           smallint      not null default 1,  -- 状态 0.已撤销 1.正常
+  created_at       timeStamp     not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at       timeStamp     not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX group_invite_link_no on `group_invite_link` (link_no);
+CREATE INDEX group_invite_link_group_no on `group_invite_link` (group_no);
+
+ALTER TABLE `group_member` ADD COLUMN invite_link_no VARCHAR(40) not null DEFAULT '' COMMENT '通过哪个邀请链接加入的群';
+CREATE INDEX group_member_invite_link_no on `group_member` (invite_link_no);
+
+ALTER TABLE `group_join_request` ADD COLUMN invite_link_no VARCHAR(40) not null DEFAULT '' COMMENT '通过哪个邀请链接申请的';
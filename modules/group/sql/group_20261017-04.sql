@@ -0,0 +1,18 @@
+-- +migrate Up
+
+-- 群自定义角色
+create table `group_role`
+(
+  id           integer       not null primary key AUTO_INCREMENT,
+  role_no      VARCHAR(40)   not null default '', -- 角色唯一编号
+  group_no     VARCHAR(40)   not null default '', -- 群编号
+  name         VARCHAR(40)   not null default '', -- 角色名称
+  permissions  VARCHAR(500)  not null default '', -- 角色拥有的权限，多个以逗号分隔
+  created_at   timeStamp     not null DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+  updated_at   timeStamp     not null DEFAULT CURRENT_TIMESTAMP  -- 更新时间
+);
+CREATE UNIQUE INDEX group_role_no on `group_role` (role_no);
+CREATE INDEX group_role_group_no on `group_role` (group_no);
+
+ALTER TABLE `group_member` ADD COLUMN role_no VARCHAR(40) not null DEFAULT '' COMMENT '成员的自定义角色编号';
+CREATE INDEX group_member_role_no on `group_member` (group_no, role_no);
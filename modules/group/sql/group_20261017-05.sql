@@ -0,0 +1,3 @@
+-- +migrate Up
+
+ALTER TABLE `group` ADD COLUMN allow_join_request smallint not null DEFAULT 0 COMMENT '是否允许非成员直接申请入群 0.否 1.是（通过需审核的邀请链接申请不受限制）';
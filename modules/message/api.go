@@ -1053,16 +1053,14 @@ func (m *Message) mutualDelete(c *wkhttp.Context) {
 		return
 	}
 	isCanDelete := true
-	if req.ChannelType == common.ChannelTypeGroup.Uint8() {
-		isManager, err := m.groupService.IsCreatorOrManager(req.ChannelID, loginUID)
+	if req.ChannelType == common.ChannelTypeGroup.Uint8() && resp.Messages[0].FromUID != loginUID {
+		canRevoke, err := m.groupService.CanOperateMember(req.ChannelID, loginUID, resp.Messages[0].FromUID, group.PermissionRevokeMessage)
 		if err != nil {
 			m.Error("查询登录用户群内权限错误", zap.Error(err))
 			c.ResponseError(errors.New("查询登录用户群内权限错误"))
 			return
 		}
-		if resp.Messages[0].FromUID != loginUID && !isManager {
-			isCanDelete = false
-		}
+		isCanDelete = canRevoke
 	}
 	if !isCanDelete {
 		c.ResponseError(errors.New("用户无权删除此消息"))
@@ -1315,28 +1313,8 @@ func (m *Message) hasRevokePermission(messageM *messageModel, loginUID string) (
 	if messageM.FromUID == loginUID { // 自己发的消息允许被撤回
 		return true, nil
 	}
-	if messageM.ChannelType == common.ChannelTypeGroup.Uint8() { // 管理者或创建者可以撤回其他成员的消息
-		loginMember, err := m.groupService.GetMember(messageM.ChannelID, loginUID)
-		if err != nil {
-			return false, err
-		}
-		if loginMember == nil {
-			return false, nil
-		}
-		fromMember, err := m.groupService.GetMember(messageM.ChannelID, messageM.FromUID)
-		if err != nil {
-			return false, err
-		}
-		if fromMember == nil && loginMember.Role != int(common.GroupMemberRoleNormal) {
-			return true, nil
-		}
-		if fromMember.Role == int(common.GroupMemberRoleCreater) || loginMember.Role == int(common.GroupMemberRoleNormal) {
-			return false, nil
-		}
-		if loginMember.Role == int(common.GroupMemberRoleCreater) || (loginMember.Role == int(common.GroupMemberRoleManager) && fromMember.Role == int(common.GroupMemberRoleNormal)) {
-			return true, nil
-		}
-
+	if messageM.ChannelType == common.ChannelTypeGroup.Uint8() { // 有撤回权限的成员可以撤回身份比自己低的成员的消息
+		return m.groupService.CanOperateMember(messageM.ChannelID, loginUID, messageM.FromUID, group.PermissionRevokeMessage)
 	}
 
 	return false, nil
@@ -1352,7 +1330,7 @@ func (m *Message) cancelMentionReminderIfNeed(message *messageModel) {
 		}
 		if payloadMap != nil {
 			if m.hasMention(payloadMap) {
-				all, uids := m.getMention(payloadMap)
+				all, uids := commonapi.GetMention(payloadMap)
 				if all {
 					version := m.ctx.GenSeq(common.RemindersKey)
 					err := m.remindersDB.deleteWithChannel(message.ChannelID, message.ChannelType, message.MessageID, version)
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/group"
 	"github.com/gocraft/dbr/v2"
 	"github.com/pkg/errors"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/common"
@@ -58,13 +59,13 @@ func (m *Message) pinnedMessage(c *wkhttp.Context) {
 			c.ResponseError(errors.New("群不存在或已删除"))
 			return
 		}
-		isCreatorOrManager, err := m.groupService.IsCreatorOrManager(req.ChannelID, loginUID)
+		canPin, err := m.groupService.HasPermission(req.ChannelID, loginUID, group.PermissionPinMessage)
 		if err != nil {
 			m.Error("查询用户在群内权限错误", zap.Error(err))
 			c.ResponseError(errors.New("查询用户在群内权限错误"))
 			return
 		}
-		if !isCreatorOrManager && groupInfo.AllowMemberPinnedMessage == 0 {
+		if !canPin && groupInfo.AllowMemberPinnedMessage == 0 {
 			c.ResponseError(errors.New("普通成员不允许置顶消息"))
 			return
 		}
@@ -267,13 +268,13 @@ func (m *Message) clearPinnedMessage(c *wkhttp.Context) {
 		fakeChannelID = common.GetFakeChannelIDWith(loginUID, req.ChannelID)
 	} else {
 		// 查询权限
-		isCreatorOrManager, err := m.groupService.IsCreatorOrManager(req.ChannelID, loginUID)
+		canPin, err := m.groupService.HasPermission(req.ChannelID, loginUID, group.PermissionPinMessage)
 		if err != nil {
 			m.Error("查询用户在群内权限错误", zap.Error(err))
 			c.ResponseError(errors.New("查询用户在群内权限错误"))
 			return
 		}
-		if !isCreatorOrManager {
+		if !canPin {
 			c.ResponseError(errors.New("用户无权清空置顶消息"))
 			return
 		}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"time"
 
+	commonapi "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/common"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/group"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/common"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
@@ -149,7 +150,7 @@ func (m *Message) getReminders(messages []*config.MessageResp) []*remindersModel
 			continue
 		}
 		if m.hasMention(payloadMap) {
-			all, uids := m.getMention(payloadMap)
+			all, uids := commonapi.GetMention(payloadMap)
 			if all {
 				version := m.ctx.GenSeq(common.RemindersKey)
 				reminders = append(reminders, &remindersModel{
@@ -255,24 +256,6 @@ func (m *Message) hasMention(payloadMap map[string]interface{}) bool {
 	return payloadMap["mention"] != nil
 }
 
-func (m *Message) getMention(payloadMap map[string]interface{}) (all bool, uids []string) {
-	mentionMap := payloadMap["mention"].(map[string]interface{})
-	if mentionMap["all"] != nil {
-		allI, _ := mentionMap["all"].(json.Number).Int64()
-		if allI == 1 {
-			all = true
-		}
-	}
-	if mentionMap["uids"] != nil {
-		uidObjs := mentionMap["uids"].([]interface{})
-		uids = make([]string, 0, len(uidObjs))
-		for _, uidObj := range uidObjs {
-			uids = append(uids, uidObj.(string))
-		}
-	}
-	return
-}
-
 func (m *Message) contentType(payloadMap map[string]interface{}) int {
 	if payloadMap["type"] != nil {
 		contentTypeI, _ := payloadMap["type"].(json.Number).Int64()
@@ -1,9 +1,7 @@
 package message
 
 import (
-	"fmt"
-	"hash/crc32"
-
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/partition"
 	"github.com/gocraft/dbr/v2"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/db"
@@ -12,22 +10,33 @@ import (
 
 // DB DB
 type DB struct {
-	session *dbr.Session
-	ctx     *config.Context
+	session          *dbr.Session
+	ctx              *config.Context
+	partitionService *partition.Service
 }
 
 // NewDB NewDB
 func NewDB(ctx *config.Context) *DB {
 	return &DB{
-		session: ctx.DB(),
-		ctx:     ctx,
+		session:          ctx.DB(),
+		ctx:              ctx,
+		partitionService: partition.GetService(ctx),
 	}
 }
 
+// 查询消息（消息分表迁移中时需要先查旧表再查新表）
 func (d *DB) queryMessageWithMessageID(channelID string, messageID string) (*messageModel, error) {
-	var m *messageModel
-	_, err := d.session.Select("*").From(d.getTable(channelID)).Where("message_id=?", messageID).Load(&m)
-	return m, err
+	for _, table := range d.partitionService.ReadTables(channelID) {
+		var m *messageModel
+		_, err := d.session.Select("*").From(table).Where("message_id=?", messageID).Load(&m)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			return m, nil
+		}
+	}
+	return nil, nil
 }
 
 func (d *DB) queryMessagesWithMessageIDs(channelID string, messageIDs []string) ([]*messageModel, error) {
@@ -35,20 +44,60 @@ func (d *DB) queryMessagesWithMessageIDs(channelID string, messageIDs []string)
 		return nil, nil
 	}
 	var models []*messageModel
-	_, err := d.session.Select("*").From(d.getTable(channelID)).Where("message_id in ?", messageIDs).Load(&models)
-	return models, err
+	for _, table := range d.partitionService.ReadTables(channelID) {
+		var list []*messageModel
+		_, err := d.session.Select("*").From(table).Where("message_id in ?", messageIDs).Load(&list)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, list...)
+	}
+	return uniqueMessages(models), nil
 }
 
 func (d *DB) queryMessagesWithChannelClientMsgNo(channelID string, channelType uint8, clientMsgNo string) ([]*messageModel, error) {
 	var models []*messageModel
-	_, err := d.session.Select("*").From(d.getTable(channelID)).Where("channel_id=? and channel_type=? and client_msg_no=?", channelID, channelType, clientMsgNo).Load(&models)
-	return models, err
+	for _, table := range d.partitionService.ReadTables(channelID) {
+		var list []*messageModel
+		_, err := d.session.Select("*").From(table).Where("channel_id=? and channel_type=? and client_msg_no=?", channelID, channelType, clientMsgNo).Load(&list)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, list...)
+	}
+	return uniqueMessages(models), nil
+}
+
+// uniqueMessages 消息在两次查询之间从旧表移到新表时会被查到两次，按消息ID去重
+func uniqueMessages(models []*messageModel) []*messageModel {
+	if len(models) <= 1 {
+		return models
+	}
+	exists := make(map[int64]bool, len(models))
+	list := make([]*messageModel, 0, len(models))
+	for _, m := range models {
+		if exists[m.MessageID] {
+			continue
+		}
+		exists[m.MessageID] = true
+		list = append(list, m)
+	}
+	return list
 }
 
 func (d *DB) queryMaxMessageSeq(channelID string, channelType uint8) (uint32, error) {
 	var maxMessageSeq uint32
-	err := d.session.Select("IFNULL(max(message_seq),0)").From(d.getTable(channelID)).Where("channel_id=? and channel_type=?", channelID, channelType).LoadOne(&maxMessageSeq)
-	return maxMessageSeq, err
+	for _, table := range d.partitionService.ReadTables(channelID) {
+		var messageSeq uint32
+		err := d.session.Select("IFNULL(max(message_seq),0)").From(table).Where("channel_id=? and channel_type=?", channelID, channelType).LoadOne(&messageSeq)
+		if err != nil {
+			return 0, err
+		}
+		if messageSeq > maxMessageSeq {
+			maxMessageSeq = messageSeq
+		}
+	}
+	return maxMessageSeq, nil
 }
 
 func (d *DB) queryProhibitWordsWithVersion(version int64) ([]*ProhibitWordModel, error) {
@@ -59,19 +108,10 @@ func (d *DB) queryProhibitWordsWithVersion(version int64) ([]*ProhibitWordModel,
 
 // 新增消息
 func (d *DB) insertMessage(m *messageModel) error {
-	_, err := d.session.InsertInto(d.getTable(m.ChannelID)).Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	_, err := d.session.InsertInto(d.partitionService.WriteTable(m.ChannelID)).Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
 	return err
 }
 
-// 通过频道ID获取表
-func (d *DB) getTable(channelID string) string {
-	tableIndex := crc32.ChecksumIEEE([]byte(channelID)) % uint32(d.ctx.GetConfig().TablePartitionConfig.MessageTableCount)
-	if tableIndex == 0 {
-		return "message"
-	}
-	return fmt.Sprintf("message%d", tableIndex)
-}
-
 // ProhibitWordModel 违禁词model
 type ProhibitWordModel struct {
 	Content   string
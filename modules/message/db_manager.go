@@ -1,6 +1,9 @@
 package message
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/gocraft/dbr/v2"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/db"
@@ -41,17 +44,36 @@ func (m *managerDB) queryMsgCount() (int64, error) {
 	return count, err
 }
 
+// 分页查询频道消息（消息分表迁移中时合并新表和旧表）
 func (m *managerDB) queryWithChannelID(channelID string, page, pageSize uint64) ([]*messageModel, error) {
 	var list []*messageModel
-	var table = m.db.getTable(channelID)
-	_, err := m.session.Select("*").From(table).Where("channel_id=?", channelID).Offset((page-1)*pageSize).Limit(pageSize).OrderDir("created_at", false).Load(&list)
+	tables := m.db.partitionService.ReadTables(channelID)
+	if len(tables) == 1 {
+		_, err := m.session.Select("*").From(tables[0]).Where("channel_id=?", channelID).Offset((page-1)*pageSize).Limit(pageSize).OrderDir("created_at", false).Load(&list)
+		return list, err
+	}
+	selects := make([]string, 0, len(tables))
+	args := make([]interface{}, 0, len(tables)+2)
+	for _, table := range tables {
+		selects = append(selects, fmt.Sprintf("SELECT * FROM `%s` WHERE channel_id=?", table))
+		args = append(args, channelID)
+	}
+	args = append(args, pageSize, (page-1)*pageSize)
+	_, err := m.session.SelectBySql(fmt.Sprintf("SELECT * FROM (%s) t ORDER BY created_at DESC LIMIT ? OFFSET ?", strings.Join(selects, " UNION ALL ")), args...).Load(&list)
 	return list, err
 }
 
 func (m *managerDB) queryRecordCount(channelID string) (int64, error) {
-	var count int64
-	_, err := m.session.Select("count(*)").From(m.db.getTable(channelID)).Where("channel_id=?", channelID).Load(&count)
-	return count, err
+	var total int64
+	for _, table := range m.db.partitionService.ReadTables(channelID) {
+		var count int64
+		_, err := m.session.Select("count(*)").From(table).Where("channel_id=?", channelID).Load(&count)
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
 }
 
 func (m *managerDB) queryMsgExtrWithMsgIds(msgIds []string) ([]*messageExtraModel, error) {
@@ -1,64 +1,107 @@
 package openapi
 
 import (
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"net/http"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/app"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/group"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/user"
-	"github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/util"
 	"github.com/gin-gonic/gin"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
 )
 
 type OpenAPI struct {
-	ctx                      *config.Context
-	appService               app.IService
-	openapiAuthcodePrefix    string
-	openapiAccessTokenPrefix string
-	userService              user.IService
+	ctx *config.Context
+	log.Log
+	db                        *openapiDB
+	appService                app.IService
+	openapiAuthcodePrefix     string
+	openapiAccessTokenPrefix  string
+	openapiRefreshTokenPrefix string
+	userService               user.IService
+	groupService              group.IService
+
+	signingKeys         []*signingKey // id_token签名密钥缓存（最新的在前）
+	signingKeysLoadedAt time.Time
+	signingKeysLock     sync.Mutex
 }
 
 func New(ctx *config.Context) *OpenAPI {
 
 	return &OpenAPI{
-		ctx:                      ctx,
-		appService:               app.NewService(ctx),
-		openapiAuthcodePrefix:    "openapi:authcodePrefix:",
-		openapiAccessTokenPrefix: "openapi:accessTokenPrefix:",
-		userService:              user.NewService(ctx),
+		ctx:                       ctx,
+		Log:                       log.NewTLog("openapi"),
+		db:                        newOpenapiDB(ctx),
+		appService:                app.NewService(ctx),
+		openapiAuthcodePrefix:     "openapi:authcodePrefix:",
+		openapiAccessTokenPrefix:  "openapi:accessTokenPrefix:",
+		openapiRefreshTokenPrefix: "openapi:refreshTokenPrefix:",
+		userService:               user.NewService(ctx),
+		groupService:              group.NewService(ctx),
 	}
 }
 
 // Route 路由配置
 func (o *OpenAPI) Route(r *wkhttp.WKHttp) {
+	// OIDC发现文档（issuer为api基地址，同时兼容根路径）
+	r.GET("/.well-known/openid-configuration", o.openidConfiguration)
 	// 不需要认证
 	openapinoauth := r.Group("/v1")
 	{
+		openapinoauth.GET("/.well-known/openid-configuration", o.openidConfiguration)
 		// #################### openapi ####################
-		openapinoauth.GET("/openapi/access_token", o.accessTokenGet) // 获取用户的授权access_token
-		openapinoauth.GET("/openapi/userinfo", o.userinfoGet)        // 获取用户信息
+		openapinoauth.GET("/openapi/access_token", o.accessTokenGet)  // 获取用户的授权access_token（旧版）
+		openapinoauth.GET("/openapi/userinfo", o.userinfoGet)         // 获取用户信息
+		openapinoauth.POST("/openapi/userinfo", o.userinfoGet)        // 获取用户信息
+		openapinoauth.GET("/openapi/oauth/jwks", o.jwks)              // id_token签名公钥
+		openapinoauth.POST("/openapi/oauth/token", o.token)           // 获取或刷新token
+		openapinoauth.POST("/openapi/oauth/revoke", o.revoke)         // 吊销token
+		openapinoauth.POST("/openapi/oauth/introspect", o.introspect) // 查询token状态
+	}
+	// 需要access_token，每个接口校验各自需要的权限
+	openapiresource := r.Group("/v1")
+	{
+		openapiresource.GET("/openapi/friends", o.accessTokenMiddleware(ScopeFriends), o.friendsGet)        // 获取用户好友
+		openapiresource.GET("/openapi/groups", o.accessTokenMiddleware(ScopeGroups), o.groupsGet)           // 获取用户的群聊
+		openapiresource.POST("/openapi/messages", o.accessTokenMiddleware(ScopeSendMessage), o.messageSend) // 以用户身份发送消息
 	}
 	// 需要用户认证
 	openapi := r.Group("/v1", o.ctx.AuthMiddleware(r))
 	{
 		// #################### openapi ####################
-		openapi.GET("/openapi/authcode", o.authcodeGet) // 获取用户的授权authcode
+		openapi.GET("/openapi/authcode", o.authcodeGet)                           // 获取用户的授权authcode（旧版）
+		openapi.GET("/openapi/authorize", o.authorize)                            // 用户同意授权
+		openapi.GET("/openapi/authorized_apps", o.authorizedApps)                 // 我授权过的app
+		openapi.DELETE("/openapi/authorized_apps/:app_id", o.revokeAuthorizedApp) // 取消授权
 	}
 }
 
+// 旧版接口 使用authcode和app_key换取access_token
 func (o *OpenAPI) accessTokenGet(c *wkhttp.Context) {
 	authcode := c.Query("authcode")
 
 	appKey := c.Query("app_key")
-	appID, uid, err := o.getOpenapiAuthcodeCache(authcode)
+	data, err := o.consumeAuthcode(authcode)
 	if err != nil {
 		c.ResponseError(err)
 		return
 	}
+	if data == nil {
+		c.ResponseError(fmt.Errorf("invalid authcode: %s", authcode))
+		return
+	}
+	if data.RedirectURI != "" || data.CodeChallenge != "" {
+		c.ResponseError(errors.New("该授权码只能通过/v1/openapi/oauth/token换取token"))
+		return
+	}
+	appID := data.AppID
 	appResp, err := o.appService.GetApp(appID)
 	if err != nil {
 		c.ResponseError(err)
@@ -72,39 +115,47 @@ func (o *OpenAPI) accessTokenGet(c *wkhttp.Context) {
 		c.ResponseError(fmt.Errorf("appID: %s status: %s", appID, appResp.Status.String()))
 		return
 	}
-	if appResp.AppKey != appKey {
+	if subtle.ConstantTimeCompare([]byte(appResp.AppKey), []byte(appKey)) != 1 {
 		c.ResponseError(fmt.Errorf("appKey: %s not match", appKey))
 		return
 	}
-	accessToken := util.GenerUUID()
-
-	second := 24 * 7 * 3600
-
-	err = o.setOpenapiAccessToken(uid, appID, accessToken, time.Second*time.Duration(second))
+	grant, err := o.db.queryGrant(data.UID, appID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if !grant.usable(data.TokenVersion) {
+		c.ResponseError(errors.New("用户已取消授权"))
+		return
+	}
+	resp, err := o.issueTokens(&tokenData{
+		AppID:        appID,
+		UID:          data.UID,
+		Scope:        data.Scope,
+		TokenVersion: grant.TokenVersion,
+	}, "", 0)
 	if err != nil {
 		c.ResponseError(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"access_token": accessToken,
-		"expire":       second,
-	})
+	c.JSON(http.StatusOK, resp)
 
 }
 
+// 获取用户信息 token包含openid权限时返回OIDC标准声明，否则返回旧版格式
 func (o *OpenAPI) userinfoGet(c *wkhttp.Context) {
-	accessToken := c.Query("access_token")
-
-	appID, uid, err := o.getOpenapiAccessToken(accessToken)
+	data, err := o.checkAccessToken(bearerToken(c))
 	if err != nil {
-		c.ResponseError(err)
+		c.ResponseErrorWithStatus(err, http.StatusUnauthorized)
 		return
 	}
-	if appID == "" || uid == "" {
-		c.ResponseError(fmt.Errorf("invalid accessToken: %s", accessToken))
+	openid := scopeContains(data.Scope, ScopeOpenID)
+	if !openid && !scopeContains(data.Scope, ScopeProfile) {
+		c.ResponseErrorWithStatus(fmt.Errorf("access_token没有%s权限", ScopeProfile), http.StatusUnauthorized)
 		return
 	}
+	appID, uid := data.AppID, data.UID
 	user, err := o.userService.GetUser(uid)
 	if err != nil {
 		c.ResponseError(err)
@@ -114,62 +165,53 @@ func (o *OpenAPI) userinfoGet(c *wkhttp.Context) {
 		c.ResponseError(fmt.Errorf("user: %s not found", uid))
 		return
 	}
-	avatarURL := fmt.Sprintf("%s/%s", o.ctx.GetConfig().External.APIBaseURL, o.ctx.GetConfig().GetAvatarPath(user.UID))
+	if openid {
+		claims := gin.H{
+			"sub": user.UID,
+		}
+		if scopeContains(data.Scope, ScopeProfile) {
+			for k, v := range o.profileClaims(user.UID, user.Name, user.ShortNo) {
+				claims[k] = v
+			}
+		}
+		c.JSON(http.StatusOK, claims)
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"uid":    user.UID,
 		"name":   user.Name,
-		"avatar": avatarURL,
+		"avatar": o.avatarURL(user.UID),
 		"app_id": appID,
 	})
 }
 
+// 旧版接口 获取授权码（只授予profile权限）
 func (o *OpenAPI) authcodeGet(c *wkhttp.Context) {
 	uid := c.GetLoginUID()
 
 	appID := c.Query("app_id")
-
-	authcode := util.GenerUUID()
-
-	err := o.setOpenapiAuthcodeCache(uid, appID, authcode)
+	appResp, err := o.appService.GetApp(appID)
 	if err != nil {
 		c.ResponseError(err)
 		return
 	}
+	if appResp.Status != app.StatusEnable {
+		c.ResponseError(fmt.Errorf("appID: %s status: %s", appID, appResp.Status.String()))
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"authcode": authcode,
+	authcode, err := o.createAuthcode(&authcodeData{
+		AppID: appID,
+		UID:   uid,
+		Scope: ScopeProfile,
 	})
-
-}
-
-func (o *OpenAPI) setOpenapiAuthcodeCache(uid, appID, authcode string) error {
-	return o.ctx.GetRedisConn().SetAndExpire(fmt.Sprintf("%s%s", o.openapiAuthcodePrefix, authcode), fmt.Sprintf("%s@%s", appID, uid), time.Minute*5)
-}
-
-func (o *OpenAPI) getOpenapiAuthcodeCache(authcode string) (string, string, error) {
-	appIDAndUID, err := o.ctx.GetRedisConn().GetString(fmt.Sprintf("%s%s", o.openapiAuthcodePrefix, authcode))
 	if err != nil {
-		return "", "", err
-	}
-	appIDAndUIDArr := strings.Split(appIDAndUID, "@")
-	if len(appIDAndUIDArr) != 2 {
-		return "", "", fmt.Errorf("invalid appIDAndUIDArr: %s", appIDAndUID)
+		c.ResponseError(err)
+		return
 	}
-	return appIDAndUIDArr[0], appIDAndUIDArr[1], nil
-}
 
-func (o *OpenAPI) setOpenapiAccessToken(uid, appID, accessToken string, expire time.Duration) error {
-	return o.ctx.GetRedisConn().SetAndExpire(fmt.Sprintf("%s%s", o.openapiAccessTokenPrefix, accessToken), fmt.Sprintf("%s@%s", appID, uid), expire)
-}
+	c.JSON(http.StatusOK, gin.H{
+		"authcode": authcode,
+	})
 
-func (o *OpenAPI) getOpenapiAccessToken(accessToken string) (string, string, error) {
-	appIDAndUID, err := o.ctx.GetRedisConn().GetString(fmt.Sprintf("%s%s", o.openapiAccessTokenPrefix, accessToken))
-	if err != nil {
-		return "", "", err
-	}
-	appIDAndUIDArr := strings.Split(appIDAndUID, "@")
-	if len(appIDAndUIDArr) != 2 {
-		return "", "", fmt.Errorf("invalid appIDAndUIDArr: %s", appIDAndUID)
-	}
-	return appIDAndUIDArr[0], appIDAndUIDArr[1], nil
 }
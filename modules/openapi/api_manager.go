@@ -0,0 +1,209 @@
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/app"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/common"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// 每个app最多注册的回调地址数量
+const clientMaxRedirectURICount = 10
+
+// Manager openapi后台管理
+type Manager struct {
+	ctx *config.Context
+	log.Log
+	db         *openapiDB
+	appService app.IService
+}
+
+// NewManager NewManager
+func NewManager(ctx *config.Context) *Manager {
+	return &Manager{
+		ctx:        ctx,
+		Log:        log.NewTLog("openapiManager"),
+		db:         newOpenapiDB(ctx),
+		appService: app.NewService(ctx),
+	}
+}
+
+// Route 路由配置
+func (m *Manager) Route(r *wkhttp.WKHttp) {
+	auth := r.Group("/v1/manager", m.ctx.AuthMiddleware(r))
+	{
+		auth.GET("/openapi/scopes", m.scopes)                         // 支持的权限
+		auth.GET("/openapi/clients/:app_id", m.clientGet)             // 获取app的OAuth2配置
+		auth.PUT("/openapi/clients/:app_id", m.clientUpdate)          // 修改app的OAuth2配置
+		auth.POST("/openapi/signing_keys/rotate", m.rotateSigningKey) // 立即轮换id_token签名密钥
+	}
+}
+
+// 支持的权限
+func (m *Manager) scopes(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	list := make([]*scopeResp, 0, len(scopeDescMap))
+	for _, scope := range scopeKeys() {
+		list = append(list, &scopeResp{
+			Scope: scope,
+			Desc:  scopeDescMap[scope],
+		})
+	}
+	c.Response(list)
+}
+
+// 获取app的OAuth2配置
+func (m *Manager) clientGet(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	appID := c.Param("app_id")
+	client, err := m.db.queryClientWithAppID(appID)
+	if err != nil {
+		m.Error("查询openapi客户端失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询openapi客户端失败！"))
+		return
+	}
+	resp := &clientResp{
+		AppID:        appID,
+		RedirectURIs: make([]string, 0),
+		Scopes:       make([]string, 0),
+	}
+	if client != nil {
+		if uris := client.redirectURIList(); len(uris) > 0 {
+			resp.RedirectURIs = uris
+		}
+		resp.Scopes = parseScope(client.Scopes)
+	}
+	c.Response(resp)
+}
+
+// 修改app的OAuth2配置
+func (m *Manager) clientUpdate(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	appID := c.Param("app_id")
+	var req clientReq
+	if err := c.BindJSON(&req); err != nil {
+		m.Error(common.ErrData.Error(), zap.Error(err))
+		c.ResponseError(common.ErrData)
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	appResp, err := m.appService.GetApp(appID)
+	if err != nil || appResp == nil {
+		c.ResponseError(errors.New("app不存在！"))
+		return
+	}
+	err = m.db.upsertClient(&clientModel{
+		AppID:        appID,
+		RedirectUris: util.ToJson(req.RedirectURIs),
+		Scopes:       joinScope(req.Scopes),
+	})
+	if err != nil {
+		m.Error("修改openapi客户端失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改openapi客户端失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 立即轮换id_token签名密钥（旧密钥仍在JWKS中保留，各节点最迟在密钥缓存过期后使用新密钥）
+func (m *Manager) rotateSigningKey(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	err = createSigningKey(m.db)
+	if err != nil {
+		m.Error("轮换签名密钥失败！", zap.Error(err))
+		c.ResponseError(errors.New("轮换签名密钥失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+type clientReq struct {
+	RedirectURIs []string `json:"redirect_uris"` // 回调地址
+	Scopes       []string `json:"scopes"`        // 允许申请的权限
+}
+
+func (r clientReq) check() error {
+	if len(r.RedirectURIs) > clientMaxRedirectURICount {
+		return fmt.Errorf("回调地址不能超过%d个！", clientMaxRedirectURICount)
+	}
+	for _, uri := range r.RedirectURIs {
+		if err := checkRedirectURI(uri); err != nil {
+			return err
+		}
+	}
+	for _, scope := range r.Scopes {
+		if _, ok := scopeDescMap[scope]; !ok {
+			return fmt.Errorf("不支持的权限[%s]！", scope)
+		}
+	}
+	return nil
+}
+
+// checkRedirectURI 回调地址必须是不带fragment的绝对地址，允许app的自定义scheme
+func checkRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" || u.Fragment != "" || strings.Contains(uri, "#") {
+		return fmt.Errorf("回调地址[%s]格式有误！", uri)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "javascript", "data", "file", "vbscript":
+		return fmt.Errorf("回调地址[%s]的协议不被允许！", uri)
+	case "http":
+		if u.Hostname() != "localhost" && u.Hostname() != "127.0.0.1" {
+			return fmt.Errorf("回调地址[%s]必须使用https！", uri)
+		}
+	case "https":
+		if u.Host == "" {
+			return fmt.Errorf("回调地址[%s]格式有误！", uri)
+		}
+	}
+	return nil
+}
+
+func scopeKeys() []string {
+	keys := make([]string, 0, len(scopeDescMap))
+	for scope := range scopeDescMap {
+		keys = append(keys, scope)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type scopeResp struct {
+	Scope string `json:"scope"`
+	Desc  string `json:"desc"`
+}
+
+type clientResp struct {
+	AppID        string   `json:"app_id"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+}
@@ -0,0 +1,71 @@
+package openapi
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	authcodeExpire     = time.Minute * 5     // 授权码有效期
+	accessTokenExpire  = time.Hour * 2       // access_token有效期
+	refreshTokenExpire = time.Hour * 24 * 30 // refresh_token有效期
+)
+
+const (
+	// ScopeOpenID 使用OpenID Connect登录（签发id_token）
+	ScopeOpenID = "openid"
+	// ScopeProfile 获取用户基本资料
+	ScopeProfile = "profile"
+	// ScopeFriends 获取用户好友
+	ScopeFriends = "friends"
+	// ScopeSendMessage 以用户身份发送消息
+	ScopeSendMessage = "send_message"
+	// ScopeGroups 获取用户的群聊
+	ScopeGroups = "groups"
+)
+
+// 支持的权限及说明
+var scopeDescMap = map[string]string{
+	ScopeOpenID:      "使用你的账号登录",
+	ScopeProfile:     "获取你的昵称、头像",
+	ScopeFriends:     "获取你的好友列表",
+	ScopeSendMessage: "以你的身份发送消息",
+	ScopeGroups:      "获取你的群聊列表",
+}
+
+// parseScope 解析空格分隔的权限，去重并排序
+func parseScope(scope string) []string {
+	scopeMap := map[string]bool{}
+	for _, s := range strings.Fields(scope) {
+		scopeMap[s] = true
+	}
+	scopes := make([]string, 0, len(scopeMap))
+	for s := range scopeMap {
+		scopes = append(scopes, s)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+func joinScope(scopes []string) string {
+	return strings.Join(parseScope(strings.Join(scopes, " ")), " ")
+}
+
+// scopeContains 权限集合是否包含指定的全部权限
+func scopeContains(scope string, required ...string) bool {
+	scopes := parseScope(scope)
+	for _, r := range required {
+		found := false
+		for _, s := range scopes {
+			if s == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
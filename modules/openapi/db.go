@@ -0,0 +1,102 @@
+package openapi
+
+import (
+	"time"
+
+	"github.com/gocraft/dbr/v2"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+)
+
+type openapiDB struct {
+	session *dbr.Session
+	ctx     *config.Context
+}
+
+func newOpenapiDB(ctx *config.Context) *openapiDB {
+	return &openapiDB{
+		session: ctx.DB(),
+		ctx:     ctx,
+	}
+}
+
+func (d *openapiDB) queryClientWithAppID(appID string) (*clientModel, error) {
+	var m *clientModel
+	_, err := d.session.Select("*").From("openapi_client").Where("app_id=?", appID).Load(&m)
+	return m, err
+}
+
+// 添加或修改客户端配置
+func (d *openapiDB) upsertClient(m *clientModel) error {
+	_, err := d.session.InsertBySql("insert into openapi_client (app_id, redirect_uris, scopes) values (?, ?, ?) ON DUPLICATE KEY UPDATE redirect_uris=VALUES(redirect_uris),scopes=VALUES(scopes)", m.AppID, m.RedirectUris, m.Scopes).Exec()
+	return err
+}
+
+func (d *openapiDB) queryGrant(uid string, appID string) (*grantModel, error) {
+	var m *grantModel
+	_, err := d.session.Select("*").From("openapi_grant").Where("uid=? and app_id=?", uid, appID).Load(&m)
+	return m, err
+}
+
+func (d *openapiDB) queryGrantsWithUID(uid string) ([]*grantModel, error) {
+	var models []*grantModel
+	_, err := d.session.Select("*").From("openapi_grant").Where("uid=? and scope<>''", uid).OrderDir("updated_at", false).Load(&models)
+	return models, err
+}
+
+// 添加或修改用户授权
+func (d *openapiDB) upsertGrant(uid string, appID string, scope string) error {
+	_, err := d.session.InsertBySql("insert into openapi_grant (uid, app_id, scope) values (?, ?, ?) ON DUPLICATE KEY UPDATE scope=VALUES(scope),updated_at=NOW()", uid, appID, scope).Exec()
+	return err
+}
+
+// 使用户对app的所有token失效
+func (d *openapiDB) incrGrantTokenVersion(uid string, appID string) error {
+	_, err := d.session.Update("openapi_grant").Set("token_version", dbr.Expr("token_version+1")).Where("uid=? and app_id=?", uid, appID).Exec()
+	return err
+}
+
+// 取消用户授权 保留授权记录并增加token版本，使之前签发的token（包括没有授权记录的旧版token）在重新授权后也不会恢复
+func (d *openapiDB) revokeGrant(uid string, appID string) error {
+	_, err := d.session.InsertBySql("insert into openapi_grant (uid, app_id, scope, token_version) values (?, ?, '', 1) ON DUPLICATE KEY UPDATE scope='',token_version=token_version+1,updated_at=NOW()", uid, appID).Exec()
+	return err
+}
+
+type clientModel struct {
+	AppID        string
+	RedirectUris string // JSON数组
+	Scopes       string // 空格分隔
+	db.BaseModel
+}
+
+type grantModel struct {
+	UID          string
+	AppID        string
+	Scope        string // 空格分隔，为空表示用户已取消授权
+	TokenVersion int
+	db.BaseModel
+}
+
+// 授权未取消且token版本一致
+func (g *grantModel) usable(tokenVersion int) bool {
+	return g != nil && g.Scope != "" && g.TokenVersion == tokenVersion
+}
+
+// 查询指定时间之后创建的签名密钥（最新的在前）
+func (d *openapiDB) querySigningKeysCreatedAfter(t time.Time) ([]*signingKeyModel, error) {
+	var models []*signingKeyModel
+	_, err := d.session.Select("*").From("openapi_signing_key").Where("created_at>?", t).OrderDir("created_at", false).OrderDir("id", false).Load(&models)
+	return models, err
+}
+
+func (d *openapiDB) insertSigningKey(m *signingKeyModel) error {
+	_, err := d.session.InsertInto("openapi_signing_key").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	return err
+}
+
+type signingKeyModel struct {
+	Kid        string
+	PrivateKey string
+	db.BaseModel
+}
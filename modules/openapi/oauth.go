@@ -0,0 +1,678 @@
+package openapi
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/app"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/util"
+	"github.com/gin-gonic/gin"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// OAuth2错误码（RFC 6749 5.2）
+const (
+	errInvalidRequest       = "invalid_request"
+	errInvalidClient        = "invalid_client"
+	errInvalidGrant         = "invalid_grant"
+	errInvalidScope         = "invalid_scope"
+	errUnsupportedGrantType = "unsupported_grant_type"
+	errUnsupportedResponse  = "unsupported_response_type"
+	errServerError          = "server_error"
+	errInsufficientScope    = "insufficient_scope" // RFC 6750 3.1
+)
+
+// 授权码数据
+type authcodeData struct {
+	AppID               string `json:"app_id"`
+	UID                 string `json:"uid"`
+	RedirectURI         string `json:"redirect_uri,omitempty"`
+	Scope               string `json:"scope"`
+	CodeChallenge       string `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string `json:"code_challenge_method,omitempty"`
+	Nonce               string `json:"nonce,omitempty"`     // OIDC nonce，原样放入id_token
+	AuthTime            int64  `json:"auth_time,omitempty"` // 用户授权时间
+	TokenVersion        int    `json:"token_version"`       // 创建授权码时用户授权的token版本
+}
+
+// token数据（access_token和refresh_token共用）
+type tokenData struct {
+	AppID        string `json:"app_id"`
+	UID          string `json:"uid"`
+	Scope        string `json:"scope"`
+	TokenVersion int    `json:"token_version"`
+	Public       bool   `json:"public,omitempty"` // 公开客户端（无client_secret，使用PKCE）
+	ExpireAt     int64  `json:"expire_at"`
+	Used         bool   `json:"used,omitempty"` // refresh_token是否已被使用（轮换后旧的refresh_token再次使用视为泄露）
+	Legacy       bool   `json:"-"`              // 旧版接口签发的access_token
+}
+
+type tokenResp struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	IDToken      string `json:"id_token,omitempty"` // scope包含openid时返回
+	Expire       int64  `json:"expire"`             // 兼容旧版字段，同expires_in
+}
+
+func oauthError(c *wkhttp.Context, status int, code string, desc string) {
+	c.JSON(status, gin.H{
+		"error":             code,
+		"error_description": desc,
+	})
+}
+
+// 授权（用户已登录，同意授权后返回授权码）
+func (o *OpenAPI) authorize(c *wkhttp.Context) {
+	uid := c.GetLoginUID()
+	if c.Query("response_type") != "code" {
+		oauthError(c, http.StatusBadRequest, errUnsupportedResponse, "response_type只支持code")
+		return
+	}
+	appID := c.Query("client_id")
+	redirectURI := c.Query("redirect_uri")
+	codeChallenge := c.Query("code_challenge")
+	codeChallengeMethod := c.Query("code_challenge_method")
+	if appID == "" || redirectURI == "" {
+		oauthError(c, http.StatusBadRequest, errInvalidRequest, "client_id和redirect_uri不能为空")
+		return
+	}
+	if codeChallenge != "" && codeChallengeMethod != "S256" {
+		oauthError(c, http.StatusBadRequest, errInvalidRequest, "code_challenge_method只支持S256")
+		return
+	}
+	appResp, err := o.appService.GetApp(appID)
+	if err != nil || appResp.Status != app.StatusEnable {
+		oauthError(c, http.StatusBadRequest, errInvalidClient, "app不存在或已禁用")
+		return
+	}
+	client, err := o.db.queryClientWithAppID(appID)
+	if err != nil {
+		o.Error("查询openapi客户端失败！", zap.Error(err))
+		oauthError(c, http.StatusInternalServerError, errServerError, "查询客户端失败")
+		return
+	}
+	if client == nil || !client.redirectURIAllowed(redirectURI) {
+		oauthError(c, http.StatusBadRequest, errInvalidRequest, "redirect_uri未注册")
+		return
+	}
+	scope := c.Query("scope")
+	if strings.TrimSpace(scope) == "" {
+		scope = ScopeProfile
+	}
+	scope = joinScope(strings.Fields(scope))
+	if err := client.checkScope(scope); err != nil {
+		oauthError(c, http.StatusBadRequest, errInvalidScope, err.Error())
+		return
+	}
+	code, err := o.createAuthcode(&authcodeData{
+		AppID:               appID,
+		UID:                 uid,
+		RedirectURI:         redirectURI,
+		Scope:               scope,
+		CodeChallenge:       codeChallenge,
+		CodeChallengeMethod: codeChallengeMethod,
+		Nonce:               c.Query("nonce"),
+		AuthTime:            time.Now().Unix(),
+	})
+	if err != nil {
+		o.Error("创建授权码失败！", zap.Error(err))
+		oauthError(c, http.StatusInternalServerError, errServerError, "创建授权码失败")
+		return
+	}
+	state := c.Query("state")
+	redirectURL, _ := url.Parse(redirectURI)
+	query := redirectURL.Query()
+	query.Set("code", code)
+	if state != "" {
+		query.Set("state", state)
+	}
+	redirectURL.RawQuery = query.Encode()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":         code,
+		"state":        state,
+		"redirect_uri": redirectURL.String(),
+	})
+}
+
+// 创建授权码并记录用户授权
+func (o *OpenAPI) createAuthcode(data *authcodeData) (string, error) {
+	grant, err := o.db.queryGrant(data.UID, data.AppID)
+	if err != nil {
+		return "", err
+	}
+	grantScope := data.Scope
+	if grant != nil {
+		grantScope = joinScope(append(parseScope(grant.Scope), parseScope(data.Scope)...))
+		data.TokenVersion = grant.TokenVersion
+	}
+	err = o.db.upsertGrant(data.UID, data.AppID, grantScope)
+	if err != nil {
+		return "", err
+	}
+	code := util.GenerUUID()
+	err = o.ctx.GetRedisConn().SetAndExpire(o.openapiAuthcodePrefix+code, util.ToJson(data), authcodeExpire)
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// 获取并删除授权码（授权码只能使用一次，并发兑换时只有一个请求能拿到）
+func (o *OpenAPI) consumeAuthcode(code string) (*authcodeData, error) {
+	if code == "" {
+		return nil, nil
+	}
+	key := o.openapiAuthcodePrefix + code
+	value, err := o.ctx.GetRedisConn().GetString(key)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return nil, nil
+	}
+	claimed, err := o.claimOnce(key, authcodeExpire)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, nil
+	}
+	if err := o.ctx.GetRedisConn().Del(key); err != nil {
+		o.Warn("删除授权码失败！", zap.Error(err))
+	}
+	var data *authcodeData
+	if err := json.Unmarshal([]byte(value), &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// token接口 支持authorization_code和refresh_token
+func (o *OpenAPI) token(c *wkhttp.Context) {
+	switch c.PostForm("grant_type") {
+	case "authorization_code":
+		o.tokenWithAuthcode(c)
+	case "refresh_token":
+		o.tokenWithRefreshToken(c)
+	default:
+		oauthError(c, http.StatusBadRequest, errUnsupportedGrantType, "grant_type只支持authorization_code和refresh_token")
+	}
+}
+
+func (o *OpenAPI) tokenWithAuthcode(c *wkhttp.Context) {
+	appID, authenticated, err := o.authenticateClient(c)
+	if err != nil {
+		oauthError(c, http.StatusUnauthorized, errInvalidClient, err.Error())
+		return
+	}
+	data, err := o.consumeAuthcode(c.PostForm("code"))
+	if err != nil {
+		o.Error("查询授权码失败！", zap.Error(err))
+		oauthError(c, http.StatusInternalServerError, errServerError, "查询授权码失败")
+		return
+	}
+	if data == nil || data.AppID != appID {
+		oauthError(c, http.StatusBadRequest, errInvalidGrant, "授权码无效或已过期")
+		return
+	}
+	if data.RedirectURI != "" && data.RedirectURI != c.PostForm("redirect_uri") {
+		oauthError(c, http.StatusBadRequest, errInvalidGrant, "redirect_uri不匹配")
+		return
+	}
+	public := false
+	if data.CodeChallenge != "" {
+		if !verifyCodeChallenge(c.PostForm("code_verifier"), data.CodeChallenge) {
+			oauthError(c, http.StatusBadRequest, errInvalidGrant, "code_verifier不正确")
+			return
+		}
+		public = !authenticated
+	} else if !authenticated {
+		oauthError(c, http.StatusUnauthorized, errInvalidClient, "未使用PKCE时必须提供client_secret")
+		return
+	}
+	grant, err := o.db.queryGrant(data.UID, appID)
+	if err != nil {
+		o.Error("查询用户授权失败！", zap.Error(err))
+		oauthError(c, http.StatusInternalServerError, errServerError, "查询用户授权失败")
+		return
+	}
+	if !grant.usable(data.TokenVersion) {
+		oauthError(c, http.StatusBadRequest, errInvalidGrant, "用户已取消授权")
+		return
+	}
+	resp, err := o.issueTokens(&tokenData{
+		AppID:        appID,
+		UID:          data.UID,
+		Scope:        data.Scope,
+		TokenVersion: grant.TokenVersion,
+		Public:       public,
+	}, data.Nonce, data.AuthTime)
+	if err != nil {
+		o.Error("签发token失败！", zap.Error(err))
+		oauthError(c, http.StatusInternalServerError, errServerError, "签发token失败")
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, resp)
+}
+
+func (o *OpenAPI) tokenWithRefreshToken(c *wkhttp.Context) {
+	appID, authenticated, err := o.authenticateClient(c)
+	if err != nil {
+		oauthError(c, http.StatusUnauthorized, errInvalidClient, err.Error())
+		return
+	}
+	refreshToken := c.PostForm("refresh_token")
+	data, err := o.getToken(o.openapiRefreshTokenPrefix, refreshToken)
+	if err != nil {
+		o.Error("查询refresh_token失败！", zap.Error(err))
+		oauthError(c, http.StatusInternalServerError, errServerError, "查询refresh_token失败")
+		return
+	}
+	if data == nil || data.AppID != appID {
+		oauthError(c, http.StatusBadRequest, errInvalidGrant, "refresh_token无效或已过期")
+		return
+	}
+	if !data.Public && !authenticated {
+		oauthError(c, http.StatusUnauthorized, errInvalidClient, "必须提供client_secret")
+		return
+	}
+	if data.Used {
+		// 已轮换的refresh_token被再次使用，可能已泄露，吊销该用户对此app的所有token
+		o.Warn("refresh_token被重复使用，吊销所有token！", zap.String("appID", appID), zap.String("uid", data.UID))
+		if err := o.db.incrGrantTokenVersion(data.UID, appID); err != nil {
+			o.Error("吊销token失败！", zap.Error(err))
+		}
+		oauthError(c, http.StatusBadRequest, errInvalidGrant, "refresh_token已被使用")
+		return
+	}
+	valid, err := o.tokenGrantValid(data)
+	if err != nil {
+		o.Error("查询用户授权失败！", zap.Error(err))
+		oauthError(c, http.StatusInternalServerError, errServerError, "查询用户授权失败")
+		return
+	}
+	if !valid {
+		oauthError(c, http.StatusBadRequest, errInvalidGrant, "refresh_token已被吊销")
+		return
+	}
+	scope := data.Scope
+	if reqScope := c.PostForm("scope"); strings.TrimSpace(reqScope) != "" { // 只能缩小权限
+		scope = joinScope(strings.Fields(reqScope))
+		if !scopeContains(data.Scope, parseScope(scope)...) {
+			oauthError(c, http.StatusBadRequest, errInvalidScope, "scope超出了原授权范围")
+			return
+		}
+	}
+	refreshTTL := time.Until(time.Unix(data.ExpireAt, 0))
+	claimed, err := o.claimOnce(o.openapiRefreshTokenPrefix+refreshToken, refreshTTL)
+	if err != nil {
+		o.Error("更新refresh_token失败！", zap.Error(err))
+		oauthError(c, http.StatusInternalServerError, errServerError, "更新refresh_token失败")
+		return
+	}
+	if !claimed { // 并发请求已经使用了这个refresh_token
+		oauthError(c, http.StatusBadRequest, errInvalidGrant, "refresh_token已被使用")
+		return
+	}
+	data.Used = true
+	if refreshTTL > 0 {
+		err = o.ctx.GetRedisConn().SetAndExpire(o.openapiRefreshTokenPrefix+refreshToken, util.ToJson(data), refreshTTL)
+		if err != nil {
+			o.Error("更新refresh_token失败！", zap.Error(err))
+			oauthError(c, http.StatusInternalServerError, errServerError, "更新refresh_token失败")
+			return
+		}
+	}
+	resp, err := o.issueTokens(&tokenData{
+		AppID:        appID,
+		UID:          data.UID,
+		Scope:        scope,
+		TokenVersion: data.TokenVersion,
+		Public:       data.Public,
+	}, "", 0)
+	if err != nil {
+		o.Error("签发token失败！", zap.Error(err))
+		oauthError(c, http.StatusInternalServerError, errServerError, "签发token失败")
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, resp)
+}
+
+// 吊销token（RFC 7009），无论token是否有效都返回200
+func (o *OpenAPI) revoke(c *wkhttp.Context) {
+	appID, _, err := o.authenticateClient(c)
+	if err != nil {
+		oauthError(c, http.StatusUnauthorized, errInvalidClient, err.Error())
+		return
+	}
+	token := c.PostForm("token")
+	prefixes := []string{o.openapiAccessTokenPrefix, o.openapiRefreshTokenPrefix}
+	if c.PostForm("token_type_hint") == "refresh_token" {
+		prefixes = []string{o.openapiRefreshTokenPrefix, o.openapiAccessTokenPrefix}
+	}
+	for _, prefix := range prefixes {
+		data, err := o.getToken(prefix, token)
+		if err != nil {
+			o.Error("查询token失败！", zap.Error(err))
+			oauthError(c, http.StatusServiceUnavailable, errServerError, "查询token失败")
+			return
+		}
+		if data == nil || data.AppID != appID {
+			continue
+		}
+		if prefix == o.openapiRefreshTokenPrefix {
+			// 吊销refresh_token时同时吊销由它签发的access_token
+			err = o.db.incrGrantTokenVersion(data.UID, appID)
+		} else {
+			err = o.ctx.GetRedisConn().Del(prefix + token)
+		}
+		if err != nil {
+			o.Error("吊销token失败！", zap.Error(err))
+			oauthError(c, http.StatusServiceUnavailable, errServerError, "吊销token失败")
+			return
+		}
+		break
+	}
+	c.Status(http.StatusOK)
+}
+
+// 查询token状态（RFC 7662），只有app自己的token才会返回active
+func (o *OpenAPI) introspect(c *wkhttp.Context) {
+	appID, authenticated, err := o.authenticateClient(c)
+	if err != nil || !authenticated {
+		oauthError(c, http.StatusUnauthorized, errInvalidClient, "必须提供client_id和client_secret")
+		return
+	}
+	token := c.PostForm("token")
+	tokenTypes := []string{"access_token", "refresh_token"}
+	if c.PostForm("token_type_hint") == "refresh_token" {
+		tokenTypes = []string{"refresh_token", "access_token"}
+	}
+	for _, tokenType := range tokenTypes {
+		prefix := o.openapiAccessTokenPrefix
+		if tokenType == "refresh_token" {
+			prefix = o.openapiRefreshTokenPrefix
+		}
+		data, err := o.getToken(prefix, token)
+		if err != nil {
+			o.Error("查询token失败！", zap.Error(err))
+			oauthError(c, http.StatusInternalServerError, errServerError, "查询token失败")
+			return
+		}
+		if data == nil || data.AppID != appID || data.Used {
+			continue
+		}
+		valid, err := o.tokenGrantValid(data)
+		if err != nil {
+			o.Error("查询用户授权失败！", zap.Error(err))
+			oauthError(c, http.StatusInternalServerError, errServerError, "查询用户授权失败")
+			return
+		}
+		if !valid {
+			continue
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"active":     true,
+			"scope":      data.Scope,
+			"client_id":  data.AppID,
+			"sub":        data.UID,
+			"exp":        data.ExpireAt,
+			"token_type": tokenType,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"active": false,
+	})
+}
+
+// 我授权过的app
+func (o *OpenAPI) authorizedApps(c *wkhttp.Context) {
+	grants, err := o.db.queryGrantsWithUID(c.GetLoginUID())
+	if err != nil {
+		o.Error("查询授权的app失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询授权的app失败！"))
+		return
+	}
+	resps := make([]*authorizedAppResp, 0, len(grants))
+	for _, grant := range grants {
+		resp := &authorizedAppResp{
+			AppID:     grant.AppID,
+			Scope:     grant.Scope,
+			CreatedAt: grant.CreatedAt.String(),
+			UpdatedAt: grant.UpdatedAt.String(),
+		}
+		appResp, err := o.appService.GetApp(grant.AppID)
+		if err == nil {
+			resp.AppName = appResp.AppName
+			resp.AppLogo = appResp.AppLogo
+		}
+		resps = append(resps, resp)
+	}
+	c.Response(resps)
+}
+
+// 取消对app的授权，已签发的token全部失效
+func (o *OpenAPI) revokeAuthorizedApp(c *wkhttp.Context) {
+	err := o.db.revokeGrant(c.GetLoginUID(), c.Param("app_id"))
+	if err != nil {
+		o.Error("取消授权失败！", zap.Error(err))
+		c.ResponseError(errors.New("取消授权失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 签发access_token和refresh_token，scope包含openid时同时签发id_token
+func (o *OpenAPI) issueTokens(data *tokenData, nonce string, authTime int64) (*tokenResp, error) {
+	accessToken := util.GenerUUID()
+	refreshToken := util.GenerUUID()
+	now := time.Now()
+
+	accessData := *data
+	accessData.ExpireAt = now.Add(accessTokenExpire).Unix()
+	err := o.ctx.GetRedisConn().SetAndExpire(o.openapiAccessTokenPrefix+accessToken, util.ToJson(&accessData), accessTokenExpire)
+	if err != nil {
+		return nil, err
+	}
+	refreshData := *data
+	refreshData.ExpireAt = now.Add(refreshTokenExpire).Unix()
+	err = o.ctx.GetRedisConn().SetAndExpire(o.openapiRefreshTokenPrefix+refreshToken, util.ToJson(&refreshData), refreshTokenExpire)
+	if err != nil {
+		return nil, err
+	}
+	resp := &tokenResp{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(accessTokenExpire.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        data.Scope,
+		Expire:       int64(accessTokenExpire.Seconds()),
+	}
+	if scopeContains(data.Scope, ScopeOpenID) {
+		resp.IDToken, err = o.signIDToken(data, nonce, authTime, accessToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// claimOnce 抢占key的使用权（redis incr是原子的，并发时只有第一个请求返回true）
+func (o *OpenAPI) claimOnce(key string, expire time.Duration) (bool, error) {
+	claimKey := key + ":claimed"
+	count, err := o.ctx.GetRedisConn().Incr(claimKey)
+	if err != nil {
+		return false, err
+	}
+	if count != 1 {
+		return false, nil
+	}
+	if expire <= 0 {
+		expire = time.Minute
+	}
+	if err := o.ctx.GetRedisConn().SetExpire(claimKey, expire); err != nil {
+		o.Warn("设置抢占标记的过期时间失败！", zap.String("key", claimKey), zap.Error(err))
+	}
+	return true, nil
+}
+
+// 查询token，不存在返回nil
+func (o *OpenAPI) getToken(prefix string, token string) (*tokenData, error) {
+	if token == "" {
+		return nil, nil
+	}
+	value, err := o.ctx.GetRedisConn().GetString(prefix + token)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(value, "{") { // 旧版接口签发的access_token 格式为 appID@uid
+		appIDAndUIDArr := strings.Split(value, "@")
+		if len(appIDAndUIDArr) != 2 {
+			return nil, nil
+		}
+		return &tokenData{AppID: appIDAndUIDArr[0], UID: appIDAndUIDArr[1], Scope: ScopeProfile, Legacy: true}, nil
+	}
+	var data *tokenData
+	if err := json.Unmarshal([]byte(value), &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// token对应的用户授权是否仍然有效
+// 旧版token没有记录版本，视为初始版本，上线前签发的旧版token没有授权记录时同样有效，用户取消授权或token被吊销过后失效
+func (o *OpenAPI) tokenGrantValid(data *tokenData) (bool, error) {
+	grant, err := o.db.queryGrant(data.UID, data.AppID)
+	if err != nil {
+		return false, err
+	}
+	if grant == nil {
+		return data.Legacy && data.TokenVersion == 0, nil
+	}
+	return grant.usable(data.TokenVersion), nil
+}
+
+// 校验access_token并检查权限
+func (o *OpenAPI) checkAccessToken(accessToken string, scopes ...string) (*tokenData, error) {
+	data, err := o.getToken(o.openapiAccessTokenPrefix, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, errors.New("access_token无效或已过期")
+	}
+	valid, err := o.tokenGrantValid(data)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, errors.New("access_token已被吊销")
+	}
+	if !scopeContains(data.Scope, scopes...) {
+		return nil, fmt.Errorf("access_token没有%s权限", strings.Join(scopes, " "))
+	}
+	return data, nil
+}
+
+// 客户端认证 支持HTTP Basic和表单参数，未提供client_secret时authenticated为false（公开客户端）
+func (o *OpenAPI) authenticateClient(c *wkhttp.Context) (string, bool, error) {
+	appID, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		appID = c.PostForm("client_id")
+		secret = c.PostForm("client_secret")
+	}
+	if appID == "" {
+		return "", false, errors.New("client_id不能为空")
+	}
+	appResp, err := o.appService.GetApp(appID)
+	if err != nil || appResp.Status != app.StatusEnable {
+		return "", false, errors.New("app不存在或已禁用")
+	}
+	if secret == "" {
+		return appID, false, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(appResp.AppKey)) != 1 {
+		return "", false, errors.New("client_secret不正确")
+	}
+	return appID, true, nil
+}
+
+// verifyCodeChallenge 校验PKCE（S256）
+func verifyCodeChallenge(codeVerifier string, codeChallenge string) bool {
+	if len(codeVerifier) < 43 || len(codeVerifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(codeVerifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(codeChallenge)) == 1
+}
+
+// bearerToken 从Authorization头或access_token参数获取token
+func bearerToken(c *wkhttp.Context) string {
+	authorization := c.GetHeader("Authorization")
+	if strings.HasPrefix(authorization, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+	}
+	if accessToken := c.Query("access_token"); accessToken != "" {
+		return accessToken
+	}
+	return c.PostForm("access_token")
+}
+
+func (m *clientModel) redirectURIList() []string {
+	var uris []string
+	if m.RedirectUris != "" {
+		_ = json.Unmarshal([]byte(m.RedirectUris), &uris)
+	}
+	return uris
+}
+
+// 回调地址必须与注册的地址完全一致
+func (m *clientModel) redirectURIAllowed(redirectURI string) bool {
+	for _, uri := range m.redirectURIList() {
+		if uri == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *clientModel) checkScope(scope string) error {
+	for _, s := range parseScope(scope) {
+		if _, ok := scopeDescMap[s]; !ok {
+			return fmt.Errorf("不支持的权限[%s]", s)
+		}
+		if !scopeContains(m.Scopes, s) {
+			return fmt.Errorf("app未被允许申请权限[%s]", s)
+		}
+	}
+	return nil
+}
+
+type authorizedAppResp struct {
+	AppID     string `json:"app_id"`
+	AppName   string `json:"app_name"`
+	AppLogo   string `json:"app_logo"`
+	Scope     string `json:"scope"` // 已授权的权限，空格分隔
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
@@ -0,0 +1,64 @@
+package openapi
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", challenge)
+
+	assert.True(t, verifyCodeChallenge(verifier, challenge))
+	assert.False(t, verifyCodeChallenge(verifier+"x", challenge))
+	assert.False(t, verifyCodeChallenge("short", challenge))
+}
+
+func TestScope(t *testing.T) {
+	assert.Equal(t, []string{"friends", "profile"}, parseScope(" profile  friends profile"))
+	assert.Equal(t, "friends groups profile", joinScope([]string{"profile groups", "friends"}))
+	assert.True(t, scopeContains("profile friends", "profile"))
+	assert.True(t, scopeContains("profile friends"))
+	assert.False(t, scopeContains("profile", "profile", "friends"))
+
+	client := &clientModel{Scopes: "profile friends"}
+	assert.NoError(t, client.checkScope("profile"))
+	assert.Error(t, client.checkScope("profile groups"))
+	assert.Error(t, client.checkScope("unknown"))
+}
+
+func TestRedirectURI(t *testing.T) {
+	client := &clientModel{RedirectUris: `["https://example.com/callback","myapp://oauth"]`}
+	assert.True(t, client.redirectURIAllowed("https://example.com/callback"))
+	assert.True(t, client.redirectURIAllowed("myapp://oauth"))
+	assert.False(t, client.redirectURIAllowed("https://example.com/callback?x=1"))
+	assert.False(t, client.redirectURIAllowed("https://example.com/"))
+
+	assert.NoError(t, checkRedirectURI("https://example.com/callback"))
+	assert.NoError(t, checkRedirectURI("myapp://oauth"))
+	assert.NoError(t, checkRedirectURI("http://localhost:8080/cb"))
+	assert.Error(t, checkRedirectURI("http://example.com/cb"))
+	assert.Error(t, checkRedirectURI("https://example.com/cb#frag"))
+	assert.Error(t, checkRedirectURI("javascript:alert(1)"))
+	assert.Error(t, checkRedirectURI("/relative"))
+}
+
+func TestGrantUsable(t *testing.T) {
+	var grant *grantModel
+	assert.False(t, grant.usable(0))
+
+	grant = &grantModel{Scope: "profile", TokenVersion: 1}
+	assert.True(t, grant.usable(1))
+	assert.False(t, grant.usable(0))
+
+	// 取消授权后scope为空，版本增加，重新授权前后之前的token都不能再使用
+	grant = &grantModel{Scope: "", TokenVersion: 2}
+	assert.False(t, grant.usable(2))
+	grant.Scope = "profile"
+	assert.False(t, grant.usable(1))
+}
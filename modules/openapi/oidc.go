@@ -0,0 +1,226 @@
+package openapi
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/wkrsa"
+	"github.com/gin-gonic/gin"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	idTokenExpire         = time.Hour           // id_token有效期
+	signingKeyRotation    = time.Hour * 24 * 30 // 签名密钥轮换周期
+	signingKeyPublishTime = time.Hour * 24 * 60 // 密钥创建后在JWKS中保留的时间（需大于轮换周期+id_token有效期）
+	signingKeyReload      = time.Minute * 5     // 内存中的密钥重新加载间隔（其他节点轮换后最迟在此时间后生效）
+	signingKeyBits        = 2048
+)
+
+type signingKey struct {
+	kid        string
+	privateKey *rsa.PrivateKey
+	createdAt  time.Time
+}
+
+// OIDC发现文档
+func (o *OpenAPI) openidConfiguration(c *wkhttp.Context) {
+	cfg := o.ctx.GetConfig()
+	issuer := o.issuer()
+	scopes := scopeKeys()
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                issuer,
+		"authorization_endpoint":                fmt.Sprintf("%s/oauth/authorize", strings.TrimSuffix(cfg.External.H5BaseURL, "/")),
+		"token_endpoint":                        fmt.Sprintf("%s/openapi/oauth/token", issuer),
+		"userinfo_endpoint":                     fmt.Sprintf("%s/openapi/userinfo", issuer),
+		"jwks_uri":                              fmt.Sprintf("%s/openapi/oauth/jwks", issuer),
+		"revocation_endpoint":                   fmt.Sprintf("%s/openapi/oauth/revoke", issuer),
+		"introspection_endpoint":                fmt.Sprintf("%s/openapi/oauth/introspect", issuer),
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      scopes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "at_hash", "name", "picture", "preferred_username"},
+	})
+}
+
+// JWKS 公布所有未过期的签名公钥
+func (o *OpenAPI) jwks(c *wkhttp.Context) {
+	keys, err := o.getSigningKeys()
+	if err != nil {
+		o.Error("获取签名密钥失败！", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":             errServerError,
+			"error_description": "获取签名密钥失败",
+		})
+		return
+	}
+	jwkList := make([]map[string]string, 0, len(keys))
+	for _, key := range keys {
+		jwkList = append(jwkList, map[string]string{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": key.kid,
+			"n":   base64.RawURLEncoding.EncodeToString(key.privateKey.PublicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.privateKey.PublicKey.E)).Bytes()),
+		})
+	}
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(signingKeyReload.Seconds())))
+	c.JSON(http.StatusOK, gin.H{
+		"keys": jwkList,
+	})
+}
+
+func (o *OpenAPI) issuer() string {
+	return strings.TrimSuffix(o.ctx.GetConfig().External.APIBaseURL, "/")
+}
+
+func (o *OpenAPI) avatarURL(uid string) string {
+	return fmt.Sprintf("%s/%s", o.ctx.GetConfig().External.APIBaseURL, o.ctx.GetConfig().GetAvatarPath(uid))
+}
+
+// 签发id_token
+func (o *OpenAPI) signIDToken(data *tokenData, nonce string, authTime int64, accessToken string) (string, error) {
+	keys, err := o.getSigningKeys()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":     o.issuer(),
+		"sub":     data.UID,
+		"aud":     data.AppID,
+		"iat":     now.Unix(),
+		"exp":     now.Add(idTokenExpire).Unix(),
+		"at_hash": accessTokenHash(accessToken),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	if authTime > 0 {
+		claims["auth_time"] = authTime
+	}
+	if scopeContains(data.Scope, ScopeProfile) {
+		userResp, err := o.userService.GetUser(data.UID)
+		if err != nil {
+			return "", err
+		}
+		for k, v := range o.profileClaims(userResp.UID, userResp.Name, userResp.ShortNo) {
+			claims[k] = v
+		}
+	}
+	return signJWT(keys[0], claims)
+}
+
+// OIDC标准的用户资料声明
+func (o *OpenAPI) profileClaims(uid string, name string, shortNo string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":               name,
+		"picture":            o.avatarURL(uid),
+		"preferred_username": shortNo,
+	}
+}
+
+// 获取签名密钥（最新的在前），没有可用密钥或最新密钥已超过轮换周期时生成新密钥
+func (o *OpenAPI) getSigningKeys() ([]*signingKey, error) {
+	o.signingKeysLock.Lock()
+	defer o.signingKeysLock.Unlock()
+	if len(o.signingKeys) > 0 && time.Since(o.signingKeysLoadedAt) < signingKeyReload && time.Since(o.signingKeys[0].createdAt) < signingKeyRotation {
+		return o.signingKeys, nil
+	}
+	keys, err := o.loadSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 || time.Since(keys[0].createdAt) >= signingKeyRotation {
+		o.Info("生成新的id_token签名密钥")
+		if err := createSigningKey(o.db); err != nil {
+			return nil, err
+		}
+		keys, err = o.loadSigningKeys()
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 {
+			return nil, errors.New("没有可用的签名密钥")
+		}
+	}
+	o.signingKeys = keys
+	o.signingKeysLoadedAt = time.Now()
+	return keys, nil
+}
+
+func (o *OpenAPI) loadSigningKeys() ([]*signingKey, error) {
+	models, err := o.db.querySigningKeysCreatedAfter(time.Now().Add(-signingKeyPublishTime))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*signingKey, 0, len(models))
+	for _, m := range models {
+		privateKey, err := wkrsa.ParsePrivateKey([]byte(m.PrivateKey))
+		if err != nil {
+			o.Error("解析签名密钥失败！", zap.Error(err), zap.String("kid", m.Kid))
+			continue
+		}
+		keys = append(keys, &signingKey{
+			kid:        m.Kid,
+			privateKey: privateKey,
+			createdAt:  time.Time(m.CreatedAt),
+		})
+	}
+	return keys, nil
+}
+
+func createSigningKey(d *openapiDB) error {
+	privateKey, err := wkrsa.GeneratePrivateKey(signingKeyBits)
+	if err != nil {
+		return err
+	}
+	return d.insertSigningKey(&signingKeyModel{
+		Kid:        util.GenerUUID(),
+		PrivateKey: string(privateKey),
+	})
+}
+
+// signJWT 使用RS256签名JWT
+func signJWT(key *signingKey, claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": key.kid,
+	})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := wkrsa.SignWithSHA256([]byte(signingInput), key.privateKey)
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// accessTokenHash id_token中的at_hash（access_token的sha256左半部分）
+func accessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
@@ -0,0 +1,51 @@
+package openapi
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/wkrsa"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignJWT(t *testing.T) {
+	pemPrivKey, err := wkrsa.GeneratePrivateKey(2048)
+	assert.NoError(t, err)
+	privateKey, err := wkrsa.ParsePrivateKey(pemPrivKey)
+	assert.NoError(t, err)
+	key := &signingKey{kid: "kid1", privateKey: privateKey}
+
+	token, err := signJWT(key, map[string]interface{}{
+		"sub":   "u1",
+		"nonce": "n1",
+	})
+	assert.NoError(t, err)
+	parts := strings.Split(token, ".")
+	assert.Len(t, parts, 3)
+
+	var header map[string]string
+	headerBytes, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	assert.NoError(t, json.Unmarshal(headerBytes, &header))
+	assert.Equal(t, "RS256", header["alg"])
+	assert.Equal(t, "kid1", header["kid"])
+
+	var claims map[string]interface{}
+	payloadBytes, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	assert.NoError(t, json.Unmarshal(payloadBytes, &claims))
+	assert.Equal(t, "u1", claims["sub"])
+	assert.Equal(t, "n1", claims["nonce"])
+
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	assert.NoError(t, rsa.VerifyPKCS1v15(&privateKey.PublicKey, crypto.SHA256, hashed[:], signature))
+}
+
+func TestAccessTokenHash(t *testing.T) {
+	// OIDC规范示例 https://openid.net/specs/openid-connect-core-1_0.html#id_token-tokenExample
+	assert.Equal(t, "77QmUPtjPfzWtF2AnpK9RQ", accessTokenHash("jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y"))
+}
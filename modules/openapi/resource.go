@@ -0,0 +1,146 @@
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/common"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	openapiTokenDataKey  = "openapi_token_data" // 校验通过的access_token数据在上下文中的key
+	openapiMessageMaxLen = 5000                 // 以用户身份发送的文本消息最大长度
+)
+
+// accessTokenMiddleware 使用access_token访问的接口 校验token是否有效（包括是否已被吊销）以及是否拥有接口需要的权限
+func (o *OpenAPI) accessTokenMiddleware(scope string) wkhttp.HandlerFunc {
+	return func(c *wkhttp.Context) {
+		data, err := o.checkAccessToken(bearerToken(c))
+		if err != nil {
+			c.ResponseErrorWithStatus(err, http.StatusUnauthorized)
+			c.Abort()
+			return
+		}
+		if !scopeContains(data.Scope, scope) {
+			oauthError(c, http.StatusForbidden, errInsufficientScope, fmt.Sprintf("access_token没有%s权限", scope))
+			c.Abort()
+			return
+		}
+		c.Set(openapiTokenDataKey, data)
+		c.Next()
+	}
+}
+
+func accessTokenData(c *wkhttp.Context) *tokenData {
+	return c.MustGet(openapiTokenDataKey).(*tokenData)
+}
+
+// 获取授权用户的好友（需要friends权限）
+func (o *OpenAPI) friendsGet(c *wkhttp.Context) {
+	uid := accessTokenData(c).UID
+	friends, err := o.userService.GetFriends(uid)
+	if err != nil {
+		o.Error("查询好友失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询好友失败！"))
+		return
+	}
+	resps := make([]gin.H, 0, len(friends))
+	for _, friend := range friends {
+		resps = append(resps, gin.H{
+			"uid":    friend.UID,
+			"name":   friend.Name,
+			"remark": friend.Remark,
+			"avatar": o.avatarURL(friend.UID),
+		})
+	}
+	c.JSON(http.StatusOK, resps)
+}
+
+// 获取授权用户的群聊（需要groups权限）
+func (o *OpenAPI) groupsGet(c *wkhttp.Context) {
+	uid := accessTokenData(c).UID
+	groups, err := o.groupService.GetGroupsWithMemberUID(uid)
+	if err != nil {
+		o.Error("查询群聊失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询群聊失败！"))
+		return
+	}
+	resps := make([]gin.H, 0, len(groups))
+	for _, group := range groups {
+		resps = append(resps, gin.H{
+			"group_no": group.GroupNo,
+			"name":     group.Name,
+		})
+	}
+	c.JSON(http.StatusOK, resps)
+}
+
+// 以授权用户的身份发送文本消息（需要send_message权限，只能发给好友或自己所在的群）
+func (o *OpenAPI) messageSend(c *wkhttp.Context) {
+	uid := accessTokenData(c).UID
+	var req struct {
+		ChannelID   string `json:"channel_id"`
+		ChannelType uint8  `json:"channel_type"`
+		Content     string `json:"content"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		o.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if strings.TrimSpace(req.ChannelID) == "" {
+		c.ResponseError(errors.New("channel_id不能为空！"))
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		c.ResponseError(errors.New("content不能为空！"))
+		return
+	}
+	if utf8.RuneCountInString(req.Content) > openapiMessageMaxLen {
+		c.ResponseError(fmt.Errorf("content不能超过%d个字！", openapiMessageMaxLen))
+		return
+	}
+	var allowed bool
+	var err error
+	switch req.ChannelType {
+	case common.ChannelTypePerson.Uint8():
+		allowed, err = o.userService.IsFriend(uid, req.ChannelID)
+	case common.ChannelTypeGroup.Uint8():
+		allowed, err = o.groupService.ExistMember(req.ChannelID, uid)
+	default:
+		c.ResponseError(errors.New("不支持的channel_type！"))
+		return
+	}
+	if err != nil {
+		o.Error("查询是否可以发送消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询是否可以发送消息失败！"))
+		return
+	}
+	if !allowed {
+		c.ResponseError(errors.New("只能给好友或自己所在的群发送消息！"))
+		return
+	}
+	result, err := o.ctx.SendMessageWithResult(&config.MsgSendReq{
+		ChannelID:   req.ChannelID,
+		ChannelType: req.ChannelType,
+		FromUID:     uid,
+		Payload: []byte(util.ToJson(map[string]interface{}{
+			"type":    common.Text,
+			"content": req.Content,
+		})),
+	})
+	if err != nil {
+		o.Error("发送消息失败！", zap.Error(err))
+		c.ResponseError(errors.New("发送消息失败！"))
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,26 @@
+-- +migrate Up
+
+-- OAuth2客户端（与app一一对应，client_secret即app_key）
+create table `openapi_client`
+(
+  id            bigint          not null primary key AUTO_INCREMENT,
+  app_id        VARCHAR(40)     not null default '' comment 'app id',
+  redirect_uris VARCHAR(2000)   not null default '' comment '注册的回调地址（JSON数组），授权时必须完全匹配',
+  scopes        VARCHAR(200)    not null default '' comment '允许申请的权限，空格分隔',
+  created_at    timeStamp       not null DEFAULT CURRENT_TIMESTAMP,
+  updated_at    timeStamp       not null DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX `openapi_client_app_id` on `openapi_client` (`app_id`);
+
+-- 用户对app的授权
+create table `openapi_grant`
+(
+  id            bigint          not null primary key AUTO_INCREMENT,
+  uid           VARCHAR(40)     not null default '' comment '用户uid',
+  app_id        VARCHAR(40)     not null default '' comment 'app id',
+  scope         VARCHAR(200)    not null default '' comment '已授权的权限，空格分隔',
+  token_version integer         not null default 0 comment 'token版本，变更后之前签发的token全部失效',
+  created_at    timeStamp       not null DEFAULT CURRENT_TIMESTAMP,
+  updated_at    timeStamp       not null DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX `openapi_grant_uid_app_id` on `openapi_grant` (`uid`, `app_id`);
@@ -0,0 +1,13 @@
+-- +migrate Up
+
+-- OpenID Connect ID token签名密钥（定期轮换，轮换后旧密钥在JWKS中保留一段时间）
+create table `openapi_signing_key`
+(
+  id            bigint          not null primary key AUTO_INCREMENT,
+  kid           VARCHAR(40)     not null default '' comment '密钥ID',
+  private_key   TEXT            not null comment 'RSA私钥（PKCS1 pem）',
+  created_at    timeStamp       not null DEFAULT CURRENT_TIMESTAMP,
+  updated_at    timeStamp       not null DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX `openapi_signing_key_kid` on `openapi_signing_key` (`kid`);
+CREATE INDEX `openapi_signing_key_created_at` on `openapi_signing_key` (`created_at`);
@@ -101,6 +101,15 @@ func (q *QRCode) handleQRCodeInfo(c *wkhttp.Context) {
 		}))
 		return
 	}
+	if strings.HasPrefix(code, group.InviteLinkCodePrefix) { // 群邀请链接二维码 格式： grouplink_xxxx
+		result, err := q.handleGroupInviteLink(loginUID, code[len(group.InviteLinkCodePrefix):])
+		if err != nil {
+			c.ResponseError(err)
+			return
+		}
+		c.Response(result)
+		return
+	}
 
 	qrcodeContent, err := q.ctx.GetRedisConn().GetString(fmt.Sprintf("%s%s", common.QRCodeCachePrefix, code))
 	if err != nil {
@@ -198,3 +207,29 @@ func (q *QRCode) handleJoinGroup(loginUID string, qrCodeModel common.QRCodeModel
 		"url": fmt.Sprintf("%s/join_group.html?group_no=%s&auth_code=%s", q.ctx.GetConfig().External.H5BaseURL, groupNo, authCode),
 	}), nil
 }
+
+// 处理群邀请链接
+func (q *QRCode) handleGroupInviteLink(loginUID string, linkNo string) (*HandleResult, error) {
+	link, err := q.groupDB.QueryInviteLinkWithNo(linkNo)
+	if err != nil {
+		q.Error("查询邀请链接失败！", zap.Error(err))
+		return nil, errors.New("查询邀请链接失败！")
+	}
+	if link == nil {
+		return nil, errors.New("邀请链接不存在！")
+	}
+	exist, err := q.groupDB.ExistMember(loginUID, link.GroupNo) // 已在群内
+	if err != nil {
+		q.Error("查询是否存在群内失败！", zap.Error(err))
+		return nil, errors.New("查询是否存在群内失败！")
+	}
+	if exist {
+		return NewHandleResult(ForwardNative, HandlerTypeGroup, map[string]interface{}{
+			"group_no": link.GroupNo,
+		}), nil
+	}
+	return NewHandleResult(ForwardNative, HandlerTypeGroupInviteLink, map[string]interface{}{
+		"group_no": link.GroupNo,
+		"link_no":  link.LinkNo,
+	}), nil
+}
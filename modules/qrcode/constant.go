@@ -46,6 +46,8 @@ const (
 	HandlerTypeLoginConfirm HandlerType = "loginConfirm"
 	// HandlerTypeUserInfo 跳转到用户资料页面
 	HandlerTypeUserInfo HandlerType = "userInfo"
+	// HandlerTypeGroupInviteLink 跳转到群邀请链接页面
+	HandlerTypeGroupInviteLink HandlerType = "groupInviteLink"
 )
 
 // MarshalJSON MarshalJSON
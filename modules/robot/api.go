@@ -12,6 +12,8 @@ import (
 	"time"
 
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/app"
+	commonapi "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/common"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/file"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/user"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis"
@@ -31,11 +33,20 @@ type Robot struct {
 	robotEventPrefix                  string
 	userService                       user.IService
 	appService                        app.IService
+	commonService                     commonapi.IService
+	fileService                       file.IService
+	userDB                            *user.DB
 	inlineQueryEventsMap              map[string][]*robotEvent // inlineQuery事件
 	inlineQueryEventsMapLock          sync.RWMutex
 	inlineQueryEventResultChanMap     map[string]chan *InlineQueryResult
 	inlineQueryEventResultChanMapLock sync.RWMutex
 	mentionRegexp                     *regexp.Regexp
+	webhookClient                     *http.Client
+	webhookPolicy                     *webhookAddrPolicy // 允许推送的地址配置
+	webhookPolicyLoadedAt             time.Time
+	webhookPolicyLock                 sync.RWMutex
+	webhookWorkers                    map[string]*robotWebhookWorker // 每个机器人的webhook推送协程
+	webhookWorkersLock                sync.Mutex
 }
 
 func New(ctx *config.Context) *Robot {
@@ -46,10 +57,15 @@ func New(ctx *config.Context) *Robot {
 		robotEventPrefix:              "robotEvent:",
 		userService:                   user.NewService(ctx),
 		appService:                    app.NewService(ctx),
+		commonService:                 commonapi.NewService(ctx),
+		fileService:                   file.NewService(ctx),
+		userDB:                        user.NewDB(ctx),
 		inlineQueryEventsMap:          map[string][]*robotEvent{},
 		inlineQueryEventResultChanMap: map[string]chan *InlineQueryResult{},
 		mentionRegexp:                 regexp.MustCompile(`@\S+`),
+		webhookWorkers:                map[string]*robotWebhookWorker{},
 	}
+	rb.webhookClient = newWebhookClient(rb.getWebhookAddrPolicy)
 	ctx.AddMessagesListener(rb.messagesListen)
 
 	ctx.AddMessagesListener(rb.robotMessageListen)
@@ -64,6 +80,16 @@ func (rb *Robot) Route(r *wkhttp.WKHttp) {
 	{
 		auth.POST("/robot/sync", rb.sync)                // 同步机器人菜单
 		auth.POST("/robot/inline_query", rb.inlineQuery) // 机器人行内搜索
+
+		auth.POST("/robot/bots", rb.createBot)                           // 创建机器人
+		auth.GET("/robot/bots", rb.myBots)                               // 我创建的机器人
+		auth.GET("/robot/bots/:robot_id", rb.botDetail)                  // 机器人详情
+		auth.PUT("/robot/bots/:robot_id", rb.updateBot)                  // 修改机器人资料
+		auth.DELETE("/robot/bots/:robot_id", rb.deleteBot)               // 删除机器人
+		auth.POST("/robot/bots/:robot_id/token", rb.rotateBotToken)      // 重置机器人token
+		auth.POST("/robot/bots/:robot_id/avatar", rb.uploadBotAvatar)    // 上传机器人头像
+		auth.PUT("/robot/bots/:robot_id/menus", rb.updateBotMenus)       // 设置机器人菜单
+		auth.DELETE("/robot/bots/:robot_id/menus/:id", rb.deleteBotMenu) // 删除机器人菜单
 	}
 
 	robotAuth := r.Group("/v1/robots/:robot_id/:app_key", rb.authRobot()) // :robot_id即user的username
@@ -76,6 +102,9 @@ func (rb *Robot) Route(r *wkhttp.WKHttp) {
 		robotAuth.POST("/typing", rb.typing)                       // 输入中
 		robotAuth.POST("/stream/start", rb.streamStart)            // 流式消息开启
 		robotAuth.POST("/stream/end", rb.streamEnd)                // 流式消息结束
+		robotAuth.POST("/setWebhook", rb.setWebhook)               // 设置事件推送地址
+		robotAuth.POST("/deleteWebhook", rb.deleteWebhook)         // 删除事件推送地址（改为轮询）
+		robotAuth.GET("/getWebhookInfo", rb.getWebhookInfo)        // 获取事件推送状态
 
 	}
 
@@ -151,6 +180,12 @@ func (rb *Robot) authRobot() wkhttp.HandlerFunc {
 			})
 			return
 		}
+		if appM.Status == app.StatusDisable {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"msg": "app已被禁用！",
+			})
+			return
+		}
 		if appM.AppKey != appKey {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"msg": "appKey不正确！",
@@ -374,13 +409,16 @@ func (rb *Robot) addInlineQuery(robotID string, inlineQuery *InlineQuery) {
 	if events == nil {
 		events = make([]*robotEvent, 0)
 	}
-	events = append(events, &robotEvent{
+	event := &robotEvent{
 		EventID:     seq,
 		InlineQuery: inlineQuery,
 		Expire:      time.Now().Add(rb.ctx.GetConfig().Robot.InlineQueryTimeout).Unix(),
-	})
+	}
+	events = append(events, event)
 	rb.inlineQueryEventsMap[robotID] = events
 	rb.inlineQueryEventsMapLock.Unlock()
+
+	rb.dispatchWebhook(robotID, event)
 }
 
 func (rb *Robot) removeInlineQuery(robotID, sid string) {
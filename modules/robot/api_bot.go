@@ -0,0 +1,751 @@
+package robot
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/app"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/user"
+	"github.com/go-sql-driver/mysql"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/common"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	robotDefaultMaxCountPerUser = 5  // 未配置时每个用户最多可创建的机器人数量
+	robotMaxMenuCount           = 50 // 每个机器人最多的菜单数量
+	robotMaxNameLen             = 30
+	robotMaxDescriptionLen      = 512
+	robotMaxPlaceholderLen      = 40
+)
+
+// isDuplicateEntry 是否是唯一索引冲突
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+// 机器人username：字母开头，只能包含字母数字下划线，且以bot结尾
+var robotUsernameRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{4,31}$`)
+
+// 创建机器人
+func (rb *Robot) createBot(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req botCreateReq
+	if err := c.BindJSON(&req); err != nil {
+		rb.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	appConfig, err := rb.commonService.GetAppConfig()
+	if err != nil {
+		rb.Error("查询应用配置失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询应用配置失败！"))
+		return
+	}
+	if appConfig.RobotCreateOn != 1 {
+		c.ResponseError(errors.New("暂不允许创建机器人！"))
+		return
+	}
+	maxCount := appConfig.RobotMaxCountPerUser
+	if maxCount <= 0 {
+		maxCount = robotDefaultMaxCountPerUser
+	}
+
+	robotID := req.Username
+	exist, err := rb.usernameExist(robotID)
+	if err != nil {
+		rb.Error("查询机器人username是否存在失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询机器人username是否存在失败！"))
+		return
+	}
+	if exist {
+		c.ResponseError(errors.New("该username已被使用！"))
+		return
+	}
+
+	status := Enable
+	if appConfig.RobotCreateApprovalOn == 1 {
+		status = Pending
+	}
+	tx, err := rb.db.session.Begin()
+	if err != nil {
+		rb.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	// 锁定创建者，同一用户并发创建时串行执行，保证数量不超过上限
+	err = rb.userDB.LockWithUIDTx(loginUID, tx)
+	if err != nil {
+		tx.Rollback()
+		rb.Error("锁定创建者失败！", zap.Error(err))
+		c.ResponseError(errors.New("锁定创建者失败！"))
+		return
+	}
+	count, err := rb.db.queryCountWithCreatorUIDTx(loginUID, tx)
+	if err != nil {
+		tx.Rollback()
+		rb.Error("查询用户创建的机器人数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户创建的机器人数量失败！"))
+		return
+	}
+	if count >= int64(maxCount) {
+		tx.Rollback()
+		c.ResponseError(fmt.Errorf("最多只能创建%d个机器人！", maxCount))
+		return
+	}
+	appResp, err := rb.appService.CreateAppTx(app.Req{AppID: robotID}, tx)
+	if err != nil {
+		tx.Rollback()
+		rb.Error("创建机器人app失败！", zap.Error(err))
+		c.ResponseError(errors.New("创建机器人app失败！"))
+		return
+	}
+	// user.uid和robot.robot_id的唯一索引保证并发创建同一username时只有一个能成功
+	err = rb.userDB.InsertTx(&user.Model{
+		UID:      robotID,
+		Username: robotID,
+		Name:     req.Name,
+		ShortNo:  util.Ten2Hex(time.Now().UnixNano()),
+		Robot:    1,
+		Status:   1,
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		if isDuplicateEntry(err) {
+			c.ResponseError(errors.New("该username已被使用！"))
+			return
+		}
+		rb.Error("添加机器人用户失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加机器人用户失败！"))
+		return
+	}
+	robotM := &robot{
+		AppID:       appResp.AppID,
+		RobotID:     robotID,
+		Username:    robotID,
+		InlineOn:    req.InlineOn,
+		Placeholder: req.Placeholder,
+		Token:       util.GenerUUID(),
+		Version:     rb.ctx.GenSeq(common.RobotSeqKey),
+		Status:      int(status),
+		CreatorUID:  loginUID,
+		Description: req.Description,
+	}
+	err = rb.db.insertTx(robotM, tx)
+	if err != nil {
+		tx.Rollback()
+		if isDuplicateEntry(err) {
+			c.ResponseError(errors.New("该username已被使用！"))
+			return
+		}
+		rb.Error("添加机器人失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加机器人失败！"))
+		return
+	}
+	for _, menuReq := range req.Menus {
+		err = rb.db.insertMenuTx(menuReq.toMenu(robotID), tx)
+		if err != nil {
+			tx.Rollback()
+			rb.Error("添加机器人菜单失败！", zap.Error(err))
+			c.ResponseError(errors.New("添加机器人菜单失败！"))
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.RollbackUnlessCommitted()
+		rb.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	resp := newBotResp(robotM, req.Name, nil)
+	resp.Token = robotM.Token
+	resp.AppKey = appResp.AppKey
+	c.Response(resp)
+}
+
+// 我创建的机器人
+func (rb *Robot) myBots(c *wkhttp.Context) {
+	robots, err := rb.db.queryWithCreatorUID(c.GetLoginUID())
+	if err != nil {
+		rb.Error("查询我的机器人失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询我的机器人失败！"))
+		return
+	}
+	resps := make([]*botResp, 0, len(robots))
+	if len(robots) == 0 {
+		c.Response(resps)
+		return
+	}
+	robotIDs := make([]string, 0, len(robots))
+	for _, robotM := range robots {
+		robotIDs = append(robotIDs, robotM.RobotID)
+	}
+	users, err := rb.userDB.QueryByUIDs(robotIDs)
+	if err != nil {
+		rb.Error("查询机器人用户信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询机器人用户信息失败！"))
+		return
+	}
+	for _, robotM := range robots {
+		var name string
+		for _, userM := range users {
+			if userM.UID == robotM.RobotID {
+				name = userM.Name
+				break
+			}
+		}
+		resps = append(resps, newBotResp(robotM, name, nil))
+	}
+	c.Response(resps)
+}
+
+// 机器人详情（包含token和app key）
+func (rb *Robot) botDetail(c *wkhttp.Context) {
+	robotM := rb.queryOwnedRobot(c)
+	if robotM == nil {
+		return
+	}
+	userM, err := rb.userDB.QueryByUID(robotM.RobotID)
+	if err != nil {
+		rb.Error("查询机器人用户信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询机器人用户信息失败！"))
+		return
+	}
+	var name string
+	if userM != nil {
+		name = userM.Name
+	}
+	menus, err := rb.db.queryMenusWithRobotID(robotM.RobotID)
+	if err != nil {
+		rb.Error("查询机器人菜单失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询机器人菜单失败！"))
+		return
+	}
+	appResp, err := rb.appService.GetApp(robotM.AppID)
+	if err != nil {
+		rb.Error("查询机器人app失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询机器人app失败！"))
+		return
+	}
+	resp := newBotResp(robotM, name, menus)
+	resp.Token = robotM.Token
+	resp.AppKey = appResp.AppKey
+	c.Response(resp)
+}
+
+// 修改机器人资料
+func (rb *Robot) updateBot(c *wkhttp.Context) {
+	robotM := rb.queryOwnedRobot(c)
+	if robotM == nil {
+		return
+	}
+	var req botUpdateReq
+	if err := c.BindJSON(&req); err != nil {
+		rb.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	infoMap := map[string]interface{}{}
+	if req.Description != nil {
+		infoMap["description"] = *req.Description
+	}
+	if req.Placeholder != nil {
+		infoMap["placeholder"] = *req.Placeholder
+	}
+	if req.InlineOn != nil {
+		infoMap["inline_on"] = *req.InlineOn
+	}
+	if len(infoMap) > 0 {
+		infoMap["version"] = rb.ctx.GenSeq(common.RobotSeqKey)
+		err := rb.db.updateRobotInfo(robotM.RobotID, infoMap)
+		if err != nil {
+			rb.Error("修改机器人资料失败！", zap.Error(err))
+			c.ResponseError(errors.New("修改机器人资料失败！"))
+			return
+		}
+	}
+	if req.Name != nil {
+		err := rb.userDB.UpdateUsersWithField("name", *req.Name, robotM.RobotID)
+		if err != nil {
+			rb.Error("修改机器人名称失败！", zap.Error(err))
+			c.ResponseError(errors.New("修改机器人名称失败！"))
+			return
+		}
+	}
+	c.ResponseOK()
+}
+
+// 重置机器人token，旧的token和app key立即失效
+func (rb *Robot) rotateBotToken(c *wkhttp.Context) {
+	robotM := rb.queryOwnedRobot(c)
+	if robotM == nil {
+		return
+	}
+	tx, err := rb.db.session.Begin()
+	if err != nil {
+		rb.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	token := util.GenerUUID()
+	count, err := rb.db.updateTokenTx(robotM.RobotID, robotM.Token, token, tx)
+	if err != nil {
+		tx.Rollback()
+		rb.Error("重置机器人token失败！", zap.Error(err))
+		c.ResponseError(errors.New("重置机器人token失败！"))
+		return
+	}
+	if count == 0 {
+		tx.Rollback()
+		c.ResponseError(errors.New("机器人token已被重置，请刷新后重试！"))
+		return
+	}
+	appKey, err := rb.appService.ResetAppKeyTx(robotM.AppID, tx)
+	if err != nil {
+		tx.Rollback()
+		rb.Error("重置机器人app key失败！", zap.Error(err))
+		c.ResponseError(errors.New("重置机器人app key失败！"))
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.RollbackUnlessCommitted()
+		rb.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	rb.removeWebhookCache(robotM.RobotID) // webhook签名使用token
+	c.Response(map[string]interface{}{
+		"token":   token,
+		"app_key": appKey,
+	})
+}
+
+// 上传机器人头像
+func (rb *Robot) uploadBotAvatar(c *wkhttp.Context) {
+	robotM := rb.queryOwnedRobot(c)
+	if robotM == nil {
+		return
+	}
+	if c.Request.MultipartForm == nil {
+		err := c.Request.ParseMultipartForm(1024 * 1024 * 20) // 20M
+		if err != nil {
+			rb.Error("数据格式不正确！", zap.Error(err))
+			c.ResponseError(errors.New("数据格式不正确！"))
+			return
+		}
+	}
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		rb.Error("读取文件失败！", zap.Error(err))
+		c.ResponseError(errors.New("读取文件失败！"))
+		return
+	}
+	defer file.Close()
+	avatarID := crc32.ChecksumIEEE([]byte(robotM.RobotID)) % uint32(rb.ctx.GetConfig().Avatar.Partition)
+	_, err = rb.fileService.UploadFile(fmt.Sprintf("avatar/%d/%s.png", avatarID, robotM.RobotID), "image/png", func(w io.Writer) error {
+		_, err := io.Copy(w, file)
+		return err
+	})
+	if err != nil {
+		rb.Error("上传文件失败！", zap.Error(err))
+		c.ResponseError(errors.New("上传文件失败！"))
+		return
+	}
+	err = rb.userDB.UpdateUsersWithField("is_upload_avatar", "1", robotM.RobotID)
+	if err != nil {
+		rb.Error("修改机器人是否上传头像失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改机器人是否上传头像失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 设置机器人菜单（全量替换）
+func (rb *Robot) updateBotMenus(c *wkhttp.Context) {
+	robotM := rb.queryOwnedRobot(c)
+	if robotM == nil {
+		return
+	}
+	var menuReqs []*botMenuReq
+	if err := c.BindJSON(&menuReqs); err != nil {
+		rb.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if err := checkBotMenus(menuReqs); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	tx, err := rb.db.session.Begin()
+	if err != nil {
+		rb.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	err = rb.db.deleteMenusTx(robotM.RobotID, tx)
+	if err != nil {
+		tx.Rollback()
+		rb.Error("删除机器人菜单失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除机器人菜单失败！"))
+		return
+	}
+	for _, menuReq := range menuReqs {
+		err = rb.db.insertMenuTx(menuReq.toMenu(robotM.RobotID), tx)
+		if err != nil {
+			tx.Rollback()
+			rb.Error("添加机器人菜单失败！", zap.Error(err))
+			c.ResponseError(errors.New("添加机器人菜单失败！"))
+			return
+		}
+	}
+	robotM.Version = rb.ctx.GenSeq(common.RobotSeqKey)
+	err = rb.db.updateRobotTx(robotM, tx)
+	if err != nil {
+		tx.Rollback()
+		rb.Error("修改机器人版本号失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改机器人版本号失败！"))
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.RollbackUnlessCommitted()
+		rb.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 删除机器人某个菜单
+func (rb *Robot) deleteBotMenu(c *wkhttp.Context) {
+	robotM := rb.queryOwnedRobot(c)
+	if robotM == nil {
+		return
+	}
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	tx, err := rb.db.session.Begin()
+	if err != nil {
+		rb.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	err = rb.db.deleteMenuWithID(robotM.RobotID, id, tx)
+	if err != nil {
+		tx.Rollback()
+		rb.Error("删除机器人菜单失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除机器人菜单失败！"))
+		return
+	}
+	robotM.Version = rb.ctx.GenSeq(common.RobotSeqKey)
+	err = rb.db.updateRobotTx(robotM, tx)
+	if err != nil {
+		tx.Rollback()
+		rb.Error("修改机器人版本号失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改机器人版本号失败！"))
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.RollbackUnlessCommitted()
+		rb.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 删除机器人
+func (rb *Robot) deleteBot(c *wkhttp.Context) {
+	robotM := rb.queryOwnedRobot(c)
+	if robotM == nil {
+		return
+	}
+	tx, err := rb.db.session.Begin()
+	if err != nil {
+		rb.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	err = rb.db.deleteMenusTx(robotM.RobotID, tx)
+	if err != nil {
+		tx.Rollback()
+		rb.Error("删除机器人菜单失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除机器人菜单失败！"))
+		return
+	}
+	err = rb.db.deleteTx(robotM.RobotID, tx)
+	if err != nil {
+		tx.Rollback()
+		rb.Error("删除机器人失败！", zap.Error(err))
+		c.ResponseError(errors.New("删除机器人失败！"))
+		return
+	}
+	// 禁用机器人的app，app key随之失效
+	err = rb.appService.DisableAppTx(robotM.AppID, tx)
+	if err != nil {
+		tx.Rollback()
+		rb.Error("禁用机器人app失败！", zap.Error(err))
+		c.ResponseError(errors.New("禁用机器人app失败！"))
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.RollbackUnlessCommitted()
+		rb.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	// 机器人用户保留（历史消息需要展示），但禁用
+	err = rb.userDB.UpdateUsersWithField("status", "0", robotM.RobotID)
+	if err != nil {
+		rb.Warn("禁用机器人用户失败！", zap.Error(err), zap.String("robotID", robotM.RobotID))
+	}
+	rb.removeRobotExistCache(robotM.RobotID)
+	rb.removeWebhookCache(robotM.RobotID)
+	c.ResponseOK()
+}
+
+// 查询登录用户创建的机器人，不存在或不是创建者则直接响应错误并返回nil
+func (rb *Robot) queryOwnedRobot(c *wkhttp.Context) *robot {
+	robotID := c.Param("robot_id")
+	robotM, err := rb.db.queryRobotWithRobtID(robotID)
+	if err != nil {
+		rb.Error("查询机器人失败！", zap.Error(err), zap.String("robotID", robotID))
+		c.ResponseError(errors.New("查询机器人失败！"))
+		return nil
+	}
+	if robotM == nil || robotM.CreatorUID != c.GetLoginUID() {
+		c.ResponseError(errors.New("机器人不存在！"))
+		return nil
+	}
+	return robotM
+}
+
+func (rb *Robot) usernameExist(username string) (bool, error) {
+	robotM, err := rb.db.queryRobotWithRobtID(username)
+	if err != nil {
+		return false, err
+	}
+	if robotM != nil {
+		return true, nil
+	}
+	userM, err := rb.userDB.QueryByUID(username)
+	if err != nil {
+		return false, err
+	}
+	if userM != nil {
+		return true, nil
+	}
+	userM, err = rb.userDB.QueryByUsername(username)
+	if err != nil {
+		return false, err
+	}
+	return userM != nil, nil
+}
+
+type botCreateReq struct {
+	Username    string        `json:"username"`    // 机器人username（同时作为机器人ID）
+	Name        string        `json:"name"`        // 机器人名称
+	Description string        `json:"description"` // 机器人简介
+	InlineOn    int           `json:"inline_on"`   // 是否开启行内搜索
+	Placeholder string        `json:"placeholder"` // 输入框占位符，开启行内搜索有效
+	Menus       []*botMenuReq `json:"menus"`       // 命令菜单
+}
+
+func (r *botCreateReq) check() error {
+	r.Username = strings.TrimSpace(r.Username)
+	if !robotUsernameRegexp.MatchString(r.Username) || !strings.HasSuffix(strings.ToLower(r.Username), "bot") {
+		return errors.New("username只能包含字母、数字和下划线，以字母开头，以bot结尾，长度5-32位！")
+	}
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return errors.New("机器人名称不能为空！")
+	}
+	if utf8.RuneCountInString(r.Name) > robotMaxNameLen {
+		return errors.New("机器人名称过长！")
+	}
+	if utf8.RuneCountInString(r.Description) > robotMaxDescriptionLen {
+		return errors.New("机器人简介过长！")
+	}
+	if utf8.RuneCountInString(r.Placeholder) > robotMaxPlaceholderLen {
+		return errors.New("输入框占位符过长！")
+	}
+	if r.InlineOn != 0 && r.InlineOn != 1 {
+		return errors.New("inline_on只能为0或1！")
+	}
+	return checkBotMenus(r.Menus)
+}
+
+type botUpdateReq struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	InlineOn    *int    `json:"inline_on"`
+	Placeholder *string `json:"placeholder"`
+}
+
+func (r *botUpdateReq) check() error {
+	if r.Name != nil {
+		name := strings.TrimSpace(*r.Name)
+		if name == "" {
+			return errors.New("机器人名称不能为空！")
+		}
+		if utf8.RuneCountInString(name) > robotMaxNameLen {
+			return errors.New("机器人名称过长！")
+		}
+		r.Name = &name
+	}
+	if r.Description != nil && utf8.RuneCountInString(*r.Description) > robotMaxDescriptionLen {
+		return errors.New("机器人简介过长！")
+	}
+	if r.Placeholder != nil && utf8.RuneCountInString(*r.Placeholder) > robotMaxPlaceholderLen {
+		return errors.New("输入框占位符过长！")
+	}
+	if r.InlineOn != nil && *r.InlineOn != 0 && *r.InlineOn != 1 {
+		return errors.New("inline_on只能为0或1！")
+	}
+	return nil
+}
+
+type botMenuReq struct {
+	CMD    string `json:"cmd"`    // 命令 如 /help
+	Remark string `json:"remark"` // 命令说明
+	Type   string `json:"type"`   // 命令类型 none/inline/link
+}
+
+func (m *botMenuReq) toMenu(robotID string) *menu {
+	menuType := m.Type
+	if menuType == "" {
+		menuType = string(None)
+	}
+	return &menu{
+		RobotID: robotID,
+		CMD:     m.CMD,
+		Remark:  m.Remark,
+		Type:    menuType,
+	}
+}
+
+func checkBotMenus(menus []*botMenuReq) error {
+	if len(menus) > robotMaxMenuCount {
+		return fmt.Errorf("菜单数量不能超过%d个！", robotMaxMenuCount)
+	}
+	cmds := map[string]bool{}
+	for _, m := range menus {
+		if m == nil {
+			return errors.New("菜单不能为空！")
+		}
+		m.CMD = strings.TrimSpace(m.CMD)
+		if !strings.HasPrefix(m.CMD, "/") || utf8.RuneCountInString(m.CMD) < 2 || utf8.RuneCountInString(m.CMD) > 32 {
+			return fmt.Errorf("菜单命令[%s]需以/开头，长度2-32位！", m.CMD)
+		}
+		if cmds[m.CMD] {
+			return fmt.Errorf("菜单命令[%s]重复！", m.CMD)
+		}
+		cmds[m.CMD] = true
+		if utf8.RuneCountInString(m.Remark) > 100 {
+			return fmt.Errorf("菜单命令[%s]的说明过长！", m.CMD)
+		}
+		switch RobotCMDType(m.Type) {
+		case "", None, Inline, Link:
+		default:
+			return fmt.Errorf("菜单命令[%s]的类型有误！", m.CMD)
+		}
+	}
+	return nil
+}
+
+type botResp struct {
+	RobotID     string       `json:"robot_id"`
+	Username    string       `json:"username"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	InlineOn    int          `json:"inline_on"`
+	Placeholder string       `json:"placeholder"`
+	Status      int          `json:"status"` // 0.禁用 1.启用 2.待审核
+	Version     int64        `json:"version"`
+	Token       string       `json:"token,omitempty"`
+	AppKey      string       `json:"app_key,omitempty"` // 机器人接口 /v1/robots/{robot_id}/{app_key}/...
+	Menus       []*robotMenu `json:"menus,omitempty"`
+	CreatedAt   string       `json:"created_at"`
+	UpdatedAt   string       `json:"updated_at"`
+}
+
+func newBotResp(m *robot, name string, menus []*menu) *botResp {
+	resp := &botResp{
+		RobotID:     m.RobotID,
+		Username:    m.Username,
+		Name:        name,
+		Description: m.Description,
+		InlineOn:    m.InlineOn,
+		Placeholder: m.Placeholder,
+		Status:      m.Status,
+		Version:     m.Version,
+		CreatedAt:   m.CreatedAt.String(),
+		UpdatedAt:   m.UpdatedAt.String(),
+	}
+	if len(menus) > 0 {
+		resp.Menus = make([]*robotMenu, 0, len(menus))
+		for _, menu := range menus {
+			resp.Menus = append(resp.Menus, &robotMenu{
+				Id:        menu.Id,
+				RobotID:   menu.RobotID,
+				CMD:       menu.CMD,
+				Remark:    menu.Remark,
+				Type:      menu.Type,
+				CreatedAt: menu.CreatedAt.String(),
+				UpdatedAt: menu.UpdatedAt.String(),
+			})
+		}
+	}
+	return resp
+}
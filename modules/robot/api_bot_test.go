@@ -0,0 +1,28 @@
+package robot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBotCreateReqCheck(t *testing.T) {
+	req := &botCreateReq{Username: "weather_bot", Name: "天气"}
+	assert.NoError(t, req.check())
+
+	req = &botCreateReq{Username: "weather", Name: "天气"}
+	assert.Error(t, req.check()) // 必须以bot结尾
+
+	req = &botCreateReq{Username: "1weatherbot", Name: "天气"}
+	assert.Error(t, req.check()) // 必须以字母开头
+
+	req = &botCreateReq{Username: "weatherbot", Name: " "}
+	assert.Error(t, req.check())
+}
+
+func TestCheckBotMenus(t *testing.T) {
+	assert.NoError(t, checkBotMenus([]*botMenuReq{{CMD: "/help", Remark: "帮助"}, {CMD: "/gif", Type: "inline"}}))
+	assert.Error(t, checkBotMenus([]*botMenuReq{{CMD: "help"}}))
+	assert.Error(t, checkBotMenus([]*botMenuReq{{CMD: "/help"}, {CMD: "/help"}}))
+	assert.Error(t, checkBotMenus([]*botMenuReq{{CMD: "/help", Type: "unknown"}}))
+}
@@ -2,6 +2,7 @@ package robot
 
 import (
 	"errors"
+	"fmt"
 	"strconv"
 
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/common"
@@ -29,6 +30,7 @@ func NewManager(ctx *config.Context) *Manager {
 func (m *Manager) Route(r *wkhttp.WKHttp) {
 	auth := r.Group("/v1/manager", m.ctx.AuthMiddleware(r))
 	{
+		auth.GET("/robot/list", m.robotList)                             // 机器人列表（可查询待审核的机器人）
 		auth.GET("/robot/menus", m.list)                                 // 机器人菜单
 		auth.DELETE("/robot/:robot_id/:id", m.delete)                    // 删除某个机器人菜单
 		auth.PUT("/robot/status/:robot_id/:status", m.updateRobotStatus) // 修改机器人状态
@@ -149,19 +151,74 @@ func (m *Manager) updateRobotStatus(c *wkhttp.Context) {
 		c.ResponseError(errors.New("查询操作的机器人错误"))
 		return
 	}
-	robot.Status = int(status)
 	if robot == nil {
 		c.ResponseError(errors.New("操作的机器人不存在"))
 		return
 	}
+	robot.Status = int(status)
 	err = m.db.updateRobot(robot)
 	if err != nil {
 		c.ResponseError(errors.New("修改机器人状态信息错误"))
 		return
 	}
+	// 清除机器人是否有效的缓存
+	err = m.ctx.GetRedisConn().Del(fmt.Sprintf("robot:exist:%s", robot_id))
+	if err != nil {
+		m.Warn("删除机器人缓存失败！", zap.Error(err))
+	}
 	c.ResponseOK()
 }
 
+// 机器人列表 status: 0.禁用 1.启用 2.待审核，不传则查询全部
+func (m *Manager) robotList(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	status := -1
+	if c.Query("status") != "" {
+		status, _ = strconv.Atoi(c.Query("status"))
+	}
+	pageIndex, pageSize := c.GetPage()
+	list, err := m.db.queryWithStatus(status, uint64(pageSize), uint64(pageIndex))
+	if err != nil {
+		m.Error("查询机器人列表错误", zap.Error(err))
+		c.ResponseError(errors.New("查询机器人列表错误"))
+		return
+	}
+	count, err := m.db.queryCountWithStatus(status)
+	if err != nil {
+		m.Error("查询机器人数量错误", zap.Error(err))
+		c.ResponseError(errors.New("查询机器人数量错误"))
+		return
+	}
+	resps := make([]*managerRobotResp, 0, len(list))
+	for _, robot := range list {
+		resps = append(resps, &managerRobotResp{
+			RobotID:     robot.RobotID,
+			Username:    robot.Username,
+			CreatorUID:  robot.CreatorUID,
+			Description: robot.Description,
+			Status:      robot.Status,
+			CreatedAt:   robot.CreatedAt.String(),
+		})
+	}
+	c.Response(map[string]interface{}{
+		"count": count,
+		"list":  resps,
+	})
+}
+
+type managerRobotResp struct {
+	RobotID     string `json:"robot_id"`
+	Username    string `json:"username"`
+	CreatorUID  string `json:"creator_uid"` // 创建者uid，系统机器人为空
+	Description string `json:"description"`
+	Status      int    `json:"status"` // 0.禁用 1.启用 2.待审核
+	CreatedAt   string `json:"created_at"`
+}
+
 type robotMenu struct {
 	Id        int64  `json:"id"`
 	CMD       string `json:"cmd"`
@@ -0,0 +1,93 @@
+package robot
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// 设置事件推送地址，设置后机器人的事件将通过POST推送到该地址
+func (rb *Robot) setWebhook(c *wkhttp.Context) {
+	robotID := c.Param("robot_id")
+	var req struct {
+		URL string `json:"url"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		rb.Error("数据格式有误！", zap.Error(err))
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	webhookURL := strings.TrimSpace(req.URL)
+	if webhookURL == "" {
+		c.ResponseError(errors.New("url不能为空！"))
+		return
+	}
+	if len(webhookURL) > 255 {
+		c.ResponseError(errors.New("url过长！"))
+		return
+	}
+	policy := rb.getWebhookAddrPolicy()
+	u, err := url.Parse(webhookURL)
+	if err != nil || !policy.schemeAllowed(u.Scheme) || u.Host == "" {
+		if policy.AllowHTTP {
+			c.ResponseError(errors.New("url必须是有效的http或https地址！"))
+		} else {
+			c.ResponseError(errors.New("url必须是有效的https地址！"))
+		}
+		return
+	}
+	if err = checkWebhookHost(c.Request.Context(), policy, u.Hostname()); err != nil {
+		if errors.Is(err, errWebhookAddrNotAllowed) {
+			c.ResponseError(errors.New("url不能指向未信任的内网或本机地址！"))
+			return
+		}
+		rb.Warn("解析webhook域名失败！", zap.Error(err), zap.String("url", webhookURL))
+		c.ResponseError(errors.New("url的域名无法解析！"))
+		return
+	}
+	err = rb.db.updateWebhook(robotID, webhookURL, WebhookStatusActive)
+	if err != nil {
+		rb.Error("设置机器人webhook失败！", zap.Error(err), zap.String("robotID", robotID))
+		c.ResponseError(errors.New("设置机器人webhook失败！"))
+		return
+	}
+	rb.removeWebhookCache(robotID)
+	c.ResponseOK()
+}
+
+// 删除事件推送地址，之后机器人需要通过轮询获取事件
+func (rb *Robot) deleteWebhook(c *wkhttp.Context) {
+	robotID := c.Param("robot_id")
+	err := rb.db.updateWebhook(robotID, "", WebhookStatusNone)
+	if err != nil {
+		rb.Error("删除机器人webhook失败！", zap.Error(err), zap.String("robotID", robotID))
+		c.ResponseError(errors.New("删除机器人webhook失败！"))
+		return
+	}
+	rb.removeWebhookCache(robotID)
+	c.ResponseOK()
+}
+
+// 获取事件推送状态
+func (rb *Robot) getWebhookInfo(c *wkhttp.Context) {
+	robotID := c.Param("robot_id")
+	robotM, err := rb.db.queryRobotWithRobtID(robotID)
+	if err != nil {
+		rb.Error("查询机器人失败！", zap.Error(err), zap.String("robotID", robotID))
+		c.ResponseError(errors.New("查询机器人失败！"))
+		return
+	}
+	if robotM == nil {
+		c.ResponseError(errors.New("机器人不存在！"))
+		return
+	}
+	c.Response(gin.H{
+		"url":        robotM.WebhookURL,
+		"status":     robotM.WebhookStatus, // 0.未设置 1.推送中 2.连续失败已回退为轮询（重新设置即可恢复）
+		"fail_count": robotM.WebhookFailCount,
+	})
+}
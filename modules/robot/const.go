@@ -15,6 +15,16 @@ type RobotStatus int
 const (
 	Enable    RobotStatus = 1
 	DisEnable RobotStatus = 0
+	Pending   RobotStatus = 2 // 待管理员审核
+)
+
+// webhook状态
+type WebhookStatus int
+
+const (
+	WebhookStatusNone     WebhookStatus = 0 // 未设置，通过轮询获取事件
+	WebhookStatusActive   WebhookStatus = 1 // 推送中
+	WebhookStatusFallback WebhookStatus = 2 // 连续推送失败，已回退为轮询
 )
 
 var systemRobotMap = []*systemRobotMenu{
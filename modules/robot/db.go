@@ -92,6 +92,28 @@ func (d *robotDB) updateRobot(m *robot) error {
 	}).Where("robot_id=?", m.RobotID).Exec()
 	return err
 }
+
+// 设置机器人webhook（重新设置会清除失败记录）
+func (d *robotDB) updateWebhook(robotID string, webhookURL string, status WebhookStatus) error {
+	_, err := d.session.Update("robot").SetMap(map[string]interface{}{
+		"webhook_url":        webhookURL,
+		"webhook_status":     int(status),
+		"webhook_fail_count": 0,
+	}).Where("robot_id=?", robotID).Exec()
+	return err
+}
+
+// 累加webhook失败次数，达到上限则回退为轮询
+func (d *robotDB) incrWebhookFailCount(robotID string, maxFailCount int) error {
+	_, err := d.session.UpdateBySql("update robot set webhook_fail_count=webhook_fail_count+1,webhook_status=if(webhook_fail_count>=?,?,webhook_status) where robot_id=? and webhook_status=?", maxFailCount, int(WebhookStatusFallback), robotID, int(WebhookStatusActive)).Exec()
+	return err
+}
+
+func (d *robotDB) resetWebhookFailCount(robotID string) error {
+	_, err := d.session.Update("robot").Set("webhook_fail_count", 0).Where("robot_id=? and webhook_fail_count>0", robotID).Exec()
+	return err
+}
+
 func (d *robotDB) queryMenusWithRobotID(robotID string) ([]*menu, error) {
 	var menus []*menu
 	_, err := d.session.Select("*").From("robot_menu").Where("robot_id=?", robotID).OrderDir("created_at", false).Load(&menus)
@@ -102,6 +124,71 @@ func (d *robotDB) deleteMenuWithID(robotID string, id int64, tx *dbr.Tx) error {
 	return err
 }
 
+// 查询用户创建的机器人
+func (d *robotDB) queryWithCreatorUID(creatorUID string) ([]*robot, error) {
+	var list []*robot
+	_, err := d.session.Select("*").From("robot").Where("creator_uid=?", creatorUID).OrderDir("created_at", false).Load(&list)
+	return list, err
+}
+
+func (d *robotDB) queryCountWithCreatorUID(creatorUID string) (int64, error) {
+	var count int64
+	_, err := d.session.Select("count(*)").From("robot").Where("creator_uid=?", creatorUID).Load(&count)
+	return count, err
+}
+
+func (d *robotDB) queryCountWithCreatorUIDTx(creatorUID string, tx *dbr.Tx) (int64, error) {
+	var count int64
+	_, err := tx.Select("count(*)").From("robot").Where("creator_uid=?", creatorUID).Load(&count)
+	return count, err
+}
+
+// 分页查询机器人（status小于0则不作为条件）
+func (d *robotDB) queryWithStatus(status int, pageSize, page uint64) ([]*robot, error) {
+	var list []*robot
+	builder := d.session.Select("*").From("robot")
+	if status >= 0 {
+		builder = builder.Where("status=?", status)
+	}
+	_, err := builder.OrderDir("created_at", false).Offset((page - 1) * pageSize).Limit(pageSize).Load(&list)
+	return list, err
+}
+
+func (d *robotDB) queryCountWithStatus(status int) (int64, error) {
+	var count int64
+	builder := d.session.Select("count(*)").From("robot")
+	if status >= 0 {
+		builder = builder.Where("status=?", status)
+	}
+	_, err := builder.Load(&count)
+	return count, err
+}
+
+// 修改机器人资料
+func (d *robotDB) updateRobotInfo(robotID string, infoMap map[string]interface{}) error {
+	_, err := d.session.Update("robot").SetMap(infoMap).Where("robot_id=?", robotID).Exec()
+	return err
+}
+
+// updateTokenTx token还是旧值时才更新（并发重置时只有一个能成功）
+func (d *robotDB) updateTokenTx(robotID string, oldToken string, token string, tx *dbr.Tx) (int64, error) {
+	result, err := tx.Update("robot").Set("token", token).Where("robot_id=? and token=?", robotID, oldToken).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (d *robotDB) deleteTx(robotID string, tx *dbr.Tx) error {
+	_, err := tx.DeleteFrom("robot").Where("robot_id=?", robotID).Exec()
+	return err
+}
+
+func (d *robotDB) deleteMenusTx(robotID string, tx *dbr.Tx) error {
+	_, err := tx.DeleteFrom("robot_menu").Where("robot_id=?", robotID).Exec()
+	return err
+}
+
 type menu struct {
 	RobotID string // 机器人ID
 	CMD     string // 命令
@@ -110,13 +197,18 @@ type menu struct {
 	db.BaseModel
 }
 type robot struct {
-	AppID       string
-	RobotID     string // 机器人唯一ID
-	Username    string // 机器人用户名
-	InlineOn    int    // 是否开启行内搜索
-	Placeholder string // 输入框占位符，开启行内搜索有效
-	Token       string
-	Version     int64
-	Status      int
+	AppID            string
+	RobotID          string // 机器人唯一ID
+	Username         string // 机器人用户名
+	InlineOn         int    // 是否开启行内搜索
+	Placeholder      string // 输入框占位符，开启行内搜索有效
+	Token            string
+	Version          int64
+	Status           int
+	CreatorUID       string // 创建者uid
+	Description      string // 机器人简介
+	WebhookURL       string // 事件推送地址
+	WebhookStatus    int    // webhook状态
+	WebhookFailCount int    // webhook连续推送失败的事件数
 	db.BaseModel
 }
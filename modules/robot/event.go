@@ -13,8 +13,19 @@ import (
 	"go.uber.org/zap"
 )
 
+func (rb *Robot) robotExistCacheKey(robotID string) string {
+	return fmt.Sprintf("robot:exist:%s", robotID)
+}
+
+func (rb *Robot) removeRobotExistCache(robotID string) {
+	err := rb.ctx.GetRedisConn().Del(rb.robotExistCacheKey(robotID))
+	if err != nil {
+		rb.Warn("删除机器人缓存失败！", zap.Error(err), zap.String("robotID", robotID))
+	}
+}
+
 func (rb *Robot) existRobot(robotID string) (bool, error) {
-	key := fmt.Sprintf("robot:exist:%s", robotID)
+	key := rb.robotExistCacheKey(robotID)
 	exist, err := rb.ctx.GetRedisConn().GetString(key)
 	if err != nil {
 		return false, err
@@ -110,13 +121,22 @@ func (rb *Robot) robotMessageListen(messages []*config.MessageResp) {
 func (rb *Robot) saveRobotMessage(message *config.MessageResp, robotID string) {
 
 	seq := rb.ctx.GenSeq(fmt.Sprintf("%s%s", common.RobotEventSeqKey, robotID))
-	messageUpdateJson := util.ToJson(&robotEvent{
+	event := &robotEvent{
 		EventID: seq,
 		Message: message,
 		Expire:  time.Now().Add(rb.ctx.GetConfig().Robot.MessageExpire).Unix(),
-	})
+	}
+	if rb.dispatchWebhook(robotID, event) { // 设置了webhook则直接推送给机器人
+		return
+	}
+	rb.queueRobotEvent(robotID, event)
+}
+
+// 将事件放入机器人的轮询队列
+func (rb *Robot) queueRobotEvent(robotID string, event *robotEvent) {
+	messageUpdateJson := util.ToJson(event)
 	key := fmt.Sprintf("%s%s", rb.robotEventPrefix, robotID)
-	err := rb.ctx.GetRedisConn().ZAdd(key, float64(seq), messageUpdateJson)
+	err := rb.ctx.GetRedisConn().ZAdd(key, float64(event.EventID), messageUpdateJson)
 	if err != nil {
 		rb.Error("投递消息给机器人失败！", zap.Error(err), zap.String("robotID", robotID), zap.String("message", messageUpdateJson))
 	}
@@ -0,0 +1,5 @@
+-- +migrate Up
+
+ALTER TABLE `robot` ADD COLUMN webhook_url VARCHAR(255) not null DEFAULT '' comment '机器人事件推送地址';
+ALTER TABLE `robot` ADD COLUMN webhook_status smallint not null DEFAULT 0 comment 'webhook状态 0.未设置 1.推送中 2.连续失败已回退为轮询';
+ALTER TABLE `robot` ADD COLUMN webhook_fail_count integer not null DEFAULT 0 comment 'webhook连续推送失败的事件数';
@@ -0,0 +1,5 @@
+-- +migrate Up
+
+ALTER TABLE `robot` ADD COLUMN creator_uid VARCHAR(40) not null DEFAULT '' comment '创建者uid（用户自助创建的机器人）';
+ALTER TABLE `robot` ADD COLUMN description VARCHAR(512) not null DEFAULT '' comment '机器人简介';
+CREATE INDEX `robot_creator_uid_index` on `robot` (`creator_uid`);
@@ -0,0 +1,366 @@
+package robot
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	commonapi "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/common"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+	"go.uber.org/zap"
+)
+
+const (
+	webhookMaxAttempts    = 3                // 每个事件的最大推送次数
+	webhookRetryDelay     = time.Second      // 第一次重试的延迟，之后按指数递增
+	webhookMaxFailCount   = 20               // 连续推送失败的事件数达到此值后回退为轮询
+	webhookQueueSize      = 1000             // 每个机器人的待推送事件队列长度
+	webhookWorkerIdle     = time.Minute * 5  // 推送协程空闲多久后退出
+	webhookCacheExpire    = time.Minute * 10 // webhook配置缓存时间
+	webhookRequestTimeout = time.Second * 10 // 推送请求超时时间
+	webhookPolicyExpire   = time.Minute      // 允许推送的地址配置缓存时间
+)
+
+const (
+	webhookHeaderEventID   = "X-Robot-Event-ID"
+	webhookHeaderTimestamp = "X-Robot-Timestamp"
+	webhookHeaderSignature = "X-Robot-Signature"
+)
+
+var errWebhookNotRetryable = errors.New("webhook返回了不可重试的状态码")
+
+var errWebhookAddrNotAllowed = errors.New("webhook地址不能是内网或本机地址")
+
+// webhookAddrPolicy 允许推送的地址，默认只允许https的公网地址
+// 后台配置信任的内网地址和http后，可以推送到本地测试接收端或内部机器人
+type webhookAddrPolicy struct {
+	AllowNets []*net.IPNet // 信任的内网地址
+	AllowHTTP bool         // 是否允许http地址
+}
+
+func (p *webhookAddrPolicy) ipAllowed(ip net.IP) bool {
+	if isPublicIP(ip) {
+		return true
+	}
+	for _, ipNet := range p.AllowNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *webhookAddrPolicy) schemeAllowed(scheme string) bool {
+	return scheme == "https" || (scheme == "http" && p.AllowHTTP)
+}
+
+// checkURL 推送前检查地址的协议是否仍然允许（后台可能已关闭http）
+func (p *webhookAddrPolicy) checkURL(webhookURL string) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return err
+	}
+	if !p.schemeAllowed(u.Scheme) {
+		return fmt.Errorf("%w：不允许%s地址", errWebhookNotRetryable, u.Scheme)
+	}
+	return nil
+}
+
+// getWebhookAddrPolicy 获取允许推送的地址配置（带缓存，查询或解析失败时只允许https的公网地址）
+func (rb *Robot) getWebhookAddrPolicy() *webhookAddrPolicy {
+	rb.webhookPolicyLock.RLock()
+	policy := rb.webhookPolicy
+	loadedAt := rb.webhookPolicyLoadedAt
+	rb.webhookPolicyLock.RUnlock()
+	if policy != nil && time.Since(loadedAt) < webhookPolicyExpire {
+		return policy
+	}
+	policy = &webhookAddrPolicy{}
+	appConfig, err := rb.commonService.GetAppConfig()
+	if err != nil {
+		rb.Warn("查询机器人webhook地址配置失败！", zap.Error(err))
+	} else if appConfig != nil {
+		allowNets, err := commonapi.ParseAllowIPs(appConfig.RobotWebhookAllowIPs)
+		if err != nil {
+			rb.Warn("机器人webhook允许的内网地址格式有误！", zap.Error(err))
+		} else {
+			policy.AllowNets = allowNets
+			policy.AllowHTTP = appConfig.RobotWebhookAllowHTTP == 1
+		}
+	}
+	rb.webhookPolicyLock.Lock()
+	rb.webhookPolicy = policy
+	rb.webhookPolicyLoadedAt = time.Now()
+	rb.webhookPolicyLock.Unlock()
+	return policy
+}
+
+// 机器人webhook配置
+type robotWebhook struct {
+	URL       string        `json:"url"`
+	Token     string        `json:"token"`
+	Status    WebhookStatus `json:"status"`
+	FailCount int           `json:"fail_count"`
+}
+
+type robotWebhookJob struct {
+	hook  *robotWebhook
+	event *robotEvent
+}
+
+// 每个机器人一个推送协程，保证同一机器人的事件按顺序推送
+type robotWebhookWorker struct {
+	robotID string
+	jobs    chan *robotWebhookJob
+}
+
+func (rb *Robot) webhookCacheKey(robotID string) string {
+	return fmt.Sprintf("robot:webhook:%s", robotID)
+}
+
+// 获取机器人webhook配置（未设置或已回退则返回nil）
+func (rb *Robot) getActiveWebhook(robotID string) (*robotWebhook, error) {
+	key := rb.webhookCacheKey(robotID)
+	hookJSON, err := rb.ctx.GetRedisConn().GetString(key)
+	if err != nil {
+		return nil, err
+	}
+	hook := &robotWebhook{}
+	if hookJSON != "" {
+		err = util.ReadJsonByByte([]byte(hookJSON), hook)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		robotM, err := rb.db.queryRobotWithRobtID(robotID)
+		if err != nil {
+			return nil, err
+		}
+		if robotM != nil {
+			hook.URL = robotM.WebhookURL
+			hook.Token = robotM.Token
+			hook.Status = WebhookStatus(robotM.WebhookStatus)
+			hook.FailCount = robotM.WebhookFailCount
+		}
+		err = rb.ctx.GetRedisConn().SetAndExpire(key, util.ToJson(hook), webhookCacheExpire)
+		if err != nil {
+			rb.Warn("缓存机器人webhook配置失败！", zap.Error(err), zap.String("robotID", robotID))
+		}
+	}
+	if hook.Status != WebhookStatusActive || hook.URL == "" {
+		return nil, nil
+	}
+	return hook, nil
+}
+
+func (rb *Robot) removeWebhookCache(robotID string) {
+	err := rb.ctx.GetRedisConn().Del(rb.webhookCacheKey(robotID))
+	if err != nil {
+		rb.Warn("删除机器人webhook配置缓存失败！", zap.Error(err), zap.String("robotID", robotID))
+	}
+}
+
+// 将事件交给webhook推送，机器人未设置webhook则返回false
+func (rb *Robot) dispatchWebhook(robotID string, event *robotEvent) bool {
+	hook, err := rb.getActiveWebhook(robotID)
+	if err != nil {
+		rb.Error("查询机器人webhook配置失败！", zap.Error(err), zap.String("robotID", robotID))
+		return false
+	}
+	if hook == nil {
+		return false
+	}
+	rb.webhookWorkersLock.Lock()
+	defer rb.webhookWorkersLock.Unlock()
+	worker := rb.webhookWorkers[robotID]
+	if worker == nil {
+		worker = &robotWebhookWorker{
+			robotID: robotID,
+			jobs:    make(chan *robotWebhookJob, webhookQueueSize),
+		}
+		rb.webhookWorkers[robotID] = worker
+		go rb.runWebhookWorker(worker)
+	}
+	select {
+	case worker.jobs <- &robotWebhookJob{hook: hook, event: event}:
+		return true
+	default:
+		rb.Warn("机器人webhook待推送事件过多，回退为轮询！", zap.String("robotID", robotID), zap.Int64("eventID", event.EventID))
+		return false
+	}
+}
+
+func (rb *Robot) runWebhookWorker(worker *robotWebhookWorker) {
+	for {
+		select {
+		case job := <-worker.jobs:
+			rb.deliverWebhookJob(worker.robotID, job)
+		case <-time.After(webhookWorkerIdle):
+			rb.webhookWorkersLock.Lock()
+			if len(worker.jobs) == 0 {
+				delete(rb.webhookWorkers, worker.robotID)
+				rb.webhookWorkersLock.Unlock()
+				return
+			}
+			rb.webhookWorkersLock.Unlock()
+		}
+	}
+}
+
+// 推送单个事件，多次失败后消息事件回退到轮询队列
+func (rb *Robot) deliverWebhookJob(robotID string, job *robotWebhookJob) {
+	err := rb.getWebhookAddrPolicy().checkURL(job.hook.URL)
+	delay := webhookRetryDelay
+	for attempt := 1; err == nil && attempt <= webhookMaxAttempts; attempt++ {
+		err = postRobotWebhook(rb.webhookClient, job.hook.URL, job.hook.Token, job.event)
+		if err == nil || errors.Is(err, errWebhookNotRetryable) {
+			break
+		}
+		if attempt < webhookMaxAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	if err == nil {
+		if job.hook.FailCount > 0 {
+			job.hook.FailCount = 0
+			if err := rb.db.resetWebhookFailCount(robotID); err != nil {
+				rb.Warn("重置机器人webhook失败次数失败！", zap.Error(err), zap.String("robotID", robotID))
+			}
+			rb.removeWebhookCache(robotID)
+		}
+		return
+	}
+	rb.Warn("机器人webhook推送失败，回退到轮询队列！", zap.Error(err), zap.String("robotID", robotID), zap.Int64("eventID", job.event.EventID))
+	if job.event.Message != nil { // 行内搜索事件一直保留在内存中供轮询，无需回退
+		rb.queueRobotEvent(robotID, job.event)
+	}
+	job.hook.FailCount++
+	if err := rb.db.incrWebhookFailCount(robotID, webhookMaxFailCount); err != nil {
+		rb.Warn("更新机器人webhook失败次数失败！", zap.Error(err), zap.String("robotID", robotID))
+	}
+	rb.removeWebhookCache(robotID)
+}
+
+// 推送事件到机器人的webhook地址
+// 签名为 hex(hmac_sha256(token, timestamp + "." + body))
+func postRobotWebhook(client *http.Client, webhookURL string, token string, event *robotEvent) error {
+	resp := &robotEventResp{}
+	resp.from(event)
+	body := []byte(util.ToJson(resp))
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookHeaderEventID, strconv.FormatInt(event.EventID, 10))
+	req.Header.Set(webhookHeaderTimestamp, timestamp)
+	req.Header.Set(webhookHeaderSignature, "sha256="+signRobotWebhook(token, timestamp, body))
+
+	httpResp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(httpResp.Body, 1024*64))
+
+	if httpResp.StatusCode >= 200 && httpResp.StatusCode < 300 {
+		return nil
+	}
+	if httpResp.StatusCode == http.StatusTooManyRequests || httpResp.StatusCode >= 500 {
+		return fmt.Errorf("webhook返回状态码[%d]", httpResp.StatusCode)
+	}
+	return fmt.Errorf("%w[%d]", errWebhookNotRetryable, httpResp.StatusCode)
+}
+
+func signRobotWebhook(token string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newWebhookClient 推送webhook的http客户端
+// 每次建立连接时都会检查实际连接的ip，防止通过DNS重绑定访问内网；不跟随重定向
+func newWebhookClient(policy func() *webhookAddrPolicy) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookRequestTimeout,
+		Control: func(network string, address string, c syscall.RawConn) error {
+			return webhookDialControl(policy(), address)
+		},
+	}
+	return &http.Client{
+		Timeout: webhookRequestTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookRequestTimeout,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     webhookWorkerIdle,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// webhookDialControl 连接前检查解析后的ip
+func webhookDialControl(policy *webhookAddrPolicy, address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !policy.ipAllowed(ip) {
+		return errWebhookAddrNotAllowed
+	}
+	return nil
+}
+
+// checkWebhookHost 解析webhook的域名，解析出的任意一个ip是不信任的内网或本机地址都不允许
+func checkWebhookHost(ctx context.Context, policy *webhookAddrPolicy, host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if !policy.ipAllowed(ip) {
+			return errWebhookAddrNotAllowed
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("域名[%s]没有解析到ip", host)
+	}
+	for _, addr := range addrs {
+		if !policy.ipAllowed(addr.IP) {
+			return errWebhookAddrNotAllowed
+		}
+	}
+	return nil
+}
+
+// isPublicIP 是否是公网ip（排除回环、内网、链路本地、未指定和组播地址）
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	if ip4 := ip.To4(); ip4 != nil && (ip4[0] == 0 || ip4[0] == 100 && ip4[1]&0xc0 == 64) { // 0.0.0.0/8 和运营商级NAT 100.64.0.0/10
+		return false
+	}
+	return true
+}
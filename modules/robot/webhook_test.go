@@ -0,0 +1,106 @@
+package robot
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+)
+
+func TestPostRobotWebhook(t *testing.T) {
+	robotToken := "robot-token"
+	var received *robotEventResp
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get(webhookHeaderTimestamp)
+		if r.Header.Get(webhookHeaderSignature) != "sha256="+signRobotWebhook(robotToken, timestamp, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.Unmarshal(body, &received)
+		assert.Equal(t, strconv.FormatInt(received.EventID, 10), r.Header.Get(webhookHeaderEventID))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	event := &robotEvent{
+		EventID: 10,
+		Message: &config.MessageResp{
+			MessageID: 100,
+			FromUID:   "u1",
+			Payload:   []byte(`{"type":1,"content":"hello"}`),
+		},
+	}
+	err := postRobotWebhook(server.Client(), server.URL, robotToken, event)
+	assert.NoError(t, err)
+	assert.NotNil(t, received)
+	assert.Equal(t, int64(10), received.EventID)
+	assert.Equal(t, int64(100), received.Message.MessageID)
+
+	// 签名不正确
+	err = postRobotWebhook(server.Client(), server.URL, "wrong-token", event)
+	assert.ErrorIs(t, err, errWebhookNotRetryable)
+}
+
+func TestPostRobotWebhookRetryable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	err := postRobotWebhook(server.Client(), server.URL, "token", &robotEvent{EventID: 1})
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, errWebhookNotRetryable)
+}
+
+func TestWebhookAddrCheck(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "0.0.0.0", "100.64.0.1", "::1", "fe80::1", "fd00::1", "::ffff:127.0.0.1"} {
+		assert.False(t, isPublicIP(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"8.8.8.8", "1.1.1.1", "2001:4860:4860::8888"} {
+		assert.True(t, isPublicIP(net.ParseIP(ip)), ip)
+	}
+	strict := &webhookAddrPolicy{}
+	assert.ErrorIs(t, checkWebhookHost(context.Background(), strict, "127.0.0.1"), errWebhookAddrNotAllowed)
+	assert.ErrorIs(t, checkWebhookHost(context.Background(), strict, "localhost"), errWebhookAddrNotAllowed)
+
+	// 连接时检查实际的ip，即使保存时域名解析到的是公网ip也无法连接内网
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	err := postRobotWebhook(newWebhookClient(func() *webhookAddrPolicy { return strict }), server.URL, "robot-token", &robotEvent{EventID: 1})
+	assert.ErrorIs(t, err, errWebhookAddrNotAllowed)
+}
+
+func TestWebhookAddrPolicy(t *testing.T) {
+	strict := &webhookAddrPolicy{}
+	assert.True(t, strict.schemeAllowed("https"))
+	assert.False(t, strict.schemeAllowed("http"))
+	assert.ErrorIs(t, strict.checkURL("http://10.0.0.1/hook"), errWebhookNotRetryable)
+
+	// 信任的内网地址和http需要后台显式开启
+	policy := &webhookAddrPolicy{AllowHTTP: true}
+	_, ipNet, _ := net.ParseCIDR("127.0.0.0/8")
+	policy.AllowNets = []*net.IPNet{ipNet}
+	assert.True(t, policy.schemeAllowed("http"))
+	assert.False(t, policy.schemeAllowed("ftp"))
+	assert.NoError(t, policy.checkURL("http://127.0.0.1:8080/hook"))
+	assert.True(t, policy.ipAllowed(net.ParseIP("127.0.0.1")))
+	assert.False(t, policy.ipAllowed(net.ParseIP("10.0.0.1")))
+	assert.NoError(t, checkWebhookHost(context.Background(), policy, "127.0.0.1"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	err := postRobotWebhook(newWebhookClient(func() *webhookAddrPolicy { return policy }), server.URL, "robot-token", &robotEvent{EventID: 1})
+	assert.NoError(t, err)
+}
@@ -55,6 +55,7 @@ type User struct {
 	friendDB      *friendDB
 	deviceDB      *deviceDB
 	smsServie     commonapi.ISMSService
+	emailService  commonapi.IEmailService
 	fileService   file.IService
 	settingDB     *SettingDB
 	onlineDB      *onlineDB
@@ -67,7 +68,6 @@ type User struct {
 	setting *Setting
 	log.Log
 	ctx                      *config.Context
-	userDeviceTokenPrefix    string
 	loginUUIDPrefix          string
 	openapiAuthcodePrefix    string
 	openapiAccessTokenPrefix string
@@ -79,6 +79,10 @@ type User struct {
 	deviceFlagDB             *deviceFlagDB
 	deviceFlagsCache         []*deviceFlagModel
 	appService               app.IService
+	deviceTokenDB            *deviceTokenDB
+	totpDB                   *totpDB
+	sessionService           *sessionService
+	loginLockService         *loginLockService
 }
 
 //type AppConfig struct {
@@ -96,9 +100,9 @@ func New(ctx *config.Context) *User {
 		deviceDB:                 newDeviceDB(ctx),
 		friendDB:                 newFriendDB(ctx),
 		smsServie:                commonapi.NewSMSService(ctx),
+		emailService:             commonapi.NewEmailService(ctx),
 		settingDB:                NewSettingDB(ctx.DB()),
 		setting:                  NewSetting(ctx),
-		userDeviceTokenPrefix:    common.UserDeviceTokenPrefix,
 		loginUUIDPrefix:          "loginUUID:",
 		openapiAuthcodePrefix:    "openapi:authcodePrefix:",
 		openapiAccessTokenPrefix: "openapi:accessTokenPrefix:",
@@ -116,6 +120,10 @@ func New(ctx *config.Context) *User {
 		githubDB:                 newGithubDB(ctx),
 		commonService:            common2.NewService(ctx),
 		appService:               app.NewService(ctx),
+		deviceTokenDB:            newDeviceTokenDB(ctx),
+		totpDB:                   newTOTPDB(ctx),
+		sessionService:           newSessionService(ctx),
+		loginLockService:         newLoginLockService(ctx),
 	}
 	u.updateSystemUserToken()
 	source.SetUserProvider(u)
@@ -124,7 +132,7 @@ func New(ctx *config.Context) *User {
 
 // Route 路由配置
 func (u *User) Route(r *wkhttp.WKHttp) {
-	auth := r.Group("/v1", u.ctx.AuthMiddleware(r))
+	auth := r.Group("/v1", u.ctx.AuthMiddleware(r), u.sessionService.sessionActiveMiddleware)
 	{
 
 		auth.GET("/users/:uid", u.get) // 根据uid查询用户信息
@@ -133,9 +141,10 @@ func (u *User) Route(r *wkhttp.WKHttp) {
 
 		auth.POST("/users/:uid/avatar", u.uploadAvatar)              //上传用户头像
 		auth.PUT("/users/:uid/setting", u.setting.userSettingUpdate) // 更新用户设置
+		auth.GET("/users/:uid/signal/bundle", u.signalPrekeyBundle)  // 获取用户的prekey bundle
 	}
 
-	user := r.Group("/v1/user", u.ctx.AuthMiddleware(r))
+	user := r.Group("/v1/user", u.ctx.AuthMiddleware(r), u.sessionService.sessionActiveMiddleware)
 	{
 		user.POST("/device_token", u.registerUserDeviceToken)      // 注册用户设备
 		user.DELETE("/device_token", u.unregisterUserDeviceToken)  // 卸载用户设备
@@ -154,8 +163,18 @@ func (u *User) Route(r *wkhttp.WKHttp) {
 		user.GET("/customerservices", u.customerservices)          //客服列表
 		user.DELETE("/destroy/:code", u.destroyAccount)            // 注销用户
 		user.POST("/sms/destroy", u.sendDestroyCode)               //获取注销账号短信验证码
+		user.POST("/email/destroy", u.sendEmailDestroyCode)        // 获取注销账号邮箱验证码
+		user.DELETE("/destroy_email/:code", u.destroyWithEmail)    // 通过邮箱验证码注销用户
+		user.POST("/email/bindcode", u.sendBindEmailCode)          // 获取绑定邮箱验证码
+		user.POST("/email/oldcode", u.sendOldEmailCode)            // 获取更换邮箱的原邮箱验证码
+		user.PUT("/email", u.bindEmail)                            // 绑定或更换邮箱
 		user.PUT("/updatepassword", u.updatePwd)                   // 修改登录密码
 		user.POST("/web3publickey", u.uploadWeb3PublicKey)         // 上传web3公钥
+		user.GET("/totp", u.totpStatus)                            // 两步验证状态
+		user.POST("/totp/setup", u.totpSetup)                      // 生成两步验证密钥
+		user.POST("/totp/enable", u.totpEnable)                    // 确认开启两步验证
+		user.POST("/totp/disable", u.totpDisable)                  // 关闭两步验证
+		user.POST("/totp/recovery_codes", u.totpRecoveryCodes)     // 重新生成恢复码
 		user.POST("/quit", u.quit)                                 // 退出登录
 		// #################### 登录设备管理 ####################
 		user.GET("/devices", u.deviceList)                 // 用户登录设备
@@ -165,10 +184,22 @@ func (u *User) Route(r *wkhttp.WKHttp) {
 		user.POST("/online", u.onlinelistWithUIDs)         // 获取指定的uid在线状态
 		user.POST("/pc/quit", u.pcQuit)                    // 退出pc登录
 
+		// #################### 登录会话管理 ####################
+		user.GET("/sessions", u.sessionList)                  // 我的登录会话
+		user.DELETE("/sessions/:session_id", u.sessionRevoke) // 撤销某个登录会话
+		user.DELETE("/sessions", u.sessionRevokeOthers)       // 撤销其他所有登录会话
+		user.GET("/login_logs", u.loginLogs)                  // 我的登录记录
+
 		// #################### 用户通讯录 ####################
 		user.POST("/maillist", u.addMaillist)
 		user.GET("/maillist", u.getMailList)
 
+		// #################### signal密钥 ####################
+		user.POST("/signal/keys", u.signalKeysUpload)                      // 上传身份公钥、签名prekey和一次性公钥
+		user.GET("/signal/keys", u.signalKeysStatus)                       // 我的密钥状态
+		user.PUT("/signal/signed_prekey", u.signalSignedPrekeyUpdate)      // 轮换签名prekey
+		user.POST("/signal/onetime_prekeys", u.signalOnetimePrekeysUpload) // 补充一次性公钥
+
 		// #################### 用户红点 ####################
 		user.GET("/reddot/:category", u.getRedDot)      // 获取用户红点
 		user.DELETE("/reddot/:category", u.clearRedDot) // 清除红点
@@ -196,6 +227,13 @@ func (u *User) Route(r *wkhttp.WKHttp) {
 		v.POST("/user/login_authcode/:auth_code", u.loginWithAuthCode)   // 通过认证码登录
 		v.POST("/user/sms/login_check_phone", u.sendLoginCheckPhoneCode) //发送登录设备验证验证码
 		v.POST("/user/login/check_phone", u.loginCheckPhone)             //登录验证设备手机号
+		v.POST("/user/login/totp", u.loginTOTP)                          // 登录两步验证
+		v.POST("/user/email/registercode", u.sendEmailRegisterCode)      // 获取邮箱注册验证码
+		v.POST("/user/emailregister", u.emailRegister)                   // 邮箱注册
+		v.POST("/user/email/forgetpwd", u.sendEmailForgetPwdCode)        // 获取忘记密码邮箱验证码
+		v.POST("/user/pwdforget_email", u.pwdforgetWithEmail)            // 通过邮箱重置登录密码
+		v.POST("/user/email/login_check", u.sendLoginCheckEmailCode)     // 发送登录设备验证邮箱验证码
+		v.POST("/user/login/check_email", u.loginCheckEmail)             // 登录验证设备邮箱
 
 		// #################### 第三方授权 ####################
 		v.GET("/user/thirdlogin/authcode", u.thirdAuthcode)     // 第三方授权码获取
@@ -232,12 +270,27 @@ func (u *User) quit(c *wkhttp.Context) {
 		return
 	}
 
-	err = u.ctx.GetRedisConn().Del(fmt.Sprintf("%s%s", u.userDeviceTokenPrefix, loginUID))
+	err = u.deviceTokenDB.deleteWithUID(loginUID)
 	if err != nil {
 		u.Error("删除设备token失败！", zap.Error(err))
 		c.ResponseError(errors.New("删除设备token失败！"))
 		return
 	}
+	// web和pc的token失效，当前token失效并删除会话
+	for _, flag := range []config.DeviceFlag{config.Web, config.PC} {
+		err = u.sessionService.revokeWithDeviceFlag(loginUID, flag)
+		if err != nil {
+			u.Error("撤销登录会话失败！", zap.Error(err))
+			c.ResponseError(errors.New("撤销登录会话失败！"))
+			return
+		}
+	}
+	err = u.sessionService.logout(loginUID, c.GetHeader("token"))
+	if err != nil {
+		u.Error("退出登录会话失败！", zap.Error(err))
+		c.ResponseError(errors.New("退出登录会话失败！"))
+		return
+	}
 	c.ResponseOK()
 }
 
@@ -754,6 +807,22 @@ func (u *User) userUpdateSetting(c *wkhttp.Context) {
 		return
 	}
 
+	for key, value := range reqMap {
+		if key == "dnd_on" ||
+			key == "dnd_start" ||
+			key == "dnd_end" ||
+			key == "dnd_timezone" ||
+			key == "dnd_weekdays" ||
+			key == "dnd_allow_call" ||
+			key == "dnd_allow_mention" {
+			if err = checkDNDSetting(key, fmt.Sprintf("%v", value)); err != nil {
+				c.ResponseError(err)
+				return
+			}
+		}
+	}
+
+	updated := false
 	for key, value := range reqMap {
 		if key == "device_lock" ||
 			key == "search_by_phone" ||
@@ -763,18 +832,52 @@ func (u *User) userUpdateSetting(c *wkhttp.Context) {
 			key == "offline_protection" ||
 			key == "voice_on" ||
 			key == "shock_on" ||
-			key == "mute_of_app" {
+			key == "mute_of_app" ||
+			key == "dnd_on" ||
+			key == "dnd_start" ||
+			key == "dnd_end" ||
+			key == "dnd_timezone" ||
+			key == "dnd_weekdays" ||
+			key == "dnd_allow_call" ||
+			key == "dnd_allow_mention" {
 			err = u.db.UpdateUsersWithField(key, fmt.Sprintf("%v", value), loginUID)
 			if err != nil {
 				u.Error("修改用户资料失败", zap.Error(err))
 				c.ResponseError(errors.New("修改用户资料失败"))
 				return
 			}
+			updated = true
 		}
 	}
+	if updated {
+		u.sendUserSettingUpdate(loginUID)
+	}
 	c.ResponseOK()
 }
 
+// sendUserSettingUpdate 通知用户的其他设备同步我的设置
+func (u *User) sendUserSettingUpdate(uid string) {
+	userModel, err := u.db.QueryByUID(uid)
+	if err != nil {
+		u.Warn("查询用户信息失败！", zap.Error(err))
+		return
+	}
+	if userModel == nil {
+		return
+	}
+	err = u.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		CMD:         CMDUserSettingUpdate,
+		Subscribers: []string{uid},
+		Param: map[string]interface{}{
+			"setting": newSetting(userModel),
+		},
+	})
+	if err != nil {
+		u.Warn("发送用户设置更新命令失败！", zap.Error(err))
+	}
+}
+
 // 获取用户详情
 func (u *User) get(c *wkhttp.Context) {
 	uid := c.Param("uid")
@@ -963,6 +1066,9 @@ func (u *User) wxLogin(c *wkhttp.Context) {
 			c.ResponseError(errors.New("用户不存在"))
 			return
 		}
+		if u.responseTOTPChallengeIfNeed(c, userInfo, config.DeviceFlag(req.Flag), req.Device, totpLoginKindApp) {
+			return
+		}
 		u.execLoginAndRespose(userInfo, config.DeviceFlag(req.Flag), req.Device, loginSpanCtx, c)
 	} else {
 		// 创建用户
@@ -1029,17 +1135,30 @@ func (u *User) login(c *wkhttp.Context) {
 		c.ResponseError(err)
 		return
 	}
+	publicIP := utils.GetClientPublicIP(c.Request)
 	if userInfo == nil || userInfo.IsDestroy == 1 {
-		c.ResponseError(errors.New("用户不存在"))
+		if attempt, ok := u.reserveLoginAttempt(c, "", publicIP); ok {
+			u.responseLoginFail(c, attempt, errors.New("用户不存在"))
+		}
 		return
 	}
 	if userInfo.Password == "" {
 		c.ResponseError(errors.New("此账号不允许登录"))
 		return
 	}
-	// todo 修改密码
-	if util.MD5(util.MD5(req.Password)) != userInfo.Password {
-		c.ResponseError(errors.New("密码不正确！"))
+	attempt, ok := u.reserveLoginAttempt(c, userInfo.UID, publicIP)
+	if !ok {
+		return
+	}
+	if !verifyPassword(u.db, userInfo.UID, userInfo.Password, req.Password) {
+		u.responseLoginFail(c, attempt, errors.New("密码不正确！"))
+		return
+	}
+	u.loginLockSuccess(attempt)
+	if u.responseLoginRiskIfNeed(c, userInfo, config.DeviceFlag(req.Flag), req.Device) {
+		return
+	}
+	if u.responseTOTPChallengeIfNeed(c, userInfo, config.DeviceFlag(req.Flag), req.Device, totpLoginKindApp) {
 		return
 	}
 	u.execLoginAndRespose(userInfo, config.DeviceFlag(req.Flag), req.Device, loginSpanCtx, c)
@@ -1048,19 +1167,10 @@ func (u *User) login(c *wkhttp.Context) {
 // 验证登录用户信息
 func (u *User) execLoginAndRespose(userInfo *Model, flag config.DeviceFlag, device *deviceReq, loginSpanCtx context.Context, c *wkhttp.Context) {
 
-	result, err := u.execLogin(userInfo, flag, device, loginSpanCtx)
+	result, err := u.execLogin(userInfo, flag, device, newSessionClient(c), loginSpanCtx)
 	if err != nil {
 		if errors.Is(err, ErrUserNeedVerification) {
-			phone := ""
-			if len(userInfo.Phone) > 5 {
-				phone = fmt.Sprintf("%s******%s", userInfo.Phone[0:3], userInfo.Phone[len(userInfo.Phone)-2:])
-			}
-			c.ResponseWithStatus(http.StatusBadRequest, map[string]interface{}{
-				"status": 110,
-				"msg":    "需要验证手机号码！",
-				"uid":    userInfo.UID,
-				"phone":  phone,
-			})
+			responseLoginNeedVerification(c, userInfo)
 			return
 		}
 		c.ResponseError(err)
@@ -1073,7 +1183,22 @@ func (u *User) execLoginAndRespose(userInfo *Model, flag config.DeviceFlag, devi
 	go u.sentWelcomeMsg(publicIP, userInfo.UID)
 }
 
-func (u *User) execLogin(userInfo *Model, flag config.DeviceFlag, device *deviceReq, loginSpanCtx context.Context) (*loginUserDetailResp, error) {
+// responseLoginNeedVerification 需要验证手机号或邮箱才能登录（登录设备验证流程）
+func responseLoginNeedVerification(c *wkhttp.Context, userInfo *Model) {
+	phone := ""
+	if len(userInfo.Phone) > 5 {
+		phone = fmt.Sprintf("%s******%s", userInfo.Phone[0:3], userInfo.Phone[len(userInfo.Phone)-2:])
+	}
+	c.ResponseWithStatus(http.StatusBadRequest, map[string]interface{}{
+		"status": 110,
+		"msg":    "需要验证手机号码！",
+		"uid":    userInfo.UID,
+		"phone":  phone,
+		"email":  maskEmail(userInfo.Email), // 绑定了邮箱的用户也可以通过邮箱验证
+	})
+}
+
+func (u *User) execLogin(userInfo *Model, flag config.DeviceFlag, device *deviceReq, client *sessionClient, loginSpanCtx context.Context) (*loginUserDetailResp, error) {
 	if userInfo.Status == int(common.UserDisable) {
 		return nil, errors.New("该用户已被禁用")
 	}
@@ -1144,6 +1269,10 @@ func (u *User) execLogin(userInfo *Model, flag config.DeviceFlag, device *device
 				tokenSpan.Finish()
 				return nil, errors.New("清除旧token数据错误")
 			}
+			err = u.sessionService.removeWithToken(userInfo.UID, oldToken)
+			if err != nil {
+				u.Warn("删除旧token的会话失败", zap.Error(err))
+			}
 		}
 	} else { // PC暂时不执行删除操作，因为PC可以同时登陆
 		if strings.TrimSpace(oldToken) != "" { // 如果是web或pc类设备 因为支持多登所以这里依然使用老token
@@ -1163,6 +1292,12 @@ func (u *User) execLogin(userInfo *Model, flag config.DeviceFlag, device *device
 		tokenSpan.Finish()
 		return nil, errors.New("设置uidtoken缓存失败！")
 	}
+	err = u.sessionService.add(userInfo.UID, token, flag, device, client)
+	if err != nil {
+		u.Error("记录登录会话失败！", zap.Error(err))
+		tokenSpan.Finish()
+		return nil, errors.New("记录登录会话失败！")
+	}
 	tokenSpan.Finish()
 
 	updateTokenSpan, _ := u.ctx.Tracer().StartSpanFromContext(loginSpanCtx, "UpdateIMToken")
@@ -1191,16 +1326,19 @@ func (u *User) execLogin(userInfo *Model, flag config.DeviceFlag, device *device
 
 // sendWelcomeMsg 发送欢迎语
 func (u *User) sentWelcomeMsg(publicIP, uid string) {
+	lastLoginLog := u.loginLog.getLastLoginIP(uid)
+	//保存登录日志
+	u.loginLog.add(uid, publicIP)
+
 	appconfig, err := u.commonService.GetAppConfig()
 	if err != nil {
 		u.Error("获取应用配置错误", zap.Error(err))
 	}
-	if appconfig.SendWelcomeMessageOn == 0 {
+	if appconfig == nil || appconfig.SendWelcomeMessageOn == 0 {
 		return
 	}
 	time.Sleep(time.Second * 2)
 	//发送登录欢迎消息
-	lastLoginLog := u.loginLog.getLastLoginIP(uid)
 	content := u.ctx.GetConfig().WelcomeMessage
 	var sentContent string
 
@@ -1229,8 +1367,6 @@ func (u *User) sentWelcomeMsg(publicIP, uid string) {
 	if err != nil {
 		u.Error("发送登录消息欢迎消息失败", zap.Error(err))
 	}
-	//保存登录日志
-	u.loginLog.add(uid, publicIP)
 }
 
 // 注册
@@ -1249,38 +1385,11 @@ func (u *User) register(c *wkhttp.Context) {
 		c.ResponseError(errors.New("注册通道暂不开放"))
 		return
 	}
-	appConfig, err := u.commonService.GetAppConfig()
+	invite, err := u.checkRegisterInvite(req.InviteCode)
 	if err != nil {
-		u.Error("查询应用设置错误", zap.Error(err))
 		c.ResponseError(err)
 		return
 	}
-	var registerInviteOn = 0
-	if appConfig != nil {
-		registerInviteOn = appConfig.RegisterInviteOn
-	}
-	var invite *model.Invite
-	if registerInviteOn == 1 {
-		if req.InviteCode == "" {
-			c.ResponseError(errors.New("邀请码不能为空"))
-			return
-		}
-		var inviteCodeIsExist = false
-		modules := register.GetModules(u.ctx)
-		for _, m := range modules {
-			if m.BussDataSource.GetInviteCode != nil {
-				invite, _ = m.BussDataSource.GetInviteCode(req.InviteCode)
-				if invite != nil && invite.Uid != "" {
-					inviteCodeIsExist = true
-					break
-				}
-			}
-		}
-		if !inviteCodeIsExist {
-			c.ResponseError(errors.New("邀请码不存在"))
-			return
-		}
-	}
 	registerSpan := u.ctx.Tracer().StartSpan(
 		"user.register",
 		opentracing.ChildOf(c.GetSpanContext()),
@@ -1328,6 +1437,40 @@ func (u *User) register(c *wkhttp.Context) {
 	u.createUser(registerSpanCtx, model, c, invite)
 }
 
+// 开启注册邀请机制时校验邀请码
+func (u *User) checkRegisterInvite(inviteCode string) (*model.Invite, error) {
+	appConfig, err := u.commonService.GetAppConfig()
+	if err != nil {
+		u.Error("查询应用设置错误", zap.Error(err))
+		return nil, err
+	}
+	var registerInviteOn = 0
+	if appConfig != nil {
+		registerInviteOn = appConfig.RegisterInviteOn
+	}
+	var invite *model.Invite
+	if registerInviteOn == 1 {
+		if inviteCode == "" {
+			return nil, errors.New("邀请码不能为空")
+		}
+		var inviteCodeIsExist = false
+		modules := register.GetModules(u.ctx)
+		for _, m := range modules {
+			if m.BussDataSource.GetInviteCode != nil {
+				invite, _ = m.BussDataSource.GetInviteCode(inviteCode)
+				if invite != nil && invite.Uid != "" {
+					inviteCodeIsExist = true
+					break
+				}
+			}
+		}
+		if !inviteCodeIsExist {
+			return nil, errors.New("邀请码不存在")
+		}
+	}
+	return invite, nil
+}
+
 // 搜索用户
 func (u *User) search(c *wkhttp.Context) {
 	keyword := c.Query("keyword")
@@ -1377,6 +1520,7 @@ func (u *User) registerUserDeviceToken(c *wkhttp.Context) {
 		DeviceToken string `json:"device_token"` // 设备token
 		DeviceType  string `json:"device_type"`  // 设备类型 IOS，MI，HMS
 		BundleID    string `json:"bundle_id"`    // app的唯一ID标示
+		DeviceID    string `json:"device_id"`    // 设备唯一ID（一个用户可同时注册多个设备）
 	}
 	if err := c.BindJSON(&req); err != nil {
 		u.Error("数据格式有误！", zap.Error(err))
@@ -1395,7 +1539,13 @@ func (u *User) registerUserDeviceToken(c *wkhttp.Context) {
 		c.ResponseError(errors.New("bundleID不能为空！"))
 		return
 	}
-	err := u.ctx.GetRedisConn().Hmset(fmt.Sprintf("%s%s", u.userDeviceTokenPrefix, loginUID), "device_type", req.DeviceType, "device_token", req.DeviceToken, "bundle_id", req.BundleID)
+	err := u.deviceTokenDB.save(loginUID, &DeviceTokenModel{
+		DeviceID:    strings.TrimSpace(req.DeviceID),
+		DeviceType:  req.DeviceType,
+		DeviceToken: req.DeviceToken,
+		BundleID:    req.BundleID,
+		UpdatedAt:   time.Now().Unix(),
+	})
 	if err != nil {
 		u.Error("存储用户设备token失败！", zap.Error(err))
 		c.ResponseError(errors.New("存储用户设备token失败！"))
@@ -1432,11 +1582,17 @@ func (u *User) setUserBadge(uid string, badge int64) error {
 	return nil
 }
 
-// 卸载注册设备token
+// 卸载注册设备token（指定device_id则只卸载该设备，否则卸载所有设备）
 func (u *User) unregisterUserDeviceToken(c *wkhttp.Context) {
 	loginUID := c.MustGet("uid").(string)
+	deviceID := strings.TrimSpace(c.Query("device_id"))
 
-	err := u.ctx.GetRedisConn().Del(fmt.Sprintf("%s%s", u.userDeviceTokenPrefix, loginUID))
+	var err error
+	if deviceID != "" {
+		err = u.deviceTokenDB.delete(loginUID, deviceID)
+	} else {
+		err = u.deviceTokenDB.deleteWithUID(loginUID)
+	}
 	if err != nil {
 		u.Error("删除设备token失败！", zap.Error(err))
 		c.ResponseError(errors.New("删除设备token失败！"))
@@ -1599,6 +1755,7 @@ func (u *User) loginWithAuthCode(c *wkhttp.Context) {
 		return
 	}
 	// 获取缓存设备
+	var loginDevice *deviceReq
 	uuid := authInfoMap["uuid"].(string)
 	if uuid != "" {
 		deviceCache, err := u.ctx.GetRedisConn().GetString(fmt.Sprintf("%s%s", common.DeviceCacheUUIDPrefix, uuid))
@@ -1638,6 +1795,11 @@ func (u *User) loginWithAuthCode(c *wkhttp.Context) {
 					c.ResponseError(errors.New("更新用户登录设备失败"))
 					return
 				}
+				loginDevice = &deviceReq{
+					DeviceID:    deviceId,
+					DeviceName:  deviceName,
+					DeviceModel: dmodel,
+				}
 			}
 		}
 	}
@@ -1677,6 +1839,12 @@ func (u *User) loginWithAuthCode(c *wkhttp.Context) {
 		c.ResponseError(errors.New("设置uidtoken缓存失败！"))
 		return
 	}
+	err = u.sessionService.add(userModel.UID, token, flag, loginDevice, newSessionClient(c))
+	if err != nil {
+		u.Error("记录登录会话失败！", zap.Error(err))
+		c.ResponseError(errors.New("记录登录会话失败！"))
+		return
+	}
 
 	c.Response(map[string]interface{}{
 		"app_id":     userModel.AppID,
@@ -2022,9 +2190,13 @@ func (u *User) sendRegisterCode(c *wkhttp.Context) {
 		})
 		return
 	}
-	err = u.smsServie.SendVerifyCode(spanCtx, req.Zone, req.Phone, commonapi.CodeTypeRegister)
+	err = u.smsServie.SendVerifyCode(spanCtx, req.Zone, req.Phone, commonapi.CodeTypeRegister, utils.GetClientPublicIP(c.Request))
 	if err != nil {
 		u.Error("发送短信验证码失败", zap.Error(err))
+		if errors.Is(err, commonapi.ErrSMSLimit) {
+			c.ResponseError(err)
+			return
+		}
 		c.ResponseError(errors.New("发送短信验证码失败！"))
 		return
 	}
@@ -2055,7 +2227,7 @@ func (u *User) setChatPwd(c *wkhttp.Context) {
 		c.ResponseError(errors.New("查询用户信息失败"))
 		return
 	}
-	if user.Password != util.MD5(util.MD5(req.LoginPwd)) {
+	if !verifyPassword(u.db, user.UID, user.Password, req.LoginPwd) {
 		c.ResponseError(errors.New("登录密码错误"))
 		return
 	}
@@ -2170,10 +2342,14 @@ func (u *User) sendLoginCheckPhoneCode(c *wkhttp.Context) {
 	// 	c.ResponseOK()
 	// 	return
 	// }
-	err = u.smsServie.SendVerifyCode(spanCtx, userinfo.Zone, userinfo.Phone, commonapi.CodeTypeCheckMobile)
+	err = u.smsServie.SendVerifyCode(spanCtx, userinfo.Zone, userinfo.Phone, commonapi.CodeTypeCheckMobile, utils.GetClientPublicIP(c.Request))
 	if err != nil {
 		u.Error("发送短信失败", zap.Error(err))
 		ext.LogError(span, err)
+		if errors.Is(err, commonapi.ErrSMSLimit) {
+			c.ResponseError(err)
+			return
+		}
 		c.ResponseError(errors.New("发送短信失败"))
 		return
 	}
@@ -2223,8 +2399,12 @@ func (u *User) loginCheckPhone(c *wkhttp.Context) {
 		c.ResponseError(err)
 		return
 	}
+	u.execLoginDeviceCheckAndRespose(userInfo, spanCtx, c)
+}
 
-	loginDeviceJsonStr, err := u.ctx.GetRedisConn().GetString(fmt.Sprintf("%s%s", u.ctx.GetConfig().Cache.LoginDeviceCachePrefix, req.UID))
+// 登录设备验证通过后记录设备并登录
+func (u *User) execLoginDeviceCheckAndRespose(userInfo *Model, spanCtx context.Context, c *wkhttp.Context) {
+	loginDeviceJsonStr, err := u.ctx.GetRedisConn().GetString(fmt.Sprintf("%s%s", u.ctx.GetConfig().Cache.LoginDeviceCachePrefix, userInfo.UID))
 	if err != nil {
 		u.Error("获取登录设备缓存失败！", zap.Error(err))
 		c.ResponseError(errors.New("获取登录设备缓存失败！"))
@@ -2237,11 +2417,47 @@ func (u *User) loginCheckPhone(c *wkhttp.Context) {
 	var loginDeivce *deviceReq
 	err = util.ReadJsonByByte([]byte(loginDeviceJsonStr), &loginDeivce)
 	if err != nil {
-		u.Error("解码登录设备信息失败！", zap.Error(err), zap.String("uid", req.UID))
+		u.Error("解码登录设备信息失败！", zap.Error(err), zap.String("uid", userInfo.UID))
 		c.ResponseError(errors.New("解码登录设备信息失败！"))
 		return
 	}
-	err = u.deviceDB.insertOrUpdateDeviceCtx(spanCtx, &deviceModel{
+	// 异常登录需要两步验证时，设备验证通过后返回两步验证挑战，通过后才登录
+	totpKey := loginRiskTOTPCachePrefix + userInfo.UID
+	needTOTP, err := u.ctx.GetRedisConn().GetString(totpKey)
+	if err != nil {
+		u.Error("获取异常登录两步验证标记失败！", zap.Error(err))
+		c.ResponseError(errors.New("登录错误！"))
+		return
+	}
+	if needTOTP != "" {
+		// 设备验证只能使用一次，避免重复验证绕过两步验证
+		err = u.ctx.GetRedisConn().Del(fmt.Sprintf("%s%s", u.ctx.GetConfig().Cache.LoginDeviceCachePrefix, userInfo.UID))
+		if err != nil {
+			u.Error("删除登录设备缓存失败！", zap.Error(err))
+			c.ResponseError(errors.New("登录错误！"))
+			return
+		}
+		u.ctx.GetRedisConn().Del(totpKey)
+		token, err := createTOTPLogin(u.ctx, &totpLogin{
+			UID:    userInfo.UID,
+			Kind:   totpLoginKindDevice,
+			Flag:   int(config.APP),
+			Device: loginDeivce,
+		})
+		if err != nil {
+			u.Error("创建登录两步验证失败！", zap.Error(err))
+			c.ResponseError(errors.New("创建登录两步验证失败！"))
+			return
+		}
+		responseTOTPChallenge(c, userInfo.UID, token)
+		return
+	}
+	u.execLoginWithDeviceAndRespose(userInfo, loginDeivce, spanCtx, c)
+}
+
+// 记录已验证的登录设备并登录
+func (u *User) execLoginWithDeviceAndRespose(userInfo *Model, loginDeivce *deviceReq, spanCtx context.Context, c *wkhttp.Context) {
+	err := u.deviceDB.insertOrUpdateDeviceCtx(spanCtx, &deviceModel{
 		UID:         userInfo.UID,
 		DeviceID:    loginDeivce.DeviceID,
 		DeviceName:  loginDeivce.DeviceName,
@@ -2277,6 +2493,13 @@ func (u *User) loginCheckPhone(c *wkhttp.Context) {
 		c.ResponseError(errors.New("此账号已经被封禁！"))
 		return
 	}
+	err = u.sessionService.add(userInfo.UID, token, config.APP, loginDeivce, newSessionClient(c))
+	if err != nil {
+		u.Error("记录登录会话失败！", zap.Error(err))
+		c.ResponseError(errors.New("记录登录会话失败！"))
+		return
+	}
+	u.loginLog.add(userInfo.UID, utils.GetClientPublicIP(c.Request))
 	c.Response(newLoginUserDetailResp(userInfo, token, u.ctx))
 }
 
@@ -2313,7 +2536,7 @@ func (u *User) sendDestroyCode(c *wkhttp.Context) {
 		c.ResponseError(errors.New("登录用户不存在"))
 		return
 	}
-	err = u.smsServie.SendVerifyCode(c.Context, userInfo.Zone, userInfo.Phone, commonapi.CodeTypeDestroyAccount)
+	err = u.smsServie.SendVerifyCode(c.Context, userInfo.Zone, userInfo.Phone, commonapi.CodeTypeDestroyAccount, utils.GetClientPublicIP(c.Request))
 	if err != nil {
 		c.ResponseError(err)
 		return
@@ -2354,12 +2577,17 @@ func (u *User) destroyAccount(c *wkhttp.Context) {
 			return
 		}
 	}
+	u.execDestroyAccountAndRespose(userInfo, c)
+}
 
+// 验证通过后注销账号
+func (u *User) execDestroyAccountAndRespose(userInfo *Model, c *wkhttp.Context) {
+	loginUID := userInfo.UID
 	t := time.Now()
 	time := fmt.Sprintf("%d%d%d%d%d", t.Year(), t.Month(), t.Day(), t.Minute(), t.Second())
 	phone := fmt.Sprintf("%s@%s@delete", userInfo.Phone, time)
 	username := fmt.Sprintf("%s%s", userInfo.Zone, phone)
-	err = u.db.destroyAccount(loginUID, username, phone)
+	err := u.db.destroyAccount(loginUID, username, phone)
 	if err != nil {
 		u.Error("注销账号错误", zap.Error(err))
 		c.ResponseError(errors.New("注销账号错误"))
@@ -2513,7 +2741,13 @@ func (u *User) pwdforget(c *wkhttp.Context) {
 		}
 	}
 
-	err = u.db.UpdateUsersWithField("password", util.MD5(util.MD5(req.Pwd)), userInfo.UID)
+	pwd, err := hashPassword(req.Pwd)
+	if err != nil {
+		u.Error("计算密码哈希失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改登录密码错误"))
+		return
+	}
+	err = u.db.UpdateUsersWithField("password", pwd, userInfo.UID)
 	if err != nil {
 		u.Error("修改登录密码错误", zap.Error(err))
 		c.ResponseError(errors.New("修改登录密码错误"))
@@ -2555,9 +2789,13 @@ func (u *User) getForgetPwdSMS(c *wkhttp.Context) {
 		c.ResponseError(errors.New("该手机号未注册"))
 		return
 	}
-	err = u.smsServie.SendVerifyCode(spanCtx, req.Zone, req.Phone, commonapi.CodeTypeForgetLoginPWD)
+	err = u.smsServie.SendVerifyCode(spanCtx, req.Zone, req.Phone, commonapi.CodeTypeForgetLoginPWD, utils.GetClientPublicIP(c.Request))
 	if err != nil {
 		u.Error("发送短信验证码失败", zap.Error(err))
+		if errors.Is(err, commonapi.ErrSMSLimit) {
+			c.ResponseError(err)
+			return
+		}
 		c.ResponseError(errors.New("发送短信验证码失败！"))
 		return
 	}
@@ -2588,8 +2826,7 @@ func (u *User) createUser(registerSpanCtx context.Context, createUser *createUse
 			panic(err)
 		}
 	}()
-	publicIP := util.GetClientPublicIP(c.Request)
-	resp, err := u.createUserWithRespAndTx(registerSpanCtx, createUser, publicIP, invite, tx, func() error {
+	resp, err := u.createUserWithRespAndTx(registerSpanCtx, createUser, newSessionClient(c), invite, tx, func() error {
 		err := tx.Commit()
 		if err != nil {
 			tx.Rollback()
@@ -2608,8 +2845,7 @@ func (u *User) createUser(registerSpanCtx context.Context, createUser *createUse
 }
 
 func (u *User) createUserTx(registerSpanCtx context.Context, createUser *createUserModel, c *wkhttp.Context, commitCallback func() error, invite *model.Invite, tx *dbr.Tx) {
-	publicIP := util.GetClientPublicIP(c.Request)
-	resp, err := u.createUserWithRespAndTx(registerSpanCtx, createUser, publicIP, invite, tx, commitCallback)
+	resp, err := u.createUserWithRespAndTx(registerSpanCtx, createUser, newSessionClient(c), invite, tx, commitCallback)
 	if err != nil {
 		c.ResponseError(errors.New("注册失败！"))
 		return
@@ -2617,7 +2853,7 @@ func (u *User) createUserTx(registerSpanCtx context.Context, createUser *createU
 	c.Response(resp)
 }
 
-func (u *User) createUserWithRespAndTx(registerSpanCtx context.Context, createUser *createUserModel, publicIP string, invite *model.Invite, tx *dbr.Tx, commitCallback func() error) (*loginUserDetailResp, error) {
+func (u *User) createUserWithRespAndTx(registerSpanCtx context.Context, createUser *createUserModel, client *sessionClient, invite *model.Invite, tx *dbr.Tx, commitCallback func() error) (*loginUserDetailResp, error) {
 	var (
 		shortNo = ""
 		err     error
@@ -2654,11 +2890,16 @@ func (u *User) createUserWithRespAndTx(registerSpanCtx context.Context, createUs
 	userModel.QRVercode = fmt.Sprintf("%s@%d", util.GenerUUID(), common.QRCode)
 	userModel.Phone = createUser.Phone
 	userModel.Zone = createUser.Zone
+	userModel.Email = createUser.Email
 	if createUser.Phone != "" {
 		userModel.Username = fmt.Sprintf("%s%s", createUser.Zone, createUser.Phone)
 	}
 	if createUser.Password != "" {
-		userModel.Password = util.MD5(util.MD5(createUser.Password))
+		userModel.Password, err = hashPassword(createUser.Password)
+		if err != nil {
+			u.Error("计算密码哈希失败！", zap.Error(err))
+			return nil, err
+		}
 	}
 	if createUser.Username != "" {
 		userModel.Username = createUser.Username
@@ -2751,7 +2992,12 @@ func (u *User) createUserWithRespAndTx(registerSpanCtx context.Context, createUs
 		u.Error("更新IM的token失败！", zap.Error(err))
 		return nil, err
 	}
-	go u.sentWelcomeMsg(publicIP, createUser.UID)
+	err = u.sessionService.add(createUser.UID, token, config.DeviceFlag(createUser.Flag), createUser.Device, client)
+	if err != nil {
+		u.Error("记录登录会话失败！", zap.Error(err))
+		return nil, err
+	}
+	go u.sentWelcomeMsg(client.IP, createUser.UID)
 
 	if u.ctx.GetConfig().ShortNo.NumOn {
 		err = u.commonService.SetShortnoUsed(userModel.ShortNo, "user")
@@ -2776,6 +3022,7 @@ type createUserModel struct {
 	GiteeUID       string
 	GithubUID      string
 	Username       string
+	Email          string
 	Flag           int
 	IsUploadAvatar int
 	Device         *deviceReq
@@ -2900,6 +3147,22 @@ type setting struct {
 	OfflineProtection int `json:"offline_protection"` //离线保护，断网屏保
 	DeviceLock        int `json:"device_lock"`        // 设备锁
 	MuteOfApp         int `json:"mute_of_app"`        // web登录 app是否静音
+	DoNotDisturb
+}
+
+func newSetting(m *Model) setting {
+	return setting{
+		SearchByPhone:     m.SearchByPhone,
+		SearchByShort:     m.SearchByShort,
+		NewMsgNotice:      m.NewMsgNotice,
+		MsgShowDetail:     m.MsgShowDetail,
+		VoiceOn:           m.VoiceOn,
+		ShockOn:           m.ShockOn,
+		OfflineProtection: m.OfflineProtection,
+		DeviceLock:        m.DeviceLock,
+		MuteOfApp:         m.MuteOfApp,
+		DoNotDisturb:      newDoNotDisturb(m),
+	}
 }
 
 type blacklistResp struct {
@@ -2927,16 +3190,6 @@ func newLoginUserDetailResp(m *Model, token string, ctx *config.Context) *loginU
 		ShortStatus:     m.ShortStatus,
 		RSAPublicKey:    base64.StdEncoding.EncodeToString([]byte(ctx.GetConfig().AppRSAPubKey)),
 		MsgExpireSecond: m.MsgExpireSecond,
-		Setting: setting{
-			SearchByPhone:     m.SearchByPhone,
-			SearchByShort:     m.SearchByShort,
-			NewMsgNotice:      m.NewMsgNotice,
-			MsgShowDetail:     m.MsgShowDetail,
-			VoiceOn:           m.VoiceOn,
-			ShockOn:           m.ShockOn,
-			OfflineProtection: m.OfflineProtection,
-			DeviceLock:        m.DeviceLock,
-			MuteOfApp:         m.MuteOfApp,
-		},
+		Setting:         newSetting(m),
 	}
 }
@@ -41,6 +41,18 @@ func (u *User) deviceDelete(c *wkhttp.Context) {
 		c.ResponseError(errors.New("删除设备失败！"))
 		return
 	}
+	// 被删除的设备上的登录会话立即失效
+	err = u.sessionService.revokeWithDeviceID(c.GetLoginUID(), deviceID)
+	if err != nil {
+		u.Error("撤销设备的登录会话失败！", zap.Error(err))
+		c.ResponseError(errors.New("撤销设备的登录会话失败！"))
+		return
+	}
+	// 被删除的设备不再接收离线推送
+	err = u.deviceTokenDB.delete(c.GetLoginUID(), deviceID)
+	if err != nil {
+		u.Warn("删除设备推送token失败！", zap.Error(err), zap.String("deviceID", deviceID))
+	}
 	c.ResponseOK()
 }
 
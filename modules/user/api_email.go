@@ -0,0 +1,574 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	commonapi "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/common"
+	utils "github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/util"
+	"github.com/go-sql-driver/mysql"
+	"github.com/opentracing/opentracing-go"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// 获取邮箱注册验证码
+func (u *User) sendEmailRegisterCode(c *wkhttp.Context) {
+	var req emailReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	email, err := commonapi.NormalizeEmail(req.Email)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if u.ctx.GetConfig().Register.Off {
+		c.ResponseError(errors.New("注册通道暂不开放"))
+		return
+	}
+	userInfo, err := u.db.QueryByEmail(email)
+	if err != nil {
+		u.Error("查询用户信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息失败！"))
+		return
+	}
+	if userInfo != nil {
+		c.Response(map[string]interface{}{
+			"exist": 1,
+		})
+		return
+	}
+	if !u.sendEmailCode(c, email, commonapi.CodeTypeRegister) {
+		return
+	}
+	c.Response(map[string]interface{}{
+		"exist": 0,
+	})
+}
+
+// 邮箱注册
+func (u *User) emailRegister(c *wkhttp.Context) {
+	var req emailRegisterReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	email, err := commonapi.NormalizeEmail(req.Email)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if u.ctx.GetConfig().Register.Off {
+		c.ResponseError(errors.New("注册通道暂不开放"))
+		return
+	}
+	invite, err := u.checkRegisterInvite(req.InviteCode)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	registerSpan := u.ctx.Tracer().StartSpan(
+		"user.emailRegister",
+		opentracing.ChildOf(c.GetSpanContext()),
+	)
+	defer registerSpan.Finish()
+	registerSpanCtx := u.ctx.Tracer().ContextWithSpan(context.Background(), registerSpan)
+	registerSpan.SetTag("email", email)
+
+	userInfo, err := u.db.QueryByEmail(email)
+	if err != nil {
+		u.Error("查询用户信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息失败！"))
+		return
+	}
+	if userInfo != nil {
+		c.ResponseError(errors.New("该邮箱已注册"))
+		return
+	}
+	err = u.verifyEmailCode(registerSpanCtx, email, req.Code, commonapi.CodeTypeRegister)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	u.createUser(registerSpanCtx, &createUserModel{
+		UID:      util.GenerUUID(),
+		Sex:      1,
+		Name:     req.Name,
+		Email:    email,
+		Password: req.Password,
+		Flag:     int(req.Flag),
+		Device:   req.Device,
+	}, c, invite)
+}
+
+// 获取忘记密码邮箱验证码
+func (u *User) sendEmailForgetPwdCode(c *wkhttp.Context) {
+	var req emailReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	email, err := commonapi.NormalizeEmail(req.Email)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	userInfo, err := u.db.QueryByEmail(email)
+	if err != nil {
+		u.Error("查询用户信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息失败！"))
+		return
+	}
+	if userInfo == nil {
+		c.ResponseError(errors.New("该邮箱未注册"))
+		return
+	}
+	if !u.sendEmailCode(c, email, commonapi.CodeTypeForgetLoginPWD) {
+		return
+	}
+	c.ResponseOK()
+}
+
+// 通过邮箱重置登录密码
+func (u *User) pwdforgetWithEmail(c *wkhttp.Context) {
+	var req emailResetPwdReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	if strings.TrimSpace(req.Code) == "" {
+		c.ResponseError(errors.New("验证码不能为空！"))
+		return
+	}
+	if strings.TrimSpace(req.Pwd) == "" {
+		c.ResponseError(errors.New("密码不能为空！"))
+		return
+	}
+	if len(req.Pwd) < 6 {
+		c.ResponseError(errors.New("密码长度必须大于6位！"))
+		return
+	}
+	email, err := commonapi.NormalizeEmail(req.Email)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	userInfo, err := u.db.QueryByEmail(email)
+	if err != nil {
+		u.Error("查询用户信息错误", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息错误"))
+		return
+	}
+	if userInfo == nil {
+		c.ResponseError(errors.New("该账号不存在"))
+		return
+	}
+	err = u.verifyEmailCode(context.Background(), email, req.Code, commonapi.CodeTypeForgetLoginPWD)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	pwd, err := hashPassword(req.Pwd)
+	if err != nil {
+		u.Error("计算密码哈希失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改登录密码错误"))
+		return
+	}
+	err = u.db.UpdateUsersWithField("password", pwd, userInfo.UID)
+	if err != nil {
+		u.Error("修改登录密码错误", zap.Error(err))
+		c.ResponseError(errors.New("修改登录密码错误"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 发送登录设备验证的邮箱验证码
+func (u *User) sendLoginCheckEmailCode(c *wkhttp.Context) {
+	var req struct {
+		UID string `json:"uid"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if req.UID == "" {
+		c.ResponseError(errors.New("uid不能为空！"))
+		return
+	}
+	userInfo, err := u.queryLoginDeviceCheckUser(req.UID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if !u.sendEmailCode(c, userInfo.Email, commonapi.CodeTypeCheckMobile) {
+		return
+	}
+	c.ResponseOK()
+}
+
+// 登录设备验证（邮箱验证码）
+func (u *User) loginCheckEmail(c *wkhttp.Context) {
+	var req struct {
+		UID  string `json:"uid"`
+		Code string `json:"code"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("数据格式有误！"))
+		return
+	}
+	if req.UID == "" {
+		c.ResponseError(errors.New("uid不能为空！"))
+		return
+	}
+	if req.Code == "" {
+		c.ResponseError(errors.New("验证码不能为空！"))
+		return
+	}
+	span := u.ctx.Tracer().StartSpan(
+		"user.loginCheckEmail",
+		opentracing.ChildOf(c.GetSpanContext()),
+	)
+	defer span.Finish()
+	spanCtx := u.ctx.Tracer().ContextWithSpan(context.Background(), span)
+
+	userInfo, err := u.queryLoginDeviceCheckUser(req.UID)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	err = u.emailService.Verify(spanCtx, userInfo.Email, req.Code, commonapi.CodeTypeCheckMobile)
+	if err != nil {
+		u.Error("验证邮箱验证码失败", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	u.execLoginDeviceCheckAndRespose(userInfo, spanCtx, c)
+}
+
+// 获取绑定邮箱的验证码（发送到新邮箱）
+func (u *User) sendBindEmailCode(c *wkhttp.Context) {
+	var req emailReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	email, err := commonapi.NormalizeEmail(req.Email)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if !u.checkEmailBindable(c, email) {
+		return
+	}
+	if !u.sendEmailCode(c, email, commonapi.CodeTypeBindEmail) {
+		return
+	}
+	c.ResponseOK()
+}
+
+// 获取更换邮箱的验证码（发送到原邮箱）
+func (u *User) sendOldEmailCode(c *wkhttp.Context) {
+	userInfo, err := u.db.QueryByUID(c.GetLoginUID())
+	if err != nil {
+		u.Error("查询登录用户信息错误", zap.Error(err))
+		c.ResponseError(errors.New("查询登录用户信息错误"))
+		return
+	}
+	if userInfo == nil || userInfo.IsDestroy == 1 {
+		c.ResponseError(errors.New("登录用户不存在"))
+		return
+	}
+	if userInfo.Email == "" {
+		c.ResponseError(errors.New("未绑定邮箱"))
+		return
+	}
+	if !u.sendEmailCode(c, userInfo.Email, commonapi.CodeTypeChangeEmail) {
+		return
+	}
+	c.ResponseOK()
+}
+
+// 绑定或更换邮箱（需要原邮箱验证码或登录密码重新验证身份）
+func (u *User) bindEmail(c *wkhttp.Context) {
+	var req emailBindReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	if strings.TrimSpace(req.Code) == "" {
+		c.ResponseError(errors.New("验证码不能为空！"))
+		return
+	}
+	email, err := commonapi.NormalizeEmail(req.Email)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	userInfo, err := u.db.QueryByUID(c.GetLoginUID())
+	if err != nil {
+		u.Error("查询登录用户信息错误", zap.Error(err))
+		c.ResponseError(errors.New("查询登录用户信息错误"))
+		return
+	}
+	if userInfo == nil || userInfo.IsDestroy == 1 {
+		c.ResponseError(errors.New("登录用户不存在"))
+		return
+	}
+	if !u.checkEmailBindable(c, email) {
+		return
+	}
+	if !u.checkEmailBindAuth(c, userInfo, req) {
+		return
+	}
+	err = u.verifyEmailCode(context.Background(), email, req.Code, commonapi.CodeTypeBindEmail)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	// 邮箱有唯一索引，并发绑定同一个邮箱时只有一个能成功
+	err = u.db.UpdateUsersWithField("email", email, userInfo.UID)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			c.ResponseError(errors.New("该邮箱已被其他账号绑定"))
+			return
+		}
+		u.Error("绑定邮箱失败！", zap.Error(err))
+		c.ResponseError(errors.New("绑定邮箱失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 绑定或更换邮箱前重新验证身份，返回false表示已响应错误
+// 传了原邮箱验证码时校验原邮箱验证码，否则校验登录密码（密码错误计入登录限制，防止token泄露后被暴力破解）
+func (u *User) checkEmailBindAuth(c *wkhttp.Context, userInfo *Model, req emailBindReq) bool {
+	if strings.TrimSpace(req.OldCode) != "" {
+		if userInfo.Email == "" {
+			c.ResponseError(errors.New("未绑定邮箱"))
+			return false
+		}
+		err := u.verifyEmailCode(context.Background(), userInfo.Email, req.OldCode, commonapi.CodeTypeChangeEmail)
+		if err != nil {
+			c.ResponseError(err)
+			return false
+		}
+		return true
+	}
+	if req.Password == "" {
+		c.ResponseError(errors.New("登录密码不能为空！"))
+		return false
+	}
+	if userInfo.Password == "" {
+		c.ResponseError(errors.New("未设置登录密码，请使用原邮箱验证码验证"))
+		return false
+	}
+	attempt, ok := u.reserveLoginAttempt(c, userInfo.UID, utils.GetClientPublicIP(c.Request))
+	if !ok {
+		return false
+	}
+	if !verifyPassword(u.db, userInfo.UID, userInfo.Password, req.Password) {
+		u.responseLoginFail(c, attempt, errors.New("登录密码错误"))
+		return false
+	}
+	u.loginLockSuccess(attempt)
+	return true
+}
+
+// 获取注销账号的邮箱验证码
+func (u *User) sendEmailDestroyCode(c *wkhttp.Context) {
+	userInfo, err := u.db.QueryByUID(c.GetLoginUID())
+	if err != nil {
+		u.Error("查询登录用户信息错误", zap.Error(err))
+		c.ResponseError(errors.New("查询登录用户信息错误"))
+		return
+	}
+	if userInfo == nil || userInfo.IsDestroy == 1 {
+		c.ResponseError(errors.New("登录用户不存在"))
+		return
+	}
+	if userInfo.Email == "" {
+		c.ResponseError(errors.New("未绑定邮箱"))
+		return
+	}
+	if !u.sendEmailCode(c, userInfo.Email, commonapi.CodeTypeDestroyAccount) {
+		return
+	}
+	c.ResponseOK()
+}
+
+// 通过邮箱验证码注销账号
+func (u *User) destroyWithEmail(c *wkhttp.Context) {
+	code := c.Param("code")
+	if code == "" {
+		c.ResponseError(errors.New("验证码不能为空"))
+		return
+	}
+	userInfo, err := u.db.QueryByUID(c.GetLoginUID())
+	if err != nil {
+		u.Error("查询登录用户信息错误", zap.Error(err))
+		c.ResponseError(errors.New("查询登录用户信息错误"))
+		return
+	}
+	if userInfo == nil || userInfo.IsDestroy == 1 {
+		c.ResponseError(errors.New("登录用户不存在"))
+		return
+	}
+	if userInfo.Email == "" {
+		c.ResponseError(errors.New("未绑定邮箱"))
+		return
+	}
+	err = u.verifyEmailCode(c.Context, userInfo.Email, code, commonapi.CodeTypeDestroyAccount)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	u.execDestroyAccountAndRespose(userInfo, c)
+}
+
+// 发送邮箱验证码，返回false表示已响应错误
+func (u *User) sendEmailCode(c *wkhttp.Context, email string, codeType commonapi.CodeType) bool {
+	span := u.ctx.Tracer().StartSpan(
+		"user.sendEmailCode",
+		opentracing.ChildOf(c.GetSpanContext()),
+	)
+	defer span.Finish()
+	spanCtx := u.ctx.Tracer().ContextWithSpan(context.Background(), span)
+
+	err := u.emailService.SendVerifyCode(spanCtx, email, codeType, utils.GetClientPublicIP(c.Request))
+	if err != nil {
+		u.Error("发送邮箱验证码失败", zap.Error(err))
+		if errors.Is(err, commonapi.ErrSMSLimit) {
+			c.ResponseError(err)
+			return false
+		}
+		c.ResponseError(errors.New("发送邮箱验证码失败！"))
+		return false
+	}
+	return true
+}
+
+// 校验邮箱验证码（与短信一样，配置了测试验证码时使用测试验证码）
+func (u *User) verifyEmailCode(ctx context.Context, email string, code string, codeType commonapi.CodeType) error {
+	if strings.TrimSpace(u.ctx.GetConfig().SMSCode) != "" {
+		if strings.TrimSpace(u.ctx.GetConfig().SMSCode) != code {
+			return errors.New("验证码错误")
+		}
+		return nil
+	}
+	return u.emailService.Verify(ctx, email, code, codeType)
+}
+
+// isDuplicateEntry 是否是唯一索引冲突
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+// 邮箱是否可以被当前登录用户绑定，返回false表示已响应错误（只用于提前提示，最终以唯一索引为准）
+func (u *User) checkEmailBindable(c *wkhttp.Context, email string) bool {
+	userInfo, err := u.db.QueryByEmail(email)
+	if err != nil {
+		u.Error("查询用户信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息失败！"))
+		return false
+	}
+	if userInfo != nil {
+		if userInfo.UID == c.GetLoginUID() {
+			c.ResponseError(errors.New("已绑定该邮箱"))
+		} else {
+			c.ResponseError(errors.New("该邮箱已被其他账号绑定"))
+		}
+		return false
+	}
+	return true
+}
+
+// 查询需要登录设备验证的用户（必须有待验证的登录设备）
+func (u *User) queryLoginDeviceCheckUser(uid string) (*Model, error) {
+	userInfo, err := u.db.QueryByUID(uid)
+	if err != nil {
+		u.Error("查询用户信息失败！", zap.Error(err))
+		return nil, errors.New("查询用户信息失败！")
+	}
+	if userInfo == nil {
+		return nil, errors.New("该用户不存在")
+	}
+	if userInfo.Email == "" {
+		return nil, errors.New("未绑定邮箱")
+	}
+	loginDevice, err := u.ctx.GetRedisConn().GetString(fmt.Sprintf("%s%s", u.ctx.GetConfig().Cache.LoginDeviceCachePrefix, uid))
+	if err != nil {
+		u.Error("获取登录设备缓存失败！", zap.Error(err))
+		return nil, errors.New("获取登录设备缓存失败！")
+	}
+	if loginDevice == "" {
+		return nil, errors.New("登录设备已过期，请重新登录")
+	}
+	return userInfo, nil
+}
+
+// maskEmail 隐藏邮箱用户名中间部分 如：ab****z@example.com
+func maskEmail(email string) string {
+	i := strings.LastIndex(email, "@")
+	if i <= 0 {
+		return ""
+	}
+	name := email[:i]
+	if len(name) <= 2 {
+		return fmt.Sprintf("%s****%s", name[:1], email[i:])
+	}
+	return fmt.Sprintf("%s****%s%s", name[:2], name[len(name)-1:], email[i:])
+}
+
+type emailReq struct {
+	Email string `json:"email"`
+}
+
+type emailBindReq struct {
+	Email    string `json:"email"`
+	Code     string `json:"code"`     // 新邮箱的验证码
+	Password string `json:"password"` // 登录密码
+	OldCode  string `json:"old_code"` // 原邮箱的验证码（与登录密码二选一）
+}
+
+type emailResetPwdReq struct {
+	Email string `json:"email"` // 邮箱
+	Code  string `json:"code"`  // 验证码
+	Pwd   string `json:"pwd"`   // 新密码
+}
+
+type emailRegisterReq struct {
+	Name       string     `json:"name"`
+	Email      string     `json:"email"`
+	Code       string     `json:"code"`
+	Password   string     `json:"password"`
+	Flag       uint8      `json:"flag"`        // 注册设备的标记 0.APP 1.PC
+	Device     *deviceReq `json:"device"`      //注册用户设备信息
+	InviteCode string     `json:"invite_code"` // 邀请码
+}
+
+func (r emailRegisterReq) check() error {
+	if strings.TrimSpace(r.Email) == "" {
+		return errors.New("邮箱不能为空！")
+	}
+	if strings.TrimSpace(r.Code) == "" {
+		return errors.New("验证码不能为空！")
+	}
+	if strings.TrimSpace(r.Password) == "" {
+		return errors.New("密码不能为空！")
+	}
+	if len(r.Password) < 6 {
+		return errors.New("密码长度必须大于6位！")
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskEmail(t *testing.T) {
+	assert.Equal(t, "ab****z@example.com", maskEmail("abcxyz@example.com"))
+	assert.Equal(t, "a****@example.com", maskEmail("ab@example.com"))
+	assert.Equal(t, "", maskEmail(""))
+	assert.Equal(t, "", maskEmail("@example.com"))
+}
@@ -22,6 +22,7 @@ import (
 
 const (
 	ThirdAuthcodePrefix = "thirdlogin:authcode:"
+	thirdAuthTOTPPrefix = "totp:" // 登录状态为需要两步验证时的前缀
 )
 
 func (u *User) thirdAuthcode(c *wkhttp.Context) {
@@ -70,6 +71,21 @@ func (u *User) thirdAuthStatus(c *wkhttp.Context) {
 		u.Error("redis del error", zap.Error(err))
 	}
 
+	if strings.HasPrefix(result, thirdAuthTOTPPrefix) {
+		var challenge map[string]interface{}
+		err = util.ReadJsonByByte([]byte(strings.TrimPrefix(result, thirdAuthTOTPPrefix)), &challenge)
+		if err != nil {
+			c.ResponseError(err)
+			return
+		}
+		c.Response(gin.H{
+			"status":     3, // 需要两步验证
+			"uid":        challenge["uid"],
+			"totp_token": challenge["totp_token"],
+		})
+		return
+	}
+
 	var loginResp *loginUserDetailResp
 	err = util.ReadJsonByByte([]byte(result), &loginResp)
 	if err != nil {
@@ -130,19 +146,29 @@ func (u *User) giteeOAuth(c *wkhttp.Context) {
 	defer loginSpan.Finish()
 
 	var loginResp *loginUserDetailResp
+	var totpToken string
 	if userInfoM != nil { // 存在就登录
 		if userInfoM.IsDestroy == 1 {
 			c.ResponseError(errors.New("用户不存在"))
 			return
 		}
-		loginResp, err = u.execLogin(userInfoM, deviceFlag, nil, loginSpanCtx)
+		totpToken, err = u.createTOTPLoginIfNeed(userInfoM.UID, deviceFlag, nil, totpLoginKindApp)
 		if err != nil {
-			c.ResponseError(err)
+			u.Error("创建登录两步验证失败！", zap.Error(err))
+			c.ResponseError(errors.New("创建登录两步验证失败！"))
 			return
 		}
-		// 发送登录消息
-		publicIP := util.GetClientPublicIP(c.Request)
-		go u.sentWelcomeMsg(publicIP, userInfoM.UID)
+		// 开启了两步验证时由客户端通过登录状态拿到挑战，再调用登录两步验证完成登录
+		if totpToken == "" {
+			loginResp, err = u.execLogin(userInfoM, deviceFlag, nil, newSessionClient(c), loginSpanCtx)
+			if err != nil {
+				c.ResponseError(err)
+				return
+			}
+			// 发送登录消息
+			publicIP := util.GetClientPublicIP(c.Request)
+			go u.sentWelcomeMsg(publicIP, userInfoM.UID)
+		}
 	} else {
 		// 创建用户
 		uid := util.GenerUUID()
@@ -196,8 +222,7 @@ func (u *User) giteeOAuth(c *wkhttp.Context) {
 			return
 		}
 		// 发送登录消息
-		publicIP := util.GetClientPublicIP(c.Request)
-		loginResp, err = u.createUserWithRespAndTx(loginSpanCtx, model, publicIP, nil, tx, func() error {
+		loginResp, err = u.createUserWithRespAndTx(loginSpanCtx, model, newSessionClient(c), nil, tx, func() error {
 			err := tx.Commit()
 			if err != nil {
 				tx.Rollback()
@@ -214,7 +239,12 @@ func (u *User) giteeOAuth(c *wkhttp.Context) {
 		}
 	}
 	var loginRespStr string
-	if loginResp != nil {
+	if totpToken != "" {
+		loginRespStr = thirdAuthTOTPPrefix + util.ToJson(map[string]interface{}{
+			"uid":        userInfoM.UID,
+			"totp_token": totpToken,
+		})
+	} else if loginResp != nil {
 		loginRespStr = util.ToJson(loginResp)
 	} else {
 		loginRespStr = "0"
@@ -0,0 +1,84 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// reserveLoginAttempt 校验密码前占用一次尝试，被锁定或需要等待时直接响应并返回false
+func (u *User) reserveLoginAttempt(c *wkhttp.Context, uid string, publicIP string) (*loginAttempt, bool) {
+	status, attempt, err := u.loginLockService.reserve(uid, publicIP)
+	if err != nil {
+		u.Error("查询登录限制失败！", zap.Error(err))
+		c.ResponseError(errors.New("登录错误！"))
+		return nil, false
+	}
+	if attempt == nil {
+		responseLoginLock(c, loginLockMessage(status, ""), status)
+		return nil, false
+	}
+	return attempt, true
+}
+
+// responseLoginFail 密码错误（或用户不存在）时记录错误次数并响应
+func (u *User) responseLoginFail(c *wkhttp.Context, attempt *loginAttempt, failErr error) {
+	if attempt.UID != "" {
+		u.loginLog.addFail(attempt.UID, attempt.IP)
+	}
+	status, err := u.loginLockService.fail(attempt)
+	if err != nil {
+		u.Error("记录登录错误次数失败！", zap.Error(err))
+		c.ResponseError(failErr)
+		return
+	}
+	responseLoginLock(c, loginLockMessage(status, failErr.Error()), status)
+}
+
+// loginLockSuccess 密码校验通过后清除账号的错误次数
+func (u *User) loginLockSuccess(attempt *loginAttempt) {
+	err := u.loginLockService.success(attempt)
+	if err != nil {
+		u.Warn("清除登录错误次数失败！", zap.Error(err), zap.String("uid", attempt.UID))
+	}
+}
+
+func loginLockMessage(status *loginLockStatus, defaultMsg string) string {
+	if status.Locked {
+		target := "账号"
+		if status.LockType == loginLockTypeIP {
+			target = "当前网络"
+		}
+		return fmt.Sprintf("密码错误次数过多，%s已被暂时锁定，请%d分钟后再试", target, int(math.Ceil(status.RetryAfter.Minutes())))
+	}
+	if defaultMsg != "" {
+		return defaultMsg
+	}
+	return fmt.Sprintf("尝试过于频繁，请%d秒后再试", loginRetryAfterSeconds(status.RetryAfter))
+}
+
+func loginRetryAfterSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
+
+// responseLoginLock 登录被限制的响应，客户端根据captcha_required决定是否展示图形验证码，retry_after为需要等待的秒数
+func responseLoginLock(c *wkhttp.Context, msg string, status *loginLockStatus) {
+	captchaRequired := 0
+	if status.CaptchaRequired {
+		captchaRequired = 1
+	}
+	c.ResponseWithStatus(http.StatusBadRequest, map[string]interface{}{
+		"status":           http.StatusBadRequest,
+		"msg":              msg,
+		"captcha_required": captchaRequired,
+		"retry_after":      loginRetryAfterSeconds(status.RetryAfter),
+	})
+}
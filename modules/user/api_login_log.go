@@ -1,8 +1,18 @@
 package user
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
+	common2 "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/common"
+	utils "github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/common"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
 	"go.uber.org/zap"
 )
 
@@ -10,25 +20,81 @@ import (
 type LoginLog struct {
 	ctx *config.Context
 	log.Log
-	loginLogDB *LoginLogDB
+	loginLogDB    *LoginLogDB
+	commonService common2.IService
 }
 
 // NewLoginLog 创建
 func NewLoginLog(ctx *config.Context) *LoginLog {
-	return &LoginLog{ctx: ctx, Log: log.NewTLog("loginLog"), loginLogDB: NewLoginLogDB(ctx.DB())}
+	return &LoginLog{ctx: ctx, Log: log.NewTLog("loginLog"), loginLogDB: NewLoginLogDB(ctx.DB()), commonService: common2.NewService(ctx)}
 }
 
 // add 添加登录日志
 func (l *LoginLog) add(uid string, publicIP string) {
+	m := &LoginLogModel{
+		UID:     uid,
+		LoginIP: publicIP,
+		Status:  loginLogStatusSuccess,
+	}
+	setLoginLogLocation(m, l.location(publicIP))
+	err := l.loginLogDB.insert(m)
+	if err != nil {
+		l.Error("添加登录日志错误", zap.Error(err))
+	}
+}
+
+// addFail 添加密码错误的登录日志
+func (l *LoginLog) addFail(uid string, publicIP string) {
 	err := l.loginLogDB.insert(&LoginLogModel{
 		UID:     uid,
 		LoginIP: publicIP,
+		Status:  loginLogStatusFail,
 	})
 	if err != nil {
 		l.Error("添加登录日志错误", zap.Error(err))
 	}
 }
 
+// addRisk 添加被要求验证或禁止登录的异常登录日志
+func (l *LoginLog) addRisk(uid string, publicIP string, location *utils.IPLocation, result *loginRiskResult) {
+	m := &LoginLogModel{
+		UID:        uid,
+		LoginIP:    publicIP,
+		Status:     loginLogStatusRisk,
+		Risk:       result.rulesString(),
+		RiskAction: result.Action,
+	}
+	setLoginLogLocation(m, location)
+	err := l.loginLogDB.insert(m)
+	if err != nil {
+		l.Error("添加登录日志错误", zap.Error(err))
+	}
+}
+
+// location 开启了异常登录检测才查询登录地（需要ip库）
+func (l *LoginLog) location(publicIP string) *utils.IPLocation {
+	appConfig, err := l.commonService.GetAppConfig()
+	if err != nil {
+		l.Warn("获取应用配置错误", zap.Error(err))
+		return nil
+	}
+	if appConfig == nil || appConfig.LoginRiskOn != 1 {
+		return nil
+	}
+	return utils.GetInstance().GetLocation(publicIP)
+}
+
+func setLoginLogLocation(m *LoginLogModel, location *utils.IPLocation) {
+	if location == nil {
+		return
+	}
+	m.Country = location.Country
+	m.Region = location.Region
+	m.City = location.City
+	m.Longitude = location.Longitude
+	m.Latitude = location.Latitude
+}
+
 // getLastLoginIp 获取最后一次登录ip
 func (l *LoginLog) getLastLoginIP(uid string) *loginLogResp {
 	model, err := l.loginLogDB.queryLastLoginIP(uid)
@@ -52,3 +118,224 @@ type loginLogResp struct {
 	CreateAt string
 	LoginIP  string
 }
+
+// 我的登录记录
+func (u *User) loginLogs(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	pageIndex, pageSize := c.GetPage()
+	models, err := u.loginLog.loginLogDB.queryWithUIDAndPage(loginUID, uint64(pageIndex), uint64(pageSize))
+	if err != nil {
+		u.Error("查询登录记录失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询登录记录失败！"))
+		return
+	}
+	count, err := u.loginLog.loginLogDB.queryCountWithUID(loginUID)
+	if err != nil {
+		u.Error("查询登录记录数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询登录记录数量失败！"))
+		return
+	}
+	list := make([]*loginHistoryResp, 0, len(models))
+	for _, model := range models {
+		list = append(list, &loginHistoryResp{
+			IP:         model.LoginIP,
+			Location:   loginLogLocation(model),
+			Status:     model.Status,
+			Risk:       model.Risk,
+			RiskAction: model.RiskAction,
+			CreatedAt:  model.CreatedAt.String(),
+		})
+	}
+	c.Response(map[string]interface{}{
+		"list":  list,
+		"count": count,
+	})
+}
+
+func loginLogLocation(m *LoginLogModel) string {
+	if m.Country == "" {
+		return ""
+	}
+	return (&utils.IPLocation{Country: m.Country, Region: m.Region, City: m.City}).String()
+}
+
+type loginHistoryResp struct {
+	IP         string `json:"ip"`          // 登录IP
+	Location   string `json:"location"`    // 登录地（开启异常登录检测后才有）
+	Status     int    `json:"status"`      // 登录结果 0.密码错误 1.成功 2.异常登录
+	Risk       string `json:"risk"`        // 命中的异常登录规则 new_region.新地区 impossible_travel.不可能的移动速度 many_failures.多次密码错误
+	RiskAction int    `json:"risk_action"` // 异常登录的处理方式 2.验证手机号或邮箱 3.暂时禁止登录
+	CreatedAt  string `json:"created_at"`  // 登录时间
+}
+
+// loginRiskConfig 系统配置中的异常登录规则，未开启返回nil
+func (u *User) loginRiskConfig() (*loginRiskConfig, int, error) {
+	appConfig, err := u.commonService.GetAppConfig()
+	if err != nil {
+		return nil, 0, err
+	}
+	if appConfig == nil || appConfig.LoginRiskOn != 1 {
+		return nil, 0, nil
+	}
+	blockMinutes := appConfig.LoginRiskBlockMinutes
+	if blockMinutes <= 0 {
+		blockMinutes = 30
+	}
+	return &loginRiskConfig{
+		NewRegionAction: clampLoginRiskAction(appConfig.LoginRiskNewRegionAction),
+		TravelAction:    clampLoginRiskAction(appConfig.LoginRiskTravelAction),
+		FailAction:      clampLoginRiskAction(appConfig.LoginRiskFailAction),
+		FailCount:       appConfig.LoginRiskFailCount,
+	}, blockMinutes, nil
+}
+
+func clampLoginRiskAction(action int) int {
+	if action < loginRiskActionNone {
+		return loginRiskActionNone
+	}
+	if action > loginRiskActionBlock {
+		return loginRiskActionBlock
+	}
+	return action
+}
+
+// responseLoginRiskIfNeed 密码校验通过后检测异常登录，需要验证或被禁止登录时直接响应并返回true
+func (u *User) responseLoginRiskIfNeed(c *wkhttp.Context, userInfo *Model, flag config.DeviceFlag, device *deviceReq) bool {
+	cfg, blockMinutes, err := u.loginRiskConfig()
+	if err != nil {
+		u.Error("获取应用配置错误", zap.Error(err))
+		c.ResponseError(errors.New("登录错误！"))
+		return true
+	}
+	if cfg == nil {
+		return false
+	}
+	blockKey := loginRiskBlockCachePrefix + userInfo.UID
+	blocked, err := u.ctx.GetRedisConn().GetString(blockKey)
+	if err != nil {
+		u.Error("获取异常登录标记失败！", zap.Error(err))
+		c.ResponseError(errors.New("登录错误！"))
+		return true
+	}
+	if blocked != "" {
+		c.ResponseError(errors.New("账号存在异常登录，暂时禁止登录，请稍后再试"))
+		return true
+	}
+
+	now := time.Now()
+	publicIP := utils.GetClientPublicIP(c.Request)
+	input := &loginRiskInput{
+		Now:      now,
+		Location: utils.GetInstance().GetLocation(publicIP),
+	}
+	input.LastLogin, err = u.loginLog.loginLogDB.queryLastLoginIP(userInfo.UID)
+	if err != nil {
+		u.Error("查询登录日志错误", zap.Error(err))
+		c.ResponseError(errors.New("登录错误！"))
+		return true
+	}
+	input.Regions, err = u.loginLog.loginLogDB.queryRegionsSince(userInfo.UID, now.AddDate(0, 0, -loginRiskHistoryDays))
+	if err != nil {
+		u.Error("查询登录地区错误", zap.Error(err))
+		c.ResponseError(errors.New("登录错误！"))
+		return true
+	}
+	failSince := now.Add(-loginRiskFailWindow)
+	if input.LastLogin != nil && time.Time(input.LastLogin.CreatedAt).After(failSince) { // 上次登录成功之前的错误不再计算
+		failSince = time.Time(input.LastLogin.CreatedAt)
+	}
+	input.FailCount, err = u.loginLog.loginLogDB.queryFailCountSince(userInfo.UID, failSince)
+	if err != nil {
+		u.Error("查询密码错误次数错误", zap.Error(err))
+		c.ResponseError(errors.New("登录错误！"))
+		return true
+	}
+
+	result := evaluateLoginRisk(input, cfg)
+	if result.Action == loginRiskActionNone {
+		return false
+	}
+	u.Info("检测到异常登录", zap.String("uid", userInfo.UID), zap.String("ip", publicIP), zap.String("rules", result.rulesString()), zap.Int("action", result.Action))
+
+	action := result.Action
+	// 只有app并且绑定了手机号或邮箱才能走验证流程，否则直接禁止登录
+	if action == loginRiskActionVerify && (flag != config.APP || device == nil || (userInfo.Phone == "" && userInfo.Email == "")) {
+		action = loginRiskActionBlock
+		result.Action = action
+	}
+	switch action {
+	case loginRiskActionNotify:
+		go u.sendLoginRiskNotice(userInfo.UID, publicIP, input.Location, result)
+		return false
+	case loginRiskActionVerify:
+		u.loginLog.addRisk(userInfo.UID, publicIP, input.Location, result)
+		err = u.ctx.GetRedisConn().SetAndExpire(u.ctx.GetConfig().Cache.LoginDeviceCachePrefix+userInfo.UID, util.ToJson(device), u.ctx.GetConfig().Cache.LoginDeviceCacheExpire)
+		if err != nil {
+			u.Error("缓存登录设备失败！", zap.Error(err))
+			c.ResponseError(errors.New("缓存登录设备失败！"))
+			return true
+		}
+		// 开启了两步验证的用户验证手机号或邮箱后还需要两步验证才能登录
+		if err = u.markLoginRiskTOTP(userInfo.UID, device); err != nil {
+			u.Error("设置异常登录两步验证标记失败！", zap.Error(err))
+			c.ResponseError(errors.New("登录错误！"))
+			return true
+		}
+		go u.sendLoginRiskNotice(userInfo.UID, publicIP, input.Location, result)
+		responseLoginNeedVerification(c, userInfo)
+		return true
+	default:
+		u.loginLog.addRisk(userInfo.UID, publicIP, input.Location, result)
+		err = u.ctx.GetRedisConn().SetAndExpire(blockKey, result.rulesString(), time.Duration(blockMinutes)*time.Minute)
+		if err != nil {
+			u.Error("设置异常登录标记失败！", zap.Error(err))
+		}
+		go u.sendLoginRiskNotice(userInfo.UID, publicIP, input.Location, result)
+		c.ResponseError(errors.New("账号存在异常登录，暂时禁止登录，请稍后再试"))
+		return true
+	}
+}
+
+// markLoginRiskTOTP 需要两步验证时标记异常登录的验证流程，登录设备验证通过后先返回两步验证挑战
+func (u *User) markLoginRiskTOTP(uid string, device *deviceReq) error {
+	need, err := u.needTOTP(uid, device)
+	if err != nil {
+		return err
+	}
+	key := loginRiskTOTPCachePrefix + uid
+	if !need {
+		return u.ctx.GetRedisConn().Del(key)
+	}
+	return u.ctx.GetRedisConn().SetAndExpire(key, "1", u.ctx.GetConfig().Cache.LoginDeviceCacheExpire)
+}
+
+// sendLoginRiskNotice 系统账号发送异常登录安全提醒
+func (u *User) sendLoginRiskNotice(uid string, publicIP string, location *utils.IPLocation, result *loginRiskResult) {
+	reasons := make([]string, 0, len(result.Rules))
+	for _, rule := range result.Rules {
+		reasons = append(reasons, loginRiskRuleDesc(rule))
+	}
+	var handle string
+	switch result.Action {
+	case loginRiskActionVerify:
+		handle = "本次登录需要验证手机号或邮箱。"
+	case loginRiskActionBlock:
+		handle = "本次登录已被拦截，账号暂时禁止登录。"
+	}
+	content := fmt.Sprintf("【安全提醒】您的账号于%s在%s（IP：%s）登录，存在异常：%s。%s如非本人操作，请立即修改密码，并在登录会话中撤销未知的会话。", util.ToyyyyMMddHHmmss(time.Now()), location.String(), publicIP, strings.Join(reasons, "、"), handle)
+	err := u.ctx.SendMessage(&config.MsgSendReq{
+		FromUID:     u.ctx.GetConfig().Account.SystemUID,
+		ChannelID:   uid,
+		ChannelType: common.ChannelTypePerson.Uint8(),
+		Payload: []byte(util.ToJson(map[string]interface{}{
+			"content": content,
+			"type":    common.Text,
+		})),
+		Header: config.MsgHeader{
+			RedDot: 1,
+		},
+	})
+	if err != nil {
+		u.Error("发送异常登录提醒失败", zap.Error(err))
+	}
+}
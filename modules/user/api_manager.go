@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	commonapi "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/common"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/base/event"
 	common2 "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/common"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/common"
@@ -24,27 +25,37 @@ import (
 type Manager struct {
 	ctx *config.Context
 	log.Log
-	db            *managerDB
-	userDB        *DB
-	userSettingDB *SettingDB
-	deviceDB      *deviceDB
-	friendDB      *friendDB
-	onlineService IOnlineService
-	commonService common2.IService
+	db               *managerDB
+	userDB           *DB
+	userSettingDB    *SettingDB
+	deviceDB         *deviceDB
+	friendDB         *friendDB
+	onlineService    IOnlineService
+	commonService    common2.IService
+	smsService       commonapi.ISMSService
+	emailService     commonapi.IEmailService
+	totpDB           *totpDB
+	sessionService   *sessionService
+	loginLockService *loginLockService
 }
 
 // NewManager NewManager
 func NewManager(ctx *config.Context) *Manager {
 	m := &Manager{
-		ctx:           ctx,
-		Log:           log.NewTLog("userManager"),
-		db:            newManagerDB(ctx),
-		deviceDB:      newDeviceDB(ctx),
-		friendDB:      newFriendDB(ctx),
-		userDB:        NewDB(ctx),
-		userSettingDB: NewSettingDB(ctx.DB()),
-		onlineService: NewOnlineService(ctx),
-		commonService: common2.NewService(ctx),
+		ctx:              ctx,
+		Log:              log.NewTLog("userManager"),
+		db:               newManagerDB(ctx),
+		deviceDB:         newDeviceDB(ctx),
+		friendDB:         newFriendDB(ctx),
+		userDB:           NewDB(ctx),
+		userSettingDB:    NewSettingDB(ctx.DB()),
+		onlineService:    NewOnlineService(ctx),
+		commonService:    common2.NewService(ctx),
+		smsService:       commonapi.NewSMSService(ctx),
+		emailService:     commonapi.NewEmailService(ctx),
+		totpDB:           newTOTPDB(ctx),
+		sessionService:   newSessionService(ctx),
+		loginLockService: newLoginLockService(ctx),
 	}
 	m.createManagerAccount()
 	return m
@@ -54,7 +65,8 @@ func NewManager(ctx *config.Context) *Manager {
 func (m *Manager) Route(r *wkhttp.WKHttp) {
 	user := r.Group("/v1/manager")
 	{
-		user.POST("/login", m.login) // 账号登录
+		user.POST("/login", m.login)          // 账号登录
+		user.POST("/login/totp", m.loginTOTP) // 登录两步验证
 	}
 	auth := r.Group("/v1/manager", m.ctx.AuthMiddleware(r))
 	{
@@ -72,7 +84,129 @@ func (m *Manager) Route(r *wkhttp.WKHttp) {
 		auth.POST("/user/updatepassword", m.updatePwd)        // 修改后台用户密码
 		auth.POST("/user/updatePasswd", m.updatePasswd)       // 修改客户端用户密码
 		auth.GET("/user/devices", m.devices)                  // 查看某用户设备列表
+		auth.GET("/user/smsstats", m.smsStats)                // 短信验证码发送和校验统计
+		auth.GET("/user/emailstats", m.emailStats)            // 邮箱验证码发送和校验统计
+		auth.DELETE("/user/totp/:uid", m.resetUserTOTP)       // 重置用户的两步验证
+
+		// #################### 登录会话管理 ####################
+		auth.GET("/user/sessions", m.sessions)                          // 某用户的登录会话
+		auth.DELETE("/user/sessions/:uid", m.revokeSessions)            // 撤销某用户所有登录会话
+		auth.DELETE("/user/sessions/:uid/:session_id", m.revokeSession) // 撤销某用户的某个登录会话
+
+		// #################### 登录锁定管理 ####################
+		auth.GET("/user/login_locks", m.loginLocks)                   // 密码错误次数过多被锁定的账号和IP
+		auth.DELETE("/user/login_locks/:type/:target", m.loginUnlock) // 解除锁定
+	}
+}
+
+// 某用户的登录会话
+func (m *Manager) sessions(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	uid := c.Query("uid")
+	if strings.TrimSpace(uid) == "" {
+		c.ResponseError(errors.New("用户uid不能为空！"))
+		return
+	}
+	sessions, err := m.sessionService.list(uid)
+	if err != nil {
+		m.Error("查询登录会话失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询登录会话失败！"))
+		return
+	}
+	resps := make([]*sessionResp, 0, len(sessions))
+	for _, session := range sessions {
+		resps = append(resps, newSessionResp(session, ""))
 	}
+	c.Response(resps)
+}
+
+// 撤销某用户的某个登录会话
+func (m *Manager) revokeSession(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	uid := c.Param("uid")
+	sessionID := c.Param("session_id")
+	session, err := m.sessionService.sessionDB.queryWithUIDAndSessionID(uid, sessionID)
+	if err != nil {
+		m.Error("查询登录会话失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询登录会话失败！"))
+		return
+	}
+	if session == nil {
+		c.ResponseError(errors.New("登录会话不存在！"))
+		return
+	}
+	err = m.sessionService.revoke(session)
+	if err != nil {
+		m.Error("撤销登录会话失败！", zap.Error(err))
+		c.ResponseError(errors.New("撤销登录会话失败！"))
+		return
+	}
+	m.Info("撤销用户登录会话", zap.String("operator", c.GetLoginUID()), zap.String("uid", uid), zap.String("sessionID", sessionID))
+	c.ResponseOK()
+}
+
+// 撤销某用户的所有登录会话
+func (m *Manager) revokeSessions(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	uid := c.Param("uid")
+	if strings.TrimSpace(uid) == "" {
+		c.ResponseError(errors.New("用户uid不能为空！"))
+		return
+	}
+	count, err := m.sessionService.revokeAll(uid, "")
+	if err != nil {
+		m.Error("撤销登录会话失败！", zap.Error(err))
+		c.ResponseError(errors.New("撤销登录会话失败！"))
+		return
+	}
+	m.Info("撤销用户所有登录会话", zap.String("operator", c.GetLoginUID()), zap.String("uid", uid), zap.Int("count", count))
+	c.ResponseOK()
+}
+
+// 短信验证码发送和校验统计
+func (m *Manager) smsStats(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "7"))
+	list, err := m.smsService.Stats(days)
+	if err != nil {
+		m.Error("查询短信统计失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询短信统计失败！"))
+		return
+	}
+	c.Response(list)
+}
+
+// 邮箱验证码发送和校验统计
+func (m *Manager) emailStats(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "7"))
+	list, err := m.emailService.Stats(days)
+	if err != nil {
+		m.Error("查询邮箱验证码统计失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询邮箱验证码统计失败！"))
+		return
+	}
+	c.Response(list)
 }
 
 func (m *Manager) devices(c *wkhttp.Context) {
@@ -162,7 +296,7 @@ func (m *Manager) login(c *wkhttp.Context) {
 		c.ResponseError(errors.New("登录用户不存在"))
 		return
 	}
-	if userInfo.Password != util.MD5(util.MD5(req.Password)) {
+	if !verifyPassword(m.userDB, userInfo.UID, userInfo.Password, req.Password) {
 		c.ResponseError(errors.New("用户名或密码错误"))
 		return
 	}
@@ -170,27 +304,117 @@ func (m *Manager) login(c *wkhttp.Context) {
 		c.ResponseError(errors.New("登录账号未开通管理权限"))
 		return
 	}
+	// 后台登录没有设备信息，开启了两步验证每次登录都需要验证
+	totpModel, err := m.totpDB.queryWithUID(userInfo.UID)
+	if err != nil {
+		m.Error("查询两步验证信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("登录错误！"))
+		return
+	}
+	if totpModel != nil && totpModel.Status == totpStatusEnabled {
+		token, err := createTOTPLogin(m.ctx, &totpLogin{
+			UID:  userInfo.UID,
+			Kind: totpLoginKindManager,
+		})
+		if err != nil {
+			m.Error("创建登录两步验证失败！", zap.Error(err))
+			c.ResponseError(errors.New("登录错误！"))
+			return
+		}
+		responseTOTPChallenge(c, userInfo.UID, token)
+		return
+	}
+	m.execLoginAndRespose(c, userInfo.UID, userInfo.Name, userInfo.Role)
+}
+
+// 后台登录两步验证
+func (m *Manager) loginTOTP(c *wkhttp.Context) {
+	var req totpLoginReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	login, err := verifyTOTPLogin(m.ctx, m.totpDB, m.loginLockService, req.TOTPToken, req.Code)
+	if err != nil {
+		m.Warn("后台登录两步验证失败", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	if login.Kind != totpLoginKindManager {
+		c.ResponseError(errors.New("登录已过期，请重新登录"))
+		return
+	}
+	userInfo, err := m.userDB.QueryByUID(login.UID)
+	if err != nil {
+		m.Error("查询用户信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("登录错误！"))
+		return
+	}
+	if userInfo == nil {
+		c.ResponseError(errors.New("登录用户不存在"))
+		return
+	}
+	if userInfo.Role != string(wkhttp.Admin) && userInfo.Role != string(wkhttp.SuperAdmin) {
+		c.ResponseError(errors.New("登录账号未开通管理权限"))
+		return
+	}
+	m.execLoginAndRespose(c, userInfo.UID, userInfo.Name, userInfo.Role)
+}
+
+// 重置用户的两步验证（用户丢失验证器和恢复码时使用）
+func (m *Manager) resetUserTOTP(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	uid := c.Param("uid")
+	if strings.TrimSpace(uid) == "" {
+		c.ResponseError(errors.New("用户uid不能为空！"))
+		return
+	}
+	err = resetTOTP(m.ctx, m.totpDB, uid)
+	if err != nil {
+		m.Error("重置两步验证失败！", zap.Error(err))
+		c.ResponseError(errors.New("重置两步验证失败！"))
+		return
+	}
+	m.Info("重置用户两步验证", zap.String("operator", c.GetLoginUID()), zap.String("uid", uid))
+	c.ResponseOK()
+}
+
+func (m *Manager) execLoginAndRespose(c *wkhttp.Context, uid string, name string, role string) {
 	token := util.GenerUUID()
 	// 将token设置到缓存
-	err = m.ctx.Cache().SetAndExpire(m.ctx.GetConfig().Cache.TokenCachePrefix+token, fmt.Sprintf("%s@%s@%s", userInfo.UID, userInfo.Name, userInfo.Role), m.ctx.GetConfig().Cache.TokenExpire)
+	err := m.ctx.Cache().SetAndExpire(m.ctx.GetConfig().Cache.TokenCachePrefix+token, fmt.Sprintf("%s@%s@%s", uid, name, role), m.ctx.GetConfig().Cache.TokenExpire)
 	if err != nil {
 		m.Error("设置token缓存失败！", zap.Error(err))
 		c.ResponseError(errors.New("设置token缓存失败！"))
 		return
 	}
 
-	err = m.ctx.Cache().SetAndExpire(fmt.Sprintf("%s%d%s", m.ctx.GetConfig().Cache.UIDTokenCachePrefix, config.Web, userInfo.UID), token, m.ctx.GetConfig().Cache.TokenExpire)
+	err = m.ctx.Cache().SetAndExpire(fmt.Sprintf("%s%d%s", m.ctx.GetConfig().Cache.UIDTokenCachePrefix, config.Web, uid), token, m.ctx.GetConfig().Cache.TokenExpire)
 	if err != nil {
 		m.Error("设置uidtoken缓存失败！", zap.Error(err))
 		c.ResponseError(errors.New("设置token缓存失败！"))
 		return
 	}
+	err = m.sessionService.add(uid, token, config.Web, nil, newSessionClient(c))
+	if err != nil {
+		m.Error("记录登录会话失败！", zap.Error(err))
+		c.ResponseError(errors.New("记录登录会话失败！"))
+		return
+	}
 
 	c.Response(&managerLoginResp{
-		UID:   userInfo.UID,
+		UID:   uid,
 		Token: token,
-		Name:  userInfo.Name,
-		Role:  userInfo.Role,
+		Name:  name,
+		Role:  role,
 	})
 }
 
@@ -235,7 +459,13 @@ func (m *Manager) resetUserPassword(c *wkhttp.Context) {
 		return
 	}
 
-	err = m.userDB.UpdateUsersWithField("password", util.MD5(util.MD5(req.NewPassword)), req.Uid)
+	pwd, err := hashPassword(req.NewPassword)
+	if err != nil {
+		m.Error("计算密码哈希失败！", zap.Error(err))
+		c.ResponseError(errors.New("重置用户密码错误"))
+		return
+	}
+	err = m.userDB.UpdateUsersWithField("password", pwd, req.Uid)
 	if err != nil {
 		m.Error("重置用户密码错误", zap.Error(err))
 		c.Response("重置用户密码错误")
@@ -372,7 +602,12 @@ func (m *Manager) addAdminUser(c *wkhttp.Context) {
 	userModel.Username = req.LoginName
 	userModel.Zone = ""
 	userModel.Role = string(wkhttp.Admin)
-	userModel.Password = util.MD5(util.MD5(req.Password))
+	userModel.Password, err = hashPassword(req.Password)
+	if err != nil {
+		m.Error("计算密码哈希失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加管理员错误"))
+		return
+	}
 	userModel.ShortNo = util.Ten2Hex(time.Now().UnixNano())
 	userModel.IsUploadAvatar = 0
 	userModel.NewMsgNotice = 0
@@ -446,6 +681,13 @@ func (m *Manager) addUser(c *wkhttp.Context) {
 			panic(err)
 		}
 	}()
+	pwd, err := hashPassword(req.Password)
+	if err != nil {
+		tx.Rollback()
+		m.Error("计算密码哈希失败！", zap.Error(err))
+		c.ResponseError(errors.New("添加用户错误"))
+		return
+	}
 	userModel := &Model{}
 	userModel.UID = uid
 	userModel.Name = req.Name
@@ -454,7 +696,7 @@ func (m *Manager) addUser(c *wkhttp.Context) {
 	userModel.Phone = req.Phone
 	userModel.Username = fmt.Sprintf("%s%s", req.Zone, req.Phone)
 	userModel.Zone = req.Zone
-	userModel.Password = util.MD5(util.MD5(req.Password))
+	userModel.Password = pwd
 	userModel.ShortNo = shortNo
 	userModel.IsUploadAvatar = 0
 	userModel.NewMsgNotice = 1
@@ -912,7 +1154,7 @@ func (m *Manager) updatePwd(c *wkhttp.Context) {
 		c.ResponseError(errors.New("操作用户不存在"))
 		return
 	}
-	if util.MD5(util.MD5(req.Password)) != user.Password {
+	if !matchPassword(user.Password, req.Password) {
 		c.ResponseError(errors.New("原密码错误"))
 		return
 	}
@@ -924,7 +1166,13 @@ func (m *Manager) updatePwd(c *wkhttp.Context) {
 		c.ResponseError(errors.New("新密码不能和旧密码一样"))
 		return
 	}
-	err = m.userDB.UpdateUsersWithField("password", util.MD5(util.MD5(req.NewPassword)), loginUID)
+	newPwd, err := hashPassword(req.NewPassword)
+	if err != nil {
+		m.Error("计算密码哈希失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改密码错误"))
+		return
+	}
+	err = m.userDB.UpdateUsersWithField("password", newPwd, loginUID)
 	if err != nil {
 		m.Error("修改用户密码错误", zap.Error(err))
 		c.Response("修改用户密码错误")
@@ -975,7 +1223,13 @@ func (m *Manager) updatePasswd(c *wkhttp.Context) {
 		c.ResponseError(errors.New("操作用户不存在"))
 		return
 	}
-	err = m.userDB.UpdateUsersWithField("password", util.MD5(util.MD5(req.Password)), req.Uid)
+	pwd, err := hashPassword(req.Password)
+	if err != nil {
+		m.Error("计算密码哈希失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改用户密码错误"))
+		return
+	}
+	err = m.userDB.UpdateUsersWithField("password", pwd, req.Uid)
 	if err != nil {
 		m.Error("修改用户密码错误", zap.Error(err))
 		c.Response("修改用户密码错误")
@@ -1109,7 +1363,11 @@ func (m *Manager) createManagerAccount() {
 
 	username := string(wkhttp.SuperAdmin)
 	role := string(wkhttp.SuperAdmin)
-	var pwd = m.ctx.GetConfig().AdminPwd
+	pwd, err := hashPassword(m.ctx.GetConfig().AdminPwd)
+	if err != nil {
+		m.Error("计算密码哈希失败！", zap.Error(err))
+		return
+	}
 	err = m.userDB.Insert(&Model{
 		UID:      m.ctx.GetConfig().Account.AdminUID,
 		Name:     "超级管理员",
@@ -1120,7 +1378,7 @@ func (m *Manager) createManagerAccount() {
 		Zone:     "0086",
 		Phone:    "13000000002",
 		Status:   1,
-		Password: util.MD5(util.MD5(pwd)),
+		Password: pwd,
 	})
 	if err != nil {
 		m.Error("新增系统管理员错误", zap.Error(err))
@@ -1239,3 +1497,85 @@ func newUserOnlineResp(m *onlineStatusWeightModel) *userOnlineResp {
 		Online:      m.Online,
 	}
 }
+
+// 密码错误次数过多被锁定的账号和IP
+func (m *Manager) loginLocks(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	locks, err := m.loginLockService.list()
+	if err != nil {
+		m.Error("查询登录锁定记录失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询登录锁定记录失败！"))
+		return
+	}
+	uids := make([]string, 0, len(locks))
+	for _, lock := range locks {
+		if lock.Type == loginLockTypeAccount {
+			uids = append(uids, lock.Target)
+		}
+	}
+	userMap := map[string]*Model{}
+	if len(uids) > 0 {
+		users, err := m.userDB.QueryByUIDs(uids)
+		if err != nil {
+			m.Error("查询用户信息失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询用户信息失败！"))
+			return
+		}
+		for _, user := range users {
+			userMap[user.UID] = user
+		}
+	}
+	resps := make([]*managerLoginLockResp, 0, len(locks))
+	for _, lock := range locks {
+		resp := &managerLoginLockResp{
+			Type:     lock.Type,
+			Target:   lock.Target,
+			UnlockAt: lock.UnlockAt.Format("2006-01-02 15:04:05"),
+		}
+		if user := userMap[lock.Target]; lock.Type == loginLockTypeAccount && user != nil {
+			resp.Name = user.Name
+			resp.Username = user.Username
+		}
+		resps = append(resps, resp)
+	}
+	c.Response(resps)
+}
+
+// 解除账号或IP的登录锁定
+func (m *Manager) loginUnlock(c *wkhttp.Context) {
+	err := c.CheckLoginRoleIsSuperAdmin()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	typ := c.Param("type")
+	target := strings.TrimSpace(c.Param("target"))
+	if typ != loginLockTypeAccount && typ != loginLockTypeIP {
+		c.ResponseError(errors.New("锁定类型不正确！"))
+		return
+	}
+	if target == "" {
+		c.ResponseError(errors.New("锁定目标不能为空！"))
+		return
+	}
+	err = m.loginLockService.unlock(typ, target)
+	if err != nil {
+		m.Error("解除登录锁定失败！", zap.Error(err))
+		c.ResponseError(errors.New("解除登录锁定失败！"))
+		return
+	}
+	m.Info("解除登录锁定", zap.String("operator", c.GetLoginUID()), zap.String("type", typ), zap.String("target", target))
+	c.ResponseOK()
+}
+
+type managerLoginLockResp struct {
+	Type     string `json:"type"`      // 锁定类型 account.账号 ip.IP
+	Target   string `json:"target"`    // 锁定目标（账号为uid）
+	Name     string `json:"name"`      // 用户名字（仅账号锁定）
+	Username string `json:"username"`  // 登录账号（仅账号锁定）
+	UnlockAt string `json:"unlock_at"` // 解锁时间
+}
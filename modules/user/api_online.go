@@ -28,6 +28,16 @@ func (u *User) pcQuit(c *wkhttp.Context) {
 		return
 	}
 
+	// web和pc的token失效并删除会话
+	for _, flag := range []config.DeviceFlag{config.Web, config.PC} {
+		err = u.sessionService.revokeWithDeviceFlag(c.GetLoginUID(), flag)
+		if err != nil {
+			u.Error("撤销登录会话失败！", zap.Error(err))
+			c.ResponseError(errors.New("撤销登录会话失败！"))
+			return
+		}
+	}
+
 	err = u.ctx.SendCMD(config.MsgCMDReq{
 		NoPersist:   true,
 		ChannelID:   c.GetLoginUID(),
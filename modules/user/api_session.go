@@ -0,0 +1,92 @@
+package user
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// 我的登录会话列表
+func (u *User) sessionList(c *wkhttp.Context) {
+	sessions, err := u.sessionService.list(c.GetLoginUID())
+	if err != nil {
+		u.Error("查询登录会话失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询登录会话失败！"))
+		return
+	}
+	currentSessionID := sessionIDWithToken(c.GetHeader("token"))
+	resps := make([]*sessionResp, 0, len(sessions))
+	for _, session := range sessions {
+		resps = append(resps, newSessionResp(session, currentSessionID))
+	}
+	c.Response(resps)
+}
+
+// 撤销某个登录会话
+func (u *User) sessionRevoke(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	sessionID := c.Param("session_id")
+	session, err := u.sessionService.sessionDB.queryWithUIDAndSessionID(loginUID, sessionID)
+	if err != nil {
+		u.Error("查询登录会话失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询登录会话失败！"))
+		return
+	}
+	if session == nil {
+		c.ResponseError(errors.New("登录会话不存在！"))
+		return
+	}
+	err = u.sessionService.revoke(session)
+	if err != nil {
+		u.Error("撤销登录会话失败！", zap.Error(err))
+		c.ResponseError(errors.New("撤销登录会话失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 撤销除当前会话外的所有登录会话
+func (u *User) sessionRevokeOthers(c *wkhttp.Context) {
+	_, err := u.sessionService.revokeAll(c.GetLoginUID(), sessionIDWithToken(c.GetHeader("token")))
+	if err != nil {
+		u.Error("撤销其他登录会话失败！", zap.Error(err))
+		c.ResponseError(errors.New("撤销其他登录会话失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+type sessionResp struct {
+	SessionID   string `json:"session_id"`   // 会话ID
+	DeviceFlag  int    `json:"device_flag"`  // 设备标记 0.app 1.web 2.pc
+	DeviceID    string `json:"device_id"`    // 设备ID
+	DeviceName  string `json:"device_name"`  // 设备名称
+	DeviceModel string `json:"device_model"` // 设备型号
+	IP          string `json:"ip"`           // 最后访问的IP
+	UserAgent   string `json:"user_agent"`   // 登录时的User-Agent
+	LastSeen    string `json:"last_seen"`    // 最后活跃时间
+	CreatedAt   string `json:"created_at"`   // 登录时间
+	Current     int    `json:"current"`      // 是否是当前会话
+}
+
+func newSessionResp(m *sessionModel, currentSessionID string) *sessionResp {
+	var current int
+	if m.SessionID == currentSessionID {
+		current = 1
+	}
+	return &sessionResp{
+		SessionID:   m.SessionID,
+		DeviceFlag:  m.DeviceFlag,
+		DeviceID:    m.DeviceID,
+		DeviceName:  m.DeviceName,
+		DeviceModel: m.DeviceModel,
+		IP:          m.IP,
+		UserAgent:   m.UserAgent,
+		LastSeen:    util.ToyyyyMMddHHmm(time.Unix(m.LastSeenAt, 0)),
+		CreatedAt:   m.CreatedAt.String(),
+		Current:     current,
+	}
+}
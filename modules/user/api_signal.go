@@ -0,0 +1,495 @@
+package user
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gocraft/dbr/v2"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/common"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	signalPrekeyLowThreshold    = 10                 // 一次性公钥少于此数量时通知用户补充
+	signalPrekeyMaxCount        = 500                // 每个用户最多保存的一次性公钥数量
+	signalPrekeyUploadMaxCount  = 100                // 单次最多上传的一次性公钥数量
+	signalSignedPrekeyRotation  = time.Hour * 24 * 7 // 签名prekey的轮换周期
+	signalPrekeyLowNotifyExpire = time.Minute * 10   // 一次性公钥不足的通知间隔
+	signalBundleConsumeExpire   = time.Minute        // 同一用户在此时间内最多消耗对方一个一次性公钥
+	signalTargetConsumeMax      = 20                 // 每个用户的一次性公钥在统计周期内最多被消耗的数量（所有请求者合计）
+	signalTargetConsumeExpire   = time.Hour          // 按被获取用户统计消耗数量的周期
+	signalKeyMaxLength          = 1024               // 公钥、签名base64后的最大长度
+)
+
+// 上传signal身份公钥、签名prekey和一次性公钥
+func (u *User) signalKeysUpload(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req signalKeysReq
+	if err := c.BindJSON(&req); err != nil {
+		u.Error(common.ErrData.Error(), zap.Error(err))
+		c.ResponseError(common.ErrData)
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	tx, err := u.ctx.DB().Begin()
+	if err != nil {
+		u.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	oldIdentity, err := u.identitieDB.queryWithUIDForUpdateTx(loginUID, tx)
+	if err != nil {
+		tx.Rollback()
+		u.Error("查询signal身份失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询signal身份失败！"))
+		return
+	}
+	identityChanged := oldIdentity != nil && oldIdentity.IdentityKey != req.IdentityKey
+	if !identityChanged && len(req.OnetimePrekeys) > 0 { // 身份不变时一次性公钥是追加的，同样受数量限制
+		count, err := u.onetimePrekeysDB.queryCountTx(loginUID, tx)
+		if err != nil {
+			tx.Rollback()
+			u.Error("查询一次性公钥数量失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询一次性公钥数量失败！"))
+			return
+		}
+		if count+len(req.OnetimePrekeys) > signalPrekeyMaxCount {
+			tx.Rollback()
+			c.ResponseError(fmt.Errorf("一次性公钥最多保存%d个！", signalPrekeyMaxCount))
+			return
+		}
+	}
+	err = u.identitieDB.saveOrUpdateTx(&identitiesModel{
+		UID:             loginUID,
+		RegistrationID:  req.RegistrationID,
+		IdentityKey:     req.IdentityKey,
+		SignedPrekeyID:  req.SignedPrekeyID,
+		SignedPubkey:    req.SignedPubkey,
+		SignedSignature: req.SignedSignature,
+	}, tx)
+	if err != nil {
+		tx.Rollback()
+		u.Error("保存signal身份失败！", zap.Error(err))
+		c.ResponseError(errors.New("保存signal身份失败！"))
+		return
+	}
+	if identityChanged { // 旧身份下的一次性公钥已无法使用
+		err = u.onetimePrekeysDB.deleteWithUIDTx(loginUID, tx)
+		if err != nil {
+			tx.Rollback()
+			u.Error("删除一次性公钥失败！", zap.Error(err))
+			c.ResponseError(errors.New("删除一次性公钥失败！"))
+			return
+		}
+	}
+	err = u.insertOnetimePrekeysTx(loginUID, req.OnetimePrekeys, tx)
+	if err != nil {
+		tx.Rollback()
+		u.Error("保存一次性公钥失败！", zap.Error(err))
+		c.ResponseError(errors.New("保存一次性公钥失败！"))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		u.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	if identityChanged {
+		u.sendSignalIdentityChanged(loginUID)
+	}
+	c.ResponseOK()
+}
+
+// 轮换签名prekey
+func (u *User) signalSignedPrekeyUpdate(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req signalSignedPrekeyReq
+	if err := c.BindJSON(&req); err != nil {
+		u.Error(common.ErrData.Error(), zap.Error(err))
+		c.ResponseError(common.ErrData)
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	affected, err := u.identitieDB.updateSignedPrekey(loginUID, req.SignedPrekeyID, req.SignedPubkey, req.SignedSignature)
+	if err != nil {
+		u.Error("轮换签名prekey失败！", zap.Error(err))
+		c.ResponseError(errors.New("轮换签名prekey失败！"))
+		return
+	}
+	if affected == 0 {
+		c.ResponseError(errors.New("请先上传signal身份公钥！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 补充一次性公钥
+func (u *User) signalOnetimePrekeysUpload(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	var req struct {
+		OnetimePrekeys []*signalPrekeyReq `json:"onetime_prekeys"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		u.Error(common.ErrData.Error(), zap.Error(err))
+		c.ResponseError(common.ErrData)
+		return
+	}
+	if len(req.OnetimePrekeys) == 0 {
+		c.ResponseError(errors.New("一次性公钥不能为空！"))
+		return
+	}
+	if err := checkSignalPrekeys(req.OnetimePrekeys); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	tx, err := u.ctx.DB().Begin()
+	if err != nil {
+		u.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	identity, err := u.identitieDB.queryWithUIDForUpdateTx(loginUID, tx)
+	if err != nil {
+		tx.Rollback()
+		u.Error("查询signal身份失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询signal身份失败！"))
+		return
+	}
+	if identity == nil {
+		tx.Rollback()
+		c.ResponseError(errors.New("请先上传signal身份公钥！"))
+		return
+	}
+	count, err := u.onetimePrekeysDB.queryCountTx(loginUID, tx)
+	if err != nil {
+		tx.Rollback()
+		u.Error("查询一次性公钥数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询一次性公钥数量失败！"))
+		return
+	}
+	if count+len(req.OnetimePrekeys) > signalPrekeyMaxCount {
+		tx.Rollback()
+		c.ResponseError(fmt.Errorf("一次性公钥最多保存%d个！", signalPrekeyMaxCount))
+		return
+	}
+	err = u.insertOnetimePrekeysTx(loginUID, req.OnetimePrekeys, tx)
+	if err != nil {
+		tx.Rollback()
+		u.Error("保存一次性公钥失败！", zap.Error(err))
+		c.ResponseError(errors.New("保存一次性公钥失败！"))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		u.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 我的signal密钥状态
+func (u *User) signalKeysStatus(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	identity, err := u.identitieDB.queryWithUID(loginUID)
+	if err != nil {
+		u.Error("查询signal身份失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询signal身份失败！"))
+		return
+	}
+	count, err := u.onetimePrekeysDB.queryCount(loginUID)
+	if err != nil {
+		u.Error("查询一次性公钥数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询一次性公钥数量失败！"))
+		return
+	}
+	resp := &signalKeysStatusResp{
+		OnetimePrekeyCount: count,
+		PrekeyLow:          count < signalPrekeyLowThreshold,
+	}
+	if identity != nil {
+		resp.Registered = true
+		resp.SignedPrekeyID = identity.SignedPrekeyID
+		resp.SignedPrekeyRotate = signedPrekeyNeedRotate(identity)
+	}
+	c.Response(resp)
+}
+
+// 获取用户的prekey bundle（同时消耗对方一个一次性公钥）
+func (u *User) signalPrekeyBundle(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	uid := c.Param("uid")
+	if uid == loginUID {
+		c.ResponseError(errors.New("不能获取自己的prekey！"))
+		return
+	}
+	blacklist, err := u.friendDB.existBlacklist(loginUID, uid)
+	if err != nil {
+		u.Error("查询黑名单失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询黑名单失败！"))
+		return
+	}
+	if blacklist {
+		c.ResponseError(errors.New("已被拉黑或已拉黑对方！"))
+		return
+	}
+	identity, err := u.identitieDB.queryWithUID(uid)
+	if err != nil {
+		u.Error("查询signal身份失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询signal身份失败！"))
+		return
+	}
+	if identity == nil {
+		c.ResponseError(errors.New("对方未开启加密聊天！"))
+		return
+	}
+	resp := &signalBundleResp{
+		UID:             uid,
+		RegistrationID:  identity.RegistrationID,
+		IdentityKey:     identity.IdentityKey,
+		SignedPrekeyID:  identity.SignedPrekeyID,
+		SignedPubkey:    identity.SignedPubkey,
+		SignedSignature: identity.SignedSignature,
+	}
+	if u.allowConsumeOnetimePrekey(loginUID, uid) {
+		prekey, err := u.onetimePrekeysDB.consumeMinWithUID(uid)
+		if err != nil {
+			u.Error("获取一次性公钥失败！", zap.Error(err))
+			c.ResponseError(errors.New("获取一次性公钥失败！"))
+			return
+		}
+		if prekey != nil {
+			resp.OnetimePrekey = &signalPrekeyResp{
+				KeyID:  prekey.KeyID,
+				Pubkey: prekey.Pubkey,
+			}
+		}
+		u.checkSignalPrekeyLow(identity)
+	}
+	c.Response(resp)
+}
+
+// 限制一次性公钥的消耗（超出后bundle中只有签名prekey，X3DH仍可进行）
+// 同一用户短时间内不能反复消耗对方的一次性公钥，被获取的用户也有总的消耗上限，防止多个账号合力耗尽对方的一次性公钥
+func (u *User) allowConsumeOnetimePrekey(uid string, toUID string) bool {
+	if !u.incrSignalConsumeCount(fmt.Sprintf("signal:prekeyConsume:%s:%s", uid, toUID), signalBundleConsumeExpire, 1) {
+		return false
+	}
+	return u.incrSignalConsumeCount(fmt.Sprintf("signal:prekeyConsumeTarget:%s", toUID), signalTargetConsumeExpire, signalTargetConsumeMax)
+}
+
+// incrSignalConsumeCount 先累加消耗次数再判断是否超出上限，并发请求也不会超出
+func (u *User) incrSignalConsumeCount(key string, expire time.Duration, max int64) bool {
+	count, err := u.ctx.GetRedisConn().Incr(key)
+	if err != nil {
+		u.Warn("记录一次性公钥消耗次数失败！", zap.Error(err))
+		return false // 不确定时只返回签名prekey
+	}
+	if count == 1 {
+		if err := u.ctx.GetRedisConn().Expire(key, expire); err != nil {
+			u.Warn("设置一次性公钥消耗次数过期时间失败！", zap.Error(err))
+		}
+	}
+	return count <= max
+}
+
+// 一次性公钥不足或签名prekey需要轮换时通知用户（有间隔限制）
+func (u *User) checkSignalPrekeyLow(identity *identitiesModel) {
+	count, err := u.onetimePrekeysDB.queryCount(identity.UID)
+	if err != nil {
+		u.Warn("查询一次性公钥数量失败！", zap.Error(err))
+		return
+	}
+	rotate := signedPrekeyNeedRotate(identity)
+	if count >= signalPrekeyLowThreshold && !rotate {
+		return
+	}
+	key := fmt.Sprintf("signal:prekeyLowNotify:%s", identity.UID)
+	notified, err := u.ctx.GetRedisConn().GetString(key)
+	if err != nil {
+		u.Warn("查询一次性公钥不足通知记录失败！", zap.Error(err))
+		return
+	}
+	if notified != "" {
+		return
+	}
+	err = u.ctx.SendCMD(config.MsgCMDReq{
+		NoPersist:   true,
+		CMD:         CMDSignalPrekeyLow,
+		Subscribers: []string{identity.UID},
+		Param: map[string]interface{}{
+			"onetime_prekey_count": count,
+			"signed_prekey_rotate": rotate,
+		},
+	})
+	if err != nil {
+		u.Warn("发送一次性公钥不足命令失败！", zap.Error(err))
+		return
+	}
+	err = u.ctx.GetRedisConn().SetAndExpire(key, "1", signalPrekeyLowNotifyExpire)
+	if err != nil {
+		u.Warn("保存一次性公钥不足通知记录失败！", zap.Error(err))
+	}
+}
+
+// 通知好友我的signal身份公钥已变更
+func (u *User) sendSignalIdentityChanged(uid string) {
+	friends, err := u.friendDB.QueryFriends(uid)
+	if err != nil {
+		u.Error("查询用户好友失败！", zap.Error(err))
+		return
+	}
+	uids := make([]string, 0, len(friends)+1)
+	uids = append(uids, uid) // 同步给自己的其他设备
+	for _, friend := range friends {
+		uids = append(uids, friend.ToUID)
+	}
+	err = u.ctx.SendCMD(config.MsgCMDReq{
+		CMD:         CMDSignalIdentityChanged,
+		Subscribers: uids,
+		Param: map[string]interface{}{
+			"uid": uid,
+		},
+	})
+	if err != nil {
+		u.Error("发送signal身份变更命令失败！", zap.Error(err))
+	}
+}
+
+func (u *User) insertOnetimePrekeysTx(uid string, prekeys []*signalPrekeyReq, tx *dbr.Tx) error {
+	for _, prekey := range prekeys {
+		err := u.onetimePrekeysDB.insertIgnoreTx(&onetimePrekeysModel{
+			UID:    uid,
+			KeyID:  prekey.KeyID,
+			Pubkey: prekey.Pubkey,
+		}, tx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func signedPrekeyNeedRotate(identity *identitiesModel) bool {
+	return time.Since(time.Time(identity.UpdatedAt)) > signalSignedPrekeyRotation
+}
+
+type signalKeysReq struct {
+	RegistrationID uint32 `json:"registration_id"` // 注册ID
+	IdentityKey    string `json:"identity_key"`    // 身份公钥（base64）
+	signalSignedPrekeyReq
+	OnetimePrekeys []*signalPrekeyReq `json:"onetime_prekeys"` // 一次性公钥
+}
+
+func (r signalKeysReq) check() error {
+	if r.RegistrationID == 0 {
+		return errors.New("注册ID不能为空！")
+	}
+	if err := checkSignalKey("身份公钥", r.IdentityKey); err != nil {
+		return err
+	}
+	if err := r.signalSignedPrekeyReq.check(); err != nil {
+		return err
+	}
+	return checkSignalPrekeys(r.OnetimePrekeys)
+}
+
+type signalSignedPrekeyReq struct {
+	SignedPrekeyID  int    `json:"signed_prekey_id"` // 签名prekey的ID
+	SignedPubkey    string `json:"signed_pubkey"`    // 签名prekey的公钥（base64）
+	SignedSignature string `json:"signed_signature"` // 身份私钥对签名prekey的签名（base64）
+}
+
+func (r signalSignedPrekeyReq) check() error {
+	if r.SignedPrekeyID <= 0 {
+		return errors.New("签名prekey的ID有误！")
+	}
+	if err := checkSignalKey("签名prekey", r.SignedPubkey); err != nil {
+		return err
+	}
+	return checkSignalKey("签名prekey的签名", r.SignedSignature)
+}
+
+type signalPrekeyReq struct {
+	KeyID  int    `json:"key_id"`
+	Pubkey string `json:"pubkey"` // 公钥（base64）
+}
+
+func checkSignalPrekeys(prekeys []*signalPrekeyReq) error {
+	if len(prekeys) > signalPrekeyUploadMaxCount {
+		return fmt.Errorf("单次最多上传%d个一次性公钥！", signalPrekeyUploadMaxCount)
+	}
+	keyIDs := map[int]bool{}
+	for _, prekey := range prekeys {
+		if prekey == nil || prekey.KeyID <= 0 {
+			return errors.New("一次性公钥的ID有误！")
+		}
+		if keyIDs[prekey.KeyID] {
+			return fmt.Errorf("一次性公钥的ID[%d]重复！", prekey.KeyID)
+		}
+		keyIDs[prekey.KeyID] = true
+		if err := checkSignalKey("一次性公钥", prekey.Pubkey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkSignalKey(name string, key string) error {
+	if key == "" {
+		return fmt.Errorf("%s不能为空！", name)
+	}
+	if len(key) > signalKeyMaxLength {
+		return fmt.Errorf("%s过长！", name)
+	}
+	if _, err := base64.StdEncoding.DecodeString(key); err != nil {
+		return fmt.Errorf("%s必须是base64编码！", name)
+	}
+	return nil
+}
+
+type signalKeysStatusResp struct {
+	Registered         bool `json:"registered"`           // 是否已上传身份公钥
+	SignedPrekeyID     int  `json:"signed_prekey_id"`     // 当前签名prekey的ID
+	SignedPrekeyRotate bool `json:"signed_prekey_rotate"` // 签名prekey是否需要轮换
+	OnetimePrekeyCount int  `json:"onetime_prekey_count"` // 剩余一次性公钥数量
+	PrekeyLow          bool `json:"prekey_low"`           // 一次性公钥是否需要补充
+}
+
+type signalPrekeyResp struct {
+	KeyID  int    `json:"key_id"`
+	Pubkey string `json:"pubkey"`
+}
+
+type signalBundleResp struct {
+	UID             string            `json:"uid"`
+	RegistrationID  uint32            `json:"registration_id"`
+	IdentityKey     string            `json:"identity_key"`
+	SignedPrekeyID  int               `json:"signed_prekey_id"`
+	SignedPubkey    string            `json:"signed_pubkey"`
+	SignedSignature string            `json:"signed_signature"`
+	OnetimePrekey   *signalPrekeyResp `json:"onetime_prekey"` // 一次性公钥，已用完时为空
+}
@@ -0,0 +1,45 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignalKeysReqCheck(t *testing.T) {
+	key := "BQIDBA=="
+	req := signalKeysReq{
+		RegistrationID: 1,
+		IdentityKey:    key,
+		signalSignedPrekeyReq: signalSignedPrekeyReq{
+			SignedPrekeyID:  1,
+			SignedPubkey:    key,
+			SignedSignature: key,
+		},
+		OnetimePrekeys: []*signalPrekeyReq{{KeyID: 1, Pubkey: key}, {KeyID: 2, Pubkey: key}},
+	}
+	assert.NoError(t, req.check())
+
+	bad := req
+	bad.RegistrationID = 0
+	assert.Error(t, bad.check())
+
+	bad = req
+	bad.IdentityKey = "not base64!"
+	assert.Error(t, bad.check())
+
+	bad = req
+	bad.SignedPrekeyID = 0
+	assert.Error(t, bad.check())
+
+	bad = req
+	bad.OnetimePrekeys = []*signalPrekeyReq{{KeyID: 1, Pubkey: key}, {KeyID: 1, Pubkey: key}}
+	assert.Error(t, bad.check())
+
+	prekeys := make([]*signalPrekeyReq, 0, signalPrekeyUploadMaxCount+1)
+	for i := 1; i <= signalPrekeyUploadMaxCount+1; i++ {
+		prekeys = append(prekeys, &signalPrekeyReq{KeyID: i, Pubkey: key})
+	}
+	assert.Error(t, checkSignalPrekeys(prekeys))
+	assert.NoError(t, checkSignalPrekeys(prekeys[:signalPrekeyUploadMaxCount]))
+}
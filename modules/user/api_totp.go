@@ -0,0 +1,571 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/totp"
+	"github.com/opentracing/opentracing-go"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	totpLoginCachePrefix      = "totplogin:"       // 待两步验证的登录
+	totpVerifyFailCachePrefix = "totpverify:fail:" // 已登录用户校验失败次数
+	totpLoginExpire           = time.Minute * 5    // 登录挑战有效期
+	totpLoginMaxFail          = 5                  // 登录两步验证每个账号最多可连续错误的次数，超过后锁定账号
+	totpRecoveryCodeCount     = 10                 // 恢复码数量
+	totpRecoveryCodeLen       = 10                 // 恢复码长度（不含分隔符）
+	totpRecoveryAlphabet      = "abcdefghjkmnpqrstuvwxyz23456789"
+
+	// 登录挑战的状态码
+	totpLoginStatus = 111
+)
+
+// 登录方式（两步验证通过后按原登录方式返回）
+const (
+	totpLoginKindApp      = "login"
+	totpLoginKindUsername = "usernamelogin"
+	totpLoginKindManager  = "manager"
+	totpLoginKindDevice   = "devicecheck" // 异常登录验证手机号或邮箱之后
+)
+
+type totpLogin struct {
+	UID    string     `json:"uid"`
+	Kind   string     `json:"kind"`
+	Flag   int        `json:"flag"`
+	Device *deviceReq `json:"device,omitempty"`
+}
+
+// 两步验证状态
+func (u *User) totpStatus(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	model, err := u.totpDB.queryWithUID(loginUID)
+	if err != nil {
+		u.Error("查询两步验证信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询两步验证信息失败！"))
+		return
+	}
+	enabled := 0
+	recoveryCodeCount := 0
+	if model != nil && model.Status == totpStatusEnabled {
+		enabled = 1
+		recoveryCodeCount, err = u.totpDB.queryRecoveryCodeCount(loginUID)
+		if err != nil {
+			u.Error("查询恢复码数量失败！", zap.Error(err))
+			c.ResponseError(errors.New("查询恢复码数量失败！"))
+			return
+		}
+	}
+	c.Response(map[string]interface{}{
+		"enabled":             enabled,
+		"recovery_code_count": recoveryCodeCount,
+	})
+}
+
+// 生成两步验证密钥（客户端用返回的uri生成二维码给验证器app扫描）
+func (u *User) totpSetup(c *wkhttp.Context) {
+	loginUID := c.GetLoginUID()
+	userInfo, err := u.db.QueryByUID(loginUID)
+	if err != nil {
+		u.Error("查询用户信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息失败！"))
+		return
+	}
+	if userInfo == nil {
+		c.ResponseError(errors.New("用户不存在！"))
+		return
+	}
+	model, err := u.totpDB.queryWithUID(loginUID)
+	if err != nil {
+		u.Error("查询两步验证信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询两步验证信息失败！"))
+		return
+	}
+	if model != nil && model.Status == totpStatusEnabled {
+		c.ResponseError(errors.New("已开启两步验证，请先关闭！"))
+		return
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		u.Error("生成两步验证密钥失败！", zap.Error(err))
+		c.ResponseError(errors.New("生成两步验证密钥失败！"))
+		return
+	}
+	err = u.totpDB.savePending(loginUID, secret)
+	if err != nil {
+		u.Error("保存两步验证密钥失败！", zap.Error(err))
+		c.ResponseError(errors.New("保存两步验证密钥失败！"))
+		return
+	}
+	account := userInfo.Username
+	if account == "" {
+		account = userInfo.ShortNo
+	}
+	c.Response(map[string]interface{}{
+		"secret": secret,
+		"uri":    totp.KeyURI(u.ctx.GetConfig().AppName, account, secret),
+	})
+}
+
+// 输入验证器app上的验证码确认开启两步验证，返回恢复码（只显示这一次）
+func (u *User) totpEnable(c *wkhttp.Context) {
+	var req totpCodeReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	if strings.TrimSpace(req.Code) == "" {
+		c.ResponseError(errors.New("验证码不能为空！"))
+		return
+	}
+	loginUID := c.GetLoginUID()
+	model, err := u.totpDB.queryWithUID(loginUID)
+	if err != nil {
+		u.Error("查询两步验证信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询两步验证信息失败！"))
+		return
+	}
+	if model == nil {
+		c.ResponseError(errors.New("请先生成两步验证密钥！"))
+		return
+	}
+	if model.Status == totpStatusEnabled {
+		c.ResponseError(errors.New("已开启两步验证！"))
+		return
+	}
+	counter, ok := totp.Validate(model.Secret, req.Code, time.Now())
+	if !ok {
+		c.ResponseError(errors.New("验证码不正确！"))
+		return
+	}
+	codes, codeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		u.Error("生成恢复码失败！", zap.Error(err))
+		c.ResponseError(errors.New("生成恢复码失败！"))
+		return
+	}
+	tx, err := u.ctx.DB().Begin()
+	if err != nil {
+		u.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	rows, err := u.totpDB.enableTx(loginUID, model.Secret, counter, tx)
+	if err != nil {
+		tx.Rollback()
+		u.Error("开启两步验证失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启两步验证失败！"))
+		return
+	}
+	if rows == 0 { // 密钥已被重新生成或已开启
+		tx.Rollback()
+		c.ResponseError(errors.New("两步验证密钥已变更，请重新设置！"))
+		return
+	}
+	err = u.totpDB.deleteRecoveryCodesTx(loginUID, tx)
+	if err == nil {
+		err = u.totpDB.insertRecoveryCodesTx(loginUID, codeHashes, tx)
+	}
+	if err != nil {
+		tx.Rollback()
+		u.Error("保存恢复码失败！", zap.Error(err))
+		c.ResponseError(errors.New("保存恢复码失败！"))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		u.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	c.Response(map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// 关闭两步验证（需要验证码或恢复码）
+func (u *User) totpDisable(c *wkhttp.Context) {
+	var req totpCodeReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	loginUID := c.GetLoginUID()
+	err := u.verifyTOTPWithLimit(loginUID, req.Code)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	err = resetTOTP(u.ctx, u.totpDB, loginUID)
+	if err != nil {
+		u.Error("关闭两步验证失败！", zap.Error(err))
+		c.ResponseError(errors.New("关闭两步验证失败！"))
+		return
+	}
+	c.ResponseOK()
+}
+
+// 重新生成恢复码（旧的恢复码全部失效）
+func (u *User) totpRecoveryCodes(c *wkhttp.Context) {
+	var req totpCodeReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	loginUID := c.GetLoginUID()
+	err := u.verifyTOTPWithLimit(loginUID, req.Code)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	codes, codeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		u.Error("生成恢复码失败！", zap.Error(err))
+		c.ResponseError(errors.New("生成恢复码失败！"))
+		return
+	}
+	tx, err := u.ctx.DB().Begin()
+	if err != nil {
+		u.Error("开启事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("开启事务失败！"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	err = u.totpDB.deleteRecoveryCodesTx(loginUID, tx)
+	if err == nil {
+		err = u.totpDB.insertRecoveryCodesTx(loginUID, codeHashes, tx)
+	}
+	if err != nil {
+		tx.Rollback()
+		u.Error("保存恢复码失败！", zap.Error(err))
+		c.ResponseError(errors.New("保存恢复码失败！"))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		u.Error("提交事务失败！", zap.Error(err))
+		c.ResponseError(errors.New("提交事务失败！"))
+		return
+	}
+	c.Response(map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// 登录两步验证
+func (u *User) loginTOTP(c *wkhttp.Context) {
+	var req totpLoginReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	if err := req.check(); err != nil {
+		c.ResponseError(err)
+		return
+	}
+	login, err := verifyTOTPLogin(u.ctx, u.totpDB, u.loginLockService, req.TOTPToken, req.Code)
+	if err != nil {
+		u.Warn("登录两步验证失败", zap.Error(err))
+		c.ResponseError(err)
+		return
+	}
+	if login.Kind != totpLoginKindApp && login.Kind != totpLoginKindUsername && login.Kind != totpLoginKindDevice {
+		c.ResponseError(errors.New("登录已过期，请重新登录"))
+		return
+	}
+	userInfo, err := u.db.QueryByUID(login.UID)
+	if err != nil {
+		u.Error("查询用户信息失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询用户信息失败！"))
+		return
+	}
+	if userInfo == nil || userInfo.IsDestroy == 1 {
+		c.ResponseError(errors.New("用户不存在"))
+		return
+	}
+	loginSpan := u.ctx.Tracer().StartSpan(
+		"loginTOTP",
+		opentracing.ChildOf(c.GetSpanContext()),
+	)
+	defer loginSpan.Finish()
+	loginSpanCtx := u.ctx.Tracer().ContextWithSpan(context.Background(), loginSpan)
+	if login.Kind == totpLoginKindDevice {
+		u.execLoginWithDeviceAndRespose(userInfo, login.Device, loginSpanCtx, c)
+		return
+	}
+	if login.Kind == totpLoginKindUsername {
+		u.execUsernameLoginAndRespose(userInfo, config.DeviceFlag(login.Flag), login.Device, loginSpanCtx, c)
+		return
+	}
+	u.execLoginAndRespose(userInfo, config.DeviceFlag(login.Flag), login.Device, loginSpanCtx, c)
+}
+
+// 已登录用户校验验证码或恢复码（限制错误次数，防止token泄露后被暴力破解）
+func (u *User) verifyTOTPWithLimit(uid string, code string) error {
+	failKey := fmt.Sprintf("%s%s", totpVerifyFailCachePrefix, uid)
+	failCountStr, err := u.ctx.GetRedisConn().GetString(failKey)
+	if err != nil {
+		u.Error("获取两步验证错误次数失败！", zap.Error(err))
+		return errors.New("校验两步验证失败！")
+	}
+	failCount, _ := strconv.Atoi(failCountStr)
+	if failCount >= totpLoginMaxFail {
+		return errors.New("验证码错误次数过多，请稍后再试")
+	}
+	ok, err := verifyTOTP(u.totpDB, uid, code)
+	if err != nil {
+		u.Error("校验两步验证失败！", zap.Error(err))
+		return errors.New("校验两步验证失败！")
+	}
+	if ok {
+		u.ctx.GetRedisConn().Del(failKey)
+		return nil
+	}
+	count, err := u.ctx.GetRedisConn().Incr(failKey)
+	if err == nil && count == 1 {
+		u.ctx.GetRedisConn().Expire(failKey, totpLoginExpire)
+	}
+	return errors.New("验证码不正确！")
+}
+
+// 开启了两步验证的用户在新设备上登录时返回登录挑战，返回true表示已响应客户端
+func (u *User) responseTOTPChallengeIfNeed(c *wkhttp.Context, userInfo *Model, flag config.DeviceFlag, device *deviceReq, kind string) bool {
+	token, err := u.createTOTPLoginIfNeed(userInfo.UID, flag, device, kind)
+	if err != nil {
+		u.Error("创建登录两步验证失败！", zap.Error(err))
+		c.ResponseError(errors.New("创建登录两步验证失败！"))
+		return true
+	}
+	if token == "" {
+		return false
+	}
+	responseTOTPChallenge(c, userInfo.UID, token)
+	return true
+}
+
+// createTOTPLoginIfNeed 需要两步验证时创建登录挑战并返回token，不需要时返回空（没有设备信息的登录每次都需要验证）
+func (u *User) createTOTPLoginIfNeed(uid string, flag config.DeviceFlag, device *deviceReq, kind string) (string, error) {
+	need, err := u.needTOTP(uid, device)
+	if err != nil || !need {
+		return "", err
+	}
+	return createTOTPLogin(u.ctx, &totpLogin{
+		UID:    uid,
+		Kind:   kind,
+		Flag:   int(flag),
+		Device: device,
+	})
+}
+
+// needTOTP 开启了两步验证并且不是在已登录过的设备上登录
+func (u *User) needTOTP(uid string, device *deviceReq) (bool, error) {
+	model, err := u.totpDB.queryWithUID(uid)
+	if err != nil {
+		return false, err
+	}
+	if model == nil || model.Status != totpStatusEnabled {
+		return false, nil
+	}
+	if device != nil && device.DeviceID != "" {
+		exist, err := u.deviceDB.existDeviceWithDeviceIDAndUID(device.DeviceID, uid)
+		if err != nil {
+			return false, err
+		}
+		if exist {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func responseTOTPChallenge(c *wkhttp.Context, uid string, token string) {
+	c.ResponseWithStatus(http.StatusBadRequest, map[string]interface{}{
+		"status":     totpLoginStatus,
+		"msg":        "需要两步验证！",
+		"uid":        uid,
+		"totp_token": token,
+	})
+}
+
+func createTOTPLogin(ctx *config.Context, login *totpLogin) (string, error) {
+	token := util.GenerUUID()
+	err := ctx.GetRedisConn().SetAndExpire(totpLoginCachePrefix+token, util.ToJson(login), totpLoginExpire)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// 校验登录挑战的验证码，成功后挑战失效
+// 错误次数按账号累计，达到上限后通过登录限制锁定账号，锁定期间所有挑战都无法通过
+func verifyTOTPLogin(ctx *config.Context, d *totpDB, lockService *loginLockService, token string, code string) (*totpLogin, error) {
+	cacheKey := totpLoginCachePrefix + token
+	loginJSON, err := ctx.GetRedisConn().GetString(cacheKey)
+	if err != nil {
+		return nil, err
+	}
+	if loginJSON == "" {
+		return nil, errors.New("登录已过期，请重新登录")
+	}
+	var login *totpLogin
+	if err := util.ReadJsonByByte([]byte(loginJSON), &login); err != nil || login == nil {
+		return nil, errors.New("登录已过期，请重新登录")
+	}
+	status, failCount, err := lockService.reserveTOTP(login.UID)
+	if err != nil {
+		return nil, err
+	}
+	if status.Locked {
+		ctx.GetRedisConn().Del(cacheKey)
+		return nil, totpLockError(status)
+	}
+	ok, err := verifyTOTP(d, login.UID, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		status, err = lockService.failTOTP(login.UID, failCount)
+		if err != nil {
+			return nil, err
+		}
+		if status.Locked {
+			ctx.GetRedisConn().Del(cacheKey)
+			return nil, totpLockError(status)
+		}
+		return nil, errors.New("验证码不正确！")
+	}
+	ctx.GetRedisConn().Del(cacheKey)
+	lockService.successTOTP(login.UID)
+	return login, nil
+}
+
+func totpLockError(status *loginLockStatus) error {
+	return fmt.Errorf("验证码错误次数过多，账号已被暂时锁定，请%d分钟后再试", int(math.Ceil(status.RetryAfter.Minutes())))
+}
+
+// verifyTOTP 校验验证器app上的验证码或恢复码（恢复码使用后失效）
+func verifyTOTP(d *totpDB, uid string, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return false, nil
+	}
+	model, err := d.queryWithUID(uid)
+	if err != nil {
+		return false, err
+	}
+	if model == nil || model.Status != totpStatusEnabled {
+		return false, nil
+	}
+	if len(code) == totp.Digits {
+		counter, ok := totp.Validate(model.Secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		rows, err := d.updateLastCounter(uid, counter)
+		if err != nil {
+			return false, err
+		}
+		return rows > 0, nil // 验证码已被使用过
+	}
+	return d.consumeRecoveryCode(uid, hashRecoveryCode(code))
+}
+
+// 关闭两步验证并删除恢复码
+func resetTOTP(ctx *config.Context, d *totpDB, uid string) error {
+	tx, err := ctx.DB().Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+	err = d.deleteWithUIDTx(uid, tx)
+	if err == nil {
+		err = d.deleteRecoveryCodesTx(uid, tx)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return nil
+}
+
+// generateRecoveryCodes 生成恢复码，返回明文（xxxxx-xxxxx）和对应的hash
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, totpRecoveryCodeCount)
+	codeHashes := make([]string, 0, totpRecoveryCodeCount)
+	max := big.NewInt(int64(len(totpRecoveryAlphabet)))
+	for len(codes) < totpRecoveryCodeCount {
+		code := make([]byte, totpRecoveryCodeLen)
+		for i := range code {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, nil, err
+			}
+			code[i] = totpRecoveryAlphabet[n.Int64()]
+		}
+		codeStr := fmt.Sprintf("%s-%s", code[:totpRecoveryCodeLen/2], code[totpRecoveryCodeLen/2:])
+		codes = append(codes, codeStr)
+		codeHashes = append(codeHashes, hashRecoveryCode(codeStr))
+	}
+	return codes, codeHashes, nil
+}
+
+// hashRecoveryCode 忽略大小写、空格和分隔符
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+type totpCodeReq struct {
+	Code string `json:"code"` // 验证器app上的验证码或恢复码
+}
+
+type totpLoginReq struct {
+	TOTPToken string `json:"totp_token"` // 登录时返回的两步验证token
+	Code      string `json:"code"`       // 验证器app上的验证码或恢复码
+}
+
+func (r totpLoginReq) check() error {
+	if strings.TrimSpace(r.TOTPToken) == "" {
+		return errors.New("两步验证token不能为空！")
+	}
+	if strings.TrimSpace(r.Code) == "" {
+		return errors.New("验证码不能为空！")
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package user
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, codeHashes, err := generateRecoveryCodes()
+	assert.NoError(t, err)
+	assert.Len(t, codes, totpRecoveryCodeCount)
+	assert.Len(t, codeHashes, totpRecoveryCodeCount)
+	for i, code := range codes {
+		assert.Len(t, code, totpRecoveryCodeLen+1)
+		assert.Equal(t, codeHashes[i], hashRecoveryCode(code))
+		// 忽略大小写和分隔符
+		assert.Equal(t, codeHashes[i], hashRecoveryCode(strings.ToUpper(strings.ReplaceAll(code, "-", " "))))
+	}
+}
+
+func TestTOTPLockError(t *testing.T) {
+	err := totpLockError(&loginLockStatus{Locked: true, LockType: loginLockTypeAccount, RetryAfter: time.Minute*14 + time.Second})
+	assert.EqualError(t, err, "验证码错误次数过多，账号已被暂时锁定，请15分钟后再试")
+}
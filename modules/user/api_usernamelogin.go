@@ -83,17 +83,33 @@ func (u *User) usernameLogin(c *wkhttp.Context) {
 		c.ResponseError(err)
 		return
 	}
+	publicIP := util.GetClientPublicIP(c.Request)
 	if userInfo == nil {
-		c.ResponseError(errors.New("该用户名不存在"))
+		if attempt, ok := u.reserveLoginAttempt(c, "", publicIP); ok {
+			u.responseLoginFail(c, attempt, errors.New("该用户名不存在"))
+		}
 		return
 	}
-
-	if util.MD5(util.MD5(req.Password)) != userInfo.Password {
-		c.ResponseError(errors.New("密码不正确！"))
+	attempt, ok := u.reserveLoginAttempt(c, userInfo.UID, publicIP)
+	if !ok {
+		return
+	}
+	if !verifyPassword(u.db, userInfo.UID, userInfo.Password, req.Password) {
+		u.responseLoginFail(c, attempt, errors.New("密码不正确！"))
+		return
+	}
+	u.loginLockSuccess(attempt)
+	if u.responseLoginRiskIfNeed(c, userInfo, config.DeviceFlag(req.Flag), req.Device) {
+		return
+	}
+	if u.responseTOTPChallengeIfNeed(c, userInfo, config.DeviceFlag(req.Flag), req.Device, totpLoginKindUsername) {
 		return
 	}
+	u.execUsernameLoginAndRespose(userInfo, config.DeviceFlag(req.Flag), req.Device, loginSpanCtx, c)
+}
 
-	result, err := u.execLogin(userInfo, config.DeviceFlag(req.Flag), req.Device, loginSpanCtx)
+func (u *User) execUsernameLoginAndRespose(userInfo *Model, flag config.DeviceFlag, device *deviceReq, loginSpanCtx context.Context, c *wkhttp.Context) {
+	result, err := u.execLogin(userInfo, flag, device, newSessionClient(c), loginSpanCtx)
 	if err != nil {
 		c.ResponseError(err)
 		return
@@ -143,8 +159,7 @@ func (u *User) registerWithUsername(username string, name string, password strin
 			panic(err)
 		}
 	}()
-	publicIP := util.GetClientPublicIP(c.Request)
-	result, err := u.createUserWithRespAndTx(registerSpanCtx, model, publicIP, nil, tx, func() error {
+	result, err := u.createUserWithRespAndTx(registerSpanCtx, model, newSessionClient(c), nil, tx, func() error {
 		err := tx.Commit()
 		if err != nil {
 			tx.Rollback()
@@ -231,8 +246,14 @@ func (u *User) resetPwdWithWeb3PublicKey(c *wkhttp.Context) {
 		return
 	}
 
+	pwd, err := hashPassword(req.Password)
+	if err != nil {
+		u.Error("计算密码哈希失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改用户密码错误"))
+		return
+	}
 	updateMap := map[string]interface{}{}
-	updateMap["password"] = util.MD5(util.MD5(req.Password))
+	updateMap["password"] = pwd
 	err = u.db.updateUser(updateMap, user.UID)
 	if err != nil {
 		u.Error("修改用户密码错误", zap.Error(err))
@@ -459,12 +480,17 @@ func (u *User) updatePwd(c *wkhttp.Context) {
 		c.ResponseError(errors.New("该用户不存在"))
 		return
 	}
-	oldPwd := util.MD5(util.MD5(req.Password))
-	if oldPwd != userInfo.Password {
+	if !matchPassword(userInfo.Password, req.Password) {
 		c.ResponseError(errors.New("旧密码错误"))
 		return
 	}
-	err = u.db.UpdateUsersWithField("password", util.MD5(util.MD5(req.NewPassword)), userInfo.UID)
+	newPwd, err := hashPassword(req.NewPassword)
+	if err != nil {
+		u.Error("计算密码哈希失败！", zap.Error(err))
+		c.ResponseError(errors.New("修改登录密码错误"))
+		return
+	}
+	err = u.db.UpdateUsersWithField("password", newPwd, userInfo.UID)
 	if err != nil {
 		u.Error("修改登录密码错误", zap.Error(err))
 		c.ResponseError(errors.New("修改登录密码错误"))
@@ -16,6 +16,15 @@ const (
 	// StatusEnable 启用
 	StatusEnable
 )
+const (
+	// CMDUserSettingUpdate 我的设置更新（同步给我的其他设备）
+	CMDUserSettingUpdate = "userSettingUpdate"
+	// CMDSignalIdentityChanged 用户的signal身份公钥已变更（发给好友，需重建会话）
+	CMDSignalIdentityChanged = "signalIdentityChanged"
+	// CMDSignalPrekeyLow 一次性公钥不足或签名prekey需要轮换（发给自己，需补充上传）
+	CMDSignalPrekeyLow = "signalPrekeyLow"
+)
+
 const (
 	// CacheKeyFriends 好友key
 	CacheKeyFriends string = "lm-friends:"
@@ -58,6 +58,13 @@ func (d *DB) QueryByPhone(zone string, phone string) (*Model, error) {
 	return model, err
 }
 
+// QueryByEmail 通过邮箱查询用户（邮箱统一保存为小写）
+func (d *DB) QueryByEmail(email string) (*Model, error) {
+	var model *Model
+	_, err := d.session.Select("*").From("user").Where("email=?", email).Load(&model)
+	return model, err
+}
+
 // 查询多个手机号用户
 func (d *DB) QueryByPhones(phones []string) ([]*Model, error) {
 	var models []*Model
@@ -67,12 +74,26 @@ func (d *DB) QueryByPhones(phones []string) ([]*Model, error) {
 
 // Insert 添加用户
 func (d *DB) Insert(m *Model) error {
+	fillDNDDefaults(m)
 	_, err := d.session.InsertInto("user").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
 	return err
 }
 
+// InsertTx 在事务中添加用户
+func (d *DB) InsertTx(m *Model, tx *dbr.Tx) error {
+	return d.insertTx(m, tx)
+}
+
+// LockWithUIDTx 在事务中锁定用户行，用于串行化同一用户的并发操作
+func (d *DB) LockWithUIDTx(uid string, tx *dbr.Tx) error {
+	var id int64
+	_, err := tx.Select("id").From("user").Where("uid=?", uid).Suffix("FOR UPDATE").Load(&id)
+	return err
+}
+
 // Insert 添加用户
 func (d *DB) insertTx(m *Model, tx *dbr.Tx) error {
+	fillDNDDefaults(m)
 	_, err := tx.InsertInto("user").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
 	return err
 }
@@ -213,11 +234,18 @@ func (d *DB) updatePassword(password string, uid string) error {
 	return err
 }
 
+// 仅当密码未被修改时更新密码（升级密码哈希时使用）
+func (d *DB) updatePasswordWithOld(password string, oldPassword string, uid string) error {
+	_, err := d.session.Update("user").Set("password", password).Where("uid=? and password=?", uid, oldPassword).Exec()
+	return err
+}
+
 // 注销账户
 func (d *DB) destroyAccount(uid, username, phone string) error {
 	_, err := d.session.Update("user").SetMap(map[string]interface{}{
 		"phone":      phone,
 		"username":   username,
+		"email":      "",
 		"is_destroy": 1,
 	}).Where("uid=?", uid).Exec()
 	return err
@@ -347,6 +375,13 @@ type Model struct {
 	GithubUID         string // github uid
 	Web3PublicKey     string // web3公钥
 	MsgExpireSecond   int64  // 消息过期时长
+	DndOn             int    // 是否开启勿扰时段
+	DndStart          string // 勿扰开始时间 HH:MM
+	DndEnd            string // 勿扰结束时间 HH:MM
+	DndTimezone       string // 勿扰时段所在时区
+	DndWeekdays       int    // 勿扰生效的星期掩码
+	DndAllowCall      int    // 勿扰时段是否允许音视频来电通知
+	DndAllowMention   int    // 勿扰时段是否允许@我的消息通知
 	db.BaseModel
 }
 
@@ -0,0 +1,119 @@
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/common"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+)
+
+// 旧版本每个用户只存一个设备token，直接以下面三个字段存于hash中
+const (
+	legacyDeviceTokenField = "device_token"
+	legacyDeviceTypeField  = "device_type"
+	legacyBundleIDField    = "bundle_id"
+)
+
+// deviceTokenDB 用户推送设备token（存储于redis hash，field为设备key，value为设备token json）
+type deviceTokenDB struct {
+	ctx    *config.Context
+	prefix string
+}
+
+func newDeviceTokenDB(ctx *config.Context) *deviceTokenDB {
+	return &deviceTokenDB{
+		ctx:    ctx,
+		prefix: common.UserDeviceTokenPrefix,
+	}
+}
+
+func (d *deviceTokenDB) key(uid string) string {
+	return fmt.Sprintf("%s%s", d.prefix, uid)
+}
+
+// save 保存某个设备的token（同一设备重复注册则覆盖）
+func (d *deviceTokenDB) save(uid string, m *DeviceTokenModel) error {
+	key := d.key(uid)
+	err := d.ctx.GetRedisConn().Hmset(key, m.DeviceKey(), util.ToJson(m))
+	if err != nil {
+		return err
+	}
+	// 清除旧版本的单设备记录
+	for _, field := range []string{legacyDeviceTokenField, legacyDeviceTypeField, legacyBundleIDField} {
+		if err = d.ctx.GetRedisConn().Hdel(key, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryWithUID 查询用户所有设备的token
+func (d *deviceTokenDB) queryWithUID(uid string) ([]*DeviceTokenModel, error) {
+	deviceMap, err := d.ctx.GetRedisConn().Hgetall(d.key(uid))
+	if err != nil {
+		return nil, err
+	}
+	models := make([]*DeviceTokenModel, 0, len(deviceMap))
+	if deviceMap[legacyDeviceTokenField] != "" {
+		models = append(models, &DeviceTokenModel{
+			DeviceType:  deviceMap[legacyDeviceTypeField],
+			DeviceToken: deviceMap[legacyDeviceTokenField],
+			BundleID:    deviceMap[legacyBundleIDField],
+		})
+	}
+	for field, value := range deviceMap {
+		if field == legacyDeviceTokenField || field == legacyDeviceTypeField || field == legacyBundleIDField {
+			continue
+		}
+		var m *DeviceTokenModel
+		if err = json.Unmarshal([]byte(value), &m); err != nil || m == nil {
+			continue
+		}
+		models = append(models, m)
+	}
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].UpdatedAt > models[j].UpdatedAt
+	})
+	return models, nil
+}
+
+// delete 删除某个设备的token
+func (d *deviceTokenDB) delete(uid string, deviceKey string) error {
+	if deviceKey == legacyDeviceTokenField {
+		for _, field := range []string{legacyDeviceTokenField, legacyDeviceTypeField, legacyBundleIDField} {
+			if err := d.ctx.GetRedisConn().Hdel(d.key(uid), field); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return d.ctx.GetRedisConn().Hdel(d.key(uid), deviceKey)
+}
+
+// deleteWithUID 删除用户所有设备的token
+func (d *deviceTokenDB) deleteWithUID(uid string) error {
+	return d.ctx.GetRedisConn().Del(d.key(uid))
+}
+
+// DeviceTokenModel 推送设备token
+type DeviceTokenModel struct {
+	DeviceID    string `json:"device_id"`    // 设备唯一ID
+	DeviceType  string `json:"device_type"`  // 设备类型 IOS，MI，HMS
+	DeviceToken string `json:"device_token"` // 设备token
+	BundleID    string `json:"bundle_id"`    // app的唯一ID标示
+	UpdatedAt   int64  `json:"updated_at"`   // 注册时间（秒）
+}
+
+// DeviceKey 设备在hash中的key，没有设备ID的以设备类型区分
+func (d *DeviceTokenModel) DeviceKey() string {
+	if d.DeviceID != "" {
+		return d.DeviceID
+	}
+	if d.UpdatedAt == 0 && d.DeviceType != "" { // 旧版本单设备记录
+		return legacyDeviceTokenField
+	}
+	return fmt.Sprintf("type:%s", d.DeviceType)
+}
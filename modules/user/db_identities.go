@@ -19,10 +19,24 @@ func newIdentitieDB(ctx *config.Context) *identitieDB {
 }
 
 func (i *identitieDB) saveOrUpdateTx(m *identitiesModel, tx *dbr.Tx) error {
-	_, err := tx.InsertBySql("insert into signal_identities(uid,identity_key,signed_prekey_id,signed_pubkey,signed_signature,registration_id) values(?,?,?,?,?,?) ON DUPLICATE KEY UPDATE identity_key=identity_key,signed_prekey_id=signed_prekey_id,signed_pubkey=signed_pubkey,signed_signature=signed_signature,registration_id=registration_id", m.UID, m.IdentityKey, m.SignedPrekeyID, m.SignedPubkey, m.SignedSignature, m.RegistrationID).Exec()
+	_, err := tx.InsertBySql("insert into signal_identities(uid,identity_key,signed_prekey_id,signed_pubkey,signed_signature,registration_id) values(?,?,?,?,?,?) ON DUPLICATE KEY UPDATE identity_key=VALUES(identity_key),signed_prekey_id=VALUES(signed_prekey_id),signed_pubkey=VALUES(signed_pubkey),signed_signature=VALUES(signed_signature),registration_id=VALUES(registration_id),updated_at=NOW()", m.UID, m.IdentityKey, m.SignedPrekeyID, m.SignedPubkey, m.SignedSignature, m.RegistrationID).Exec()
 	return err
 }
 
+// 轮换签名prekey
+func (i *identitieDB) updateSignedPrekey(uid string, signedPrekeyID int, signedPubkey string, signedSignature string) (int64, error) {
+	result, err := i.session.Update("signal_identities").SetMap(map[string]interface{}{
+		"signed_prekey_id": signedPrekeyID,
+		"signed_pubkey":    signedPubkey,
+		"signed_signature": signedSignature,
+		"updated_at":       dbr.Expr("NOW()"),
+	}).Where("uid=?", uid).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 func (i *identitieDB) deleteWithUID(uid string) error {
 	_, err := i.session.DeleteFrom("signal_identities").Where("uid=?", uid).Exec()
 	return err
@@ -34,6 +48,13 @@ func (i *identitieDB) queryWithUID(uid string) (*identitiesModel, error) {
 	return model, err
 }
 
+// 在事务中查询并锁定用户的signal身份，同一用户的密钥上传串行执行
+func (i *identitieDB) queryWithUIDForUpdateTx(uid string, tx *dbr.Tx) (*identitiesModel, error) {
+	var model *identitiesModel
+	_, err := tx.Select("*").From("signal_identities").Where("uid=?", uid).Suffix("FOR UPDATE").Load(&model)
+	return model, err
+}
+
 type identitiesModel struct {
 	UID             string
 	RegistrationID  uint32
@@ -1,6 +1,8 @@
 package user
 
 import (
+	"time"
+
 	"github.com/gocraft/dbr/v2"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/db"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
@@ -24,19 +26,61 @@ func (l *LoginLogDB) insert(m *LoginLogModel) error {
 	return err
 }
 
-// queryLastLoginIP 查询最后一次登录日志
+// queryLastLoginIP 查询最后一次登录成功的日志
 func (l *LoginLogDB) queryLastLoginIP(uid string) (*LoginLogModel, error) {
 	var model *LoginLogModel
-	_, err := l.session.Select("*").From("login_log").Where("uid=?", uid).OrderDir("created_at", false).Limit(1).Load(&model)
+	_, err := l.session.Select("*").From("login_log").Where("uid=? and status=?", uid, loginLogStatusSuccess).OrderDir("created_at", false).Limit(1).Load(&model)
 	if err != nil {
 		return nil, err
 	}
 	return model, nil
 }
 
+// queryRegionsSince 查询某时间之后登录成功过的国家和地区
+func (l *LoginLogDB) queryRegionsSince(uid string, since time.Time) ([]*LoginLogModel, error) {
+	var models []*LoginLogModel
+	_, err := l.session.Select("distinct country,region").From("login_log").Where("uid=? and status=? and country<>'' and created_at>?", uid, loginLogStatusSuccess, since).Load(&models)
+	return models, err
+}
+
+// queryFailCountSince 查询某时间之后密码错误的次数
+func (l *LoginLogDB) queryFailCountSince(uid string, since time.Time) (int, error) {
+	var count int
+	_, err := l.session.Select("count(*)").From("login_log").Where("uid=? and status=? and created_at>?", uid, loginLogStatusFail, since).Load(&count)
+	return count, err
+}
+
+// queryWithUIDAndPage 分页查询用户的登录日志（最新的在前）
+func (l *LoginLogDB) queryWithUIDAndPage(uid string, pageIndex, pageSize uint64) ([]*LoginLogModel, error) {
+	var models []*LoginLogModel
+	_, err := l.session.Select("*").From("login_log").Where("uid=?", uid).Offset((pageIndex-1)*pageSize).Limit(pageSize).OrderDir("id", false).Load(&models)
+	return models, err
+}
+
+// queryCountWithUID 用户的登录日志数量
+func (l *LoginLogDB) queryCountWithUID(uid string) (int64, error) {
+	var count int64
+	_, err := l.session.Select("count(*)").From("login_log").Where("uid=?", uid).Load(&count)
+	return count, err
+}
+
+const (
+	loginLogStatusFail    = 0 // 密码错误
+	loginLogStatusSuccess = 1 // 登录成功
+	loginLogStatusRisk    = 2 // 异常登录（被要求验证或禁止登录）
+)
+
 // LoginLogModel 登录日志
 type LoginLogModel struct {
-	LoginIP string //登录IP
-	UID     string
+	LoginIP    string //登录IP
+	UID        string
+	Status     int     // 登录结果
+	Country    string  // 国家
+	Region     string  // 省份/地区
+	City       string  // 城市
+	Longitude  float64 // 经度
+	Latitude   float64 // 纬度
+	Risk       string  // 命中的异常登录规则
+	RiskAction int     // 异常登录的处理方式
 	db.BaseModel
 }
@@ -24,6 +24,37 @@ func (o *onetimePrekeysDB) insertTx(m *onetimePrekeysModel, tx *dbr.Tx) error {
 	return err
 }
 
+// 插入一次性公钥，key_id已存在则忽略
+func (o *onetimePrekeysDB) insertIgnoreTx(m *onetimePrekeysModel, tx *dbr.Tx) error {
+	_, err := tx.InsertBySql("insert ignore into signal_onetime_prekeys(uid,key_id,pubkey) values(?,?,?)", m.UID, m.KeyID, m.Pubkey).Exec()
+	return err
+}
+
+// 取出用户最小的一次性公钥并删除（并发时被其他请求取走则重试）
+func (o *onetimePrekeysDB) consumeMinWithUID(uid string) (*onetimePrekeysModel, error) {
+	for i := 0; i < 5; i++ {
+		m, err := o.queryMinWithUID(uid)
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			return nil, nil
+		}
+		result, err := o.session.DeleteFrom("signal_onetime_prekeys").Where("uid=? and key_id=?", uid, m.KeyID).Exec()
+		if err != nil {
+			return nil, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if affected > 0 {
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
 func (o *onetimePrekeysDB) delete(uid string, keyID int) error {
 	_, err := o.session.DeleteFrom("signal_onetime_prekeys").Where("uid=? and key_id=?", uid, keyID).Exec()
 	return err
@@ -34,6 +65,11 @@ func (o *onetimePrekeysDB) deleteWithUID(uid string) error {
 	return err
 }
 
+func (o *onetimePrekeysDB) deleteWithUIDTx(uid string, tx *dbr.Tx) error {
+	_, err := tx.DeleteFrom("signal_onetime_prekeys").Where("uid=?", uid).Exec()
+	return err
+}
+
 // 查询用户最小的onetimePreKey
 func (o *onetimePrekeysDB) queryMinWithUID(uid string) (*onetimePrekeysModel, error) {
 	var m *onetimePrekeysModel
@@ -47,6 +83,12 @@ func (o *onetimePrekeysDB) queryCount(uid string) (int, error) {
 	return cn, err
 }
 
+func (o *onetimePrekeysDB) queryCountTx(uid string, tx *dbr.Tx) (int, error) {
+	var cn int
+	err := tx.Select("count(*)").From("signal_onetime_prekeys").Where("uid=?", uid).LoadOne(&cn)
+	return cn, err
+}
+
 type onetimePrekeysModel struct {
 	UID    string
 	KeyID  int
@@ -0,0 +1,75 @@
+package user
+
+import (
+	"time"
+
+	"github.com/gocraft/dbr/v2"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/db"
+)
+
+type sessionDB struct {
+	session *dbr.Session
+	ctx     *config.Context
+}
+
+func newSessionDB(ctx *config.Context) *sessionDB {
+	return &sessionDB{
+		session: ctx.DB(),
+		ctx:     ctx,
+	}
+}
+
+// 添加或更新会话（web和pc重复登录时会复用token，所以同一个会话会再次登录）
+func (s *sessionDB) insertOrUpdate(m *sessionModel) error {
+	_, err := s.session.InsertBySql("insert into user_session(uid,session_id,device_flag,device_id,device_name,device_model,ip,user_agent,last_seen_at,expire_at) values(?,?,?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE device_id=VALUES(device_id),device_name=VALUES(device_name),device_model=VALUES(device_model),ip=VALUES(ip),user_agent=VALUES(user_agent),last_seen_at=VALUES(last_seen_at),expire_at=VALUES(expire_at),updated_at=NOW()", m.UID, m.SessionID, m.DeviceFlag, m.DeviceID, m.DeviceName, m.DeviceModel, m.IP, m.UserAgent, m.LastSeenAt, m.ExpireAt).Exec()
+	return err
+}
+
+// 查询用户未过期的会话（最近活跃的在前）
+func (s *sessionDB) queryWithUID(uid string) ([]*sessionModel, error) {
+	var models []*sessionModel
+	_, err := s.session.Select("*").From("user_session").Where("uid=? and expire_at>?", uid, time.Now().Unix()).OrderDir("last_seen_at", false).Load(&models)
+	return models, err
+}
+
+func (s *sessionDB) queryWithUIDAndSessionID(uid string, sessionID string) (*sessionModel, error) {
+	var model *sessionModel
+	_, err := s.session.Select("*").From("user_session").Where("uid=? and session_id=?", uid, sessionID).Load(&model)
+	return model, err
+}
+
+// 更新最后活跃时间和IP
+func (s *sessionDB) updateLastSeen(uid string, sessionID string, ip string, lastSeenAt int64) error {
+	_, err := s.session.Update("user_session").SetMap(map[string]interface{}{
+		"ip":           ip,
+		"last_seen_at": lastSeenAt,
+		"updated_at":   dbr.Expr("NOW()"),
+	}).Where("uid=? and session_id=?", uid, sessionID).Exec()
+	return err
+}
+
+func (s *sessionDB) deleteWithSessionID(uid string, sessionID string) error {
+	_, err := s.session.DeleteFrom("user_session").Where("uid=? and session_id=?", uid, sessionID).Exec()
+	return err
+}
+
+// 删除已过期的会话
+func (s *sessionDB) deleteExpired(uid string) error {
+	_, err := s.session.DeleteFrom("user_session").Where("uid=? and expire_at<=?", uid, time.Now().Unix()).Exec()
+	return err
+}
+
+type sessionModel struct {
+	UID         string
+	SessionID   string
+	DeviceFlag  int
+	DeviceID    string
+	DeviceName  string
+	DeviceModel string
+	IP          string
+	UserAgent   string
+	LastSeenAt  int64
+	ExpireAt    int64
+	db.BaseModel
+}
@@ -0,0 +1,108 @@
+package user
+
+import (
+	"github.com/gocraft/dbr/v2"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/db"
+)
+
+const (
+	totpStatusPending = 0 // 待确认
+	totpStatusEnabled = 1 // 已启用
+)
+
+type totpDB struct {
+	session *dbr.Session
+	ctx     *config.Context
+}
+
+func newTOTPDB(ctx *config.Context) *totpDB {
+	return &totpDB{
+		session: ctx.DB(),
+		ctx:     ctx,
+	}
+}
+
+func (t *totpDB) queryWithUID(uid string) (*totpModel, error) {
+	var model *totpModel
+	_, err := t.session.Select("*").From("user_totp").Where("uid=?", uid).Load(&model)
+	return model, err
+}
+
+// 保存待确认的密钥（已启用的不会被覆盖）
+func (t *totpDB) savePending(uid string, secret string) error {
+	_, err := t.session.InsertBySql("insert into user_totp(uid,secret,status,last_counter) values(?,?,?,0) ON DUPLICATE KEY UPDATE secret=IF(status=?,secret,VALUES(secret)),last_counter=IF(status=?,last_counter,0),updated_at=IF(status=?,updated_at,NOW())", uid, secret, totpStatusPending, totpStatusEnabled, totpStatusEnabled, totpStatusEnabled).Exec()
+	return err
+}
+
+// 确认启用
+func (t *totpDB) enableTx(uid string, secret string, counter int64, tx *dbr.Tx) (int64, error) {
+	result, err := tx.Update("user_totp").SetMap(map[string]interface{}{
+		"status":       totpStatusEnabled,
+		"last_counter": counter,
+		"updated_at":   dbr.Expr("NOW()"),
+	}).Where("uid=? and secret=? and status=?", uid, secret, totpStatusPending).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// 记录使用过的时间步，只有比上次大才会成功（防止同一个验证码被并发或重复使用）
+func (t *totpDB) updateLastCounter(uid string, counter int64) (int64, error) {
+	result, err := t.session.Update("user_totp").SetMap(map[string]interface{}{
+		"last_counter": counter,
+		"updated_at":   dbr.Expr("NOW()"),
+	}).Where("uid=? and status=? and last_counter<?", uid, totpStatusEnabled, counter).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (t *totpDB) deleteWithUIDTx(uid string, tx *dbr.Tx) error {
+	_, err := tx.DeleteFrom("user_totp").Where("uid=?", uid).Exec()
+	return err
+}
+
+func (t *totpDB) insertRecoveryCodesTx(uid string, codeHashes []string, tx *dbr.Tx) error {
+	for _, codeHash := range codeHashes {
+		_, err := tx.InsertInto("user_totp_recovery_code").Columns("uid", "code_hash").Values(uid, codeHash).Exec()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *totpDB) deleteRecoveryCodesTx(uid string, tx *dbr.Tx) error {
+	_, err := tx.DeleteFrom("user_totp_recovery_code").Where("uid=?", uid).Exec()
+	return err
+}
+
+// 使用恢复码（删除成功表示恢复码有效）
+func (t *totpDB) consumeRecoveryCode(uid string, codeHash string) (bool, error) {
+	result, err := t.session.DeleteFrom("user_totp_recovery_code").Where("uid=? and code_hash=?", uid, codeHash).Exec()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+func (t *totpDB) queryRecoveryCodeCount(uid string) (int, error) {
+	var count int
+	_, err := t.session.Select("count(*)").From("user_totp_recovery_code").Where("uid=?", uid).Load(&count)
+	return count, err
+}
+
+type totpModel struct {
+	UID         string
+	Secret      string
+	Status      int
+	LastCounter int64
+	db.BaseModel
+}
@@ -0,0 +1,142 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // 保证容器内没有时区数据时也能解析用户的IANA时区
+)
+
+// DoNotDisturb 用户勿扰时段
+type DoNotDisturb struct {
+	On           int    `json:"dnd_on"`            // 是否开启勿扰时段 0.否 1.是
+	Start        string `json:"dnd_start"`         // 开始时间 HH:MM
+	End          string `json:"dnd_end"`           // 结束时间 HH:MM（小于开始时间表示跨天）
+	Timezone     string `json:"dnd_timezone"`      // IANA时区名 如Asia/Shanghai，为空则使用UTC
+	Weekdays     int    `json:"dnd_weekdays"`      // 生效的星期掩码 bit0.周日 bit1.周一 ... bit6.周六（1-127）
+	AllowCall    int    `json:"dnd_allow_call"`    // 勿扰时段是否允许音视频来电通知
+	AllowMention int    `json:"dnd_allow_mention"` // 勿扰时段是否允许@我的消息通知
+}
+
+const (
+	dndDefaultStart     = "22:00"
+	dndDefaultEnd       = "07:00"
+	dndDefaultWeekdays  = 127
+	dndDefaultAllowCall = 1
+)
+
+func newDoNotDisturb(m *Model) DoNotDisturb {
+	return DoNotDisturb{
+		On:           m.DndOn,
+		Start:        m.DndStart,
+		End:          m.DndEnd,
+		Timezone:     m.DndTimezone,
+		Weekdays:     m.DndWeekdays,
+		AllowCall:    m.DndAllowCall,
+		AllowMention: m.DndAllowMention,
+	}
+}
+
+// fillDNDDefaults 插入用户时会写入所有列，数据库的默认值不会生效，这里补上与数据库一致的默认值
+// 有效的星期掩码为1-127，为0说明勿扰时段还没有设置过
+func fillDNDDefaults(m *Model) {
+	if m.DndWeekdays != 0 {
+		return
+	}
+	m.DndWeekdays = dndDefaultWeekdays
+	m.DndAllowCall = dndDefaultAllowCall
+	if m.DndStart == "" {
+		m.DndStart = dndDefaultStart
+	}
+	if m.DndEnd == "" {
+		m.DndEnd = dndDefaultEnd
+	}
+}
+
+// Active 指定时间是否处于勿扰时段
+// 跨天的时段（如22:00-07:00）以开始那天的星期判断是否生效
+func (d DoNotDisturb) Active(t time.Time) bool {
+	if d.On != 1 {
+		return false
+	}
+	start, err := parseDNDClock(d.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseDNDClock(d.End)
+	if err != nil {
+		return false
+	}
+	loc := time.UTC
+	if d.Timezone != "" {
+		if l, err := time.LoadLocation(d.Timezone); err == nil {
+			loc = l
+		}
+	}
+	localTime := t.In(loc)
+	minute := localTime.Hour()*60 + localTime.Minute()
+	weekday := localTime.Weekday()
+
+	if start == end { // 全天
+		return d.weekdayOn(weekday)
+	}
+	if start < end {
+		return minute >= start && minute < end && d.weekdayOn(weekday)
+	}
+	if minute >= start {
+		return d.weekdayOn(weekday)
+	}
+	if minute < end {
+		return d.weekdayOn((weekday + 6) % 7) // 前一天开始的时段
+	}
+	return false
+}
+
+func (d DoNotDisturb) weekdayOn(weekday time.Weekday) bool {
+	return d.Weekdays&(1<<uint(weekday)) != 0
+}
+
+// parseDNDClock 解析HH:MM，返回距离零点的分钟数
+func parseDNDClock(clock string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(clock), ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("时间格式有误[%s]！", clock)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, fmt.Errorf("时间格式有误[%s]！", clock)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("时间格式有误[%s]！", clock)
+	}
+	return hour*60 + minute, nil
+}
+
+// checkDNDSetting 校验勿扰时段的设置值
+func checkDNDSetting(key string, value string) error {
+	switch key {
+	case "dnd_start", "dnd_end":
+		_, err := parseDNDClock(value)
+		return err
+	case "dnd_timezone":
+		if value == "" {
+			return nil
+		}
+		if _, err := time.LoadLocation(value); err != nil {
+			return errors.New("时区有误！")
+		}
+	case "dnd_weekdays":
+		weekdays, err := strconv.Atoi(value)
+		if err != nil || weekdays <= 0 || weekdays > 127 {
+			return errors.New("星期掩码有误！")
+		}
+	case "dnd_on", "dnd_allow_call", "dnd_allow_mention":
+		if value != "0" && value != "1" {
+			return fmt.Errorf("%s只能为0或1！", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package user
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoNotDisturbActive(t *testing.T) {
+	dnd := DoNotDisturb{
+		On:       1,
+		Start:    "22:00",
+		End:      "07:00",
+		Timezone: "Asia/Shanghai",
+		Weekdays: 1 << uint(time.Monday), // 只有周一晚上生效
+	}
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+
+	assert.True(t, dnd.Active(time.Date(2024, 5, 6, 23, 0, 0, 0, loc)))      // 周一 23:00
+	assert.True(t, dnd.Active(time.Date(2024, 5, 7, 6, 59, 0, 0, loc)))      // 周二 06:59 属于周一开始的时段
+	assert.False(t, dnd.Active(time.Date(2024, 5, 7, 7, 0, 0, 0, loc)))      // 周二 07:00
+	assert.False(t, dnd.Active(time.Date(2024, 5, 7, 23, 0, 0, 0, loc)))     // 周二 23:00
+	assert.True(t, dnd.Active(time.Date(2024, 5, 6, 15, 0, 0, 0, time.UTC))) // UTC 15:00 = 上海周一 23:00
+
+	dnd.On = 0
+	assert.False(t, dnd.Active(time.Date(2024, 5, 6, 23, 0, 0, 0, loc)))
+
+	assert.Error(t, checkDNDSetting("dnd_start", "25:00"))
+	assert.Error(t, checkDNDSetting("dnd_timezone", "Mars/Base"))
+	assert.NoError(t, checkDNDSetting("dnd_weekdays", "127"))
+	assert.Error(t, checkDNDSetting("dnd_weekdays", "0"))
+
+	// 插入用户时未设置的项使用与数据库一致的默认值
+	m := &Model{}
+	fillDNDDefaults(m)
+	assert.Equal(t, "22:00", m.DndStart)
+	assert.Equal(t, "07:00", m.DndEnd)
+	assert.Equal(t, 127, m.DndWeekdays)
+	assert.Equal(t, 1, m.DndAllowCall)
+	assert.Equal(t, 0, m.DndOn)
+}
@@ -0,0 +1,37 @@
+package user
+
+import (
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/password"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+	"go.uber.org/zap"
+)
+
+// hashPassword 计算登录密码的哈希（所有保存登录密码的地方都必须使用）
+func hashPassword(pwd string) (string, error) {
+	return password.Hash(pwd)
+}
+
+// matchPassword 校验密码是否正确（不升级哈希，用于随后会修改密码的场景）
+func matchPassword(hash string, pwd string) bool {
+	ok, _ := password.Verify(pwd, hash)
+	return ok
+}
+
+// verifyPassword 校验用户的登录密码
+// 旧版md5(md5(password))或参数已过时的哈希在校验通过后自动重新计算并保存
+func verifyPassword(d *DB, uid string, hash string, pwd string) bool {
+	ok, needRehash := password.Verify(pwd, hash)
+	if !ok || !needRehash {
+		return ok
+	}
+	newHash, err := password.Hash(pwd)
+	if err != nil {
+		log.Warn("重新计算密码哈希失败！", zap.Error(err), zap.String("uid", uid))
+		return true
+	}
+	err = d.updatePasswordWithOld(newHash, hash, uid)
+	if err != nil {
+		log.Warn("升级密码哈希失败！", zap.Error(err), zap.String("uid", uid))
+	}
+	return true
+}
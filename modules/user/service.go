@@ -78,6 +78,10 @@ type IService interface {
 	UpdateUserMsgExpireSecond(uid string, msgExpireSecond int64) error
 	// 搜索好友
 	SearchFriendsWithKeyword(uid string, keyword string) ([]*FriendResp, error)
+	// 获取用户所有推送设备token
+	GetDeviceTokens(uid string) ([]*DeviceTokenModel, error)
+	// 删除用户某个推送设备token
+	RemoveDeviceToken(uid string, deviceKey string) error
 }
 
 // Service Service
@@ -90,6 +94,7 @@ type Service struct {
 	settingDB        *SettingDB
 	onetimePrekeysDB *onetimePrekeysDB
 	onlineService    *OnlineService
+	deviceTokenDB    *deviceTokenDB
 }
 
 // NewService NewService
@@ -103,6 +108,7 @@ func NewService(ctx *config.Context) IService {
 		onlineDB:         newOnlineDB(ctx),
 		Log:              log.NewTLog("userService"),
 		onlineService:    NewOnlineService(ctx),
+		deviceTokenDB:    newDeviceTokenDB(ctx),
 	}
 }
 
@@ -406,7 +412,12 @@ func (s *Service) AddUser(user *AddUserReq) error {
 		Status:   1,
 	}
 	if user.Password != "" {
-		userM.Password = util.MD5(util.MD5(user.Password))
+		pwd, err := hashPassword(user.Password)
+		if err != nil {
+			s.Error("计算密码哈希失败！", zap.Error(err))
+			return err
+		}
+		userM.Password = pwd
 	}
 
 	err := s.db.Insert(userM)
@@ -658,11 +669,14 @@ func (s *Service) UpdateLoginPassword(req UpdateLoginPasswordReq) error {
 	if userM == nil {
 		return errors.New("用户不存在！")
 	}
-	if util.MD5(util.MD5(req.Password)) != userM.Password {
+	if !matchPassword(userM.Password, req.Password) {
 		return errors.New("原密码不正确！")
 	}
-
-	err = s.db.updatePassword(util.MD5(util.MD5(req.NewPassword)), req.UID)
+	pwd, err := hashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+	err = s.db.updatePassword(pwd, req.UID)
 	if err != nil {
 		return errors.New("更新密码失败！")
 	}
@@ -750,6 +764,7 @@ func (s *Service) SearchFriendsWithKeyword(uid string, keyword string) ([]*Frien
 type Resp struct {
 	UID             string
 	Name            string
+	ShortNo         string // 短编号
 	Zone            string
 	Phone           string
 	Email           string
@@ -759,14 +774,16 @@ type Resp struct {
 	NewMsgNotice    int
 	MsgShowDetail   int //显示消息通知详情0.否1.是
 	MsgExpireSecond int64
-	CreatedAt       int64 // 注册时间 10位时间戳
-	IsDestroy       int   // 是否注销
+	CreatedAt       int64        // 注册时间 10位时间戳
+	IsDestroy       int          // 是否注销
+	DoNotDisturb    DoNotDisturb // 勿扰时段
 }
 
 func newResp(m *Model) *Resp {
 	return &Resp{
 		UID:             m.UID,
 		Name:            m.Name,
+		ShortNo:         m.ShortNo,
 		Zone:            m.Zone,
 		Phone:           m.Phone,
 		Email:           m.Email,
@@ -778,6 +795,7 @@ func newResp(m *Model) *Resp {
 		MsgExpireSecond: m.MsgExpireSecond,
 		IsDestroy:       m.IsDestroy,
 		CreatedAt:       time.Time(m.CreatedAt).Unix(),
+		DoNotDisturb:    newDoNotDisturb(m),
 	}
 }
 
@@ -965,3 +983,11 @@ func NewUserDetailResp(m *Detail, remark, loginUID string, sourceFrom string, on
 		Vercode:        vercode,
 	}
 }
+
+func (s *Service) GetDeviceTokens(uid string) ([]*DeviceTokenModel, error) {
+	return s.deviceTokenDB.queryWithUID(uid)
+}
+
+func (s *Service) RemoveDeviceToken(uid string, deviceKey string) error {
+	return s.deviceTokenDB.delete(uid, deviceKey)
+}
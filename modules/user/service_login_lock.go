@@ -0,0 +1,492 @@
+package user
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	common2 "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/common"
+	"github.com/go-redis/redis"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+	"go.uber.org/zap"
+)
+
+const (
+	loginLockCachePrefix  = "loginlock:"     // 锁定标记 loginlock:<类型>:<目标> -> 解锁时间
+	loginFailCachePrefix  = "loginfail:"     // 密码错误次数 loginfail:<类型>:<目标>
+	loginDelayCachePrefix = "logindelay:"    // 渐进延迟 logindelay:account:<uid> -> 允许再次尝试的时间
+	loginGateCachePrefix  = "logingate:"     // 渐进延迟期间的尝试计数 logingate:account:<uid>，过期前只允许一次尝试
+	loginTOTPCachePrefix  = "logintotpfail:" // 登录两步验证错误次数 logintotpfail:<uid>
+	loginLockIndexKey     = "loginlockindex" // 所有锁定记录（有序集合，score为解锁时间）
+	loginFailWindow       = time.Hour        // 错误次数统计窗口（每次错误后重新计时）
+	loginFailMaxDelay     = time.Second * 60 // 渐进延迟的上限
+	loginLockMaxListCount = 1000             // 后台最多展示的锁定记录数量
+	loginLockUnknownIP    = "unknown"        // 获取不到客户端IP时使用
+
+	loginLockDefaultCaptchaCount = 3
+	loginLockDefaultAccountCount = 10
+	loginLockDefaultIPCount      = 50
+	loginLockDefaultDuration     = time.Minute * 15
+)
+
+// 锁定类型
+const (
+	loginLockTypeAccount = "account" // 按账号锁定
+	loginLockTypeIP      = "ip"      // 按IP锁定
+)
+
+// loginLockConfig 登录防暴力破解配置
+type loginLockConfig struct {
+	CaptchaCount int           // 账号或IP密码错误多少次后要求图形验证码
+	AccountCount int           // 同一账号密码错误多少次后锁定
+	IPCount      int           // 同一IP密码错误多少次后锁定
+	Duration     time.Duration // 锁定时长
+}
+
+func newLoginLockConfig(appConfig *common2.AppConfigResp) *loginLockConfig {
+	cfg := &loginLockConfig{
+		CaptchaCount: loginLockDefaultCaptchaCount,
+		AccountCount: loginLockDefaultAccountCount,
+		IPCount:      loginLockDefaultIPCount,
+		Duration:     loginLockDefaultDuration,
+	}
+	if appConfig == nil {
+		return cfg
+	}
+	if appConfig.LoginLockCaptchaCount > 0 {
+		cfg.CaptchaCount = appConfig.LoginLockCaptchaCount
+	}
+	if appConfig.LoginLockAccountCount > 0 {
+		cfg.AccountCount = appConfig.LoginLockAccountCount
+	}
+	if appConfig.LoginLockIPCount > 0 {
+		cfg.IPCount = appConfig.LoginLockIPCount
+	}
+	if appConfig.LoginLockMinutes > 0 {
+		cfg.Duration = time.Duration(appConfig.LoginLockMinutes) * time.Minute
+	}
+	return cfg
+}
+
+// loginFailDelay 达到验证码次数后每次错误的等待时间按1、2、4...秒递增，最多60秒
+func loginFailDelay(failCount int, captchaCount int) time.Duration {
+	if failCount < captchaCount || failCount <= 0 {
+		return 0
+	}
+	exp := failCount - captchaCount
+	if exp >= 6 {
+		return loginFailMaxDelay
+	}
+	delay := time.Second << uint(exp)
+	if delay > loginFailMaxDelay {
+		return loginFailMaxDelay
+	}
+	return delay
+}
+
+// loginLockStatus 登录限制状态
+type loginLockStatus struct {
+	Locked          bool          // 账号或IP已被锁定
+	LockType        string        // 锁定类型 account/ip
+	RetryAfter      time.Duration // 需要等待多久才能再次尝试
+	CaptchaRequired bool          // 是否需要图形验证码
+}
+
+// loginLock 锁定记录
+type loginLock struct {
+	Type     string
+	Target   string
+	UnlockAt time.Time
+}
+
+func loginLockMember(typ string, target string) string {
+	return typ + ":" + target
+}
+
+func parseLoginLockMember(member string) (string, string, bool) {
+	idx := strings.Index(member, ":")
+	if idx <= 0 || idx == len(member)-1 {
+		return "", "", false
+	}
+	typ := member[:idx]
+	if typ != loginLockTypeAccount && typ != loginLockTypeIP {
+		return "", "", false
+	}
+	return typ, member[idx+1:], true
+}
+
+func loginLockIP(ip string) string {
+	if ip == "" {
+		return loginLockUnknownIP
+	}
+	return ip
+}
+
+// loginLockService 密码登录失败计数、渐进延迟和临时锁定
+type loginLockService struct {
+	ctx *config.Context
+	log.Log
+	commonService common2.IService
+}
+
+func newLoginLockService(ctx *config.Context) *loginLockService {
+	return &loginLockService{
+		ctx:           ctx,
+		Log:           log.NewTLog("loginLockService"),
+		commonService: common2.NewService(ctx),
+	}
+}
+
+func (s *loginLockService) config() *loginLockConfig {
+	appConfig, err := s.commonService.GetAppConfig()
+	if err != nil {
+		s.Warn("获取应用配置失败，使用默认登录限制", zap.Error(err))
+		return newLoginLockConfig(nil)
+	}
+	return newLoginLockConfig(appConfig)
+}
+
+// loginAttempt 已占用计数的一次登录尝试，校验密码后必须调用fail或success
+type loginAttempt struct {
+	UID          string // 为空表示用户不存在
+	IP           string
+	IPCount      int // 包括本次在内IP的尝试次数
+	AccountCount int // 包括本次在内账号的尝试次数
+}
+
+// reserve 校验密码前占用一次尝试（uid为空表示用户不存在，只计入IP）
+// 先累加次数再与上限比较，并发的尝试也无法绕过延迟和锁定；被锁定或需要等待时返回的attempt为nil
+func (s *loginLockService) reserve(uid string, ip string) (*loginLockStatus, *loginAttempt, error) {
+	cfg := s.config()
+	now := time.Now()
+	ip = loginLockIP(ip)
+	status := &loginLockStatus{}
+
+	targets := [][2]string{{loginLockTypeIP, ip}}
+	if uid != "" {
+		targets = append([][2]string{{loginLockTypeAccount, uid}}, targets...)
+	}
+	for _, target := range targets {
+		unlockAt, err := s.getTime(loginLockCachePrefix + loginLockMember(target[0], target[1]))
+		if err != nil {
+			return nil, nil, err
+		}
+		if unlockAt.After(now) {
+			status.Locked = true
+			status.LockType = target[0]
+			status.RetryAfter = unlockAt.Sub(now)
+			return status, nil, nil
+		}
+	}
+
+	ipCount, err := s.incrFail(loginLockTypeIP, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ipCount > cfg.CaptchaCount {
+		status.CaptchaRequired = true
+	}
+	if ipCount > cfg.IPCount { // 并发的尝试已经用完了次数
+		if err = s.lock(loginLockTypeIP, ip, now.Add(cfg.Duration)); err != nil {
+			return nil, nil, err
+		}
+		status.Locked = true
+		status.LockType = loginLockTypeIP
+		status.RetryAfter = cfg.Duration
+		return status, nil, nil
+	}
+	attempt := &loginAttempt{
+		UID:     uid,
+		IP:      ip,
+		IPCount: ipCount,
+	}
+	if uid == "" {
+		return status, attempt, nil
+	}
+
+	accountCount, err := s.incrFail(loginLockTypeAccount, uid)
+	if err != nil {
+		return nil, nil, err
+	}
+	if accountCount > cfg.CaptchaCount {
+		status.CaptchaRequired = true
+	}
+	if accountCount > cfg.AccountCount {
+		s.release(loginLockTypeIP, ip)
+		if err = s.lock(loginLockTypeAccount, uid, now.Add(cfg.Duration)); err != nil {
+			return nil, nil, err
+		}
+		status.Locked = true
+		status.LockType = loginLockTypeAccount
+		status.RetryAfter = cfg.Duration
+		return status, nil, nil
+	}
+	attempt.AccountCount = accountCount
+
+	// 本次失败后需要等待的时间，从本次尝试开始计时，等待期间只允许一次尝试
+	delay := loginFailDelay(accountCount, cfg.CaptchaCount)
+	if delay > 0 {
+		member := loginLockMember(loginLockTypeAccount, uid)
+		gateCount, err := s.ctx.GetRedisConn().Incr(loginGateCachePrefix + member)
+		if err != nil {
+			return nil, nil, err
+		}
+		if gateCount > 1 && accountCount > cfg.CaptchaCount {
+			s.release(loginLockTypeIP, ip)
+			s.release(loginLockTypeAccount, uid)
+			nextAt, err := s.getTime(loginDelayCachePrefix + member)
+			if err != nil {
+				return nil, nil, err
+			}
+			status.RetryAfter = nextAt.Sub(now)
+			if status.RetryAfter < time.Second {
+				status.RetryAfter = time.Second
+			}
+			return status, nil, nil
+		}
+		if gateCount == 1 {
+			if err = s.ctx.GetRedisConn().Expire(loginGateCachePrefix+member, delay); err != nil {
+				return nil, nil, err
+			}
+			err = s.ctx.GetRedisConn().SetAndExpire(loginDelayCachePrefix+member, strconv.FormatInt(now.Add(delay).UnixNano(), 10), delay)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return status, attempt, nil
+}
+
+// fail 密码错误，占用的次数即为错误次数，达到上限时锁定
+func (s *loginLockService) fail(attempt *loginAttempt) (*loginLockStatus, error) {
+	cfg := s.config()
+	now := time.Now()
+	status := &loginLockStatus{}
+
+	if attempt.IPCount >= cfg.CaptchaCount {
+		status.CaptchaRequired = true
+	}
+	if attempt.IPCount >= cfg.IPCount {
+		if err := s.lock(loginLockTypeIP, attempt.IP, now.Add(cfg.Duration)); err != nil {
+			return nil, err
+		}
+		s.Warn("IP密码错误次数过多，暂时锁定", zap.String("ip", attempt.IP), zap.Int("failCount", attempt.IPCount))
+		status.Locked = true
+		status.LockType = loginLockTypeIP
+		status.RetryAfter = cfg.Duration
+	}
+	if attempt.UID == "" {
+		return status, nil
+	}
+
+	if attempt.AccountCount >= cfg.CaptchaCount {
+		status.CaptchaRequired = true
+	}
+	if attempt.AccountCount >= cfg.AccountCount {
+		if err := s.lock(loginLockTypeAccount, attempt.UID, now.Add(cfg.Duration)); err != nil {
+			return nil, err
+		}
+		s.Warn("账号密码错误次数过多，暂时锁定", zap.String("uid", attempt.UID), zap.String("ip", attempt.IP), zap.Int("failCount", attempt.AccountCount))
+		status.Locked = true
+		status.LockType = loginLockTypeAccount
+		status.RetryAfter = cfg.Duration
+		return status, nil
+	}
+	if status.Locked {
+		return status, nil
+	}
+	status.RetryAfter = loginFailDelay(attempt.AccountCount, cfg.CaptchaCount)
+	return status, nil
+}
+
+// success 密码校验通过，清除账号的错误次数并退回本次占用的IP次数
+// （IP之前的错误次数不清除，避免攻击者用自己的账号重置计数）
+func (s *loginLockService) success(attempt *loginAttempt) error {
+	s.release(loginLockTypeIP, attempt.IP)
+	return s.clearCounter(loginLockTypeAccount, attempt.UID)
+}
+
+// reserveTOTP 校验登录两步验证前按账号占用一次尝试（每次密码登录都会生成新的挑战，所以不能按挑战计数）
+// 账号已被锁定或次数已用完时返回的status.Locked为true
+func (s *loginLockService) reserveTOTP(uid string) (*loginLockStatus, int, error) {
+	now := time.Now()
+	status := &loginLockStatus{}
+	unlockAt, err := s.getTime(loginLockCachePrefix + loginLockMember(loginLockTypeAccount, uid))
+	if err != nil {
+		return nil, 0, err
+	}
+	if unlockAt.After(now) {
+		status.Locked = true
+		status.LockType = loginLockTypeAccount
+		status.RetryAfter = unlockAt.Sub(now)
+		return status, 0, nil
+	}
+	key := loginTOTPCachePrefix + uid
+	count, err := s.ctx.GetRedisConn().Incr(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = s.ctx.GetRedisConn().Expire(key, loginFailWindow); err != nil {
+		return nil, 0, err
+	}
+	if count > totpLoginMaxFail { // 并发的尝试已经用完了次数
+		status, err = s.lockTOTP(uid, int(count))
+		return status, 0, err
+	}
+	return status, int(count), nil
+}
+
+// failTOTP 登录两步验证错误，占用的次数即为错误次数，达到上限时锁定账号
+func (s *loginLockService) failTOTP(uid string, count int) (*loginLockStatus, error) {
+	if count >= totpLoginMaxFail {
+		return s.lockTOTP(uid, count)
+	}
+	return &loginLockStatus{}, nil
+}
+
+// successTOTP 登录两步验证通过，清除错误次数
+func (s *loginLockService) successTOTP(uid string) {
+	err := s.ctx.GetRedisConn().Del(loginTOTPCachePrefix + uid)
+	if err != nil {
+		s.Warn("清除两步验证错误次数失败！", zap.Error(err), zap.String("uid", uid))
+	}
+}
+
+func (s *loginLockService) lockTOTP(uid string, count int) (*loginLockStatus, error) {
+	cfg := s.config()
+	if err := s.lock(loginLockTypeAccount, uid, time.Now().Add(cfg.Duration)); err != nil {
+		return nil, err
+	}
+	// 锁定后重新计数，否则解锁后第一次验证就会再次锁定
+	if err := s.ctx.GetRedisConn().Del(loginTOTPCachePrefix + uid); err != nil {
+		return nil, err
+	}
+	s.Warn("账号两步验证错误次数过多，暂时锁定", zap.String("uid", uid), zap.Int("failCount", count))
+	return &loginLockStatus{
+		Locked:     true,
+		LockType:   loginLockTypeAccount,
+		RetryAfter: cfg.Duration,
+	}, nil
+}
+
+// release 退回一次占用的尝试次数
+func (s *loginLockService) release(typ string, target string) {
+	_, err := s.ctx.GetRedisConn().Decr(loginFailCachePrefix + loginLockMember(typ, target))
+	if err != nil {
+		s.Warn("退回登录尝试次数失败！", zap.Error(err), zap.String("type", typ), zap.String("target", target))
+	}
+}
+
+// lock 锁定账号或IP直到指定时间
+func (s *loginLockService) lock(typ string, target string, unlockAt time.Time) error {
+	member := loginLockMember(typ, target)
+	err := s.ctx.GetRedisConn().SetAndExpire(loginLockCachePrefix+member, strconv.FormatInt(unlockAt.UnixNano(), 10), time.Until(unlockAt))
+	if err != nil {
+		return err
+	}
+	err = s.ctx.GetRedisConn().ZAdd(loginLockIndexKey, float64(unlockAt.Unix()), member)
+	if err != nil {
+		return err
+	}
+	return s.clearCounter(typ, target)
+}
+
+// unlock 解除锁定并清除错误次数
+func (s *loginLockService) unlock(typ string, target string) error {
+	member := loginLockMember(typ, target)
+	err := s.ctx.GetRedisConn().Del(loginLockCachePrefix + member)
+	if err != nil {
+		return err
+	}
+	err = s.ctx.GetRedisConn().ZRem(loginLockIndexKey, member)
+	if err != nil {
+		return err
+	}
+	if typ == loginLockTypeAccount { // 后台解锁账号时同时清除两步验证的错误次数，密码登录成功不清除
+		err = s.ctx.GetRedisConn().Del(loginTOTPCachePrefix + target)
+		if err != nil {
+			return err
+		}
+	}
+	return s.clearCounter(typ, target)
+}
+
+// list 当前所有未过期的锁定记录
+func (s *loginLockService) list() ([]*loginLock, error) {
+	now := time.Now().Unix()
+	err := s.ctx.GetRedisConn().ZRemRangeByScore(loginLockIndexKey, "-inf", fmt.Sprintf("%d", now))
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.ctx.GetRedisConn().ZRangeByScore(loginLockIndexKey, redis.ZRangeBy{
+		Min:   fmt.Sprintf("(%d", now),
+		Max:   "+inf",
+		Count: loginLockMaxListCount,
+	})
+	if err != nil {
+		return nil, err
+	}
+	locks := make([]*loginLock, 0, len(members))
+	for _, member := range members {
+		typ, target, ok := parseLoginLockMember(member)
+		if !ok {
+			continue
+		}
+		unlockAt, err := s.getTime(loginLockCachePrefix + member)
+		if err != nil {
+			return nil, err
+		}
+		if unlockAt.IsZero() { // 已被清除
+			continue
+		}
+		locks = append(locks, &loginLock{
+			Type:     typ,
+			Target:   target,
+			UnlockAt: unlockAt,
+		})
+	}
+	return locks, nil
+}
+
+func (s *loginLockService) incrFail(typ string, target string) (int, error) {
+	key := loginFailCachePrefix + loginLockMember(typ, target)
+	count, err := s.ctx.GetRedisConn().Incr(key)
+	if err != nil {
+		return 0, err
+	}
+	err = s.ctx.GetRedisConn().Expire(key, loginFailWindow)
+	if err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+func (s *loginLockService) clearCounter(typ string, target string) error {
+	member := loginLockMember(typ, target)
+	err := s.ctx.GetRedisConn().Del(loginFailCachePrefix + member)
+	if err != nil {
+		return err
+	}
+	err = s.ctx.GetRedisConn().Del(loginGateCachePrefix + member)
+	if err != nil {
+		return err
+	}
+	return s.ctx.GetRedisConn().Del(loginDelayCachePrefix + member)
+}
+
+func (s *loginLockService) getTime(key string) (time.Time, error) {
+	value, err := s.ctx.GetRedisConn().GetString(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if value == "" {
+		return time.Time{}, nil
+	}
+	ts, _ := strconv.ParseInt(value, 10, 64)
+	if ts <= 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, ts), nil
+}
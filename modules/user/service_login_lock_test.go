@@ -0,0 +1,57 @@
+package user
+
+import (
+	"testing"
+	"time"
+
+	common2 "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginFailDelay(t *testing.T) {
+	assert.Equal(t, time.Duration(0), loginFailDelay(0, 3))
+	assert.Equal(t, time.Duration(0), loginFailDelay(2, 3))
+	assert.Equal(t, time.Second, loginFailDelay(3, 3))
+	assert.Equal(t, time.Second*2, loginFailDelay(4, 3))
+	assert.Equal(t, time.Second*32, loginFailDelay(8, 3))
+	assert.Equal(t, loginFailMaxDelay, loginFailDelay(9, 3))
+	assert.Equal(t, loginFailMaxDelay, loginFailDelay(100, 3))
+}
+
+func TestNewLoginLockConfig(t *testing.T) {
+	cfg := newLoginLockConfig(nil)
+	assert.Equal(t, loginLockDefaultCaptchaCount, cfg.CaptchaCount)
+	assert.Equal(t, loginLockDefaultAccountCount, cfg.AccountCount)
+	assert.Equal(t, loginLockDefaultIPCount, cfg.IPCount)
+	assert.Equal(t, loginLockDefaultDuration, cfg.Duration)
+
+	cfg = newLoginLockConfig(&common2.AppConfigResp{LoginLockCaptchaCount: 2, LoginLockAccountCount: 6, LoginLockMinutes: 5})
+	assert.Equal(t, 2, cfg.CaptchaCount)
+	assert.Equal(t, 6, cfg.AccountCount)
+	assert.Equal(t, loginLockDefaultIPCount, cfg.IPCount)
+	assert.Equal(t, time.Minute*5, cfg.Duration)
+}
+
+func TestParseLoginLockMember(t *testing.T) {
+	typ, target, ok := parseLoginLockMember(loginLockMember(loginLockTypeIP, "2001:db8::1"))
+	assert.True(t, ok)
+	assert.Equal(t, loginLockTypeIP, typ)
+	assert.Equal(t, "2001:db8::1", target)
+
+	typ, target, ok = parseLoginLockMember(loginLockMember(loginLockTypeAccount, "u1"))
+	assert.True(t, ok)
+	assert.Equal(t, loginLockTypeAccount, typ)
+	assert.Equal(t, "u1", target)
+
+	_, _, ok = parseLoginLockMember("other:u1")
+	assert.False(t, ok)
+	_, _, ok = parseLoginLockMember("account:")
+	assert.False(t, ok)
+}
+
+func TestLoginLockMessage(t *testing.T) {
+	msg := loginLockMessage(&loginLockStatus{Locked: true, LockType: loginLockTypeAccount, RetryAfter: time.Minute*14 + time.Second}, "密码不正确！")
+	assert.Equal(t, "密码错误次数过多，账号已被暂时锁定，请15分钟后再试", msg)
+	assert.Equal(t, "密码不正确！", loginLockMessage(&loginLockStatus{RetryAfter: time.Second}, "密码不正确！"))
+	assert.Equal(t, "尝试过于频繁，请2秒后再试", loginLockMessage(&loginLockStatus{RetryAfter: time.Millisecond * 1500}, ""))
+}
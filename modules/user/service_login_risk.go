@@ -0,0 +1,140 @@
+package user
+
+import (
+	"strings"
+	"time"
+
+	utils "github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/util"
+)
+
+// 异常登录的处理方式
+const (
+	loginRiskActionNone   = 0 // 不处理
+	loginRiskActionNotify = 1 // 允许登录，系统账号发送安全提醒
+	loginRiskActionVerify = 2 // 验证手机号或邮箱后才能登录
+	loginRiskActionBlock  = 3 // 暂时禁止登录
+)
+
+// 异常登录规则
+const (
+	loginRiskRuleNewRegion = "new_region"        // 从没登录过的国家/地区登录
+	loginRiskRuleTravel    = "impossible_travel" // 与上次登录地的距离不可能在间隔时间内到达
+	loginRiskRuleFail      = "many_failures"     // 一小时内多次密码错误后登录
+)
+
+const (
+	loginRiskHistoryDays      = 90                 // 新地区对比最近多少天登录成功过的地区
+	loginRiskFailWindow       = time.Hour          // 统计密码错误次数的时间窗口
+	loginRiskTravelSpeed      = 1000.0             // 超过该速度（公里/小时）视为不可能到达
+	loginRiskTravelMinKm      = 500.0              // 距离小于该值不判断（ip库定位有误差）
+	loginRiskBlockCachePrefix = "loginrisk:block:" // 暂时禁止登录的标记
+	loginRiskTOTPCachePrefix  = "loginrisk:totp:"  // 异常登录验证手机号或邮箱后还需要两步验证的标记
+)
+
+// loginRiskConfig 异常登录规则配置（来自系统配置）
+type loginRiskConfig struct {
+	NewRegionAction int
+	TravelAction    int
+	FailAction      int
+	FailCount       int
+}
+
+// loginRiskInput 判断异常登录需要的数据
+type loginRiskInput struct {
+	Now       time.Time
+	Location  *utils.IPLocation // 本次登录地（未知为nil）
+	LastLogin *LoginLogModel    // 上次登录成功的日志
+	Regions   []*LoginLogModel  // 最近登录成功过的国家和地区
+	FailCount int               // 最近的密码错误次数
+}
+
+// loginRiskResult 命中的规则和最终的处理方式（取命中规则中最严格的）
+type loginRiskResult struct {
+	Rules  []string
+	Action int
+}
+
+func (r *loginRiskResult) rulesString() string {
+	return strings.Join(r.Rules, ",")
+}
+
+type loginRiskRule struct {
+	name   string
+	action func(cfg *loginRiskConfig) int
+	hit    func(input *loginRiskInput, cfg *loginRiskConfig) bool
+}
+
+var loginRiskRules = []loginRiskRule{
+	{
+		name:   loginRiskRuleNewRegion,
+		action: func(cfg *loginRiskConfig) int { return cfg.NewRegionAction },
+		hit: func(input *loginRiskInput, cfg *loginRiskConfig) bool {
+			if input.Location == nil || len(input.Regions) == 0 { // 首次登录没有可对比的地区
+				return false
+			}
+			for _, region := range input.Regions {
+				if region.Country == input.Location.Country && region.Region == input.Location.Region {
+					return false
+				}
+			}
+			return true
+		},
+	},
+	{
+		name:   loginRiskRuleTravel,
+		action: func(cfg *loginRiskConfig) int { return cfg.TravelAction },
+		hit: func(input *loginRiskInput, cfg *loginRiskConfig) bool {
+			if !input.Location.HasCoordinate() || input.LastLogin == nil || (input.LastLogin.Longitude == 0 && input.LastLogin.Latitude == 0) {
+				return false
+			}
+			distance := utils.GeoDistance(input.LastLogin.Latitude, input.LastLogin.Longitude, input.Location.Latitude, input.Location.Longitude)
+			if distance < loginRiskTravelMinKm {
+				return false
+			}
+			hours := input.Now.Sub(time.Time(input.LastLogin.CreatedAt)).Hours()
+			if hours <= 0 {
+				return true
+			}
+			return distance/hours > loginRiskTravelSpeed
+		},
+	},
+	{
+		name:   loginRiskRuleFail,
+		action: func(cfg *loginRiskConfig) int { return cfg.FailAction },
+		hit: func(input *loginRiskInput, cfg *loginRiskConfig) bool {
+			return cfg.FailCount > 0 && input.FailCount >= cfg.FailCount
+		},
+	},
+}
+
+// evaluateLoginRisk 按规则判断本次登录是否异常
+func evaluateLoginRisk(input *loginRiskInput, cfg *loginRiskConfig) *loginRiskResult {
+	result := &loginRiskResult{
+		Rules:  make([]string, 0),
+		Action: loginRiskActionNone,
+	}
+	for _, rule := range loginRiskRules {
+		action := rule.action(cfg)
+		if action <= loginRiskActionNone || !rule.hit(input, cfg) {
+			continue
+		}
+		result.Rules = append(result.Rules, rule.name)
+		if action > result.Action {
+			result.Action = action
+		}
+	}
+	return result
+}
+
+// loginRiskRuleDesc 规则说明（用于安全提醒）
+func loginRiskRuleDesc(rule string) string {
+	switch rule {
+	case loginRiskRuleNewRegion:
+		return "从新的地区登录"
+	case loginRiskRuleTravel:
+		return "与上次登录地相距过远"
+	case loginRiskRuleFail:
+		return "登录前多次输入错误密码"
+	}
+	return rule
+}
@@ -0,0 +1,55 @@
+package user
+
+import (
+	"testing"
+	"time"
+
+	utils "github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/db"
+)
+
+func TestEvaluateLoginRisk(t *testing.T) {
+	cfg := &loginRiskConfig{
+		NewRegionAction: loginRiskActionNotify,
+		TravelAction:    loginRiskActionVerify,
+		FailAction:      loginRiskActionBlock,
+		FailCount:       5,
+	}
+	now := time.Now()
+	shenzhen := &utils.IPLocation{Country: "中国", Region: "广东", City: "深圳", Longitude: 114.0579, Latitude: 22.5431}
+	beijing := &utils.IPLocation{Country: "中国", Region: "北京", City: "北京", Longitude: 116.4074, Latitude: 39.9042}
+	lastLogin := &LoginLogModel{Country: "中国", Region: "广东", Longitude: 114.0579, Latitude: 22.5431}
+	lastLogin.CreatedAt = db.Time(now.Add(-time.Hour))
+	regions := []*LoginLogModel{{Country: "中国", Region: "广东"}}
+
+	// 常用地区登录
+	result := evaluateLoginRisk(&loginRiskInput{Now: now, Location: shenzhen, LastLogin: lastLogin, Regions: regions}, cfg)
+	assert.Equal(t, loginRiskActionNone, result.Action)
+	assert.Len(t, result.Rules, 0)
+
+	// 首次登录没有历史不算新地区
+	result = evaluateLoginRisk(&loginRiskInput{Now: now, Location: beijing}, cfg)
+	assert.Equal(t, loginRiskActionNone, result.Action)
+
+	// 一小时前在深圳，现在在北京（约1940公里）
+	result = evaluateLoginRisk(&loginRiskInput{Now: now, Location: beijing, LastLogin: lastLogin, Regions: regions}, cfg)
+	assert.Equal(t, []string{loginRiskRuleNewRegion, loginRiskRuleTravel}, result.Rules)
+	assert.Equal(t, loginRiskActionVerify, result.Action)
+
+	// 一天前在深圳，只是新地区
+	lastLogin.CreatedAt = db.Time(now.Add(-time.Hour * 24))
+	result = evaluateLoginRisk(&loginRiskInput{Now: now, Location: beijing, LastLogin: lastLogin, Regions: regions}, cfg)
+	assert.Equal(t, []string{loginRiskRuleNewRegion}, result.Rules)
+	assert.Equal(t, loginRiskActionNotify, result.Action)
+
+	// 多次密码错误，取最严格的处理方式
+	result = evaluateLoginRisk(&loginRiskInput{Now: now, Location: beijing, LastLogin: lastLogin, Regions: regions, FailCount: 5}, cfg)
+	assert.Equal(t, []string{loginRiskRuleNewRegion, loginRiskRuleFail}, result.Rules)
+	assert.Equal(t, loginRiskActionBlock, result.Action)
+
+	// 规则的处理方式为不处理时不命中
+	cfg.FailAction = loginRiskActionNone
+	result = evaluateLoginRisk(&loginRiskInput{Now: now, Location: shenzhen, Regions: regions, FailCount: 10}, cfg)
+	assert.Equal(t, loginRiskActionNone, result.Action)
+}
@@ -0,0 +1,314 @@
+package user
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	utils "github.com/TangSengDaoDao/TangSengDaoDaoServer/pkg/util"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	sessionTokenCachePrefix  = "sessiontoken:"  // 会话ID对应的token（撤销会话时用于清除token缓存）
+	sessionActiveCachePrefix = "sessionactive:" // 会话最近已更新过活跃时间的标记
+	sessionActiveInterval    = time.Minute * 5  // 活跃时间的最小更新间隔
+	sessionUserAgentMaxLen   = 255
+)
+
+// sessionClient 登录的客户端信息
+type sessionClient struct {
+	IP        string
+	UserAgent string
+}
+
+func newSessionClient(c *wkhttp.Context) *sessionClient {
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > sessionUserAgentMaxLen {
+		userAgent = userAgent[:sessionUserAgentMaxLen]
+	}
+	return &sessionClient{
+		IP:        utils.GetClientPublicIP(c.Request),
+		UserAgent: userAgent,
+	}
+}
+
+// sessionService 登录会话管理（每个登录token对应一个会话）
+type sessionService struct {
+	ctx *config.Context
+	log.Log
+	sessionDB *sessionDB
+}
+
+func newSessionService(ctx *config.Context) *sessionService {
+	return &sessionService{
+		ctx:       ctx,
+		Log:       log.NewTLog("sessionService"),
+		sessionDB: newSessionDB(ctx),
+	}
+}
+
+// sessionIDWithToken 根据token计算会话ID（列表中只暴露会话ID，不暴露token）
+func sessionIDWithToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:16])
+}
+
+// add 登录成功后记录会话
+func (s *sessionService) add(uid string, token string, flag config.DeviceFlag, device *deviceReq, client *sessionClient) error {
+	sessionID := sessionIDWithToken(token)
+	tokenExpire := s.ctx.GetConfig().Cache.TokenExpire
+	now := time.Now()
+	m := &sessionModel{
+		UID:        uid,
+		SessionID:  sessionID,
+		DeviceFlag: int(flag),
+		LastSeenAt: now.Unix(),
+		ExpireAt:   now.Add(tokenExpire).Unix(),
+	}
+	if device != nil {
+		m.DeviceID = device.DeviceID
+		m.DeviceName = device.DeviceName
+		m.DeviceModel = device.DeviceModel
+	}
+	if client != nil {
+		m.IP = client.IP
+		m.UserAgent = client.UserAgent
+	}
+	err := s.ctx.GetRedisConn().SetAndExpire(sessionTokenCachePrefix+sessionID, token, tokenExpire)
+	if err != nil {
+		return err
+	}
+	err = s.sessionDB.insertOrUpdate(m)
+	if err != nil {
+		return err
+	}
+	err = s.sessionDB.deleteExpired(uid)
+	if err != nil {
+		s.Warn("删除过期会话失败！", zap.Error(err), zap.String("uid", uid))
+	}
+	return nil
+}
+
+// removeWithToken token被替换后删除对应的会话
+func (s *sessionService) removeWithToken(uid string, token string) error {
+	sessionID := sessionIDWithToken(token)
+	err := s.ctx.GetRedisConn().Del(sessionTokenCachePrefix + sessionID)
+	if err != nil {
+		return err
+	}
+	return s.sessionDB.deleteWithSessionID(uid, sessionID)
+}
+
+// list 用户未过期的会话
+func (s *sessionService) list(uid string) ([]*sessionModel, error) {
+	return s.sessionDB.queryWithUID(uid)
+}
+
+// revoke 撤销会话：立即清除token缓存并删除会话
+// 只有该会话的token是IM当前使用的token时才作废IM的token并踢下线（IM每个设备类型只保存一个token，不能误踢同类型的其他会话）
+func (s *sessionService) revoke(session *sessionModel) error {
+	token, err := s.ctx.GetRedisConn().GetString(sessionTokenCachePrefix + session.SessionID)
+	if err != nil {
+		return err
+	}
+	imToken := false
+	if token != "" {
+		imToken, err = s.clearToken(session.UID, session.DeviceFlag, token)
+		if err != nil {
+			return err
+		}
+		err = s.ctx.GetRedisConn().Del(sessionTokenCachePrefix + session.SessionID)
+		if err != nil {
+			return err
+		}
+	}
+	err = s.sessionDB.deleteWithSessionID(session.UID, session.SessionID)
+	if err != nil {
+		return err
+	}
+	if imToken {
+		s.quitIM(session.UID, session.DeviceFlag)
+	}
+	return nil
+}
+
+// logout 退出登录：清除当前token并删除对应的会话（IM连接由客户端自己断开）
+func (s *sessionService) logout(uid string, token string) error {
+	if token == "" {
+		return nil
+	}
+	session, err := s.sessionDB.queryWithUIDAndSessionID(uid, sessionIDWithToken(token))
+	if err != nil {
+		return err
+	}
+	if session != nil {
+		_, err = s.clearToken(uid, session.DeviceFlag, token)
+	} else {
+		err = s.ctx.Cache().Delete(s.ctx.GetConfig().Cache.TokenCachePrefix + token)
+	}
+	if err != nil {
+		return err
+	}
+	return s.removeWithToken(uid, token)
+}
+
+// revokeWithDeviceFlag 撤销某个设备类型的所有会话（app退出web或pc登录时使用）
+// 没有会话记录的旧登录通过uidtoken缓存找到token后清除
+func (s *sessionService) revokeWithDeviceFlag(uid string, flag config.DeviceFlag) error {
+	sessions, err := s.sessionDB.queryWithUID(uid)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.DeviceFlag != int(flag) {
+			continue
+		}
+		if err = s.revoke(session); err != nil {
+			return err
+		}
+	}
+	token, err := s.ctx.Cache().Get(s.uidTokenKey(uid, int(flag)))
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return nil
+	}
+	imToken, err := s.clearToken(uid, int(flag), token)
+	if err != nil {
+		return err
+	}
+	err = s.removeWithToken(uid, token)
+	if err != nil {
+		return err
+	}
+	if imToken {
+		s.quitIM(uid, int(flag))
+	}
+	return nil
+}
+
+// revokeWithDeviceID 撤销某个设备上的所有会话（删除登录设备时使用）
+func (s *sessionService) revokeWithDeviceID(uid string, deviceID string) error {
+	if deviceID == "" {
+		return nil
+	}
+	sessions, err := s.sessionDB.queryWithUID(uid)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.DeviceID != deviceID {
+			continue
+		}
+		if err = s.revoke(session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearToken 清除token缓存，返回该token是否是此设备类型当前使用的token（即IM当前的token）
+func (s *sessionService) clearToken(uid string, deviceFlag int, token string) (bool, error) {
+	err := s.ctx.Cache().Delete(s.ctx.GetConfig().Cache.TokenCachePrefix + token)
+	if err != nil {
+		return false, err
+	}
+	uidTokenKey := s.uidTokenKey(uid, deviceFlag)
+	uidToken, err := s.ctx.Cache().Get(uidTokenKey)
+	if err != nil {
+		return false, err
+	}
+	if uidToken != token {
+		return false, nil
+	}
+	err = s.ctx.Cache().Delete(uidTokenKey)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// quitIM 把IM的token换成随机值后踢下线，被撤销的token无法再连接IM
+func (s *sessionService) quitIM(uid string, deviceFlag int) {
+	deviceLevel := config.DeviceLevelSlave
+	if deviceFlag == int(config.APP) {
+		deviceLevel = config.DeviceLevelMaster
+	}
+	_, err := s.ctx.UpdateIMToken(config.UpdateIMTokenReq{
+		UID:         uid,
+		Token:       util.GenerUUID(),
+		DeviceFlag:  config.DeviceFlag(deviceFlag),
+		DeviceLevel: deviceLevel,
+	})
+	if err != nil {
+		s.Warn("作废IM的token失败！", zap.Error(err), zap.String("uid", uid), zap.Int("deviceFlag", deviceFlag))
+	}
+	err = s.ctx.QuitUserDevice(uid, deviceFlag)
+	if err != nil {
+		s.Warn("踢下线IM设备失败！", zap.Error(err), zap.String("uid", uid), zap.Int("deviceFlag", deviceFlag))
+	}
+}
+
+func (s *sessionService) uidTokenKey(uid string, deviceFlag int) string {
+	return fmt.Sprintf("%s%d%s", s.ctx.GetConfig().Cache.UIDTokenCachePrefix, deviceFlag, uid)
+}
+
+// revokeAll 撤销用户的所有会话，exceptSessionID不为空时保留该会话
+func (s *sessionService) revokeAll(uid string, exceptSessionID string) (int, error) {
+	sessions, err := s.sessionDB.queryWithUID(uid)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, session := range sessions {
+		if session.SessionID == exceptSessionID {
+			continue
+		}
+		err = s.revoke(session)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// touch 更新会话的最后活跃时间（每个会话最多每sessionActiveInterval更新一次）
+func (s *sessionService) touch(uid string, token string, ip string) {
+	sessionID := sessionIDWithToken(token)
+	activeKey := sessionActiveCachePrefix + sessionID
+	active, err := s.ctx.GetRedisConn().GetString(activeKey)
+	if err != nil {
+		s.Warn("获取会话活跃标记失败！", zap.Error(err))
+		return
+	}
+	if active != "" {
+		return
+	}
+	err = s.ctx.GetRedisConn().SetAndExpire(activeKey, "1", sessionActiveInterval)
+	if err != nil {
+		s.Warn("设置会话活跃标记失败！", zap.Error(err))
+		return
+	}
+	err = s.sessionDB.updateLastSeen(uid, sessionID, ip, time.Now().Unix())
+	if err != nil {
+		s.Warn("更新会话活跃时间失败！", zap.Error(err), zap.String("uid", uid))
+	}
+}
+
+// sessionActiveMiddleware 记录会话活跃时间（需要放在认证中间件之后）
+func (s *sessionService) sessionActiveMiddleware(c *wkhttp.Context) {
+	token := c.GetHeader("token")
+	loginUID := c.GetString("uid")
+	if token != "" && loginUID != "" {
+		s.touch(loginUID, token, utils.GetClientPublicIP(c.Request))
+	}
+	c.Next()
+}
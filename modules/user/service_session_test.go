@@ -0,0 +1,15 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionIDWithToken(t *testing.T) {
+	sessionID := sessionIDWithToken("token1")
+	assert.Len(t, sessionID, 32)
+	assert.Equal(t, sessionID, sessionIDWithToken("token1"))
+	assert.NotEqual(t, sessionID, sessionIDWithToken("token2"))
+	assert.NotContains(t, sessionID, "token1")
+}
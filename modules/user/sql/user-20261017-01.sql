@@ -0,0 +1,9 @@
+-- +migrate Up
+
+ALTER TABLE `user` ADD COLUMN dnd_on smallint NOT NULL DEFAULT 0 COMMENT '是否开启勿扰时段 0.否 1.是';
+ALTER TABLE `user` ADD COLUMN dnd_start VARCHAR(5) NOT NULL DEFAULT '22:00' COMMENT '勿扰开始时间 HH:MM';
+ALTER TABLE `user` ADD COLUMN dnd_end VARCHAR(5) NOT NULL DEFAULT '07:00' COMMENT '勿扰结束时间 HH:MM（小于开始时间表示跨天）';
+ALTER TABLE `user` ADD COLUMN dnd_timezone VARCHAR(64) NOT NULL DEFAULT '' COMMENT '勿扰时段所在时区（IANA时区名，如Asia/Shanghai）';
+ALTER TABLE `user` ADD COLUMN dnd_weekdays smallint NOT NULL DEFAULT 127 COMMENT '勿扰生效的星期掩码 bit0.周日 bit1.周一 ... bit6.周六';
+ALTER TABLE `user` ADD COLUMN dnd_allow_call smallint NOT NULL DEFAULT 1 COMMENT '勿扰时段是否允许音视频来电通知 0.否 1.是';
+ALTER TABLE `user` ADD COLUMN dnd_allow_mention smallint NOT NULL DEFAULT 0 COMMENT '勿扰时段是否允许@我的消息通知 0.否 1.是';
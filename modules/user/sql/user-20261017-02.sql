@@ -0,0 +1,4 @@
+-- +migrate Up
+
+-- 密码改为argon2id等带算法前缀的哈希，长度需要加大（旧的md5哈希在登录时自动升级）
+ALTER TABLE `user` MODIFY COLUMN password VARCHAR(255) not null default '' comment '密码哈希';
@@ -0,0 +1,25 @@
+-- +migrate Up
+
+-- 两步验证（TOTP）
+create table `user_totp`
+(
+  id           integer      not null primary key AUTO_INCREMENT,
+  uid          VARCHAR(40)  not null default '',                             -- 用户uid
+  secret       VARCHAR(100) not null default '',                             -- TOTP密钥（base32）
+  status       smallint     not null default 0,                              -- 状态 0.待确认 1.已启用
+  last_counter BIGINT       not null default 0,                              -- 最后一次使用的时间步（防止验证码重放）
+  created_at   timeStamp    not null DEFAULT CURRENT_TIMESTAMP,              -- 创建时间
+  updated_at   timeStamp    not null DEFAULT CURRENT_TIMESTAMP               -- 更新时间
+);
+CREATE UNIQUE INDEX user_totp_uid on `user_totp` (uid);
+
+-- 两步验证恢复码（只保存hash，使用后删除）
+create table `user_totp_recovery_code`
+(
+  id         integer      not null primary key AUTO_INCREMENT,
+  uid        VARCHAR(40)  not null default '',                               -- 用户uid
+  code_hash  VARCHAR(64)  not null default '',                               -- 恢复码的sha256
+  created_at timeStamp    not null DEFAULT CURRENT_TIMESTAMP,                -- 创建时间
+  updated_at timeStamp    not null DEFAULT CURRENT_TIMESTAMP                 -- 更新时间
+);
+CREATE UNIQUE INDEX user_totp_recovery_code_uid_code on `user_totp_recovery_code` (uid, code_hash);
@@ -0,0 +1,11 @@
+-- +migrate Up
+
+-- 同一邮箱被多个账号绑定时只保留最早的账号，其他账号需要重新绑定
+UPDATE `user` u INNER JOIN (SELECT LOWER(email) email, MIN(id) id FROM `user` WHERE email<>'' GROUP BY LOWER(email) HAVING COUNT(*)>1) d ON LOWER(u.email)=d.email AND u.id<>d.id SET u.email='';
+
+-- 邮箱登录、找回密码和注册时按邮箱查询
+CREATE INDEX user_email_idx on `user` (email);
+
+-- 一个邮箱只能绑定一个账号（未绑定邮箱时email为空字符串，唯一索引建在把空字符串转为NULL的生成列上）
+ALTER TABLE `user` ADD COLUMN email_key VARCHAR(100) GENERATED ALWAYS AS (NULLIF(email, '')) VIRTUAL COMMENT '唯一的邮箱，未绑定时为NULL';
+CREATE UNIQUE INDEX user_email_key on `user` (email_key);
@@ -0,0 +1,21 @@
+-- +migrate Up
+
+-- 登录会话（每个token一条，token失效或被撤销后删除）
+create table `user_session`
+(
+  id           integer      not null primary key AUTO_INCREMENT,
+  uid          VARCHAR(40)  not null default '',                             -- 用户uid
+  session_id   VARCHAR(40)  not null default '',                             -- 会话ID（由token计算，不可反推token）
+  device_flag  smallint     not null default 0,                              -- 设备标记 0.app 1.web 2.pc
+  device_id    VARCHAR(40)  not null default '',                             -- 设备ID
+  device_name  VARCHAR(100) not null default '',                             -- 设备名称
+  device_model VARCHAR(100) not null default '',                             -- 设备型号
+  ip           VARCHAR(50)  not null default '',                             -- 最后访问的IP
+  user_agent   VARCHAR(255) not null default '',                             -- 登录时的User-Agent
+  last_seen_at BIGINT       not null default 0,                              -- 最后活跃时间（秒）
+  expire_at    BIGINT       not null default 0,                              -- token过期时间（秒）
+  created_at   timeStamp    not null DEFAULT CURRENT_TIMESTAMP,              -- 创建时间
+  updated_at   timeStamp    not null DEFAULT CURRENT_TIMESTAMP               -- 更新时间
+);
+CREATE UNIQUE INDEX user_session_session_id on `user_session` (session_id);
+CREATE INDEX user_session_uid on `user_session` (uid);
@@ -0,0 +1,11 @@
+-- +migrate Up
+
+ALTER TABLE `login_log` ADD COLUMN status smallint not null DEFAULT 1 COMMENT '登录结果 0.密码错误 1.成功 2.异常登录';
+ALTER TABLE `login_log` ADD COLUMN country VARCHAR(50) not null DEFAULT '' COMMENT '登录国家';
+ALTER TABLE `login_log` ADD COLUMN region VARCHAR(50) not null DEFAULT '' COMMENT '登录省份/地区';
+ALTER TABLE `login_log` ADD COLUMN city VARCHAR(50) not null DEFAULT '' COMMENT '登录城市';
+ALTER TABLE `login_log` ADD COLUMN longitude DECIMAL(10,6) not null DEFAULT 0 COMMENT '经度';
+ALTER TABLE `login_log` ADD COLUMN latitude DECIMAL(10,6) not null DEFAULT 0 COMMENT '纬度';
+ALTER TABLE `login_log` ADD COLUMN risk VARCHAR(100) not null DEFAULT '' COMMENT '命中的异常登录规则（多个用逗号分隔）';
+ALTER TABLE `login_log` ADD COLUMN risk_action smallint not null DEFAULT 0 COMMENT '异常登录的处理方式 1.安全提醒 2.验证手机号或邮箱 3.暂时禁止登录';
+CREATE INDEX login_log_uid_created_at on `login_log` (uid, created_at);
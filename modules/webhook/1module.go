@@ -28,4 +28,15 @@ func init() {
 			},
 		}
 	})
+
+	// 注册推送管理模块
+	register.AddModule(func(ctx interface{}) register.Module {
+
+		return register.Module{
+			Name: "webhook_manager",
+			SetupAPI: func() register.APIRouter {
+				return NewManager(ctx.(*config.Context))
+			},
+		}
+	})
 }
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,7 +13,9 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"time"
 
+	common2 "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/common"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/group"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/user"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/common"
@@ -32,11 +36,13 @@ type Webhook struct {
 	supportTypes []common.ContentType
 	db           *DB
 	messageDB    *messageDB
+	pushLogDB    *pushLogDB
 	pushMap      map[common.DeviceType]map[string]Push
 	groupService group.IService
 	userService  user.IService
 	wkhook.UnimplementedWebhookServiceServer
-	grpcServer *grpc.Server
+	grpcServer   *grpc.Server
+	callbackAuth *callbackAuth
 }
 
 // New New
@@ -90,30 +96,46 @@ func New(ctx *config.Context) *Webhook {
 		Log:          log.NewTLog("Webhook"),
 		pushMap:      pushMap,
 		messageDB:    newMessageDB(ctx),
+		pushLogDB:    newPushLogDB(ctx),
 		groupService: group.NewService(ctx),
 		userService:  user.NewService(ctx),
+		callbackAuth: newCallbackAuth(ctx),
 	}
 }
+
+const (
+	pushMaxAttempts    = 3               // 单个设备最多推送次数（包含重试）
+	pushRetryBaseDelay = time.Second * 2 // 推送重试的基础间隔，每次重试翻倍
+	pushLogKeepDays    = 30              // 推送记录保留天数
+)
+
 func getSupportTypes() []common.ContentType {
 	return []common.ContentType{common.Text, common.Image, common.GIF, common.Voice, common.Video, common.File, common.Location, common.Card, common.MultipleForward, common.VectorSticker, common.EmojiSticker}
 }
 
 // Route 路由配置
 func (w *Webhook) Route(r *wkhttp.WKHttp) {
-	r.POST("/v1/webhook", w.webhook)
+	// IM回调需要校验来源IP和签名
+	imAuth := w.callbackAuth.httpMiddleware
+
+	r.POST("/v1/webhook", imAuth, w.webhook)
 
-	r.POST("/v2/webhook", w.webhook)
+	r.POST("/v2/webhook", imAuth, w.webhook)
 
-	r.POST("/v1/datasource", w.datasource)
+	r.POST("/v1/datasource", imAuth, w.datasource)
 
-	r.POST("/v1/webhook/message/notify", w.messageNotify) // 接受IM的消息通知,(TODO: 此接口需要与IM做安全认证)
+	r.POST("/v1/webhook/message/notify", imAuth, w.messageNotify) // 接受IM的消息通知
 
 	r.POST("/v1/webhook/github", w.github) // github webhook
 
 }
 
 func (w *Webhook) Start() error {
-	w.grpcServer = grpc.NewServer()
+	opts, err := w.callbackAuth.grpcServerOptions()
+	if err != nil {
+		return err
+	}
+	w.grpcServer = grpc.NewServer(opts...)
 
 	lis, err := net.Listen("tcp", w.ctx.GetConfig().GRPCAddr)
 	if err != nil {
@@ -123,6 +145,8 @@ func (w *Webhook) Start() error {
 	// 注册grpc服务
 	wkhook.RegisterWebhookServiceServer(w.grpcServer, w)
 
+	w.ctx.Schedule(time.Hour, w.cleanPushLogs) // 定时清除过期的推送记录
+
 	go func() {
 		err = w.grpcServer.Serve(lis)
 		if err != nil {
@@ -389,7 +413,9 @@ func (w *Webhook) pushTo(msgResp msgOfflineNotify, toUids []string) error {
 		return nil
 	}
 	fromUID := ""
-	if !isVideoCall { // 音视频消息不检查设置，直接推送
+	var mentionAll bool      // 是否@所有人（仅群主和管理员的@所有人有效）
+	var mentionUIDs []string // 被@的用户
+	if !isVideoCall {        // 音视频消息不检查设置，直接推送
 		// 查询免打扰
 		// 查询用户总设置
 		if msgResp.ChannelType == common.ChannelTypePerson.Uint8() {
@@ -411,12 +437,24 @@ func (w *Webhook) pushTo(msgResp msgOfflineNotify, toUids []string) error {
 				w.Error("查询一批用户对某群设置错误", zap.Error(err))
 				return nil
 			}
+			if msgResp.PayloadMap != nil {
+				mentionAll, mentionUIDs = common2.GetMention(msgResp.PayloadMap)
+				if mentionAll {
+					mentionAll, err = w.groupService.IsCreatorOrManager(msgResp.ChannelID, msgResp.FromUID)
+					if err != nil {
+						w.Warn("查询发送者是否是群管理者失败！", zap.Error(err), zap.String("fromUID", msgResp.FromUID))
+						mentionAll = false
+					}
+				}
+			}
 		}
 	}
 
+	now := time.Now()
 	for _, toUID := range toUids {
+		mentioned := mentionAll || isMentioned(mentionUIDs, toUID)
 		if !isVideoCall {
-			if !w.allowPush(users, userSettings, groupSettings, toUID, fromUID) {
+			if !w.allowPush(users, userSettings, groupSettings, toUID, fromUID, mentioned) {
 				continue
 			}
 		} else {
@@ -435,6 +473,10 @@ func (w *Webhook) pushTo(msgResp msgOfflineNotify, toUids []string) error {
 			w.Error("没有找到toUser", zap.String("toUID", toUID))
 			continue
 		}
+		if !allowPushInDND(toUser.DoNotDisturb, now, isVideoCall, mentioned) {
+			w.Debug("勿扰时段内不推送", zap.String("toUID", toUID))
+			continue
+		}
 
 		w.ctx.PushPool.Work <- &pool.Job{
 			Data: map[string]interface{}{
@@ -445,11 +487,17 @@ func (w *Webhook) pushTo(msgResp msgOfflineNotify, toUids []string) error {
 				dataMap := data.(map[string]interface{})
 				toUser := dataMap["toUser"].(*user.Resp)
 				msgResp := dataMap["msg"].(msgOfflineNotify)
-				result, err := w.push(toUser, msgResp)
+				results, err := w.push(toUser, msgResp)
 				if err != nil {
-					w.Debug("推送失败！", zap.String("uid", toUser.UID), zap.String("deviceType", result.deviceType), zap.String("deviceToken", result.deviceToken), zap.Error(err))
-				} else {
-					w.Debug("推送成功！", zap.String("uid", toUser.UID), zap.String("deviceType", result.deviceType), zap.String("deviceToken", result.deviceToken))
+					w.Debug("推送失败！", zap.String("uid", toUser.UID), zap.Error(err))
+					return
+				}
+				for _, result := range results {
+					if result.err != nil {
+						w.Debug("推送失败！", zap.String("uid", toUser.UID), zap.String("deviceType", result.deviceType), zap.String("deviceToken", result.deviceToken), zap.Error(result.err))
+					} else {
+						w.Debug("推送成功！", zap.String("uid", toUser.UID), zap.String("deviceType", result.deviceType), zap.String("deviceToken", result.deviceToken))
+					}
 				}
 			},
 		}
@@ -458,8 +506,8 @@ func (w *Webhook) pushTo(msgResp msgOfflineNotify, toUids []string) error {
 	return nil
 }
 
-// 是否允许推送
-func (w *Webhook) allowPush(users []*user.Resp, userSettings []*user.SettingResp, groupSettings []*group.SettingResp, toUID string, fromUID string) bool {
+// 是否允许推送（群内被@的消息不受免打扰和仅@我通知的限制）
+func (w *Webhook) allowPush(users []*user.Resp, userSettings []*user.SettingResp, groupSettings []*group.SettingResp, toUID string, fromUID string, mentioned bool) bool {
 	isPush := true
 	if len(users) > 0 {
 		for _, user := range users {
@@ -485,7 +533,7 @@ func (w *Webhook) allowPush(users []*user.Resp, userSettings []*user.SettingResp
 	if isPush && groupSettings != nil && len(groupSettings) > 0 {
 		for _, groupSetting := range groupSettings {
 			if groupSetting.UID == toUID {
-				if groupSetting.Mute == 1 {
+				if (groupSetting.Mute == 1 || groupSetting.MentionOnly == 1) && !mentioned {
 					isPush = false
 				}
 				break
@@ -495,55 +543,138 @@ func (w *Webhook) allowPush(users []*user.Resp, userSettings []*user.SettingResp
 	return isPush
 }
 
-func (w *Webhook) push(toUser *user.Resp, msgResp msgOfflineNotify) (pushResp, error) {
+// allowPushInDND 勿扰时段内是否允许推送（音视频来电和@我的消息可按用户设置放行）
+func allowPushInDND(dnd user.DoNotDisturb, now time.Time, isVideoCall bool, mentioned bool) bool {
+	if !dnd.Active(now) {
+		return true
+	}
+	if isVideoCall {
+		return dnd.AllowCall == 1
+	}
+	if mentioned {
+		return dnd.AllowMention == 1
+	}
+	return false
+}
 
+// push 推送给用户所有已注册的设备
+func (w *Webhook) push(toUser *user.Resp, msgResp msgOfflineNotify) ([]pushResp, error) {
+	deviceTokens, err := w.userService.GetDeviceTokens(toUser.UID)
+	if err != nil {
+		return nil, err
+	}
+	if len(deviceTokens) <= 0 {
+		return nil, errors.New("用户设备信息不存在！")
+	}
+	results := make([]pushResp, 0, len(deviceTokens))
+	for _, deviceToken := range deviceTokens {
+		results = append(results, w.pushDevice(toUser, deviceToken, msgResp, 1))
+	}
+	return results, nil
+}
+
+// pushDevice 推送给用户的某个设备并记录推送结果（临时性错误会延迟重试）
+func (w *Webhook) pushDevice(toUser *user.Resp, deviceToken *user.DeviceTokenModel, msgResp msgOfflineNotify, attempt int) pushResp {
 	toUID := toUser.UID
-	var deviceMap map[string]string
-	deviceMap, err := w.ctx.GetRedisConn().Hgetall(fmt.Sprintf("%s%s", common.UserDeviceTokenPrefix, toUID))
+	start := time.Now()
+	err := w.pushToDevice(toUser, deviceToken, msgResp)
+	latency := time.Since(start).Milliseconds()
+
+	status := PushStatusSuccess
+	retry := false
 	if err != nil {
-		return pushResp{}, err
+		if errors.Is(err, ErrDeviceTokenInvalid) { // 厂商返回token已失效，清除此设备
+			status = PushStatusTokenInvalid
+			w.Info("设备token已失效，清除设备token", zap.String("uid", toUID), zap.String("deviceType", deviceToken.DeviceType), zap.String("deviceID", deviceToken.DeviceID))
+			if rmErr := w.userService.RemoveDeviceToken(toUID, deviceToken.DeviceKey()); rmErr != nil {
+				w.Warn("清除失效的设备token失败！", zap.Error(rmErr), zap.String("uid", toUID))
+			}
+		} else if isRetryablePushError(err) && attempt < pushMaxAttempts {
+			status = PushStatusRetrying
+			retry = true
+		} else {
+			status = PushStatusFail
+		}
 	}
-	if len(deviceMap) <= 0 {
-		return pushResp{}, errors.New("用户设备信息不存在！")
+	w.savePushLog(toUID, deviceToken, msgResp, status, attempt, latency, err)
+	if retry {
+		w.retryPush(toUser, deviceToken, msgResp, attempt+1)
+	}
+	return pushResp{
+		deviceID:    deviceToken.DeviceID,
+		deviceType:  deviceToken.DeviceType,
+		deviceToken: deviceToken.DeviceToken,
+		err:         err,
 	}
-	deviceToken := deviceMap["device_token"]
-	deviceType := deviceMap["device_type"]
-	bundleID := deviceMap["bundle_id"]
+}
 
-	w.Debug("开始推送", zap.String("uid", toUID), zap.String("deviceType", deviceType), zap.String("deviceToken", deviceToken))
+// retryPush 指数退避后重新推送给某个设备
+func (w *Webhook) retryPush(toUser *user.Resp, deviceToken *user.DeviceTokenModel, msgResp msgOfflineNotify, attempt int) {
+	delay := pushRetryBaseDelay * time.Duration(1<<uint(attempt-2))
+	w.Debug("推送失败，稍后重试", zap.String("uid", toUser.UID), zap.String("deviceType", deviceToken.DeviceType), zap.Int("attempt", attempt), zap.Duration("delay", delay))
+	time.AfterFunc(delay, func() {
+		w.ctx.PushPool.Work <- &pool.Job{
+			JobFunc: func(id int64, data interface{}) {
+				result := w.pushDevice(toUser, deviceToken, msgResp, attempt)
+				if result.err != nil {
+					w.Debug("重试推送失败！", zap.String("uid", toUser.UID), zap.String("deviceType", result.deviceType), zap.Int("attempt", attempt), zap.Error(result.err))
+				}
+			},
+		}
+	})
+}
 
-	if w.pushMap[common.DeviceType(deviceType)] == nil {
-		return pushResp{
-			deviceType:  deviceType,
-			deviceToken: deviceToken,
-		}, errors.New("不支持的推送设备！")
+// savePushLog 保存推送记录
+func (w *Webhook) savePushLog(toUID string, deviceToken *user.DeviceTokenModel, msgResp msgOfflineNotify, status PushStatus, attempt int, latency int64, pushErr error) {
+	var errorMsg string
+	if pushErr != nil {
+		errorMsg = pushErr.Error()
+		if len([]rune(errorMsg)) > 500 {
+			errorMsg = string([]rune(errorMsg)[:500])
+		}
 	}
-	pusher := w.pushMap[common.DeviceType(deviceType)][bundleID]
-	if pusher == nil {
-		w.Warn("不支持的推送设备！", zap.String("deviceType", deviceType), zap.String("uid", toUID), zap.String("bundleID", bundleID))
-		return pushResp{
-			deviceType:  deviceType,
-			deviceToken: deviceToken,
-		}, errors.New("不支持的推送设备！")
+	tokenHash := sha256.Sum256([]byte(deviceToken.DeviceToken))
+	err := w.pushLogDB.insert(&pushLogModel{
+		UID:         toUID,
+		MessageID:   fmt.Sprintf("%d", msgResp.MessageID),
+		ChannelID:   msgResp.ChannelID,
+		ChannelType: msgResp.ChannelType,
+		DeviceID:    deviceToken.DeviceID,
+		Vendor:      deviceToken.DeviceType,
+		TokenHash:   hex.EncodeToString(tokenHash[:]),
+		Status:      int(status),
+		Attempt:     attempt,
+		ErrorCode:   pushErrorCode(pushErr),
+		ErrorMsg:    errorMsg,
+		Latency:     latency,
+	})
+	if err != nil {
+		w.Warn("保存推送记录失败！", zap.Error(err), zap.String("uid", toUID))
 	}
-	payload, err := pusher.GetPayload(msgResp, w.ctx, toUser)
+}
+
+// cleanPushLogs 清除过期的推送记录
+func (w *Webhook) cleanPushLogs() {
+	err := w.pushLogDB.deleteBefore(time.Now().AddDate(0, 0, -pushLogKeepDays))
 	if err != nil {
-		return pushResp{
-			deviceType:  deviceType,
-			deviceToken: deviceToken,
-		}, err
+		w.Warn("清除过期的推送记录失败！", zap.Error(err))
 	}
-	err = pusher.Push(deviceToken, payload)
+}
+
+// pushToDevice 推送给用户的某个设备
+func (w *Webhook) pushToDevice(toUser *user.Resp, deviceToken *user.DeviceTokenModel, msgResp msgOfflineNotify) error {
+	w.Debug("开始推送", zap.String("uid", toUser.UID), zap.String("deviceType", deviceToken.DeviceType), zap.String("deviceToken", deviceToken.DeviceToken))
+
+	pusher := w.pushMap[common.DeviceType(deviceToken.DeviceType)][deviceToken.BundleID]
+	if pusher == nil {
+		w.Warn("不支持的推送设备！", zap.String("deviceType", deviceToken.DeviceType), zap.String("uid", toUser.UID), zap.String("bundleID", deviceToken.BundleID))
+		return errors.New("不支持的推送设备！")
+	}
+	payload, err := pusher.GetPayload(msgResp, w.ctx, toUser)
 	if err != nil {
-		return pushResp{
-			deviceType:  deviceType,
-			deviceToken: deviceToken,
-		}, err
+		return err
 	}
-	return pushResp{
-		deviceType:  deviceType,
-		deviceToken: deviceToken,
-	}, nil
+	return pusher.Push(deviceToken.DeviceToken, payload)
 }
 
 func (w *Webhook) containSupportType(contentType common.ContentType) bool {
@@ -644,6 +775,8 @@ type msgOfflineNotify struct {
 }
 
 type pushResp struct {
+	deviceID    string
 	deviceToken string
 	deviceType  string
+	err         error
 }
@@ -0,0 +1,103 @@
+package webhook
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+)
+
+// Manager 推送管理
+type Manager struct {
+	ctx *config.Context
+	log.Log
+	pushLogDB *pushLogDB
+}
+
+// NewManager NewManager
+func NewManager(ctx *config.Context) *Manager {
+	return &Manager{
+		ctx:       ctx,
+		Log:       log.NewTLog("webhookManager"),
+		pushLogDB: newPushLogDB(ctx),
+	}
+}
+
+// Route 路由配置
+func (m *Manager) Route(r *wkhttp.WKHttp) {
+	auth := r.Group("/v1/manager", m.ctx.AuthMiddleware(r))
+	{
+		auth.GET("/push/logs", m.pushLogs) // 推送记录
+	}
+}
+
+// 推送记录（通过uid或消息ID查询）
+func (m *Manager) pushLogs(c *wkhttp.Context) {
+	err := c.CheckLoginRole()
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	uid := strings.TrimSpace(c.Query("uid"))
+	messageID := strings.TrimSpace(c.Query("message_id"))
+	if uid == "" && messageID == "" {
+		c.ResponseError(errors.New("uid和消息ID不能同时为空！"))
+		return
+	}
+	pageIndex, pageSize := c.GetPage()
+	models, err := m.pushLogDB.query(uid, messageID, uint64(pageSize), uint64(pageIndex))
+	if err != nil {
+		m.Error("查询推送记录失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询推送记录失败！"))
+		return
+	}
+	count, err := m.pushLogDB.queryCount(uid, messageID)
+	if err != nil {
+		m.Error("查询推送记录数量失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询推送记录数量失败！"))
+		return
+	}
+	list := make([]*managerPushLogResp, 0, len(models))
+	for _, model := range models {
+		list = append(list, &managerPushLogResp{
+			ID:          model.Id,
+			UID:         model.UID,
+			MessageID:   model.MessageID,
+			ChannelID:   model.ChannelID,
+			ChannelType: model.ChannelType,
+			DeviceID:    model.DeviceID,
+			Vendor:      model.Vendor,
+			TokenHash:   model.TokenHash,
+			Status:      model.Status,
+			Attempt:     model.Attempt,
+			ErrorCode:   model.ErrorCode,
+			ErrorMsg:    model.ErrorMsg,
+			Latency:     model.Latency,
+			CreatedAt:   model.CreatedAt.String(),
+		})
+	}
+	c.Response(map[string]interface{}{
+		"count": count,
+		"list":  list,
+	})
+}
+
+type managerPushLogResp struct {
+	ID          int64  `json:"id"`
+	UID         string `json:"uid"`
+	MessageID   string `json:"message_id"`
+	ChannelID   string `json:"channel_id"`
+	ChannelType uint8  `json:"channel_type"`
+	DeviceID    string `json:"device_id"`
+	Vendor      string `json:"vendor"`     // 推送厂商
+	TokenHash   string `json:"token_hash"` // 设备token的sha256
+	Status      int    `json:"status"`     // 推送状态 1.成功 2.失败 3.等待重试 4.token已失效
+	Attempt     int    `json:"attempt"`    // 第几次尝试
+	ErrorCode   string `json:"error_code"` // 厂商错误码
+	ErrorMsg    string `json:"error_msg"`  // 错误信息
+	Latency     int64  `json:"latency"`    // 推送耗时（毫秒）
+	CreatedAt   string `json:"created_at"`
+}
@@ -0,0 +1,297 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	common2 "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/common"
+	"github.com/gin-gonic/gin"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/log"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// IM回调签名的请求头
+// 签名内容：时间戳\n随机串\n请求方法\n请求路径(含query)\n请求体，签名算法：hex(hmac-sha256(密钥, 签名内容))
+const (
+	imCallbackHeaderTimestamp = "X-WK-Timestamp" // 时间戳（秒）
+	imCallbackHeaderNonce     = "X-WK-Nonce"     // 随机串（时间窗口内不能重复）
+	imCallbackHeaderSignature = "X-WK-Signature" // 签名
+)
+
+const (
+	imCallbackNonceCachePrefix = "imcallback:nonce:"
+	imCallbackDefaultMaxSkew   = 300              // 默认时间戳允许的误差（秒）
+	imCallbackNonceMaxLen      = 64               // 随机串最大长度
+	imCallbackConfigExpire     = time.Second * 30 // 配置缓存时间（回调很频繁，不每次查询数据库）
+	grpcTokenMetadataKey       = "token"          // grpc请求元数据中的令牌
+)
+
+// imCallbackConfig IM回调认证配置
+type imCallbackConfig struct {
+	Secret    string
+	AllowNets []*net.IPNet
+	MaxSkew   time.Duration
+}
+
+// callbackAuth IM回调（http和grpc）认证
+type callbackAuth struct {
+	log.Log
+	ctx           *config.Context
+	commonService common2.IService
+
+	cfgLock     sync.RWMutex
+	cfg         *imCallbackConfig
+	cfgLoadedAt time.Time
+}
+
+func newCallbackAuth(ctx *config.Context) *callbackAuth {
+	return &callbackAuth{
+		Log:           log.NewTLog("callbackAuth"),
+		ctx:           ctx,
+		commonService: common2.NewService(ctx),
+	}
+}
+
+func (a *callbackAuth) config() (*imCallbackConfig, error) {
+	a.cfgLock.RLock()
+	cfg := a.cfg
+	loadedAt := a.cfgLoadedAt
+	a.cfgLock.RUnlock()
+	if cfg != nil && time.Since(loadedAt) < imCallbackConfigExpire {
+		return cfg, nil
+	}
+	appConfig, err := a.commonService.GetAppConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg = &imCallbackConfig{
+		MaxSkew: time.Second * imCallbackDefaultMaxSkew,
+	}
+	if appConfig != nil {
+		cfg.Secret = appConfig.IMCallbackSecret
+		if appConfig.IMCallbackMaxSkew > 0 {
+			cfg.MaxSkew = time.Second * time.Duration(appConfig.IMCallbackMaxSkew)
+		}
+		cfg.AllowNets, err = common2.ParseAllowIPs(appConfig.IMCallbackAllowIPs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	a.cfgLock.Lock()
+	a.cfg = cfg
+	a.cfgLoadedAt = time.Now()
+	a.cfgLock.Unlock()
+	return cfg, nil
+}
+
+// httpMiddleware 校验IM回调的来源IP和签名
+func (a *callbackAuth) httpMiddleware(c *wkhttp.Context) {
+	cfg, err := a.config()
+	if err != nil {
+		a.Error("获取IM回调认证配置失败！", zap.Error(err))
+		abortCallback(c, http.StatusInternalServerError, "获取IM回调认证配置失败！")
+		return
+	}
+	remoteIP := requestRemoteIP(c.Request)
+	if !ipAllowed(cfg.AllowNets, remoteIP) {
+		a.Warn("IM回调来源IP不在白名单内", zap.String("ip", remoteIP), zap.String("path", c.Request.URL.Path))
+		abortCallback(c, http.StatusForbidden, "来源IP不允许访问")
+		return
+	}
+	if cfg.Secret == "" {
+		c.Next()
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		abortCallback(c, http.StatusBadRequest, "读取数据失败！")
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	timestamp := c.GetHeader(imCallbackHeaderTimestamp)
+	nonce := c.GetHeader(imCallbackHeaderNonce)
+	signature := c.GetHeader(imCallbackHeaderSignature)
+	err = verifyIMCallback(cfg, timestamp, nonce, signature, c.Request.Method, c.Request.URL.RequestURI(), body, time.Now())
+	if err != nil {
+		a.Warn("IM回调签名校验失败", zap.Error(err), zap.String("ip", remoteIP), zap.String("path", c.Request.URL.Path))
+		abortCallback(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	// 时间窗口内同一个随机串只能使用一次，防止重放
+	nonceKey := imCallbackNonceCachePrefix + nonce
+	count, err := a.ctx.GetRedisConn().Incr(nonceKey)
+	if err != nil {
+		a.Error("记录IM回调随机串失败！", zap.Error(err))
+		abortCallback(c, http.StatusInternalServerError, "记录IM回调随机串失败！")
+		return
+	}
+	if count == 1 {
+		err = a.ctx.GetRedisConn().Expire(nonceKey, cfg.MaxSkew*2)
+		if err != nil {
+			a.Warn("设置IM回调随机串过期时间失败", zap.Error(err))
+		}
+	} else {
+		a.Warn("IM回调请求重放", zap.String("nonce", nonce), zap.String("ip", remoteIP))
+		abortCallback(c, http.StatusUnauthorized, "请求已被处理过")
+		return
+	}
+	c.Next()
+}
+
+// grpcServerOptions grpc服务的TLS和令牌认证（配置修改后重启生效）
+func (a *callbackAuth) grpcServerOptions() ([]grpc.ServerOption, error) {
+	appConfig, err := a.commonService.GetAppConfig()
+	if err != nil {
+		return nil, err
+	}
+	opts := make([]grpc.ServerOption, 0, 2)
+	if appConfig == nil {
+		a.Warn("grpc webhook服务未配置TLS和令牌")
+		return opts, nil
+	}
+	certFile := strings.TrimSpace(appConfig.GRPCCertFile)
+	keyFile := strings.TrimSpace(appConfig.GRPCKeyFile)
+	if certFile != "" || keyFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载grpc TLS证书失败：%w", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	} else {
+		a.Warn("grpc webhook服务未配置TLS")
+	}
+	token := strings.TrimSpace(appConfig.GRPCToken)
+	if token == "" {
+		a.Warn("grpc webhook服务未配置访问令牌")
+	}
+	opts = append(opts, grpc.UnaryInterceptor(a.grpcUnaryInterceptor(token)))
+	return opts, nil
+}
+
+// grpcUnaryInterceptor 校验grpc请求的来源IP和令牌
+func (a *callbackAuth) grpcUnaryInterceptor(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		cfg, err := a.config()
+		if err != nil {
+			a.Error("获取IM回调认证配置失败！", zap.Error(err))
+			return nil, status.Error(codes.Internal, "获取IM回调认证配置失败！")
+		}
+		remoteIP := ""
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			remoteIP = addrIP(p.Addr.String())
+		}
+		if !ipAllowed(cfg.AllowNets, remoteIP) {
+			a.Warn("grpc请求来源IP不在白名单内", zap.String("ip", remoteIP), zap.String("method", info.FullMethod))
+			return nil, status.Error(codes.PermissionDenied, "来源IP不允许访问")
+		}
+		if token != "" {
+			md, _ := metadata.FromIncomingContext(ctx)
+			if !grpcTokenValid(md, token) {
+				a.Warn("grpc请求令牌无效", zap.String("ip", remoteIP), zap.String("method", info.FullMethod))
+				return nil, status.Error(codes.Unauthenticated, "令牌无效")
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+func grpcTokenValid(md metadata.MD, token string) bool {
+	values := md.Get(grpcTokenMetadataKey)
+	for _, auth := range md.Get("authorization") {
+		values = append(values, strings.TrimPrefix(auth, "Bearer "))
+	}
+	for _, value := range values {
+		if subtle.ConstantTimeCompare([]byte(value), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func signIMCallback(secret string, timestamp string, nonce string, method string, uri string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%s\n%s\n%s\n%s\n", timestamp, nonce, method, uri)))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func verifyIMCallback(cfg *imCallbackConfig, timestamp string, nonce string, signature string, method string, uri string, body []byte, now time.Time) error {
+	if timestamp == "" || nonce == "" || signature == "" {
+		return errors.New("缺少签名信息")
+	}
+	if len(nonce) > imCallbackNonceMaxLen {
+		return errors.New("随机串过长")
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("时间戳格式有误")
+	}
+	skew := now.Sub(time.Unix(ts, 0))
+	if skew > cfg.MaxSkew || skew < -cfg.MaxSkew {
+		return errors.New("时间戳已过期")
+	}
+	expected := signIMCallback(cfg.Secret, timestamp, nonce, method, uri, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return errors.New("签名不正确")
+	}
+	return nil
+}
+
+// ipAllowed 白名单为空表示不限制
+func ipAllowed(nets []*net.IPNet, ipStr string) bool {
+	if len(nets) == 0 {
+		return true
+	}
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestRemoteIP 直连的来源IP（不信任X-Forwarded-For，经过反向代理时白名单需要配置代理的IP）
+func requestRemoteIP(r *http.Request) string {
+	return addrIP(r.RemoteAddr)
+}
+
+func addrIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+func abortCallback(c *wkhttp.Context, httpStatus int, msg string) {
+	c.AbortWithStatusJSON(httpStatus, gin.H{
+		"msg":    msg,
+		"status": httpStatus,
+	})
+}
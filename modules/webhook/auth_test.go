@@ -0,0 +1,53 @@
+package webhook
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	common2 "github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/common"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestVerifyIMCallback(t *testing.T) {
+	cfg := &imCallbackConfig{Secret: "secret", MaxSkew: time.Minute * 5}
+	now := time.Now()
+	ts := strconv.FormatInt(now.Unix(), 10)
+	body := []byte(`{"cmd":"getSubscribers"}`)
+	sign := signIMCallback(cfg.Secret, ts, "n1", "POST", "/v1/datasource", body)
+
+	assert.NoError(t, verifyIMCallback(cfg, ts, "n1", sign, "POST", "/v1/datasource", body, now))
+	assert.Error(t, verifyIMCallback(cfg, ts, "n1", sign, "POST", "/v1/datasource", []byte(`{}`), now))
+	assert.Error(t, verifyIMCallback(cfg, ts, "n2", sign, "POST", "/v1/datasource", body, now))
+	assert.Error(t, verifyIMCallback(cfg, ts, "n1", sign, "POST", "/v1/webhook?event=msg.offline", body, now))
+	assert.Error(t, verifyIMCallback(cfg, ts, "n1", sign, "POST", "/v1/datasource", body, now.Add(time.Minute*6)))
+	assert.Error(t, verifyIMCallback(cfg, ts, "n1", sign, "POST", "/v1/datasource", body, now.Add(-time.Minute*6)))
+	assert.Error(t, verifyIMCallback(cfg, "", "n1", sign, "POST", "/v1/datasource", body, now))
+	assert.Error(t, verifyIMCallback(&imCallbackConfig{Secret: "other", MaxSkew: time.Minute}, ts, "n1", sign, "POST", "/v1/datasource", body, now))
+}
+
+func TestIPAllowed(t *testing.T) {
+	nets, err := common2.ParseAllowIPs("127.0.0.1, 10.0.0.0/8\n::1")
+	assert.NoError(t, err)
+	assert.Len(t, nets, 3)
+	assert.True(t, ipAllowed(nets, "127.0.0.1"))
+	assert.True(t, ipAllowed(nets, "10.2.3.4"))
+	assert.True(t, ipAllowed(nets, "::1"))
+	assert.False(t, ipAllowed(nets, "192.168.1.1"))
+	assert.False(t, ipAllowed(nets, ""))
+
+	assert.True(t, ipAllowed(nil, "192.168.1.1"))
+
+	_, err = common2.ParseAllowIPs("10.0.0.x")
+	assert.Error(t, err)
+	_, err = common2.ParseAllowIPs("10.0.0.0/33")
+	assert.Error(t, err)
+}
+
+func TestGRPCTokenValid(t *testing.T) {
+	assert.True(t, grpcTokenValid(metadata.Pairs("token", "abc"), "abc"))
+	assert.True(t, grpcTokenValid(metadata.Pairs("authorization", "Bearer abc"), "abc"))
+	assert.False(t, grpcTokenValid(metadata.Pairs("token", "abd"), "abc"))
+	assert.False(t, grpcTokenValid(nil, "abc"))
+}
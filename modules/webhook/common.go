@@ -97,6 +97,15 @@ func ParsePushInfo(msgResp msgOfflineNotify, ctx *config.Context, toUser *user.R
 	return payloadInfo, nil
 }
 
+func isMentioned(mentionUIDs []string, uid string) bool {
+	for _, mentionUID := range mentionUIDs {
+		if mentionUID == uid {
+			return true
+		}
+	}
+	return false
+}
+
 func getFromName(msgResp msgOfflineNotify, ctx *config.Context) (string, error) {
 	fromName, err := getAndCacheShowNameForFromUID(msgResp, ctx)
 	if err != nil {
@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/gocraft/dbr/v2"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/db"
+	"github.com/tangseng-vge/TangSengDaoDaoServerLib/pkg/util"
+)
+
+// PushStatus 推送状态
+type PushStatus int
+
+const (
+	// PushStatusSuccess 推送成功
+	PushStatusSuccess PushStatus = 1
+	// PushStatusFail 推送失败
+	PushStatusFail PushStatus = 2
+	// PushStatusRetrying 推送失败，等待重试
+	PushStatusRetrying PushStatus = 3
+	// PushStatusTokenInvalid 设备token已失效（已被清除）
+	PushStatusTokenInvalid PushStatus = 4
+)
+
+type pushLogDB struct {
+	session *dbr.Session
+	ctx     *config.Context
+}
+
+func newPushLogDB(ctx *config.Context) *pushLogDB {
+	return &pushLogDB{
+		session: ctx.DB(),
+		ctx:     ctx,
+	}
+}
+
+func (p *pushLogDB) insert(m *pushLogModel) error {
+	_, err := p.session.InsertInto("push_log").Columns(util.AttrToUnderscore(m)...).Record(m).Exec()
+	return err
+}
+
+// 查询推送记录（uid和messageID为空则不作为条件）
+func (p *pushLogDB) query(uid string, messageID string, pageSize, page uint64) ([]*pushLogModel, error) {
+	var models []*pushLogModel
+	builder := p.session.Select("*").From("push_log")
+	if uid != "" {
+		builder = builder.Where("uid=?", uid)
+	}
+	if messageID != "" {
+		builder = builder.Where("message_id=?", messageID)
+	}
+	_, err := builder.OrderDir("id", false).Offset((page - 1) * pageSize).Limit(pageSize).Load(&models)
+	return models, err
+}
+
+func (p *pushLogDB) queryCount(uid string, messageID string) (int64, error) {
+	var count int64
+	builder := p.session.Select("count(*)").From("push_log")
+	if uid != "" {
+		builder = builder.Where("uid=?", uid)
+	}
+	if messageID != "" {
+		builder = builder.Where("message_id=?", messageID)
+	}
+	_, err := builder.Load(&count)
+	return count, err
+}
+
+// 删除某个时间之前的推送记录
+func (p *pushLogDB) deleteBefore(t time.Time) error {
+	_, err := p.session.DeleteFrom("push_log").Where("created_at<?", t.Format("2006-01-02 15:04:05")).Exec()
+	return err
+}
+
+type pushLogModel struct {
+	UID         string
+	MessageID   string
+	ChannelID   string
+	ChannelType uint8
+	DeviceID    string
+	Vendor      string
+	TokenHash   string
+	Status      int
+	Attempt     int
+	ErrorCode   string
+	ErrorMsg    string
+	Latency     int64
+	db.BaseModel
+}
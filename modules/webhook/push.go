@@ -1,6 +1,12 @@
 package webhook
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/user"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/common"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
@@ -70,6 +76,62 @@ func (b *BaseRTCPayload) GetRTCPayload() RTCPayload {
 	return b
 }
 
+// ErrDeviceTokenInvalid 推送厂商返回设备token无效或已注销（此token需要被清除）
+var ErrDeviceTokenInvalid = errors.New("设备token已失效！")
+
+// ErrPushRetryable 推送厂商暂时不可用（5xx、超时、限流），稍后可重试
+var ErrPushRetryable = errors.New("推送厂商暂时不可用！")
+
+// VendorError 推送厂商返回的错误
+type VendorError struct {
+	Code string // 厂商返回的错误码
+	Msg  string // 厂商返回的错误信息
+	kind error  // 错误类别 ErrDeviceTokenInvalid 或 ErrPushRetryable，为nil表示不可重试的普通错误
+}
+
+func newVendorError(kind error, code string, msg string) error {
+	return &VendorError{
+		Code: code,
+		Msg:  msg,
+		kind: kind,
+	}
+}
+
+func (v *VendorError) Error() string {
+	if v.Code == "" {
+		return v.Msg
+	}
+	return fmt.Sprintf("%s（错误码：%s）", v.Msg, v.Code)
+}
+
+func (v *VendorError) Unwrap() error {
+	return v.kind
+}
+
+// isRetryablePushError 是否是可重试的推送错误
+func isRetryablePushError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrPushRetryable) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return false
+}
+
+// pushErrorCode 获取推送错误的厂商错误码
+func pushErrorCode(err error) string {
+	var vendorErr *VendorError
+	if errors.As(err, &vendorErr) {
+		return vendorErr.Code
+	}
+	return ""
+}
+
 // Push Push
 type Push interface {
 	GetPayload(msg msgOfflineNotify, ctx *config.Context, toUser *user.Resp) (Payload, error)
@@ -96,6 +96,12 @@ func (m *FIREBASEPush) Push(deviceToken string, payload Payload) error {
 	// Response is a message ID string.
 	m.Debug("Successfully sent firebase message:" + response)
 	if err != nil {
+		if messaging.IsRegistrationTokenNotRegistered(err) {
+			return newVendorError(ErrDeviceTokenInvalid, "UNREGISTERED", err.Error())
+		}
+		if messaging.IsUnavailable(err) || messaging.IsInternal(err) || messaging.IsQuotaExceeded(err) {
+			return newVendorError(ErrPushRetryable, "UNAVAILABLE", err.Error())
+		}
 		return err
 	}
 	return nil
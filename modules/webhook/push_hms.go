@@ -2,7 +2,6 @@ package webhook
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -119,6 +118,9 @@ func (h *HMSPush) Push(deviceToken string, payload Payload) error {
 		return err
 	}
 	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return newVendorError(ErrPushRetryable, fmt.Sprintf("%d", resp.StatusCode), fmt.Sprintf("华为推送返回错误！-> %s", resp.Body))
+		}
 		return fmt.Errorf("华为推送返回错误！-> %s", resp.Body)
 	}
 	h.Debug("返回", zap.String("body", resp.Body))
@@ -128,8 +130,12 @@ func (h *HMSPush) Push(deviceToken string, payload Payload) error {
 	}
 	if resultMap != nil && resultMap["code"] != nil {
 		code := resultMap["code"].(string)
+		msg, _ := resultMap["msg"].(string)
+		if code == "80300007" { // 所有token都无效
+			return newVendorError(ErrDeviceTokenInvalid, code, msg)
+		}
 		if code != "80000000" {
-			return errors.New(resultMap["msg"].(string))
+			return newVendorError(nil, code, msg)
 		}
 	}
 	return nil
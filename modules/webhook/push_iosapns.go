@@ -1,7 +1,6 @@
 package webhook
 
 import (
-	"errors"
 	"fmt"
 
 	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/user"
@@ -115,7 +114,14 @@ func (p *IOSPush) Push(deviceToken string, payload Payload) error {
 		return err
 	}
 	if res.StatusCode != 200 {
-		return errors.New(res.Reason)
+		code := fmt.Sprintf("%d", res.StatusCode)
+		if res.StatusCode == 410 || res.Reason == apns2.ReasonBadDeviceToken || res.Reason == apns2.ReasonUnregistered || res.Reason == apns2.ReasonDeviceTokenNotForTopic {
+			return newVendorError(ErrDeviceTokenInvalid, code, res.Reason)
+		}
+		if res.StatusCode == 429 || res.StatusCode >= 500 {
+			return newVendorError(ErrPushRetryable, code, res.Reason)
+		}
+		return newVendorError(nil, code, res.Reason)
 	}
 	return nil
 }
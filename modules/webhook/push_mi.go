@@ -1,7 +1,6 @@
 package webhook
 
 import (
-	"errors"
 	"fmt"
 	"net/url"
 
@@ -82,10 +81,11 @@ func (m *MIPush) Push(deviceToken string, payload Payload) error {
 	}
 	m.Debug("返回", zap.Any("data", result))
 	if result != nil && result["result"].(string) != "ok" {
+		code := fmt.Sprintf("%v", result["code"])
 		if result["reason"] != nil {
-			return errors.New(result["reason"].(string))
+			return newVendorError(nil, code, result["reason"].(string))
 		}
-		return errors.New(result["description"].(string))
+		return newVendorError(nil, code, result["description"].(string))
 	}
 	return nil
 }
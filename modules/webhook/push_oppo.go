@@ -4,7 +4,6 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"time"
 
@@ -89,7 +88,8 @@ func (o *OPPOPush) Push(deviceToken string, payload Payload) error {
 	if resp != nil && resp["code"] != nil {
 		code, _ := resp["code"].(json.Number).Int64()
 		if code != 0 {
-			return errors.New(resp["message"].(string))
+			message, _ := resp["message"].(string)
+			return newVendorError(nil, fmt.Sprintf("%d", code), message)
 		}
 	}
 	return nil
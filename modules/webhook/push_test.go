@@ -1,8 +1,13 @@
 package webhook
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"testing"
 
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/group"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServer/modules/user"
 	"github.com/stretchr/testify/assert"
 	"github.com/tangseng-vge/TangSengDaoDaoServerLib/config"
 )
@@ -68,3 +73,33 @@ func TestFirebasePush(t *testing.T) {
 	err := mi.Push("请前端开发给你提供这个值", NewFIREBASEPayload(payloadInfo, "11"))
 	assert.NoError(t, err)
 }
+
+func TestPushErrorClassify(t *testing.T) {
+	err := newVendorError(ErrDeviceTokenInvalid, "410", "Unregistered")
+	assert.True(t, errors.Is(err, ErrDeviceTokenInvalid))
+	assert.False(t, isRetryablePushError(err))
+	assert.Equal(t, "410", pushErrorCode(err))
+
+	err = newVendorError(ErrPushRetryable, "429", "TooManyRequests")
+	assert.True(t, isRetryablePushError(err))
+
+	err = newVendorError(nil, "400", "BadTopic")
+	assert.False(t, isRetryablePushError(err))
+	assert.Equal(t, "", pushErrorCode(errors.New("other")))
+	assert.True(t, isRetryablePushError(fmt.Errorf("wrap: %w", context.DeadlineExceeded)))
+}
+
+func TestAllowPushWithMention(t *testing.T) {
+	w := &Webhook{}
+	users := []*user.Resp{{UID: "u1", NewMsgNotice: 1}, {UID: "u2", NewMsgNotice: 1}}
+	groupSettings := []*group.SettingResp{{UID: "u1", Mute: 1}, {UID: "u2", MentionOnly: 1}}
+
+	assert.False(t, w.allowPush(users, nil, groupSettings, "u1", "", false))
+	assert.True(t, w.allowPush(users, nil, groupSettings, "u1", "", true))
+	assert.False(t, w.allowPush(users, nil, groupSettings, "u2", "", false))
+	assert.True(t, w.allowPush(users, nil, groupSettings, "u2", "", true))
+
+	uids := []string{"u1"}
+	assert.True(t, isMentioned(uids, "u1"))
+	assert.False(t, isMentioned(uids, "u2"))
+}
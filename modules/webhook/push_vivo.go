@@ -2,7 +2,6 @@ package webhook
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -85,6 +84,9 @@ func (v *VIVOPush) Push(deviceToken string, payload Payload) error {
 	}
 
 	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return newVendorError(ErrPushRetryable, fmt.Sprintf("%d", resp.StatusCode), fmt.Sprintf("vivo推送返回错误！-> %s", resp.Body))
+		}
 		return fmt.Errorf("vivo推送返回错误！-> %s", resp.Body)
 	}
 
@@ -96,7 +98,8 @@ func (v *VIVOPush) Push(deviceToken string, payload Payload) error {
 	if resultMap != nil && resultMap["result"] != nil {
 		code, _ := resultMap["result"].(json.Number).Int64()
 		if code != 0 {
-			return errors.New(resultMap["desc"].(string))
+			desc, _ := resultMap["desc"].(string)
+			return newVendorError(nil, fmt.Sprintf("%d", code), desc)
 		}
 	}
 	return nil
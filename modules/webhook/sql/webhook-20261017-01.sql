@@ -0,0 +1,24 @@
+-- +migrate Up
+
+-- 离线推送记录
+create table IF NOT EXISTS `push_log`
+(
+  id           bigint       not null primary key AUTO_INCREMENT,
+  uid          VARCHAR(40)  not null default '' comment '接收者uid',
+  message_id   VARCHAR(20)  not null default '' comment '消息ID',
+  channel_id   VARCHAR(100) not null default '' comment '频道ID',
+  channel_type smallint     not null default 0 comment '频道类型',
+  device_id    VARCHAR(100) not null default '' comment '设备ID',
+  vendor       VARCHAR(40)  not null default '' comment '推送厂商（设备类型 IOS，MI，HMS等）',
+  token_hash   VARCHAR(64)  not null default '' comment '设备token的sha256',
+  status       smallint     not null default 0 comment '推送状态 1.成功 2.失败 3.等待重试 4.token已失效',
+  attempt      integer      not null default 1 comment '第几次尝试',
+  error_code   VARCHAR(40)  not null default '' comment '厂商返回的错误码',
+  error_msg    VARCHAR(500) not null default '' comment '错误信息',
+  latency      integer      not null default 0 comment '推送耗时（毫秒）',
+  created_at   timeStamp    not null DEFAULT CURRENT_TIMESTAMP,
+  updated_at   timeStamp    not null DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX push_log_uid_idx on `push_log` (uid);
+CREATE INDEX push_log_message_id_idx on `push_log` (message_id);
+CREATE INDEX push_log_created_at_idx on `push_log` (created_at);
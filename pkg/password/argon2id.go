@@ -0,0 +1,84 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2idID argon2id算法标识
+const Argon2idID = "argon2id"
+
+var errInvalidArgon2idHash = errors.New("argon2id哈希格式有误")
+
+// Argon2idHasher argon2id哈希 格式为 $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+type Argon2idHasher struct {
+	Memory  uint32 // 内存 单位KiB
+	Time    uint32 // 迭代次数
+	Threads uint8  // 并行度
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// NewArgon2idHasher 默认参数参考OWASP推荐值（m=19MiB,t=2,p=1）
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{
+		Memory:  19 * 1024,
+		Time:    2,
+		Threads: 1,
+		SaltLen: 16,
+		KeyLen:  32,
+	}
+}
+
+// ID ID
+func (a *Argon2idHasher) ID() string {
+	return Argon2idID
+}
+
+// Hash Hash
+func (a *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, a.KeyLen)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", Argon2idID, argon2.Version, a.Memory, a.Time, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify Verify
+func (a *Argon2idHasher) Verify(password string, hash string) (bool, bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != Argon2idID {
+		return false, false, errInvalidArgon2idHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, errInvalidArgon2idHash
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, false, errInvalidArgon2idHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, errInvalidArgon2idHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false, false, errInvalidArgon2idHash
+	}
+	otherKey := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return false, false, nil
+	}
+	needRehash := memory != a.Memory || time != a.Time || threads != a.Threads || uint32(len(key)) != a.KeyLen
+	return true, needRehash, nil
+}
@@ -0,0 +1,52 @@
+package password
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BcryptID bcrypt算法标识
+const BcryptID = "2a"
+
+// BcryptHasher bcrypt哈希 格式为 $2a$<cost>$<salt+key>
+type BcryptHasher struct {
+	Cost int
+}
+
+// NewBcryptHasher NewBcryptHasher
+func NewBcryptHasher() *BcryptHasher {
+	return &BcryptHasher{
+		Cost: bcrypt.DefaultCost,
+	}
+}
+
+// ID ID
+func (b *BcryptHasher) ID() string {
+	return BcryptID
+}
+
+// Hash Hash
+func (b *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify Verify
+func (b *BcryptHasher) Verify(password string, hash string) (bool, bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false, false, err
+	}
+	return true, cost != b.Cost, nil
+}
@@ -0,0 +1,116 @@
+package password
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// Hasher 密码哈希算法
+// 生成的哈希必须以 $<id>$ 开头，用于校验时识别算法
+type Hasher interface {
+	// ID 算法标识 例如 argon2id
+	ID() string
+	// Hash 计算密码哈希
+	Hash(password string) (string, error)
+	// Verify 校验密码，needRehash表示哈希参数已过时需要重新计算
+	Verify(password string, hash string) (ok bool, needRehash bool, err error)
+}
+
+var (
+	hashers       = map[string]Hasher{}
+	defaultHasher Hasher
+	lock          sync.RWMutex
+)
+
+func init() {
+	Register(NewArgon2idHasher())
+	Register(NewBcryptHasher())
+	_ = SetDefault(Argon2idID)
+}
+
+// Register 注册哈希算法
+func Register(hasher Hasher) {
+	lock.Lock()
+	defer lock.Unlock()
+	hashers[hasher.ID()] = hasher
+}
+
+// SetDefault 设置生成新哈希时使用的算法（其他算法的哈希在校验通过后会被重新计算）
+func SetDefault(id string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	hasher := hashers[id]
+	if hasher == nil {
+		return errors.New("不支持的密码哈希算法: " + id)
+	}
+	defaultHasher = hasher
+	return nil
+}
+
+// Hash 使用默认算法计算密码哈希
+func Hash(password string) (string, error) {
+	lock.RLock()
+	hasher := defaultHasher
+	lock.RUnlock()
+	return hasher.Hash(password)
+}
+
+// Verify 校验密码
+// 支持所有已注册算法的哈希以及旧版的md5(md5(password))，
+// 校验通过但不是默认算法（或参数已过时）时needRehash为true，调用方应使用Hash重新计算并保存
+func Verify(password string, hash string) (ok bool, needRehash bool) {
+	if hash == "" {
+		return false, false
+	}
+	if isLegacyMD5(hash) {
+		return verifyLegacyMD5(password, hash), true
+	}
+	id := hashID(hash)
+	lock.RLock()
+	hasher := hashers[id]
+	isDefault := hasher != nil && hasher == defaultHasher
+	lock.RUnlock()
+	if hasher == nil {
+		return false, false
+	}
+	ok, needRehash, err := hasher.Verify(password, hash)
+	if err != nil || !ok {
+		return false, false
+	}
+	return true, needRehash || !isDefault
+}
+
+// 取出哈希中的算法标识 $<id>$...
+func hashID(hash string) string {
+	if !strings.HasPrefix(hash, "$") {
+		return ""
+	}
+	parts := strings.SplitN(hash[1:], "$", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	switch parts[0] {
+	case "2b", "2y": // bcrypt的其他版本标识
+		return BcryptID
+	}
+	return parts[0]
+}
+
+// 旧版哈希为32位小写十六进制
+func isLegacyMD5(hash string) bool {
+	if len(hash) != md5.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+func verifyLegacyMD5(password string, hash string) bool {
+	first := md5.Sum([]byte(password))
+	second := md5.Sum([]byte(hex.EncodeToString(first[:])))
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(second[:])), []byte(strings.ToLower(hash))) == 1
+}
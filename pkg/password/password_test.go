@@ -0,0 +1,70 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashAndVerify(t *testing.T) {
+	hash, err := Hash("123456")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$"))
+	assert.LessOrEqual(t, len(hash), 255)
+
+	ok, needRehash := Verify("123456", hash)
+	assert.True(t, ok)
+	assert.False(t, needRehash)
+
+	ok, _ = Verify("1234567", hash)
+	assert.False(t, ok)
+
+	hash2, err := Hash("123456")
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, hash2)
+}
+
+func TestVerifyLegacyMD5(t *testing.T) {
+	// md5(md5("admiN123456")) 与初始化脚本中超级管理员的密码一致
+	ok, needRehash := Verify("admiN123456", "14c3a0db22308e34ca7dacb1806c0bdf")
+	assert.True(t, ok)
+	assert.True(t, needRehash)
+
+	ok, _ = Verify("admin123456", "14c3a0db22308e34ca7dacb1806c0bdf")
+	assert.False(t, ok)
+
+	ok, _ = Verify("", "")
+	assert.False(t, ok)
+}
+
+func TestVerifyBcrypt(t *testing.T) {
+	hasher := NewBcryptHasher()
+	hasher.Cost = 4
+	hash, err := hasher.Hash("123456")
+	assert.NoError(t, err)
+
+	ok, needRehash := Verify("123456", hash)
+	assert.True(t, ok)
+	assert.True(t, needRehash) // 默认算法为argon2id
+
+	ok, _ = Verify("123456", strings.Replace(hash, "$2a$", "$2b$", 1))
+	assert.True(t, ok)
+
+	ok, _ = Verify("654321", hash)
+	assert.False(t, ok)
+}
+
+func TestVerifyArgon2idParams(t *testing.T) {
+	hasher := NewArgon2idHasher()
+	hasher.Time = 1
+	hash, err := hasher.Hash("123456")
+	assert.NoError(t, err)
+
+	ok, needRehash := Verify("123456", hash)
+	assert.True(t, ok)
+	assert.True(t, needRehash)
+
+	ok, _ = Verify("123456", "$argon2id$v=19$m=x$bad$bad")
+	assert.False(t, ok)
+}
@@ -0,0 +1,109 @@
+// Package totp 基于时间的一次性密码（RFC 6238，HMAC-SHA1，兼容Google Authenticator等验证器app）
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits 验证码位数
+	Digits = 6
+	// Period 时间步长（秒）
+	Period = 30
+	// Skew 允许前后偏差的时间步数（兼容客户端时钟误差）
+	Skew = 1
+
+	secretSize = 20
+)
+
+var b32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret 生成base32编码（无填充）的随机密钥
+func GenerateSecret() (string, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return b32NoPadding.EncodeToString(secret), nil
+}
+
+// Counter 时间对应的时间步
+func Counter(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+// CodeWithCounter 计算指定时间步的验证码
+func CodeWithCounter(secret string, counter int64) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, counter, Digits), nil
+}
+
+// Validate 校验验证码，成功返回匹配的时间步（调用方应拒绝不大于上次使用的时间步，防止重放）
+func Validate(secret string, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+	current := Counter(t)
+	for i := -Skew; i <= Skew; i++ {
+		counter := current + int64(i)
+		if subtle.ConstantTimeCompare([]byte(hotp(key, counter, Digits)), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// KeyURI 验证器app扫码使用的otpauth地址
+func KeyURI(issuer string, account string, secret string) string {
+	label := url.PathEscape(account)
+	if issuer != "" {
+		label = url.PathEscape(issuer) + ":" + label
+	}
+	params := url.Values{}
+	params.Set("secret", secret)
+	if issuer != "" {
+		params.Set("issuer", issuer)
+	}
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", Digits))
+	params.Set("period", fmt.Sprintf("%d", Period))
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, params.Encode())
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(secret), " ", ""))
+	return b32NoPadding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+// hotp RFC 4226
+func hotp(key []byte, counter int64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
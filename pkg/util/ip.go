@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"net"
 	"net/http"
 	"strconv"
@@ -260,6 +261,76 @@ func (p *IpSearch) GetArea(ip string) string {
 	return area
 }
 
+// IPLocation IP所在地
+type IPLocation struct {
+	Country     string  // 国家
+	Region      string  // 省份/地区
+	City        string  // 城市
+	CountryCode string  // 国家代码
+	Longitude   float64 // 经度（未知为0）
+	Latitude    float64 // 纬度（未知为0）
+}
+
+// GetLocation 查询IP所在地，非公网IPv4返回nil
+func (p *IpSearch) GetLocation(ip string) *IPLocation {
+	if p == nil {
+		return nil
+	}
+	parsedIP := net.ParseIP(strings.TrimSpace(ip))
+	if parsedIP == nil || parsedIP.To4() == nil || parsedIP.IsLoopback() || parsedIP.IsPrivate() || parsedIP.IsUnspecified() {
+		return nil
+	}
+	return parseIPLocation(p.Get(parsedIP.To4().String()))
+}
+
+// parseIPLocation 解析ip库记录 格式：洲|国家|省份|城市|区县|运营商|行政代码|英文名|国家代码|经度|纬度
+func parseIPLocation(record string) *IPLocation {
+	fields := strings.Split(record, "|")
+	if len(fields) < 9 || fields[1] == "" {
+		return nil
+	}
+	location := &IPLocation{
+		Country:     fields[1],
+		Region:      fields[2],
+		City:        fields[3],
+		CountryCode: fields[8],
+	}
+	if len(fields) > 10 {
+		location.Longitude, _ = strconv.ParseFloat(fields[9], 64)
+		location.Latitude, _ = strconv.ParseFloat(fields[10], 64)
+	}
+	return location
+}
+
+// HasCoordinate 是否有经纬度
+func (l *IPLocation) HasCoordinate() bool {
+	return l != nil && (l.Longitude != 0 || l.Latitude != 0)
+}
+
+// String 国家 省份 城市
+func (l *IPLocation) String() string {
+	if l == nil {
+		return "未知"
+	}
+	parts := make([]string, 0, 3)
+	for _, part := range []string{l.Country, l.Region, l.City} {
+		if part != "" && (len(parts) == 0 || parts[len(parts)-1] != part) {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// GeoDistance 两个经纬度之间的球面距离（公里）
+func GeoDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371.0
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
 func (p *IpSearch) binarySearch(low uint32, high uint32, k uint32) uint32 {
 	var M uint32 = 0
 	for low <= high {
@@ -0,0 +1,32 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIPLocation(t *testing.T) {
+	location := parseIPLocation("亚洲|中国|广东|深圳|南山|电信|440305|China|CN|113.93029|22.53291")
+	assert.NotNil(t, location)
+	assert.Equal(t, "中国", location.Country)
+	assert.Equal(t, "广东", location.Region)
+	assert.Equal(t, "深圳", location.City)
+	assert.Equal(t, "CN", location.CountryCode)
+	assert.True(t, location.HasCoordinate())
+	assert.Equal(t, "中国 广东 深圳", location.String())
+
+	location = parseIPLocation("亚洲|新加坡|新加坡|||||Singapore|SG")
+	assert.NotNil(t, location)
+	assert.False(t, location.HasCoordinate())
+	assert.Equal(t, "新加坡", location.String())
+
+	assert.Nil(t, parseIPLocation("保留地址"))
+}
+
+func TestGeoDistance(t *testing.T) {
+	// 北京到上海约1067公里
+	distance := GeoDistance(39.9042, 116.4074, 31.2304, 121.4737)
+	assert.InDelta(t, 1067, distance, 20)
+	assert.Equal(t, 0.0, GeoDistance(22.5, 113.9, 22.5, 113.9))
+}
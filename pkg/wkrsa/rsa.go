@@ -5,6 +5,7 @@ import (
 	"crypto/md5"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/pem"
@@ -29,3 +30,30 @@ func SignWithMD5(data []byte, pemPrivKey []byte) (string, error) {
 	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.MD5, hashed)
 	return base64.StdEncoding.EncodeToString(signature), err
 }
+
+// GeneratePrivateKey 生成rsa私钥 返回PKCS1格式的pem
+func GeneratePrivateKey(bits int) ([]byte, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	}), nil
+}
+
+// ParsePrivateKey 解析PKCS1格式的pem私钥
+func ParsePrivateKey(pemPrivKey []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemPrivKey)
+	if block == nil {
+		return nil, errors.New("private key error")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// SignWithSHA256 rsa签名（RS256）返回原始签名
+func SignWithSHA256(data []byte, privateKey *rsa.PrivateKey) ([]byte, error) {
+	hashed := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hashed[:])
+}
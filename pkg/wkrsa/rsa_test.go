@@ -1,6 +1,9 @@
 package wkrsa
 
 import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
 	"fmt"
 	"testing"
 )
@@ -41,3 +44,23 @@ R0a+FMM2fsqqRjYN4Zf84pJvWnIy7dG/pXKq8AAWkV7iJNVpshGb
 		panic(err)
 	}
 }
+
+func TestSignWithSHA256(t *testing.T) {
+	pemPrivKey, err := GeneratePrivateKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := ParsePrivateKey(pemPrivKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := SignWithSHA256([]byte("test"), privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashed := sha256.Sum256([]byte("test"))
+	err = rsa.VerifyPKCS1v15(&privateKey.PublicKey, crypto.SHA256, hashed[:], signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+}